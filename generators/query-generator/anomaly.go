@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// AnomalyConfig configures EWMA-based result-count anomaly detection
+type AnomalyConfig struct {
+	Enabled bool    `yaml:"enabled"`
+	Alpha   float64 `yaml:"alpha"`  // EWMA smoothing factor (default: 0.1)
+	Factor  float64 `yaml:"factor"` // Deviation factor from the EWMA that counts as an anomaly (default: 3)
+	Warmup  int     `yaml:"warmup"` // Observations per series before anomalies are reported (default: 20)
+}
+
+// ewmaSeries is the moving average state of a single series
+type ewmaSeries struct {
+	value float64
+	count int
+}
+
+// ewmaDetector flags observations that deviate from a series' exponentially weighted moving average
+type ewmaDetector struct {
+	alpha  float64
+	factor float64
+	warmup int
+
+	mu     sync.Mutex
+	series map[string]*ewmaSeries
+}
+
+// newEWMADetector creates a detector, applying defaults for unset settings
+func newEWMADetector(cfg AnomalyConfig) *ewmaDetector {
+	d := &ewmaDetector{
+		alpha:  cfg.Alpha,
+		factor: cfg.Factor,
+		warmup: cfg.Warmup,
+		series: make(map[string]*ewmaSeries),
+	}
+	if d.alpha <= 0 || d.alpha > 1 {
+		d.alpha = 0.1
+	}
+	if d.factor <= 1 {
+		d.factor = 3
+	}
+	if d.warmup <= 0 {
+		d.warmup = 20
+	}
+	return d
+}
+
+// observe adds a value to the series and returns the anomaly direction ("spike" or "drop",
+// empty when normal) along with the moving average before this observation
+func (d *ewmaDetector) observe(key string, value float64) (string, float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.series[key]
+	if !ok {
+		s = &ewmaSeries{value: value}
+		d.series[key] = s
+	}
+	baseline := s.value
+
+	direction := ""
+	if s.count >= d.warmup {
+		switch {
+		case baseline > 0 && value > baseline*d.factor:
+			direction = "spike"
+		case baseline >= 1 && value < baseline/d.factor:
+			direction = "drop"
+		}
+	}
+
+	s.value = d.alpha*value + (1-d.alpha)*s.value
+	s.count++
+	return direction, baseline
+}
+
+// seed sets the baseline of a series, skipping its warmup
+func (d *ewmaDetector) seed(key string, value float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.series[key] = &ewmaSeries{value: value, count: d.warmup}
+}
+
+// resultAnomalies detects result-count anomalies per query and bucket (nil when disabled)
+var resultAnomalies *resultAnomalyDetector
+
+// resultAnomalyDetector tracks spans and traces returned per query and bucket
+type resultAnomalyDetector struct {
+	detector  *ewmaDetector
+	anomalies *prometheus.CounterVec
+	ewma      *prometheus.GaugeVec
+}
+
+// newResultAnomalyDetector creates the detector and its metrics
+func newResultAnomalyDetector(cfg AnomalyConfig) *resultAnomalyDetector {
+	return &resultAnomalyDetector{
+		detector: newEWMADetector(cfg),
+		anomalies: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "result_count",
+			Name:      "anomalies_total",
+			Help:      "Responses whose result count deviated from the moving average beyond the configured factor",
+		}, []string{"name", "bucket", "signal", "direction"}),
+		ewma: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Subsystem: "result_count",
+			Name:      "ewma",
+			Help:      "Exponentially weighted moving average of results returned",
+		}, []string{"name", "bucket", "signal"}),
+	}
+}
+
+// observe checks the spans and traces returned by a response
+func (r *resultAnomalyDetector) observe(queryName, bucketName string, spans, traces int) {
+	for _, sig := range []struct {
+		name  string
+		value int
+	}{{"spans", spans}, {"traces", traces}} {
+		key := queryName + "|" + bucketName + "|" + sig.name
+		direction, baseline := r.detector.observe(key, float64(sig.value))
+		r.ewma.WithLabelValues(queryName, bucketName, sig.name).Set(baseline)
+		if direction != "" {
+			r.anomalies.WithLabelValues(queryName, bucketName, sig.name, direction).Inc()
+			log.Printf("Result-count anomaly [%s] %s: %s %s to %d (moving average %.1f)",
+				bucketName, queryName, sig.name, direction, sig.value, baseline)
+		}
+	}
+}
+
+// latencyAnomalies detects latency anomalies per query and bucket (nil when disabled)
+var latencyAnomalies *latencyAnomalyDetector
+
+// latencyAnomalyDetector tracks successful request latency per query and bucket
+type latencyAnomalyDetector struct {
+	detector  *ewmaDetector
+	anomalies *prometheus.CounterVec
+}
+
+// newLatencyAnomalyDetector creates the detector and its metrics
+func newLatencyAnomalyDetector(cfg AnomalyConfig) *latencyAnomalyDetector {
+	return &latencyAnomalyDetector{
+		detector: newEWMADetector(cfg),
+		anomalies: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "latency",
+			Name:      "anomalies_total",
+			Help:      "Requests whose latency deviated from the moving average beyond the configured factor",
+		}, []string{"name", "bucket", "direction"}),
+	}
+}
+
+// observe checks the latency of a successful request
+func (l *latencyAnomalyDetector) observe(queryName, bucketName string, seconds float64) {
+	direction, baseline := l.detector.observe(queryName+"|"+bucketName, seconds)
+	if direction != "" {
+		l.anomalies.WithLabelValues(queryName, bucketName, direction).Inc()
+		log.Printf("Latency anomaly [%s] %s: %s to %.3fs (moving average %.3fs)", bucketName, queryName, direction, seconds, baseline)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default satisfied thresholds per query class; requests up to 4x the threshold are tolerating
+const (
+	defaultApdexThreshold          = time.Second
+	defaultExpensiveApdexThreshold = 30 * time.Second
+	apdexFrustratedFactor          = 4
+)
+
+// ApdexConfig configures the Apdex score computed per query
+type ApdexConfig struct {
+	Enabled bool                            `yaml:"enabled"`
+	Classes map[string]ApdexThresholdConfig `yaml:"classes"` // Thresholds per query class (default: standard 1s, expensive 30s)
+	Windows []string                        `yaml:"windows"` // Rolling windows (default: ["5m", "1h"])
+}
+
+// ApdexThresholdConfig splits the requests of a query class into satisfied, tolerating and
+// frustrated ones; failed requests are always frustrated
+type ApdexThresholdConfig struct {
+	Satisfied  string `yaml:"satisfied"`  // Latency up to which a request is satisfied (T)
+	Frustrated string `yaml:"frustrated"` // Latency above which a request is frustrated (default: 4T)
+}
+
+// apdexThresholds are the parsed thresholds of a query class
+type apdexThresholds struct {
+	satisfied, frustrated time.Duration
+}
+
+// apdex scores queries (nil when disabled)
+var apdex *apdexTracker
+
+// apdexTracker computes Apdex scores per query over rolling windows and the whole run. Window
+// slots count frustrated requests as errors and tolerating requests as slow.
+type apdexTracker struct {
+	classes     map[string]apdexThresholds
+	windows     []time.Duration
+	windowNames []string
+
+	mu      sync.Mutex
+	queries map[string]*apdexQuery
+	score   *prometheus.GaugeVec
+}
+
+// apdexQuery holds the request outcomes of one query
+type apdexQuery struct {
+	windows []*rollingWindow
+	run     sloSlot
+}
+
+// newApdexTracker validates the Apdex config and applies the defaults
+func newApdexTracker(cfg ApdexConfig) (*apdexTracker, error) {
+	t := &apdexTracker{
+		classes: map[string]apdexThresholds{
+			queryClassStandard:  {defaultApdexThreshold, apdexFrustratedFactor * defaultApdexThreshold},
+			queryClassExpensive: {defaultExpensiveApdexThreshold, apdexFrustratedFactor * defaultExpensiveApdexThreshold},
+		},
+		queries: make(map[string]*apdexQuery),
+	}
+	for class, c := range cfg.Classes {
+		if err := validateQueryClass(class); err != nil || class == "" {
+			return nil, fmt.Errorf("classes: unknown class %q", class)
+		}
+		satisfied, err := time.ParseDuration(c.Satisfied)
+		if err != nil || satisfied <= 0 {
+			return nil, fmt.Errorf("class %s: invalid satisfied threshold %q", class, c.Satisfied)
+		}
+		frustrated := apdexFrustratedFactor * satisfied
+		if c.Frustrated != "" {
+			frustrated, err = time.ParseDuration(c.Frustrated)
+			if err != nil || frustrated < satisfied {
+				return nil, fmt.Errorf("class %s: frustrated threshold %q must be a duration >= satisfied", class, c.Frustrated)
+			}
+		}
+		t.classes[class] = apdexThresholds{satisfied, frustrated}
+	}
+
+	windows := cfg.Windows
+	if len(windows) == 0 {
+		windows = []string{"5m", "1h"}
+	}
+	for _, w := range windows {
+		d, err := time.ParseDuration(w)
+		if err != nil || d < rollingSlots*time.Millisecond {
+			return nil, fmt.Errorf("invalid apdex window %q", w)
+		}
+		t.windows = append(t.windows, d)
+		t.windowNames = append(t.windowNames, w)
+	}
+
+	t.score = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Name:      "apdex_score",
+		Help:      "Apdex score of a query over the window (run: since the start): (satisfied + tolerating/2) / requests",
+	}, []string{"name", "window"})
+	return t, nil
+}
+
+// record adds the outcome of a request of a query of the given class
+func (t *apdexTracker) record(queryName, class string, latency time.Duration, failed bool) {
+	if t == nil {
+		return
+	}
+	if class == "" {
+		class = queryClassStandard
+	}
+	thresholds := t.classes[class]
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q, ok := t.queries[queryName]
+	if !ok {
+		q = &apdexQuery{}
+		for i, d := range t.windows {
+			q.windows = append(q.windows, &rollingWindow{name: t.windowNames[i], width: d / rollingSlots})
+		}
+		t.queries[queryName] = q
+	}
+	slots := []*sloSlot{&q.run}
+	for _, w := range q.windows {
+		slots = append(slots, w.slot(now))
+	}
+	for _, s := range slots {
+		s.total++
+		switch {
+		case failed || latency > thresholds.frustrated:
+			s.errors++
+		case latency > thresholds.satisfied:
+			s.slow++
+		}
+	}
+}
+
+// apdexScore returns the Apdex score of the outcomes of a slot
+func apdexScore(s sloSlot) float64 {
+	return (s.total - s.errors - s.slow/2) / s.total
+}
+
+// update recomputes the score gauges
+func (t *apdexTracker) update() {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for queryName, q := range t.queries {
+		t.score.WithLabelValues(queryName, "run").Set(apdexScore(q.run))
+		for _, w := range q.windows {
+			if sum := w.sum(now); sum.total > 0 {
+				t.score.WithLabelValues(queryName, w.name).Set(apdexScore(sum))
+			}
+		}
+	}
+}
+
+// runScore returns the Apdex score of a query over the whole run; false when it has no requests
+func (t *apdexTracker) runScore(queryName string) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q, ok := t.queries[queryName]
+	if !ok || q.run.total == 0 {
+		return 0, false
+	}
+	return apdexScore(q.run), true
+}
+
+// run periodically updates the score gauges
+func (t *apdexTracker) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.update()
+	}
+}
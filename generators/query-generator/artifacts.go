@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// artifactsMarker marks the run directories the generator created, so retention never
+	// removes other directories sharing the base directory
+	artifactsMarker = ".query-load-run"
+	// artifactsLatest is the symlink to the newest run directory
+	artifactsLatest = "latest"
+)
+
+// ArtifactsConfig writes the files of each run under a directory of its own, so repeated job
+// runs on a persistent volume do not overwrite each other's reports and samples
+type ArtifactsConfig struct {
+	// Base directory; relative report, sample and slow-log paths are written under <dir>/<run ID>
+	// (empty = paths are used as configured)
+	Dir   string `yaml:"dir"`
+	RunID string `yaml:"runID"` // Run directory name (default: start time and pod name, e.g. 20251127T101500Z-generator-0)
+	Keep  int    `yaml:"keep"`  // Run directories kept, the oldest are removed at startup (default: 0 = all)
+}
+
+// prepareArtifacts creates the run directory, moves the relative output paths of the config
+// into it, snapshots the config file and query catalog, and applies retention. It returns the
+// run directory.
+func prepareArtifacts(config *Config, configPath string, now time.Time) (string, error) {
+	cfg := config.Artifacts
+	if cfg.Keep < 0 {
+		return "", fmt.Errorf("keep must be >= 0, got %d", cfg.Keep)
+	}
+	runID := cfg.RunID
+	if runID == "" {
+		runID = now.UTC().Format("20060102T150405Z")
+		if identity.Pod != "" {
+			runID += "-" + identity.Pod
+		}
+	}
+	if runID == artifactsLatest || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return "", fmt.Errorf("invalid runID %q", runID)
+	}
+
+	dir := filepath.Join(cfg.Dir, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, artifactsMarker), []byte(now.UTC().Format(time.RFC3339)+"\n"), 0o644); err != nil {
+		return "", err
+	}
+
+	inRun := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	inRun(&config.Report.HTML)
+	inRun(&config.Report.Markdown)
+	inRun(&config.Report.JSON)
+	inRun(&config.SlowLog.Path)
+	for i := range config.Samples {
+		inRun(&config.Samples[i].Path)
+	}
+
+	// Snapshots of what the run was configured with
+	if data, err := os.ReadFile(configPath); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, "config.yaml"), data, 0o644); err != nil {
+			return "", err
+		}
+	}
+	if loadedCatalog != nil {
+		data, err := yaml.Marshal(loadedCatalog)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "catalog.yaml"), data, 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	latest := filepath.Join(cfg.Dir, artifactsLatest)
+	os.Remove(latest)
+	if err := os.Symlink(runID, latest); err != nil {
+		log.Printf("Warning: Could not link %s to the run directory: %v", latest, err)
+	}
+
+	if cfg.Keep > 0 {
+		if err := pruneArtifacts(cfg.Dir, runID, cfg.Keep); err != nil {
+			log.Printf("Warning: Could not apply artifacts retention: %v", err)
+		}
+	}
+	return dir, nil
+}
+
+// pruneArtifacts removes the oldest run directories of base so that keep remain, the current
+// run included
+func pruneArtifacts(base, current string, keep int) error {
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return err
+	}
+	type run struct {
+		name    string
+		started time.Time
+	}
+	var runs []run
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == current {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(base, e.Name(), artifactsMarker))
+		if err != nil {
+			continue // not a run directory
+		}
+		runs = append(runs, run{name: e.Name(), started: info.ModTime()})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].started.Before(runs[j].started) })
+	for len(runs) > keep-1 {
+		if err := os.RemoveAll(filepath.Join(base, runs[0].name)); err != nil {
+			return err
+		}
+		log.Printf("Artifacts retention: removed run %s", runs[0].name)
+		runs = runs[1:]
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// attributeScopes are the TraceQL scopes an attribute name can start with
+var attributeScopes = []string{"span", "resource", "event", "link", "instrumentation"}
+
+// attributeRef is an attribute name with its scope ("" for unscoped attributes)
+type attributeRef struct {
+	scope, name string
+}
+
+// parseAttributeRef splits "span.http.status_code", ".http.status_code" or "http.status_code"
+// into scope and name
+func parseAttributeRef(s string) attributeRef {
+	for _, scope := range attributeScopes {
+		if strings.HasPrefix(s, scope+".") {
+			return attributeRef{scope: scope, name: s[len(scope)+1:]}
+		}
+	}
+	return attributeRef{name: strings.TrimPrefix(s, ".")}
+}
+
+// matches reports whether a referenced attribute is the known attribute a; unscoped names match
+// any scope
+func (r attributeRef) matches(a attributeRef) bool {
+	return r.name == a.name && (r.scope == "" || a.scope == "" || r.scope == a.scope)
+}
+
+// queryAttributes returns the attributes a query filters on: the attributes of its TraceQL
+// (intrinsics such as status or span:name are not attributes) or the keys of its tags
+func queryAttributes(q QueryConfig) []string {
+	seen := make(map[string]bool)
+	var attributes []string
+	add := func(a string) {
+		if a != "" && !seen[a] {
+			seen[a] = true
+			attributes = append(attributes, a)
+		}
+	}
+	if q.TraceQL != "" {
+		tokens, _ := lexTraceQL(q.TraceQL)
+		for _, tok := range tokens {
+			if tok.kind == "ident" && strings.Contains(tok.text, ".") && !strings.Contains(tok.text, ":") {
+				add(tok.text)
+			}
+		}
+	}
+	for k := range q.Tags {
+		add(k)
+	}
+	sort.Strings(attributes)
+	return attributes
+}
+
+// checkAttributes returns an error for every query attribute missing from the attributes the
+// write side is known to emit, so long runs do not query attributes nothing ever wrote; without
+// known attributes nothing is checked
+func checkAttributes(queries []QueryConfig, known []string) []error {
+	if len(known) == 0 {
+		return nil
+	}
+	refs := make([]attributeRef, 0, len(known))
+	for _, a := range known {
+		refs = append(refs, parseAttributeRef(a))
+	}
+	var problems []error
+	seen := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		if seen[q.Name] {
+			continue // duration sweep variants share their query's filter
+		}
+		seen[q.Name] = true
+		for _, a := range queryAttributes(q) {
+			ref := parseAttributeRef(a)
+			found := false
+			for _, k := range refs {
+				if ref.matches(k) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				problems = append(problems, fmt.Errorf("query %s: attribute %s is not in the attribute catalog", q.Name, a))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default ages at which recorded traces are audited: past the ingester flush, compaction and a
+// 24h retention boundary
+var defaultAuditAges = []string{"1h", "6h", "26h"}
+
+// AuditConfig checks that traces written during the run stay retrievable as they age
+type AuditConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Ages           []string `yaml:"ages"`           // Ages at which every recorded trace is audited (default: 1h, 6h, 26h)
+	RecordInterval string   `yaml:"recordInterval"` // How often a newly written trace ID is recorded (default: 1m)
+	TraceQL        string   `yaml:"traceql"`        // Finds newly written traces (default: the write generator's marker)
+	StateFile      string   `yaml:"stateFile"`      // Keeps the recorded trace IDs so audits survive restarts (optional)
+	WrittenTraces  string   `yaml:"writtenTraces"`  // NDJSON file the write side appends written trace IDs to (optional)
+}
+
+// audits checks the completeness of aged data (nil when disabled)
+var audits *completenessAuditor
+
+// completenessAuditor records the IDs of newly written traces and, once they reach each
+// configured age, verifies they are still retrievable by ID and findable by search
+type completenessAuditor struct {
+	ages      []time.Duration
+	ageLabels []string
+	interval  time.Duration
+	traceql   string
+	stateFile string
+	client    *probeClient
+
+	writtenTraces string // file of trace IDs recorded at write time, "" to search for them
+	writtenOffset int64  // bytes of writtenTraces already read
+	searching     bool   // writtenTraces is unavailable and traces are found by search
+
+	traces []*auditedTrace
+
+	results *prometheus.CounterVec
+	tracked prometheus.Gauge
+}
+
+// auditedTrace is a recorded trace and how many of the ages it has been audited at
+type auditedTrace struct {
+	TraceID           string    `json:"traceID"`
+	StartTimeUnixNano string    `json:"startTimeUnixNano"`
+	DurationMs        int64     `json:"durationMs"`
+	Spans             int       `json:"spans"` // spans when recorded; fewer later means partial
+	RecordedAt        time.Time `json:"recordedAt"`
+	Audited           int       `json:"audited"` // ages (in ascending order) already audited
+}
+
+// newCompletenessAuditor validates the audit config and restores the recorded traces
+func newCompletenessAuditor(cfg AuditConfig, transport http.RoundTripper, target, endpoint, tenant, timeFormat string) (*completenessAuditor, error) {
+	a := &completenessAuditor{
+		interval:      time.Minute,
+		traceql:       cfg.TraceQL,
+		stateFile:     cfg.StateFile,
+		writtenTraces: cfg.WrittenTraces,
+		client:        newProbeClient(transport, time.Minute, target, endpoint, tenant, timeFormat),
+	}
+	ages := cfg.Ages
+	if len(ages) == 0 {
+		ages = defaultAuditAges
+	}
+	type age struct {
+		d     time.Duration
+		label string
+	}
+	var sorted []age
+	for _, s := range ages {
+		d, err := parseExtendedDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid age %q", s)
+		}
+		sorted = append(sorted, age{d, s})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].d < sorted[j].d })
+	for _, age := range sorted {
+		a.ages = append(a.ages, age.d)
+		a.ageLabels = append(a.ageLabels, age.label)
+	}
+	if cfg.RecordInterval != "" {
+		d, err := time.ParseDuration(cfg.RecordInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid recordInterval %q", cfg.RecordInterval)
+		}
+		a.interval = d
+	}
+	if a.traceql == "" {
+		a.traceql = defaultFreshnessTraceQL
+	}
+	if err := validateTraceQL(a.traceql); err != nil {
+		return nil, fmt.Errorf("invalid traceql %q: %v", a.traceql, err)
+	}
+	if a.stateFile != "" {
+		data, err := os.ReadFile(a.stateFile)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &a.traces); err != nil {
+				return nil, fmt.Errorf("invalid state file %s: %w", a.stateFile, err)
+			}
+			log.Printf("Restored %d audited trace(s) from %s", len(a.traces), a.stateFile)
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read state file: %w", err)
+		}
+	}
+
+	a.results = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "audit",
+		Name:      "traces_total",
+		Help:      "Audited traces by age class, check (by_id, search) and result (found, missing, partial: fewer spans than when written, error)",
+	}, []string{"age", "check", "result"})
+	a.tracked = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "audit",
+		Name:      "tracked_traces",
+		Help:      "Recorded traces still waiting for an audit",
+	})
+	a.tracked.Set(float64(len(a.traces)))
+	return a, nil
+}
+
+// run records a trace and audits the due ones every interval until ctx is done
+func (a *completenessAuditor) run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		changed := a.record(now)
+		if a.auditDue(now) {
+			changed = true
+		}
+		if changed {
+			a.tracked.Set(float64(len(a.traces)))
+			a.save()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// record adds the newest trace written since the last call: from the IDs the write side
+// recorded when writtenTraces is set and readable, else the newest trace search finds. Found by
+// search, a trace's ages count from when it became searchable rather than when it was written,
+// and traces never searchable are not audited at all.
+func (a *completenessAuditor) record(now time.Time) bool {
+	if a.writtenTraces != "" {
+		written, err := a.readWritten()
+		if err == nil {
+			if a.searching {
+				log.Printf("Audit: reading written trace IDs from %s", a.writtenTraces)
+				a.searching = false
+			}
+			return a.recordWritten(written)
+		}
+		if !a.searching {
+			log.Printf("Warning: Audit cannot read written trace IDs (%v), finding new traces by search until it can", err)
+			a.searching = true
+		}
+	}
+	return a.recordSearched(now)
+}
+
+// writtenTrace is a trace ID the write side recorded, with what it knows of the trace
+type writtenTrace struct {
+	TraceID           string    `json:"traceID"`
+	WrittenAt         time.Time `json:"writtenAt"`
+	StartTimeUnixNano string    `json:"startTimeUnixNano,omitempty"`
+	DurationMs        int64     `json:"durationMs,omitempty"`
+	Spans             int       `json:"spans,omitempty"` // 0 when unknown
+}
+
+// otlpExport is a line of the OpenTelemetry Collector's file exporter (OTLP JSON)
+type otlpExport struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID           string      `json:"traceId"`
+				StartTimeUnixNano json.Number `json:"startTimeUnixNano"`
+				EndTimeUnixNano   json.Number `json:"endTimeUnixNano"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+// readWritten reads the complete lines appended to writtenTraces since the last call, starting
+// over when the file was truncated
+func (a *completenessAuditor) readWritten() ([]writtenTrace, error) {
+	f, err := os.Open(a.writtenTraces)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < a.writtenOffset {
+		a.writtenOffset = 0
+	}
+	if _, err := f.Seek(a.writtenOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var written []writtenTrace
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return written, nil // a partial last line is read once complete
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.writtenOffset += int64(len(line))
+		traces, err := parseWrittenTraces(line)
+		if err != nil {
+			log.Printf("Warning: Audit skipped a line of %s: %v", a.writtenTraces, err)
+			continue
+		}
+		written = append(written, traces...)
+	}
+}
+
+// parseWrittenTraces parses a line of the written traces file: a writtenTrace, or an OTLP JSON
+// export whose spans are grouped by trace
+func parseWrittenTraces(line []byte) ([]writtenTrace, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil, nil
+	}
+	var export otlpExport
+	if err := json.Unmarshal(line, &export); err != nil {
+		return nil, err
+	}
+	if len(export.ResourceSpans) == 0 {
+		var t writtenTrace
+		if err := json.Unmarshal(line, &t); err != nil {
+			return nil, err
+		}
+		if t.TraceID == "" || t.WrittenAt.IsZero() {
+			return nil, fmt.Errorf("needs traceID and writtenAt")
+		}
+		return []writtenTrace{t}, nil
+	}
+
+	type bounds struct{ start, end, spans int64 }
+	byTrace := make(map[string]*bounds)
+	var order []string
+	for _, rs := range export.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				start, err1 := span.StartTimeUnixNano.Int64()
+				end, err2 := span.EndTimeUnixNano.Int64()
+				if span.TraceID == "" || err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("span without traceId, startTimeUnixNano or endTimeUnixNano")
+				}
+				b := byTrace[span.TraceID]
+				if b == nil {
+					b = &bounds{start: start, end: end}
+					byTrace[span.TraceID] = b
+					order = append(order, span.TraceID)
+				}
+				if start < b.start {
+					b.start = start
+				}
+				if end > b.end {
+					b.end = end
+				}
+				b.spans++
+			}
+		}
+	}
+	traces := make([]writtenTrace, 0, len(order))
+	for _, id := range order {
+		b := byTrace[id]
+		traces = append(traces, writtenTrace{
+			TraceID:           id,
+			WrittenAt:         time.Unix(0, b.end),
+			StartTimeUnixNano: strconv.FormatInt(b.start, 10),
+			DurationMs:        (b.end - b.start) / int64(time.Millisecond),
+			Spans:             int(b.spans),
+		})
+	}
+	return traces, nil
+}
+
+// recordWritten adds the newest written trace not recorded yet; its ages count from when it was
+// written. Without a span count from the write side, the spans retrieved by ID now are the
+// baseline of partial results, or none when it is not retrievable yet.
+func (a *completenessAuditor) recordWritten(written []writtenTrace) bool {
+	known := make(map[string]bool, len(a.traces))
+	for _, t := range a.traces {
+		known[t.TraceID] = true
+	}
+	var newest *writtenTrace
+	for i, t := range written {
+		if !known[t.TraceID] && (newest == nil || t.WrittenAt.After(newest.WrittenAt)) {
+			newest = &written[i]
+		}
+	}
+	if newest == nil {
+		return false
+	}
+	trace := &auditedTrace{
+		TraceID:           newest.TraceID,
+		StartTimeUnixNano: newest.StartTimeUnixNano,
+		DurationMs:        newest.DurationMs,
+		Spans:             newest.Spans,
+		RecordedAt:        newest.WrittenAt,
+	}
+	if trace.StartTimeUnixNano == "" {
+		trace.StartTimeUnixNano = strconv.FormatInt(newest.WrittenAt.UnixNano(), 10)
+	}
+	if trace.Spans == 0 {
+		if spans, err := a.client.traceSpans(trace.TraceID); err == nil {
+			trace.Spans = spans
+		}
+	}
+	a.traces = append(a.traces, trace)
+	return true
+}
+
+// recordSearched adds the newest searchable trace of the write generator not recorded yet
+func (a *completenessAuditor) recordSearched(now time.Time) bool {
+	resp, err := a.client.search(a.traceql, now.Add(-2*time.Minute), now, 20)
+	if err != nil {
+		log.Printf("Warning: Audit failed to find a new trace: %s", redaction.error(err))
+		return false
+	}
+	known := make(map[string]bool, len(a.traces))
+	for _, t := range a.traces {
+		known[t.TraceID] = true
+	}
+	var newest *auditedTrace
+	var newestEnd time.Time
+	for _, trace := range resp.Traces {
+		end := traceEnd(trace.StartTimeUnixNano, trace.DurationMs)
+		if known[trace.TraceID] || end.IsZero() || !end.After(newestEnd) {
+			continue
+		}
+		newest = &auditedTrace{TraceID: trace.TraceID, StartTimeUnixNano: trace.StartTimeUnixNano, DurationMs: trace.DurationMs}
+		newestEnd = end
+	}
+	if newest == nil {
+		return false
+	}
+	spans, err := a.client.traceSpans(newest.TraceID)
+	if err != nil {
+		log.Printf("Warning: Audit failed to retrieve new trace %s: %s", newest.TraceID, redaction.error(err))
+		return false
+	}
+	newest.Spans = spans
+	newest.RecordedAt = now
+	a.traces = append(a.traces, newest)
+	return true
+}
+
+// auditDue audits every recorded trace that reached its next age and forgets the traces
+// audited at every age
+func (a *completenessAuditor) auditDue(now time.Time) bool {
+	changed := false
+	remaining := a.traces[:0]
+	for _, t := range a.traces {
+		for t.Audited < len(a.ages) && now.Sub(t.RecordedAt) >= a.ages[t.Audited] {
+			a.audit(t, a.ageLabels[t.Audited])
+			t.Audited++
+			changed = true
+		}
+		if t.Audited < len(a.ages) {
+			remaining = append(remaining, t)
+		}
+	}
+	a.traces = remaining
+	return changed
+}
+
+// audit checks that a recorded trace is still complete by ID and findable by search
+func (a *completenessAuditor) audit(t *auditedTrace, age string) {
+	spans, err := a.client.traceSpans(t.TraceID)
+	result := "found"
+	switch {
+	case errors.Is(err, errTraceNotFound):
+		result = "missing"
+	case err != nil:
+		result = "error"
+		log.Printf("Warning: Audit of trace %s by ID failed: %s", t.TraceID, redaction.error(err))
+	case spans < t.Spans:
+		result = "partial"
+	}
+	a.results.WithLabelValues(age, "by_id", result).Inc()
+	if result == "missing" || result == "partial" {
+		log.Printf("Audit [%s]: trace %s is %s by ID (%d of %d spans)", age, t.TraceID, result, spans, t.Spans)
+	}
+
+	// Search around the trace only, as its age may be past the default search window
+	start := traceEnd(t.StartTimeUnixNano, 0)
+	end := traceEnd(t.StartTimeUnixNano, t.DurationMs)
+	resp, err := a.client.search(fmt.Sprintf("{ trace:id = %q }", t.TraceID), start.Add(-time.Minute), end.Add(time.Minute), 20)
+	result = "missing"
+	if err != nil {
+		result = "error"
+		log.Printf("Warning: Audit search of trace %s failed: %s", t.TraceID, redaction.error(err))
+	} else {
+		for _, trace := range resp.Traces {
+			// Search results may drop the leading zeros of trace IDs
+			if strings.TrimLeft(trace.TraceID, "0") == strings.TrimLeft(t.TraceID, "0") {
+				result = "found"
+				break
+			}
+		}
+	}
+	a.results.WithLabelValues(age, "search", result).Inc()
+	if result == "missing" {
+		log.Printf("Audit [%s]: trace %s is not found by search", age, t.TraceID)
+	}
+}
+
+// save writes the recorded traces to the state file
+func (a *completenessAuditor) save() {
+	if a.stateFile == "" {
+		return
+	}
+	data, err := json.Marshal(a.traces)
+	if err != nil {
+		log.Printf("Warning: Failed to encode audit state: %v", err)
+		return
+	}
+	if err := os.WriteFile(a.stateFile, data, 0o644); err != nil {
+		log.Printf("Warning: Failed to write audit state: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWrittenTraces(t *testing.T) {
+	writtenAt := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		line    string
+		want    []writtenTrace
+		wantErr bool
+	}{
+		{"empty", "  \n", nil, false},
+		{
+			"written trace",
+			`{"traceID": "abc", "writtenAt": "2025-11-27T08:00:00Z", "spans": 12}`,
+			[]writtenTrace{{TraceID: "abc", WrittenAt: writtenAt, Spans: 12}},
+			false,
+		},
+		{
+			"otlp export",
+			`{"resourceSpans": [{"scopeSpans": [{"spans": [
+				{"traceId": "t1", "startTimeUnixNano": "1764230400000000000", "endTimeUnixNano": "1764230400500000000"},
+				{"traceId": "t2", "startTimeUnixNano": 1764230401000000000, "endTimeUnixNano": 1764230401100000000}
+			]}]}, {"scopeSpans": [{"spans": [
+				{"traceId": "t1", "startTimeUnixNano": "1764230399000000000", "endTimeUnixNano": "1764230400200000000"}
+			]}]}]}`,
+			[]writtenTrace{
+				{TraceID: "t1", WrittenAt: time.Unix(0, 1764230400500000000), StartTimeUnixNano: "1764230399000000000", DurationMs: 1500, Spans: 2},
+				{TraceID: "t2", WrittenAt: time.Unix(0, 1764230401100000000), StartTimeUnixNano: "1764230401000000000", DurationMs: 100, Spans: 1},
+			},
+			false,
+		},
+		{"missing writtenAt", `{"traceID": "abc"}`, nil, true},
+		{"otlp span without times", `{"resourceSpans": [{"scopeSpans": [{"spans": [{"traceId": "t1"}]}]}]}`, nil, true},
+		{"not json", `abc`, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseWrittenTraces([]byte(tc.line))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tc.wantErr)
+			}
+			for i := range got {
+				if !got[i].WrittenAt.Equal(tc.want[i].WrittenAt) {
+					t.Errorf("trace %d writtenAt = %s, want %s", i, got[i].WrittenAt, tc.want[i].WrittenAt)
+				}
+				got[i].WrittenAt = tc.want[i].WrittenAt
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("traces = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadWrittenTraces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "written.jsonl")
+	a := &completenessAuditor{writtenTraces: path}
+	ids := func(written []writtenTrace) []string {
+		var ids []string
+		for _, w := range written {
+			ids = append(ids, w.TraceID)
+		}
+		return ids
+	}
+	appendLines := func(s string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := a.readWritten(); !os.IsNotExist(err) {
+		t.Fatalf("readWritten of a missing file = %v, want a not-exist error", err)
+	}
+
+	appendLines(`{"traceID": "a", "writtenAt": "2025-11-27T08:00:00Z"}` + "\n" + `{"traceID": "b", "writtenAt": "2025-11-27T08:00:01Z"}` + "\n" + `{"traceID": "c", "wri`)
+	written, err := a.readWritten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(written); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("first read = %v, want [a b] without the partial line", got)
+	}
+
+	appendLines(`ttenAt": "2025-11-27T08:00:02Z"}` + "\n" + "garbage\n" + `{"traceID": "d", "writtenAt": "2025-11-27T08:00:03Z"}` + "\n")
+	written, err = a.readWritten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(written); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("second read = %v, want [c d]", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"traceID": "e", "writtenAt": "2025-11-27T08:00:04Z"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written, err = a.readWritten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(written); !reflect.DeepEqual(got, []string{"e"}) {
+		t.Errorf("read after truncation = %v, want [e]", got)
+	}
+}
+
+func TestRecordWrittenNewest(t *testing.T) {
+	base := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	a := &completenessAuditor{traces: []*auditedTrace{{TraceID: "known"}}}
+	written := []writtenTrace{
+		{TraceID: "old", WrittenAt: base, Spans: 3},
+		{TraceID: "known", WrittenAt: base.Add(2 * time.Second), Spans: 3},
+		{TraceID: "new", WrittenAt: base.Add(time.Second), Spans: 5},
+	}
+	if !a.recordWritten(written) {
+		t.Fatalf("recordWritten = false, want a recorded trace")
+	}
+	got := a.traces[len(a.traces)-1]
+	if got.TraceID != "new" || got.Spans != 5 || !got.RecordedAt.Equal(base.Add(time.Second)) {
+		t.Errorf("recorded %+v, want trace new with 5 spans recorded at its write time", got)
+	}
+	if got.StartTimeUnixNano == "" {
+		t.Errorf("recorded trace has no start time to search around")
+	}
+	if a.recordWritten([]writtenTrace{{TraceID: "known", WrittenAt: base}}) {
+		t.Errorf("recordWritten of known traces = true, want false")
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Authentication types
+const (
+	authServiceAccount = "serviceAccount"
+	authOIDC           = "oidc"
+	authAPIKey         = "apiKey"
+	authBasic          = "basic"
+	authNone           = "none"
+)
+
+const (
+	defaultTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultRefreshBefore = time.Minute
+	tokenRetryInterval   = 10 * time.Second
+	// A forced refresh within this long of the previous one reuses its token
+	forcedRefreshCooldown = 5 * time.Second
+	// defaultCredentialsLabel is the tenant label of metrics of the default credentials
+	defaultCredentialsLabel = "default"
+)
+
+// AuthConfig configures how query requests are authenticated
+type AuthConfig struct {
+	Type          string     `yaml:"type"`          // "serviceAccount" (default), "oidc", "apiKey", "basic" or "none"
+	TokenFile     string     `yaml:"tokenFile"`     // serviceAccount token path (default: the mounted service account token)
+	OIDC          OIDCConfig `yaml:"oidc"`          // Client credentials flow settings for type oidc
+	RefreshBefore string     `yaml:"refreshBefore"` // Refresh this long before the token expires (default: 1m)
+
+	// Static API key for type apiKey
+	APIKey       string `yaml:"apiKey"`
+	APIKeyFile   string `yaml:"apiKeyFile"`
+	APIKeyHeader string `yaml:"apiKeyHeader"` // Header carrying the key (default: "Authorization" as a bearer token)
+
+	// HTTP basic auth for type basic, e.g. a Grafana Cloud instance ID and API key
+	BasicAuth BasicAuthConfig `yaml:"basicAuth"`
+
+	// Credentials of individual tenants, overriding the ones above for their requests
+	Tenants map[string]AuthConfig `yaml:"tenants"`
+}
+
+// OIDCConfig configures the OAuth2 client credentials flow against an OIDC provider
+type OIDCConfig struct {
+	TokenURL         string   `yaml:"tokenURL"`
+	ClientID         string   `yaml:"clientID"`
+	ClientSecret     string   `yaml:"clientSecret"`
+	ClientSecretFile string   `yaml:"clientSecretFile"`
+	Scopes           []string `yaml:"scopes"`
+	Audience         string   `yaml:"audience"`
+}
+
+// normalizeAuthType returns the auth type, defaulting to serviceAccount
+func normalizeAuthType(t string) string {
+	if t == "" {
+		return authServiceAccount
+	}
+	return t
+}
+
+// apiKeyHeaders returns the custom headers API keys are sent in, so they are redacted like
+// Authorization
+func (cfg AuthConfig) apiKeyHeaders() []string {
+	var headers []string
+	if cfg.APIKeyHeader != "" {
+		headers = append(headers, cfg.APIKeyHeader)
+	}
+	for _, tenant := range cfg.Tenants {
+		headers = append(headers, tenant.apiKeyHeaders()...)
+	}
+	return headers
+}
+
+// credentials authenticate requests
+type credentials interface {
+	// apply sets the authentication headers of a request
+	apply(req *http.Request)
+	// retryUnauthorized reacts to a 401 for req and reports whether the request should be retried
+	retryUnauthorized(req *http.Request) bool
+}
+
+// auth authenticates query requests (nil when no tenant has credentials)
+var auth *authenticator
+
+// authenticator holds the default credentials and those of individual tenants
+type authenticator struct {
+	fallback credentials // nil = unauthenticated
+	tenants  map[string]credentials
+}
+
+// newAuthenticator creates the credentials of the config and of every tenant in it
+func newAuthenticator(cfg AuthConfig) (*authenticator, error) {
+	metrics := newAuthMetrics()
+	a := &authenticator{tenants: make(map[string]credentials, len(cfg.Tenants))}
+
+	var err error
+	a.fallback, err = newCredentials(cfg, defaultCredentialsLabel, metrics)
+	if err != nil {
+		return nil, err
+	}
+	for tenant, tc := range cfg.Tenants {
+		if len(tc.Tenants) > 0 {
+			return nil, fmt.Errorf("tenant %s: credentials cannot be nested", tenant)
+		}
+		if tc.RefreshBefore == "" {
+			tc.RefreshBefore = cfg.RefreshBefore
+		}
+		c, err := newCredentials(tc, tenant, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		a.tenants[tenant] = c
+	}
+	if a.fallback == nil && len(cfg.Tenants) == 0 {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// credentialsFor returns the credentials of a tenant (nil = unauthenticated)
+func (a *authenticator) credentialsFor(tenant string) credentials {
+	if c, ok := a.tenants[tenant]; ok {
+		return c
+	}
+	return a.fallback
+}
+
+// apply authenticates a request of the tenant
+func (a *authenticator) apply(tenant string, req *http.Request) {
+	if a == nil {
+		return
+	}
+	if c := a.credentialsFor(tenant); c != nil {
+		c.apply(req)
+	}
+}
+
+// retryUnauthorized reacts to a 401 for a request of the tenant and reports whether to retry it
+func (a *authenticator) retryUnauthorized(tenant string, req *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	if c := a.credentialsFor(tenant); c != nil && c.retryUnauthorized(req) {
+		c.apply(req)
+		return true
+	}
+	return false
+}
+
+// authMetrics are shared by the token providers of every tenant
+type authMetrics struct {
+	refreshes *prometheus.CounterVec
+	expiry    *prometheus.GaugeVec
+}
+
+func newAuthMetrics() *authMetrics {
+	return &authMetrics{
+		refreshes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "auth",
+			Name:      "token_refreshes_total",
+			Help:      "Bearer token refreshes by tenant, reason (startup, scheduled, unauthorized) and result",
+		}, []string{"tenant", "reason", "result"}),
+		expiry: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Subsystem: "auth",
+			Name:      "token_expiry_timestamp_seconds",
+			Help:      "Expiry of the current bearer token by tenant as a Unix timestamp (0 = no expiry or no token)",
+		}, []string{"tenant"}),
+	}
+}
+
+// newCredentials creates the credentials of one auth config (nil for type none, or when the
+// default service account token is missing)
+func newCredentials(cfg AuthConfig, label string, metrics *authMetrics) (credentials, error) {
+	switch cfg.Type {
+	case "", authServiceAccount:
+		path := cfg.TokenFile
+		if path == "" {
+			path = defaultTokenFile
+		}
+		p, err := newTokenProvider(cfg, label, metrics, func() (string, time.Time, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			token := strings.TrimSpace(string(data))
+			return token, jwtExpiry(token), nil
+		})
+		if err != nil {
+			if cfg.TokenFile != "" {
+				return nil, fmt.Errorf("failed to read token: %w", err)
+			}
+			// Outside a cluster the service account token is missing; requests go out unauthenticated
+			log.Printf("Warning: Failed to read token: %v", err)
+			return nil, nil
+		}
+		return p, nil
+	case authOIDC:
+		fetch, err := newOIDCFetcher(cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		p, err := newTokenProvider(cfg, label, metrics, fetch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain OIDC token: %w", err)
+		}
+		return p, nil
+	case authAPIKey:
+		return newAPIKeyCredentials(cfg)
+	case authBasic:
+		if cfg.BasicAuth.Username == "" {
+			return nil, fmt.Errorf("basic needs basicAuth.username")
+		}
+		password, err := cfg.BasicAuth.password()
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(cfg.BasicAuth.Username + ":" + password))
+		return &staticCredentials{header: "Authorization", value: "Basic " + encoded}, nil
+	case authNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown auth type %q (expected %s, %s, %s, %s or %s)", cfg.Type, authServiceAccount, authOIDC, authAPIKey, authBasic, authNone)
+	}
+}
+
+// staticCredentials send a fixed header value, such as an API key or basic auth credentials
+type staticCredentials struct {
+	header string
+	value  string
+}
+
+func newAPIKeyCredentials(cfg AuthConfig) (*staticCredentials, error) {
+	key := cfg.APIKey
+	if cfg.APIKeyFile != "" {
+		data, err := os.ReadFile(cfg.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read apiKeyFile: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		return nil, fmt.Errorf("apiKey needs apiKey or apiKeyFile")
+	}
+	if cfg.APIKeyHeader == "" || strings.EqualFold(cfg.APIKeyHeader, "Authorization") {
+		return &staticCredentials{header: "Authorization", value: "Bearer " + key}, nil
+	}
+	return &staticCredentials{header: cfg.APIKeyHeader, value: key}, nil
+}
+
+func (c *staticCredentials) apply(req *http.Request) {
+	req.Header.Set(c.header, c.value)
+}
+
+func (c *staticCredentials) retryUnauthorized(*http.Request) bool {
+	return false // the credentials do not change
+}
+
+// tokenProvider caches a bearer token and refreshes it ahead of its expiry
+type tokenProvider struct {
+	fetch         func() (token string, expiry time.Time, err error)
+	refreshBefore time.Duration
+
+	mu          sync.Mutex
+	current     string
+	expiry      time.Time // zero when the token does not expire
+	lastRefresh time.Time
+
+	refreshes   *prometheus.CounterVec // curried with the tenant label
+	expiryGauge prometheus.Gauge
+}
+
+// newTokenProvider fetches the first token and starts refreshing it ahead of expiry
+func newTokenProvider(cfg AuthConfig, label string, metrics *authMetrics, fetch func() (string, time.Time, error)) (*tokenProvider, error) {
+	p := &tokenProvider{
+		fetch:         fetch,
+		refreshBefore: defaultRefreshBefore,
+		refreshes:     metrics.refreshes.MustCurryWith(prometheus.Labels{"tenant": label}),
+		expiryGauge:   metrics.expiry.WithLabelValues(label),
+	}
+	if cfg.RefreshBefore != "" {
+		d, err := time.ParseDuration(cfg.RefreshBefore)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid refreshBefore %q", cfg.RefreshBefore)
+		}
+		p.refreshBefore = d
+	}
+
+	if err := p.refresh("startup"); err != nil {
+		return nil, err
+	}
+	go p.run()
+	return p, nil
+}
+
+// token returns the current bearer token
+func (p *tokenProvider) token() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+func (p *tokenProvider) apply(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.token())
+}
+
+// retryUnauthorized refreshes the token after a 401 unless it already changed since the request
+// was sent. Workers hitting 401 together share one refresh.
+func (p *tokenProvider) retryUnauthorized(req *http.Request) bool {
+	rejected := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	if p.current != rejected || time.Since(p.lastRefresh) < forcedRefreshCooldown {
+		changed := p.current != rejected
+		p.mu.Unlock()
+		return changed
+	}
+	p.mu.Unlock()
+
+	if err := p.refresh("unauthorized"); err != nil {
+		log.Printf("Warning: Token refresh after 401 failed: %v", err)
+		return false
+	}
+	return p.token() != rejected
+}
+
+// refresh fetches a new token and records the outcome
+func (p *tokenProvider) refresh(reason string) error {
+	token, expiry, err := p.fetch()
+	p.mu.Lock()
+	p.lastRefresh = time.Now()
+	if err == nil {
+		p.current, p.expiry = token, expiry
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.refreshes.WithLabelValues(reason, "failure").Inc()
+		return err
+	}
+	p.refreshes.WithLabelValues(reason, "success").Inc()
+	if expiry.IsZero() {
+		p.expiryGauge.Set(0)
+	} else {
+		p.expiryGauge.Set(float64(expiry.Unix()))
+	}
+	return nil
+}
+
+// run refreshes the token refreshBefore its expiry, retrying failed refreshes
+func (p *tokenProvider) run() {
+	for {
+		p.mu.Lock()
+		expiry := p.expiry
+		p.mu.Unlock()
+		if expiry.IsZero() {
+			return // the token never expires
+		}
+
+		// A re-read token may still be inside the refresh window (e.g. a service account token
+		// the kubelet has not rotated yet), so wait at least the retry interval
+		wait := time.Until(expiry.Add(-p.refreshBefore))
+		if wait < tokenRetryInterval {
+			wait = tokenRetryInterval
+		}
+		time.Sleep(wait)
+		for {
+			err := p.refresh("scheduled")
+			if err == nil {
+				break
+			}
+			log.Printf("Warning: Token refresh failed, retrying in %s: %v", tokenRetryInterval, err)
+			time.Sleep(tokenRetryInterval)
+		}
+	}
+}
+
+// jwtExpiry returns the exp claim of a JWT (zero when absent or not a JWT)
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Exp), 0)
+}
+
+// newOIDCFetcher returns a fetch function for the client credentials flow
+func newOIDCFetcher(cfg OIDCConfig) (func() (string, time.Time, error), error) {
+	if cfg.TokenURL == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc needs tokenURL and clientID")
+	}
+	secret := cfg.ClientSecret
+	if cfg.ClientSecretFile != "" {
+		data, err := os.ReadFile(cfg.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oidc.clientSecretFile: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", secret)
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	return func() (string, time.Time, error) {
+		res, err := client.PostForm(cfg.TokenURL, form)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return "", time.Time{}, fmt.Errorf("token endpoint returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		var resp struct {
+			AccessToken string  `json:"access_token"`
+			IDToken     string  `json:"id_token"`
+			ExpiresIn   float64 `json:"expires_in"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return "", time.Time{}, fmt.Errorf("invalid token response: %w", err)
+		}
+		token := resp.AccessToken
+		if token == "" {
+			token = resp.IDToken
+		}
+		if token == "" {
+			return "", time.Time{}, fmt.Errorf("token response has no access_token")
+		}
+		expiry := jwtExpiry(token)
+		if expiry.IsZero() && resp.ExpiresIn > 0 {
+			expiry = time.Now().Add(time.Duration(resp.ExpiresIn * float64(time.Second)))
+		}
+		return token, expiry, nil
+	}, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testAuthMetrics returns unregistered auth metrics
+func testAuthMetrics() *authMetrics {
+	return &authMetrics{
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"tenant", "reason", "result"}),
+		expiry:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"tenant"}),
+	}
+}
+
+// testJWT returns an unsigned JWT with the given claims
+func testJWT(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestJWTExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  time.Time
+	}{
+		{"exp", testJWT(`{"sub":"loadgen","exp":1764230400}`), time.Unix(1764230400, 0)},
+		{"fractional exp", testJWT(`{"exp":1764230400.7}`), time.Unix(1764230400, 0)},
+		{"no exp", testJWT(`{"sub":"loadgen"}`), time.Time{}},
+		{"opaque token", "2YotnFZFEjr1zCsicMWpAA", time.Time{}},
+		{"invalid payload", "a.!!!.c", time.Time{}},
+		{"payload not JSON", "a." + base64.RawURLEncoding.EncodeToString([]byte("exp")) + ".c", time.Time{}},
+	} {
+		if got := jwtExpiry(tc.token); !got.Equal(tc.want) {
+			t.Errorf("%s: jwtExpiry = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOIDCFetcher(t *testing.T) {
+	jwt := testJWT(`{"exp":1764230400}`)
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		for key, want := range map[string]string{
+			"grant_type": "client_credentials", "client_id": "loadgen", "client_secret": "s3cret",
+			"scope": "openid profile", "audience": "observatorium",
+		} {
+			if got := r.PostForm.Get(key); got != want {
+				t.Errorf("form %s = %q, want %q", key, got, want)
+			}
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	fetch, err := newOIDCFetcher(OIDCConfig{
+		TokenURL: server.URL, ClientID: "loadgen", ClientSecret: "s3cret",
+		Scopes: []string{"openid", "profile"}, Audience: "observatorium",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		status    int
+		body      string
+		token     string
+		expiresIn time.Duration // expected expiry from now when the token is not a JWT
+		expiry    time.Time
+		ok        bool
+	}{
+		{"jwt exp wins over expires_in", 200, `{"access_token":"` + jwt + `","expires_in":60}`, jwt, 0, time.Unix(1764230400, 0), true},
+		{"expires_in", 200, `{"access_token":"opaque","expires_in":300}`, "opaque", 300 * time.Second, time.Time{}, true},
+		{"id token", 200, `{"id_token":"opaque"}`, "opaque", 0, time.Time{}, true},
+		{"no token", 200, `{"expires_in":300}`, "", 0, time.Time{}, false},
+		{"not JSON", 200, `<html>`, "", 0, time.Time{}, false},
+		{"rejected", 401, `{"error":"invalid_client"}`, "", 0, time.Time{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body = tc.status, tc.body
+			token, expiry, err := fetch()
+			if (err == nil) != tc.ok {
+				t.Fatalf("fetch = %v, want ok: %v", err, tc.ok)
+			}
+			if token != tc.token {
+				t.Errorf("token = %q, want %q", token, tc.token)
+			}
+			if tc.expiresIn > 0 {
+				if d := time.Until(expiry) - tc.expiresIn; d > 0 || d < -5*time.Second {
+					t.Errorf("expiry in %s, want %s", time.Until(expiry), tc.expiresIn)
+				}
+			} else if !expiry.Equal(tc.expiry) {
+				t.Errorf("expiry = %s, want %s", expiry, tc.expiry)
+			}
+		})
+	}
+
+	if _, err := newOIDCFetcher(OIDCConfig{TokenURL: server.URL}); err == nil {
+		t.Errorf("newOIDCFetcher without clientID succeeded")
+	}
+}
+
+func TestNewTokenProvider(t *testing.T) {
+	metrics := testAuthMetrics()
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	p, err := newTokenProvider(AuthConfig{RefreshBefore: "5m"}, "tenant-1", metrics, func() (string, time.Time, error) {
+		return "t1", expiry, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.token() != "t1" || p.refreshBefore != 5*time.Minute {
+		t.Errorf("provider = token %q refreshing %s ahead, want t1 and 5m", p.token(), p.refreshBefore)
+	}
+	if got := testutil.ToFloat64(metrics.refreshes.WithLabelValues("tenant-1", "startup", "success")); got != 1 {
+		t.Errorf("startup refreshes = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.expiry.WithLabelValues("tenant-1")); got != float64(expiry.Unix()) {
+		t.Errorf("expiry gauge = %v, want %d", got, expiry.Unix())
+	}
+
+	if _, err := newTokenProvider(AuthConfig{RefreshBefore: "soon"}, "t", testAuthMetrics(), nil); err == nil {
+		t.Errorf("newTokenProvider with an invalid refreshBefore succeeded")
+	}
+	failing := testAuthMetrics()
+	if _, err := newTokenProvider(AuthConfig{}, "t", failing, func() (string, time.Time, error) {
+		return "", time.Time{}, errors.New("unreachable")
+	}); err == nil {
+		t.Errorf("newTokenProvider with a failing fetch succeeded")
+	}
+	if got := testutil.ToFloat64(failing.refreshes.WithLabelValues("t", "startup", "failure")); got != 1 {
+		t.Errorf("failed startup refreshes = %v, want 1", got)
+	}
+}
+
+func TestTokenProviderRetryUnauthorized(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		sent        string        // token the rejected request carried
+		lastRefresh time.Duration // ago
+		fetchErr    error
+		retry       bool
+		token       string // current token afterwards
+		refreshes   float64
+	}{
+		{"forced refresh", "t1", time.Minute, nil, true, "t2", 1},
+		{"token already refreshed", "t0", time.Minute, nil, true, "t1", 0},
+		{"refreshed moments ago", "t1", time.Second, nil, false, "t1", 0},
+		{"refresh failed", "t1", time.Minute, errors.New("unreachable"), false, "t1", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := testAuthMetrics()
+			p := &tokenProvider{
+				fetch:       func() (string, time.Time, error) { return "t2", time.Time{}, tc.fetchErr },
+				current:     "t1",
+				lastRefresh: time.Now().Add(-tc.lastRefresh),
+				refreshes:   metrics.refreshes.MustCurryWith(prometheus.Labels{"tenant": "t"}),
+				expiryGauge: metrics.expiry.WithLabelValues("t"),
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.sent)
+
+			if got := p.retryUnauthorized(req); got != tc.retry {
+				t.Errorf("retryUnauthorized = %v, want %v", got, tc.retry)
+			}
+			if p.token() != tc.token {
+				t.Errorf("token = %q, want %q", p.token(), tc.token)
+			}
+			var refreshes float64
+			for _, result := range []string{"success", "failure"} {
+				refreshes += testutil.ToFloat64(metrics.refreshes.WithLabelValues("t", "unauthorized", result))
+			}
+			if refreshes != tc.refreshes {
+				t.Errorf("unauthorized refreshes = %v, want %v", refreshes, tc.refreshes)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRetryUnauthorized(t *testing.T) {
+	metrics := testAuthMetrics()
+	provider := &tokenProvider{
+		fetch:       func() (string, time.Time, error) { return "fresh", time.Time{}, nil },
+		current:     "stale",
+		refreshes:   metrics.refreshes.MustCurryWith(prometheus.Labels{"tenant": "a"}),
+		expiryGauge: metrics.expiry.WithLabelValues("a"),
+	}
+	a := &authenticator{
+		fallback: &staticCredentials{header: "X-API-Key", value: "key"},
+		tenants:  map[string]credentials{"a": provider},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	a.apply("a", req)
+	if !a.retryUnauthorized("a", req) || req.Header.Get("Authorization") != "Bearer fresh" {
+		t.Errorf("retried request carries %q, want the refreshed token", req.Header.Get("Authorization"))
+	}
+
+	// Static credentials do not change, so a 401 is not retried
+	req = httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	a.apply("b", req)
+	if req.Header.Get("X-API-Key") != "key" || a.retryUnauthorized("b", req) {
+		t.Errorf("tenant without its own credentials: header %q, want key and no retry", req.Header.Get("X-API-Key"))
+	}
+
+	var none *authenticator
+	if none.retryUnauthorized("a", req) {
+		t.Errorf("unauthenticated requests are retried")
+	}
+}
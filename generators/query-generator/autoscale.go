@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// defaultWorkerJitter bounds the random delay before a worker's first request
+const defaultWorkerJitter = time.Second
+
+// WorkerStartConfig spreads the first requests of a query's workers
+type WorkerStartConfig struct {
+	Jitter  string `yaml:"jitter"`  // Random delay up to this before a worker's first request (default: 1s, "0s" = none)
+	Stagger string `yaml:"stagger"` // Initial worker i starts at (i-1) x stagger, before its jitter (default: 0 = together)
+}
+
+// workerStart is the parsed WorkerStartConfig
+type workerStart struct {
+	jitter, stagger time.Duration
+}
+
+// newWorkerStart validates the worker start config
+func newWorkerStart(cfg WorkerStartConfig) (workerStart, error) {
+	s := workerStart{jitter: defaultWorkerJitter}
+	if cfg.Jitter != "" {
+		d, err := time.ParseDuration(cfg.Jitter)
+		if err != nil || d < 0 {
+			return s, fmt.Errorf("invalid jitter %q", cfg.Jitter)
+		}
+		s.jitter = d
+	}
+	if cfg.Stagger != "" {
+		d, err := time.ParseDuration(cfg.Stagger)
+		if err != nil || d < 0 {
+			return s, fmt.Errorf("invalid stagger %q", cfg.Stagger)
+		}
+		s.stagger = d
+	}
+	return s, nil
+}
+
+// wait delays the first request of worker id; only the initial workers of a pool are staggered,
+// workers added later by the autoscaler or control API just get the jitter. False when ctx ends first.
+func (s workerStart) wait(ctx context.Context, id, initial int) bool {
+	var delay time.Duration
+	if id <= initial {
+		delay = time.Duration(id-1) * s.stagger
+	}
+	if s.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// autoscaleSamples is the number of limiter/idle samples averaged per scaling decision
+const autoscaleSamples = 10
+
+// AutoscaleConfig grows and shrinks the worker pool of each query within bounds
+type AutoscaleConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	MinWorkers int    `yaml:"minWorkers"` // Default: 1
+	MaxWorkers int    `yaml:"maxWorkers"` // Default: 4x concurrentQueries
+	Interval   string `yaml:"interval"`   // How often the pool size is reconsidered (default: 10s)
+}
+
+// workerPool runs the workers of one executor and, when autoscaling, adjusts their number:
+// limiter tokens left unconsumed while no worker waits for one mean the server is too slow for
+// the current concurrency, workers waiting on the limiter mean there are more than needed
+type workerPool struct {
+	name    string
+	limiter *rate.Limiter
+	spawn   func(id int)
+
+	minWorkers, maxWorkers int
+	interval               time.Duration
+
+	mu           sync.Mutex
+	workers      int // running workers
+	pendingExits int // workers asked to exit that have not yet done so
+	nextID       int
+
+	idle int64 // workers currently waiting on the limiter (atomic)
+}
+
+// newWorkerPool creates the pool; spawn runs a worker and must call exited when it returns
+func newWorkerPool(name string, cfg AutoscaleConfig, initial int, limiter *rate.Limiter, spawn func(id int)) (*workerPool, error) {
+	p := &workerPool{name: name, limiter: limiter, spawn: spawn, minWorkers: initial, maxWorkers: initial}
+	if !cfg.Enabled {
+		return p, nil
+	}
+
+	p.minWorkers, p.maxWorkers = cfg.MinWorkers, cfg.MaxWorkers
+	if p.minWorkers <= 0 {
+		p.minWorkers = 1
+	}
+	if p.maxWorkers <= 0 {
+		p.maxWorkers = 4 * initial
+	}
+	if p.maxWorkers < p.minWorkers {
+		return nil, fmt.Errorf("autoscale.maxWorkers (%d) must be >= minWorkers (%d)", p.maxWorkers, p.minWorkers)
+	}
+	p.interval = 10 * time.Second
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid autoscale.interval %q", cfg.Interval)
+		}
+		p.interval = d
+	}
+	return p, nil
+}
+
+// start launches the initial workers, clamped to the pool bounds, and the autoscaler if enabled
+func (p *workerPool) start(ctx context.Context, initial int) {
+	if initial < p.minWorkers {
+		initial = p.minWorkers
+	}
+	if initial > p.maxWorkers {
+		initial = p.maxWorkers
+	}
+	for i := 0; i < initial; i++ {
+		p.add()
+	}
+	if p.interval > 0 {
+		log.Printf("Autoscaling workers for %s between %d and %d every %s", p.name, p.minWorkers, p.maxWorkers, p.interval)
+		go p.autoscale(ctx)
+	}
+}
+
+// add starts one worker
+func (p *workerPool) add() {
+	p.mu.Lock()
+	p.workers++
+	p.nextID++
+	id := p.nextID
+	workersGauge.WithLabelValues(p.name).Set(float64(p.workers))
+	p.mu.Unlock()
+
+	job.workerStarted()
+	go p.spawn(id)
+}
+
+// setWorkers grows or shrinks the pool to n workers; surplus workers exit after their
+// current request
+func (p *workerPool) setWorkers(n int) {
+	p.mu.Lock()
+	current := p.workers - p.pendingExits
+	if n < current {
+		p.pendingExits += current - n
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	for i := current; i < n; i++ {
+		p.add()
+	}
+}
+
+// size returns the number of running workers
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.workers
+}
+
+// draining returns the number of workers asked to exit that are finishing their request
+func (p *workerPool) draining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pendingExits
+}
+
+// autoscaled reports whether the autoscaler manages the pool size
+func (p *workerPool) autoscaled() bool {
+	return p.interval > 0
+}
+
+// shouldExit is polled by workers between requests and consumes one pending scale-down
+func (p *workerPool) shouldExit() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pendingExits == 0 {
+		return false
+	}
+	p.pendingExits--
+	return true
+}
+
+// exited records that a worker returned
+func (p *workerPool) exited() {
+	p.mu.Lock()
+	p.workers--
+	workersGauge.WithLabelValues(p.name).Set(float64(p.workers))
+	p.mu.Unlock()
+	job.workerDone()
+}
+
+// waitLimiter waits for a limiter token, tracking how many workers are idle
+func (p *workerPool) waitLimiter(ctx context.Context) error {
+	atomic.AddInt64(&p.idle, 1)
+	defer atomic.AddInt64(&p.idle, -1)
+	return p.limiter.Wait(ctx)
+}
+
+// autoscale samples the limiter and idle workers and resizes the pool every interval
+func (p *workerPool) autoscale(ctx context.Context) {
+	ticker := time.NewTicker(p.interval / autoscaleSamples)
+	defer ticker.Stop()
+
+	var tokens, idle float64
+	samples := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		tokens += p.limiter.Tokens()
+		idle += float64(atomic.LoadInt64(&p.idle))
+		samples++
+		if samples < autoscaleSamples {
+			continue
+		}
+		p.resize(tokens/float64(samples), idle/float64(samples))
+		tokens, idle, samples = 0, 0, 0
+	}
+}
+
+// resize applies one scaling decision from the averaged samples
+func (p *workerPool) resize(avgTokens, avgIdle float64) {
+	p.mu.Lock()
+	current := p.workers - p.pendingExits
+	switch {
+	case avgTokens >= 1 && avgIdle < 0.5 && current < p.maxWorkers:
+		// Tokens go unconsumed and nobody is waiting for them: every worker is stuck in a request
+		step := current / 4
+		if step < 1 {
+			step = 1
+		}
+		if current+step > p.maxWorkers {
+			step = p.maxWorkers - current
+		}
+		p.mu.Unlock()
+		log.Printf("Autoscale %s: %d -> %d workers (unconsumed tokens: %.1f)", p.name, current, current+step, avgTokens)
+		for i := 0; i < step; i++ {
+			p.add()
+		}
+	case avgIdle >= 1.5 && current > p.minWorkers:
+		// Several workers wait on the limiter at any time: more than needed for the target QPS
+		step := int(avgIdle / 2)
+		if step < 1 {
+			step = 1
+		}
+		if current-step < p.minWorkers {
+			step = current - p.minWorkers
+		}
+		p.pendingExits += step
+		p.mu.Unlock()
+		log.Printf("Autoscale %s: %d -> %d workers (idle workers: %.1f)", p.name, current, current-step, avgIdle)
+	default:
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// testWorkerPool returns a pool of initial idle workers that never send requests
+func testWorkerPool(t *testing.T, cfg AutoscaleConfig, initial int) *workerPool {
+	t.Helper()
+	saved := workersGauge
+	workersGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"name"})
+	t.Cleanup(func() { workersGauge = saved })
+
+	p, err := newWorkerPool("q", cfg, initial, rate.NewLimiter(1, 1), func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < initial; i++ {
+		p.add()
+	}
+	return p
+}
+
+func TestNewWorkerPool(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      AutoscaleConfig
+		min, max int
+		interval time.Duration
+		ok       bool
+	}{
+		{"static", AutoscaleConfig{MinWorkers: 2, MaxWorkers: 20}, 4, 4, 0, true},
+		{"defaults", AutoscaleConfig{Enabled: true}, 1, 16, 10 * time.Second, true},
+		{"bounds", AutoscaleConfig{Enabled: true, MinWorkers: 2, MaxWorkers: 6, Interval: "30s"}, 2, 6, 30 * time.Second, true},
+		{"max below min", AutoscaleConfig{Enabled: true, MinWorkers: 8, MaxWorkers: 6}, 0, 0, 0, false},
+		{"invalid interval", AutoscaleConfig{Enabled: true, Interval: "0s"}, 0, 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := newWorkerPool("q", tc.cfg, 4, nil, nil)
+			if (err == nil) != tc.ok {
+				t.Fatalf("newWorkerPool = %v, want ok: %v", err, tc.ok)
+			}
+			if !tc.ok {
+				return
+			}
+			if p.minWorkers != tc.min || p.maxWorkers != tc.max || p.interval != tc.interval {
+				t.Errorf("pool = %d-%d workers every %s, want %d-%d every %s",
+					p.minWorkers, p.maxWorkers, p.interval, tc.min, tc.max, tc.interval)
+			}
+			if p.autoscaled() != (tc.interval > 0) {
+				t.Errorf("autoscaled = %v, want %v", p.autoscaled(), tc.interval > 0)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		workers   int
+		avgTokens float64
+		avgIdle   float64
+		want      int
+	}{
+		{"unconsumed tokens grow by a quarter", 8, 2, 0, 10},
+		{"grow by at least one", 2, 1, 0, 3},
+		{"grow up to max", 11, 5, 0, 12},
+		{"at max", 12, 5, 0, 12},
+		{"unconsumed tokens with waiting workers", 8, 2, 1, 8},
+		{"idle workers shrink", 8, 0, 5, 6},
+		{"shrink by at least one", 8, 0, 1.5, 7},
+		{"shrink down to min", 3, 0, 10, 2},
+		{"at min", 2, 0, 10, 2},
+		{"balanced", 8, 0.5, 1, 8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := testWorkerPool(t, AutoscaleConfig{Enabled: true, MinWorkers: 2, MaxWorkers: 12}, tc.workers)
+			p.resize(tc.avgTokens, tc.avgIdle)
+			if got := p.size() - p.draining(); got != tc.want {
+				t.Errorf("workers after resize = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolScaleDown(t *testing.T) {
+	p := testWorkerPool(t, AutoscaleConfig{}, 4)
+	p.setWorkers(2)
+	if p.draining() != 2 {
+		t.Fatalf("draining = %d, want 2", p.draining())
+	}
+	// Surplus workers exit between requests, one per pending scale-down
+	for i, want := range []bool{true, true, false} {
+		if got := p.shouldExit(); got != want {
+			t.Errorf("shouldExit %d = %v, want %v", i, got, want)
+		}
+	}
+	p.exited()
+	p.exited()
+	if p.size() != 2 || p.draining() != 0 {
+		t.Errorf("pool = %d workers, %d draining, want 2 and 0", p.size(), p.draining())
+	}
+
+	p.setWorkers(5)
+	if p.size() != 5 {
+		t.Errorf("workers after growing = %d, want 5", p.size())
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultBucketProbeTraceQL      = "{}"
+	defaultBucketProbeInterval     = time.Minute
+	defaultBucketProbeEmptyResults = 20
+)
+
+// BucketProbeConfig decides bucket eligibility from observed data instead of the time elapsed
+// since the data epoch, for pre-seeded clusters and write generators that start late
+type BucketProbeConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	TraceQL      string `yaml:"traceql"`      // Cheap query run over each bucket's range (default: {})
+	Interval     string `yaml:"interval"`     // How often buckets without data are probed again (default: 1m)
+	EmptyResults int    `yaml:"emptyResults"` // Consecutive empty results in an eligible bucket that trigger a re-probe (default: 20)
+}
+
+// bucketProbes decides bucket eligibility (nil when disabled)
+var bucketProbes *bucketProber
+
+// bucketProber searches each bucket's range for any trace. A bucket is eligible once a probe
+// found data in it; a run of empty results of its queries probes it again, and the bucket is
+// eligible no longer if the probe finds nothing either.
+type bucketProber struct {
+	buckets      []timeBucket
+	traceql      string
+	interval     time.Duration
+	emptyResults int
+	client       *probeClient
+
+	mu     sync.Mutex
+	states map[string]*bucketProbeState
+
+	reprobe chan string // buckets to probe again after empty results
+
+	eligibleGauge *prometheus.GaugeVec
+	probes        *prometheus.CounterVec
+}
+
+// bucketProbeState is the eligibility of a bucket and the empty results seen since
+type bucketProbeState struct {
+	hasData   bool
+	empty     int  // consecutive empty results of the bucket's queries
+	reprobing bool // a re-probe is queued
+}
+
+// newBucketProber validates the config; the probes query the first tenant
+func newBucketProber(cfg BucketProbeConfig, buckets []timeBucket, transport http.RoundTripper, timeout time.Duration, target, endpoint, tenant, timeFormat string) (*bucketProber, error) {
+	p := &bucketProber{
+		buckets:      buckets,
+		traceql:      cfg.TraceQL,
+		interval:     defaultBucketProbeInterval,
+		emptyResults: cfg.EmptyResults,
+		states:       make(map[string]*bucketProbeState, len(buckets)),
+		reprobe:      make(chan string, len(buckets)),
+	}
+	if p.traceql == "" {
+		p.traceql = defaultBucketProbeTraceQL
+	}
+	if err := validateTraceQL(p.traceql); err != nil {
+		return nil, fmt.Errorf("invalid traceql %q: %v", p.traceql, err)
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval %q", cfg.Interval)
+		}
+		p.interval = d
+	}
+	if p.emptyResults < 0 {
+		return nil, fmt.Errorf("emptyResults must be >= 0, got %d", p.emptyResults)
+	}
+	if p.emptyResults == 0 {
+		p.emptyResults = defaultBucketProbeEmptyResults
+	}
+	for _, b := range buckets {
+		p.states[b.name] = &bucketProbeState{}
+	}
+	p.client = newProbeClient(transport, timeout, target, endpoint, tenant, timeFormat)
+
+	p.eligibleGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_probe",
+		Name:      "eligible",
+		Help:      "Whether the last probe of the bucket found data (1) or not (0); plan entries of ineligible buckets run immediate",
+	}, []string{"bucket"})
+	p.probes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_probe",
+		Name:      "probes_total",
+		Help:      "Bucket probes by bucket and result (data, empty, error)",
+	}, []string{"bucket", "result"})
+	for _, b := range buckets {
+		p.eligibleGauge.WithLabelValues(b.name).Set(0)
+	}
+	return p, nil
+}
+
+// eligible reports whether the last probe of the bucket found data
+func (p *bucketProber) eligible(bucketName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.states[bucketName]
+	return ok && state.hasData
+}
+
+// probeAll probes every bucket once, so the load starts with the eligibility of the data
+// already there
+func (p *bucketProber) probeAll() {
+	for i := range p.buckets {
+		p.probe(&p.buckets[i])
+	}
+}
+
+// run probes the buckets without data every interval, and the buckets queued after empty
+// results as they come, until ctx is done
+func (p *bucketProber) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-p.reprobe:
+			for i := range p.buckets {
+				if p.buckets[i].name == name {
+					p.probe(&p.buckets[i])
+				}
+			}
+		case <-ticker.C:
+			for i := range p.buckets {
+				if !p.eligible(p.buckets[i].name) {
+					p.probe(&p.buckets[i])
+				}
+			}
+		}
+	}
+}
+
+// probe searches the bucket's whole range for one trace and updates its eligibility; a failed
+// probe keeps the current state
+func (p *bucketProber) probe(b *timeBucket) {
+	now := time.Now()
+	hasData := false
+	if !b.absolute() || b.start.Before(now) {
+		start, end := b.bounds(now)
+		resp, err := p.client.search(p.traceql, start, end, 1)
+		if err != nil {
+			p.probes.WithLabelValues(b.name, "error").Inc()
+			log.Printf("Warning: Probe of bucket %s failed: %s", b.name, redaction.error(err))
+			p.mu.Lock()
+			p.states[b.name].reprobing = false
+			p.mu.Unlock()
+			return
+		}
+		hasData = len(resp.Traces) > 0
+	}
+	if hasData {
+		p.probes.WithLabelValues(b.name, "data").Inc()
+	} else {
+		p.probes.WithLabelValues(b.name, "empty").Inc()
+	}
+
+	p.mu.Lock()
+	state := p.states[b.name]
+	changed := state.hasData != hasData
+	state.hasData = hasData
+	state.empty = 0
+	state.reprobing = false
+	p.mu.Unlock()
+
+	if hasData {
+		p.eligibleGauge.WithLabelValues(b.name).Set(1)
+	} else {
+		p.eligibleGauge.WithLabelValues(b.name).Set(0)
+	}
+	if changed && hasData {
+		log.Printf("Bucket %s is eligible: the probe found data", b.name)
+	} else if changed {
+		log.Printf("Bucket %s is no longer eligible: the probe found no data", b.name)
+	}
+}
+
+// observe counts the empty results of a bucket's queries and queues a re-probe of the bucket
+// after emptyResults of them in a row
+func (p *bucketProber) observe(sample *requestSample) {
+	if p == nil || sample.Status < 200 || sample.Status >= 300 || sample.Error != "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.states[sample.Bucket]
+	if !ok || !state.hasData {
+		return
+	}
+	if sample.Traces > 0 {
+		state.empty = 0
+		return
+	}
+	state.empty++
+	if state.empty < p.emptyResults || state.reprobing {
+		return
+	}
+	select {
+	case p.reprobe <- sample.Bucket:
+		state.reprobing = true
+	default:
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeBucketConfig represents a time bucket definition from config.
+// A bucket is either relative (ageStart/ageEnd) or absolute (start/end as RFC3339 timestamps).
+type TimeBucketConfig struct {
+	Name     string `yaml:"name"`
+	AgeStart string `yaml:"ageStart"`
+	AgeEnd   string `yaml:"ageEnd"`
+	Start    string `yaml:"start"` // e.g. "2025-11-27T00:00:00Z", or "2025-11-27T00:00:00" in the configured timezone
+	End      string `yaml:"end"`   // e.g. "2025-11-27T06:00:00Z"
+	Weight   int    `yaml:"weight"`
+
+	// Optional query window length range; when set, each query uses a random
+	// window length in [minWindow, maxWindow] placed randomly inside the bucket
+	MinWindow string `yaml:"minWindow"`
+	MaxWindow string `yaml:"maxWindow"`
+
+	// Optional SLO of the bucket's queries, exported as breach counters and compliance ratios
+	SLO BucketSLOConfig `yaml:"slo"`
+
+	// Workers per query dedicated to the bucket's plan entries (default: 0 = shared with the other
+	// buckets), so slow long-range queries cannot starve the other buckets of workers
+	Workers int `yaml:"workers"`
+
+	// Optional overlapping windows sliding forward through the bucket range per worker
+	Slide SlideConfig `yaml:"slide"`
+}
+
+// timeBucket defines a time range for queries
+type timeBucket struct {
+	name     string        // bucket name (e.g., "ingester", "backend-1h")
+	ageStart time.Duration // how far back to end the query window
+	ageEnd   time.Duration // how far back to start the query window
+	start    time.Time     // fixed start of the query window (absolute buckets only)
+	end      time.Time     // fixed end of the query window (absolute buckets only)
+	weight   int           // weight for random selection
+
+	minWindow time.Duration // minimum query window length (0 = whole bucket)
+	maxWindow time.Duration // maximum query window length (0 = whole bucket)
+
+	workers int // workers per query dedicated to the bucket (0 = shared)
+
+	slide *windowSlide // sliding windows per worker (nil = independent windows)
+}
+
+// absolute reports whether the bucket is defined by fixed timestamps
+func (b *timeBucket) absolute() bool {
+	return !b.start.IsZero()
+}
+
+// eligible reports whether data could exist for the bucket. Relative buckets
+// become eligible once the test has run for ageEnd, absolute ones once their start has passed;
+// with bucket probing, once a probe found data in the bucket.
+func (b *timeBucket) eligible(now time.Time, elapsed time.Duration) bool {
+	if bucketProbes != nil {
+		return bucketProbes.eligible(b.name)
+	}
+	if b.absolute() {
+		return b.start.Before(now)
+	}
+	return b.ageEnd <= elapsed
+}
+
+// bounds returns the whole time range of the bucket at the given moment
+func (b *timeBucket) bounds(now time.Time) (time.Time, time.Time) {
+	if b.absolute() {
+		if b.end.After(now) {
+			return b.start, now
+		}
+		return b.start, b.end
+	}
+	return now.Add(-b.ageEnd), now.Add(-b.ageStart)
+}
+
+// windowFor returns the query time range of a worker of a lane: the next window of its slide,
+// or a window picked like window
+func (b *timeBucket) windowFor(lane string, worker int, now time.Time) (time.Time, time.Time) {
+	if b.slide == nil {
+		return b.window(now)
+	}
+	start, end := b.bounds(now)
+	return b.slide.next(lane+"/"+strconv.Itoa(worker), start, end)
+}
+
+// window returns the query time range for the bucket at the given moment
+func (b *timeBucket) window(now time.Time) (time.Time, time.Time) {
+	start, end := b.bounds(now)
+	if b.maxWindow <= 0 {
+		return start, end
+	}
+
+	// Pick a random window length and place it randomly inside the bucket range
+	span := end.Sub(start)
+	length := b.minWindow
+	if b.maxWindow > b.minWindow {
+		length += time.Duration(rand.Int63n(int64(b.maxWindow - b.minWindow + 1)))
+	}
+	if length >= span {
+		return start, end
+	}
+	offset := time.Duration(rand.Int63n(int64(span - length + 1)))
+	start = start.Add(offset)
+	return start, start.Add(length)
+}
+
+// convertTimeBuckets converts config time buckets to internal timeBucket struct; absolute bucket
+// times without a UTC offset are in loc
+func convertTimeBuckets(configBuckets []TimeBucketConfig, loc *time.Location) ([]timeBucket, error) {
+	buckets := make([]timeBucket, 0, len(configBuckets))
+
+	for _, cb := range configBuckets {
+		bucket := timeBucket{
+			name:    cb.Name,
+			weight:  cb.Weight,
+			workers: cb.Workers,
+		}
+		if cb.Workers < 0 {
+			return nil, fmt.Errorf("bucket %s: workers must be >= 0, got %d", cb.Name, cb.Workers)
+		}
+
+		if cb.MinWindow != "" || cb.MaxWindow != "" {
+			minWindow, maxWindow, err := parseWindowRange(cb.MinWindow, cb.MaxWindow)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window length in bucket %s: %v", cb.Name, err)
+			}
+			bucket.minWindow = minWindow
+			bucket.maxWindow = maxWindow
+		}
+
+		slide, err := newWindowSlide(cb.Slide)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slide in bucket %s: %v", cb.Name, err)
+		}
+		if slide != nil && bucket.maxWindow > 0 {
+			return nil, fmt.Errorf("bucket %s: slide cannot be combined with minWindow/maxWindow", cb.Name)
+		}
+		bucket.slide = slide
+
+		if cb.Start != "" || cb.End != "" {
+			if cb.AgeStart != "" || cb.AgeEnd != "" {
+				return nil, fmt.Errorf("bucket %s: start/end cannot be combined with ageStart/ageEnd", cb.Name)
+			}
+
+			start, err := parseBucketTime(cb.Start, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start timestamp in bucket %s: %v", cb.Name, err)
+			}
+
+			end, err := parseBucketTime(cb.End, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid end timestamp in bucket %s: %v", cb.Name, err)
+			}
+
+			if !start.Before(end) {
+				return nil, fmt.Errorf("bucket %s: start must be before end", cb.Name)
+			}
+
+			bucket.start = start
+			bucket.end = end
+			buckets = append(buckets, bucket)
+			continue
+		}
+
+		ageStart, err := parseExtendedDuration(cb.AgeStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ageStart duration in bucket %s: %v", cb.Name, err)
+		}
+
+		ageEnd, err := parseExtendedDuration(cb.AgeEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ageEnd duration in bucket %s: %v", cb.Name, err)
+		}
+
+		bucket.ageStart = ageStart
+		bucket.ageEnd = ageEnd
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+// parseWindowRange parses a min/max window length pair; a missing bound defaults to the other one
+func parseWindowRange(minStr, maxStr string) (time.Duration, time.Duration, error) {
+	if minStr == "" {
+		minStr = maxStr
+	}
+	if maxStr == "" {
+		maxStr = minStr
+	}
+
+	minWindow, err := parseExtendedDuration(minStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("minWindow: %v", err)
+	}
+	maxWindow, err := parseExtendedDuration(maxStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("maxWindow: %v", err)
+	}
+	if minWindow <= 0 || maxWindow < minWindow {
+		return 0, 0, fmt.Errorf("need 0 < minWindow <= maxWindow, got %s and %s", minWindow, maxWindow)
+	}
+	return minWindow, maxWindow, nil
+}
+
+// selectTimeBucket selects a time bucket based on weighted random selection
+// Only buckets where data could exist are considered
+func selectTimeBucket(buckets []timeBucket, testStartTime time.Time) *timeBucket {
+	now := time.Now()
+	elapsed := now.Sub(testStartTime)
+
+	// Filter to only buckets where data could exist
+	var eligible []timeBucket
+	for _, bucket := range buckets {
+		if bucket.eligible(now, elapsed) {
+			eligible = append(eligible, bucket)
+		}
+	}
+
+	// If no buckets are eligible yet, return nil
+	if len(eligible) == 0 {
+		return nil
+	}
+
+	// Weighted selection from eligible buckets only
+	totalWeight := 0
+	for _, bucket := range eligible {
+		totalWeight += bucket.weight
+	}
+
+	r := rand.Intn(totalWeight)
+	cumulative := 0
+	for i := range eligible {
+		cumulative += eligible[i].weight
+		if r < cumulative {
+			return &eligible[i]
+		}
+	}
+	return &eligible[0]
+}
+
+// Day and week components of extended durations, and ISO-8601 durations without years/months
+var (
+	dayWeekComponent = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)([dw])`)
+	isoDuration      = regexp.MustCompile(`^P(?:([0-9.]+)W)?(?:([0-9.]+)D)?(?:T(?:([0-9.]+)H)?(?:([0-9.]+)M)?(?:([0-9.]+)S)?)?$`)
+)
+
+// parseExtendedDuration parses a Go duration that may also use days and weeks ("2d", "1w3d12h"),
+// or an ISO-8601 duration ("P2D", "P1DT12H", "PT30M"). Years and months are rejected because
+// their length varies.
+func parseExtendedDuration(s string) (time.Duration, error) {
+	if strings.HasPrefix(s, "P") {
+		return parseISODuration(s)
+	}
+	converted := dayWeekComponent.ReplaceAllStringFunc(s, func(c string) string {
+		m := dayWeekComponent.FindStringSubmatch(c)
+		v, _ := strconv.ParseFloat(m[1], 64)
+		hours := v * 24
+		if m[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	d, err := time.ParseDuration(converted)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (expected e.g. 90s, 6h, 2d, 1w or P1DT12H)", s)
+	}
+	return d, nil
+}
+
+// parseISODuration parses an ISO-8601 duration with week, day, hour, minute and second components
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q (years and months are not supported)", s)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q", s)
+		}
+		total += time.Duration(v * float64(unit))
+	}
+	return total, nil
+}
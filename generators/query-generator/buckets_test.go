@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExtendedDuration(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"90s", 90 * time.Second},
+		{"6h", 6 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 2 * day},
+		{"1.5d", 36 * time.Hour},
+		{"1w", 7 * day},
+		{"1w2d", 9 * day},
+		{"2d12h", 60 * time.Hour},
+		{"0.5w", 84 * time.Hour},
+		{"P1D", day},
+		{"P1W", 7 * day},
+		{"PT12H", 12 * time.Hour},
+		{"P1DT12H", 36 * time.Hour},
+		{"PT1H30M15S", time.Hour + 30*time.Minute + 15*time.Second},
+		{"PT0.5S", 500 * time.Millisecond},
+		{"P1W1DT1H1M1S", 8*day + time.Hour + time.Minute + time.Second},
+	} {
+		got, err := parseExtendedDuration(tc.in)
+		if err != nil {
+			t.Errorf("parseExtendedDuration(%s) = %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseExtendedDuration(%s) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseExtendedDurationInvalid(t *testing.T) {
+	for _, in := range []string{"", "d", "2x", "1y", "P", "PT", "P1Y", "P1M", "P1DT", "PT1D", "P1H", "P1.2.3D", "1dd"} {
+		if d, err := parseExtendedDuration(in); err == nil {
+			t.Errorf("parseExtendedDuration(%q) = %s, want an error", in, d)
+		}
+	}
+}
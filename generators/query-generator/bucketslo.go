@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// latencySLOObjective is the fraction of requests that must meet a bucket's maxP99
+const latencySLOObjective = 0.99
+
+// BucketSLOConfig declares the SLO of the queries of one time bucket, e.g. p99 < 1s for recent
+// (ingester) data and p99 < 10s for backend data
+type BucketSLOConfig struct {
+	MaxP99       string  `yaml:"maxP99"`       // p99 latency objective (empty = not checked)
+	MaxErrorRate float64 `yaml:"maxErrorRate"` // Maximum fraction of failed requests (0 = not checked)
+}
+
+// bucketSLOs tracks the per-bucket SLOs (nil when no bucket declares one)
+var bucketSLOs *bucketSLOTracker
+
+// bucketSLOTracker counts requests and SLO breaches per time bucket over the whole run
+type bucketSLOTracker struct {
+	mu      sync.Mutex
+	buckets map[string]*bucketSLO
+	order   []string // bucket names in config order, for stable violation reports
+}
+
+// bucketSLO is the SLO and outcome counts of one time bucket
+type bucketSLO struct {
+	maxP99       time.Duration
+	maxErrorRate float64
+
+	requests, slow, failed int64
+
+	requestsCounter prometheus.Counter
+	slowCounter     prometheus.Counter
+	failedCounter   prometheus.Counter
+	latencyRatio    prometheus.Gauge
+	errorsRatio     prometheus.Gauge
+}
+
+// newBucketSLOTracker validates the bucket SLOs; it returns nil when no bucket declares one
+func newBucketSLOTracker(configs []TimeBucketConfig) (*bucketSLOTracker, error) {
+	requests := promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_slo",
+		Name:      "requests_total",
+		Help:      "Requests of time buckets with an SLO",
+	}, []string{"bucket"})
+	breaches := promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_slo",
+		Name:      "breaches_total",
+		Help:      "Requests breaching their bucket's SLO, by slo (latency: slower than maxP99, errors: failed)",
+	}, []string{"bucket", "slo"})
+	compliance := promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_slo",
+		Name:      "compliance_ratio",
+		Help:      "Fraction of a bucket's requests meeting its SLO since the start of the run, by slo",
+	}, []string{"bucket", "slo"})
+	objective := promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "bucket_slo",
+		Name:      "objective_ratio",
+		Help:      "Compliance ratio a bucket's SLO requires, by slo",
+	}, []string{"bucket", "slo"})
+
+	t := &bucketSLOTracker{buckets: make(map[string]*bucketSLO)}
+	for _, cfg := range configs {
+		if cfg.SLO.MaxP99 == "" && cfg.SLO.MaxErrorRate == 0 {
+			continue
+		}
+		s := &bucketSLO{
+			maxErrorRate:    cfg.SLO.MaxErrorRate,
+			requestsCounter: requests.WithLabelValues(cfg.Name),
+		}
+		if cfg.SLO.MaxP99 != "" {
+			d, err := time.ParseDuration(cfg.SLO.MaxP99)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("bucket %s: invalid slo.maxP99 %q", cfg.Name, cfg.SLO.MaxP99)
+			}
+			s.maxP99 = d
+			s.slowCounter = breaches.WithLabelValues(cfg.Name, "latency")
+			s.latencyRatio = compliance.WithLabelValues(cfg.Name, "latency")
+			objective.WithLabelValues(cfg.Name, "latency").Set(latencySLOObjective)
+		}
+		if s.maxErrorRate < 0 || s.maxErrorRate >= 1 {
+			return nil, fmt.Errorf("bucket %s: slo.maxErrorRate must be in [0, 1)", cfg.Name)
+		}
+		if s.maxErrorRate > 0 {
+			s.failedCounter = breaches.WithLabelValues(cfg.Name, "errors")
+			s.errorsRatio = compliance.WithLabelValues(cfg.Name, "errors")
+			objective.WithLabelValues(cfg.Name, "errors").Set(1 - s.maxErrorRate)
+		}
+		t.buckets[cfg.Name] = s
+		t.order = append(t.order, cfg.Name)
+	}
+	if len(t.buckets) == 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// record adds the outcome of a request of the given bucket
+func (t *bucketSLOTracker) record(bucket string, latency time.Duration, failed bool) {
+	if t == nil {
+		return
+	}
+	s, ok := t.buckets[bucket]
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.requests++
+	s.requestsCounter.Inc()
+	if s.maxP99 > 0 {
+		if latency > s.maxP99 {
+			s.slow++
+			s.slowCounter.Inc()
+		}
+		s.latencyRatio.Set(1 - float64(s.slow)/float64(s.requests))
+	}
+	if s.maxErrorRate > 0 {
+		if failed {
+			s.failed++
+			s.failedCounter.Inc()
+		}
+		s.errorsRatio.Set(1 - float64(s.failed)/float64(s.requests))
+	}
+}
+
+// violations returns the buckets whose SLO was not met over the run
+func (t *bucketSLOTracker) violations() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var violations []string
+	for _, name := range t.order {
+		s := t.buckets[name]
+		if s.requests == 0 {
+			continue
+		}
+		if within := 1 - float64(s.slow)/float64(s.requests); s.maxP99 > 0 && within < latencySLOObjective {
+			violations = append(violations, fmt.Sprintf("bucket %s: p99 > %s (%.2f%% of requests within)", name, s.maxP99, within*100))
+		}
+		if rate := float64(s.failed) / float64(s.requests); s.maxErrorRate > 0 && rate > s.maxErrorRate {
+			violations = append(violations, fmt.Sprintf("bucket %s: error rate %.2f%% > %.2f%%", name, rate*100, s.maxErrorRate*100))
+		}
+	}
+	return violations
+}
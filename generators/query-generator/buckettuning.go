@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the latency bucket recommendations
+var defaultTuningPercentiles = []float64{0.5, 0.9, 0.95, 0.99, 0.999}
+
+const (
+	defaultTuningBuckets  = 12
+	defaultTuningInterval = 10 * time.Minute
+)
+
+// BucketTuningConfig recommends latency histogram buckets from the latencies observed per
+// query, since the default layout is often all too small or all too large for a cluster
+type BucketTuningConfig struct {
+	Enabled     bool      `yaml:"enabled"`
+	Percentiles []float64 `yaml:"percentiles"` // Percentiles a bucket boundary is placed at (default: 0.5, 0.9, 0.95, 0.99, 0.999)
+	Buckets     int       `yaml:"buckets"`     // Buckets per layout (default: 12)
+	Interval    string    `yaml:"interval"`    // How often the recommendations are logged (default: 10m)
+	// Recommendations are written to this file at the end of the run; when it exists at startup,
+	// its combined layout replaces the default buckets of the latency histograms, so the next
+	// phase or run uses the layout the previous one recommended
+	File string `yaml:"file"`
+}
+
+// latencyBuckets tracks latencies for bucket recommendations (nil when disabled)
+var latencyBuckets *bucketTuner
+
+// bucketTuner keeps a compact latency histogram per query to recommend bucket layouts
+type bucketTuner struct {
+	percentiles []float64
+	buckets     int
+	interval    time.Duration
+	file        string
+
+	mu      sync.Mutex
+	queries map[string]*latencyHistogram
+}
+
+// bucketRecommendation is the recommended latency bucket layout of a query ("*" for all queries
+// combined), with the observed percentiles it is based on
+type bucketRecommendation struct {
+	Query       string             `json:"query"`
+	Requests    uint64             `json:"requests"`
+	Percentiles map[string]float64 `json:"percentiles"` // Observed latency by percentile, e.g. "p99"
+	Buckets     []float64          `json:"buckets"`
+}
+
+// tunedBucketsFile is the file written for the next run
+type tunedBucketsFile struct {
+	Combined []float64            `json:"combined"` // Layout of the latency histograms of the next run
+	Queries  map[string][]float64 `json:"queries"`  // Per-query layouts, for reference
+}
+
+// newBucketTuner validates the config (nil when disabled)
+func newBucketTuner(cfg BucketTuningConfig) (*bucketTuner, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	t := &bucketTuner{
+		percentiles: cfg.Percentiles,
+		buckets:     cfg.Buckets,
+		interval:    defaultTuningInterval,
+		file:        cfg.File,
+		queries:     make(map[string]*latencyHistogram),
+	}
+	if len(t.percentiles) == 0 {
+		t.percentiles = defaultTuningPercentiles
+	}
+	for _, p := range t.percentiles {
+		if p <= 0 || p >= 1 {
+			return nil, fmt.Errorf("percentiles must be between 0 and 1, got %g", p)
+		}
+	}
+	if t.buckets == 0 {
+		t.buckets = defaultTuningBuckets
+	}
+	if t.buckets < len(t.percentiles)+2 {
+		return nil, fmt.Errorf("buckets must be at least the number of percentiles + 2, got %d", t.buckets)
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval %q", cfg.Interval)
+		}
+		t.interval = d
+	}
+	return t, nil
+}
+
+// loadTunedBuckets returns the combined layout of a recommendations file, or nil when the file
+// does not exist yet
+func loadTunedBuckets(path string) ([]float64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f tunedBucketsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := 1; i < len(f.Combined); i++ {
+		if f.Combined[i] <= f.Combined[i-1] {
+			return nil, fmt.Errorf("%s: buckets must be increasing", path)
+		}
+	}
+	return f.Combined, nil
+}
+
+// record adds the latency of a successful request
+func (t *bucketTuner) record(sample *requestSample) {
+	if t == nil || sample.Throttled || sample.failed() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.queries[sample.Query]
+	if h == nil {
+		h = &latencyHistogram{}
+		t.queries[sample.Query] = h
+	}
+	h.observe(sample.LatencySeconds)
+}
+
+// run logs the recommendations every interval until ctx is done
+func (t *bucketTuner) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range t.recommendations() {
+				log.Printf("Recommended latency buckets for %s (%d requests): %s", r.Query, r.Requests, formatBuckets(r.Buckets))
+			}
+		}
+	}
+}
+
+// recommendations returns the layout of every query with requests, sorted by name, followed
+// by the combined layout
+func (t *bucketTuner) recommendations() []bucketRecommendation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.queries))
+	for name := range t.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []bucketRecommendation
+	var combined latencyHistogram
+	for _, name := range names {
+		h := t.queries[name]
+		combined.merge(h)
+		results = append(results, t.recommend(name, h))
+	}
+	if len(names) > 1 {
+		results = append(results, t.recommend("*", &combined))
+	}
+	return results
+}
+
+// recommend places bucket boundaries at the observed percentiles and spreads the rest evenly
+// on a log scale from half the fastest to twice the slowest latency
+func (t *bucketTuner) recommend(query string, h *latencyHistogram) bucketRecommendation {
+	r := bucketRecommendation{Query: query, Requests: h.total, Percentiles: make(map[string]float64, len(t.percentiles))}
+	bounds := make(map[float64]bool, t.buckets)
+	for _, p := range t.percentiles {
+		v := h.quantile(p)
+		r.Percentiles["p"+strconv.FormatFloat(p*100, 'g', 6, 64)] = v
+		bounds[roundSignificant(v, 2)] = true
+	}
+	lo := h.quantile(0.001) / 2
+	if lo < latencyHistMin {
+		lo = latencyHistMin
+	}
+	hi := h.quantile(1) * 2
+	if hi <= lo {
+		hi = lo * 10
+	}
+	spread := t.buckets - len(bounds)
+	for i := 0; i < spread; i++ {
+		v := lo * math.Pow(hi/lo, float64(i)/float64(spread-1))
+		bounds[roundSignificant(v, 2)] = true
+	}
+	for v := range bounds {
+		r.Buckets = append(r.Buckets, v)
+	}
+	sort.Float64s(r.Buckets)
+	return r
+}
+
+// writeFile writes the recommendations for the next run; the combined layout is the layout of
+// the only query when there is one
+func (t *bucketTuner) writeFile() error {
+	if t == nil || t.file == "" {
+		return nil
+	}
+	recommendations := t.recommendations()
+	if len(recommendations) == 0 {
+		return nil
+	}
+	f := tunedBucketsFile{Queries: make(map[string][]float64, len(recommendations))}
+	for _, r := range recommendations {
+		if r.Query == "*" {
+			continue
+		}
+		f.Queries[r.Query] = r.Buckets
+	}
+	f.Combined = recommendations[len(recommendations)-1].Buckets
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.file, append(data, '\n'), 0o644)
+}
+
+// roundSignificant rounds v to the given number of significant digits
+func roundSignificant(v float64, digits int) float64 {
+	if v <= 0 {
+		return 0
+	}
+	scale := math.Pow(10, float64(digits)-math.Ceil(math.Log10(v)))
+	return math.Round(v*scale) / scale
+}
+
+// formatBuckets formats a layout as a YAML flow list, to paste into a config
+func formatBuckets(buckets []float64) string {
+	parts := make([]string, len(buckets))
+	for i, b := range buckets {
+		parts[i] = strconv.FormatFloat(b, 'g', -1, 64)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// writeBucketRecommendations appends the Markdown latency bucket recommendations
+func writeBucketRecommendations(b *strings.Builder, results []bucketRecommendation) {
+	if len(results) == 0 {
+		return
+	}
+	b.WriteString("\n#### Recommended latency buckets\n\n")
+	b.WriteString("| Query | Requests | Buckets (s) |\n|:--|--:|:--|\n")
+	for _, r := range results {
+		fmt.Fprintf(b, "| `%s` | %d | `%s` |\n", r.Query, r.Requests, formatBuckets(r.Buckets))
+	}
+}
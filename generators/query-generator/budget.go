@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// budget caps the number of requests sent (nil when no maxTotalQueries is set)
+var budget *queryBudget
+
+// queryBudget counts requests against the global query.maxTotalQueries and the per-query
+// maxTotalQueries; a worker whose budget is used exits instead of sending more requests
+type queryBudget struct {
+	mu       sync.Mutex
+	limited  bool  // query.maxTotalQueries is set
+	max      int64 // global cap of this replica when limited
+	used     int64
+	queries  map[string]*queryBudgetCounter
+	open     int  // queries that may still send requests
+	finished bool // every request of the budget has been sent
+}
+
+// queryBudgetCounter is the budget of one query
+type queryBudgetCounter struct {
+	limited bool // the query's maxTotalQueries is set
+	max     int64
+	used    int64
+}
+
+// newQueryBudget validates the budgets of the queries this replica runs; it returns nil when
+// none is set. On a sharded fleet each budget is split across the replicas with shard.split:
+// a query's over the replicas running its plan entries, the global one by share of the plan.
+// A replica whose part is 0 sends nothing for the query (or at all), as if it were used.
+func newQueryBudget(maxTotal int64, queries []QueryConfig, shard planShard, plan []PlanEntry) (*queryBudget, error) {
+	if maxTotal < 0 {
+		return nil, fmt.Errorf("query.maxTotalQueries must be >= 0, got %d", maxTotal)
+	}
+	b := &queryBudget{limited: maxTotal > 0, queries: make(map[string]*queryBudgetCounter)}
+	if b.limited {
+		b.max = shard.split(maxTotal, plan, "")
+	}
+	limited := b.limited
+	for _, q := range queries {
+		if q.MaxTotalQueries < 0 {
+			return nil, fmt.Errorf("query %s: maxTotalQueries must be >= 0, got %d", q.Name, q.MaxTotalQueries)
+		}
+		c := &queryBudgetCounter{limited: q.MaxTotalQueries > 0}
+		if c.limited {
+			c.max = shard.split(q.MaxTotalQueries, plan, q.Name)
+		}
+		b.queries[q.Name] = c
+		limited = limited || c.limited
+	}
+	if !limited {
+		return nil, nil
+	}
+	b.open = len(b.queries)
+	return b, nil
+}
+
+// start settles the budgets this replica got no part of; it runs once the job exists, as a
+// replica with nothing left to send ends (or idles through) the job
+func (b *queryBudget) start() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var empty []string
+	for name, q := range b.queries {
+		if q.limited && q.max == 0 {
+			empty = append(empty, name)
+		}
+	}
+	switch {
+	case b.limited && b.max == 0:
+		b.idle("no part of the query budget on this replica")
+	case len(b.queries) > 0 && len(empty) == len(b.queries):
+		b.idle("no part of any query's budget on this replica")
+	default:
+		for _, name := range empty {
+			log.Printf("Query '%s': no part of its budget on this replica, not sending it", name)
+			job.queryDone(name)
+			b.open--
+		}
+	}
+}
+
+// budgetBounded reports whether maxTotalQueries alone ends a run: a global budget or one per query
+func (c *Config) budgetBounded() bool {
+	if c.Query.MaxTotalQueries > 0 {
+		return true
+	}
+	for _, q := range c.Queries {
+		if q.MaxTotalQueries <= 0 {
+			return false
+		}
+	}
+	return len(c.Queries) > 0
+}
+
+// take reserves a request of a query; false means its budget is used and the worker should exit
+func (b *queryBudget) take(queryName string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queries[queryName]
+	if !ok {
+		q = &queryBudgetCounter{}
+		b.queries[queryName] = q
+	}
+	if b.finished || (q.limited && q.used >= q.max) {
+		return false
+	}
+
+	b.used++
+	q.used++
+	if q.limited && q.used == q.max {
+		log.Printf("Query '%s': budget of %d requests used, stopping its workers", queryName, q.max)
+		job.queryDone(queryName)
+		b.open--
+	}
+	switch {
+	case b.limited && b.used == b.max:
+		b.finish(fmt.Sprintf("query budget of %d requests used", b.max))
+	case b.open == 0:
+		b.finish("every query used its budget")
+	}
+	return true
+}
+
+// idle stops all workers before the first request of a replica left without budget
+func (b *queryBudget) idle(reason string) {
+	b.finished = true
+	if job != nil {
+		job.idleRun(reason)
+		return
+	}
+	log.Printf("Nothing to send on this replica (%s); metrics are still served", reason)
+}
+
+// finish stops all workers: a job ends, a service keeps serving its metrics
+func (b *queryBudget) finish(reason string) {
+	b.finished = true
+	if job != nil {
+		job.end(reason)
+		return
+	}
+	log.Printf("Query budget exhausted (%s), all workers stopped; metrics are still served", reason)
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestQueryBudgetSharded(t *testing.T) {
+	// q1 runs on replicas 0, 3 and 6 of 10; q2 on the others
+	plan := testPlan("q1", "q2", "q2", "q1", "q2", "q2", "q1", "q2", "q2", "q2")
+	queries := []QueryConfig{{Name: "q1", MaxTotalQueries: 100}, {Name: "q2"}}
+
+	var total, global int64
+	for index := 0; index < 10; index++ {
+		shard := planShard{index: index, count: 10}
+		var running []QueryConfig
+		for _, q := range queries {
+			if shard.share(plan, q.Name) > 0 {
+				running = append(running, q)
+			}
+		}
+		b, err := newQueryBudget(5, running, shard, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q, ok := b.queries["q1"]; ok {
+			total += q.max
+		}
+		global += b.max
+	}
+	if total != 100 {
+		t.Errorf("q1 budgets of the fleet add up to %d, want 100", total)
+	}
+	if global != 5 {
+		t.Errorf("global budgets of the fleet add up to %d, want 5", global)
+	}
+}
+
+func TestQueryBudgetTake(t *testing.T) {
+	b, err := newQueryBudget(0, []QueryConfig{{Name: "q1", MaxTotalQueries: 2}, {Name: "q2", MaxTotalQueries: 1}}, planShard{count: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		query string
+		want  bool
+	}{
+		{"q1", true}, {"q1", true}, {"q1", false}, {"q2", true}, {"q2", false},
+	} {
+		if got := b.take(tc.query); got != tc.want {
+			t.Errorf("take %d (%s) = %v, want %v", i, tc.query, got, tc.want)
+		}
+	}
+	if !b.finished {
+		t.Errorf("budget not finished after every query used its own")
+	}
+}
+
+func TestQueryBudgetNoPart(t *testing.T) {
+	// Replica 9 of 10 has the last entry of a 5 request cap: no part of it
+	plan := testPlan("a", "b", "c", "d", "e", "f", "g", "h", "i", "j")
+	b, err := newQueryBudget(5, []QueryConfig{{Name: "j"}}, planShard{index: 9, count: 10}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.start()
+	if b.take("j") {
+		t.Errorf("take succeeded without a part of the budget")
+	}
+
+	// A query budget of 2 over 3 replicas leaves the last without a part of it; q2 still runs there
+	plan = testPlan("q1", "q1", "q1", "q2", "q2", "q2")
+	queries := []QueryConfig{{Name: "q1", MaxTotalQueries: 2}, {Name: "q2", MaxTotalQueries: 3}}
+	b, err = newQueryBudget(0, queries, planShard{index: 2, count: 3}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.start()
+	if got := []int64{b.queries["q1"].max, b.queries["q2"].max}; got[0] != 0 || got[1] != 1 {
+		t.Fatalf("parts = %v, want [0 1]", got)
+	}
+	if b.take("q1") || !b.take("q2") || b.take("q2") {
+		t.Errorf("take does not follow the parts [0 1]")
+	}
+	if !b.finished {
+		t.Errorf("budget not finished once the query with a part used it")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = ""
+)
+
+var phaseFlag = flag.String("phase", "", "Name of the test phase this run belongs to, exported as a label of query_load_test_config_info (env: PHASE)")
+
+// runConfigMetrics are the gauges describing what a run was configured with
+type runConfigMetrics struct {
+	info        *prometheus.GaugeVec
+	targetQPS   prometheus.Gauge
+	concurrency prometheus.Gauge
+	buckets     prometheus.Gauge
+	tenants     prometheus.Gauge
+	queries     prometheus.Gauge
+}
+
+// configMetrics is registered by publishBuildInfo
+var configMetrics *runConfigMetrics
+
+// buildCommit returns the commit given at build time, falling back to the VCS revision Go
+// stamps into binaries built from a checkout
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// runPhase returns the phase selected with --phase or PHASE
+func runPhase() string {
+	if *phaseFlag != "" {
+		return *phaseFlag
+	}
+	return os.Getenv("PHASE")
+}
+
+// publishBuildInfo exports query_load_test_build_info and registers the configuration gauges
+func publishBuildInfo() {
+	promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Name:      "build_info",
+		Help:      "Always 1; labeled with the version, commit and Go version of the generator",
+	}, []string{"version", "commit", "go_version"}).WithLabelValues(version, buildCommit(), runtime.Version()).Set(1)
+
+	newGauge := func(name, help string) prometheus.Gauge {
+		return promauto.NewGauge(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Subsystem: "config",
+			Name:      name,
+			Help:      help,
+		})
+	}
+	configMetrics = &runConfigMetrics{
+		info: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Subsystem: "config",
+			Name:      "info",
+			Help:      "Always 1; labeled with the phase, run mode and query target of the run",
+		}, []string{"phase", "mode", "target"}),
+		targetQPS:   newGauge("target_qps", "Configured total target QPS across all queries"),
+		concurrency: newGauge("concurrency", "Configured workers per query"),
+		buckets:     newGauge("time_buckets", "Number of configured time buckets"),
+		tenants:     newGauge("tenants", "Number of tenants requests are rotated across"),
+		queries:     newGauge("queries", "Number of queries run"),
+	}
+}
+
+// publish sets the configuration gauges; calling it again replaces the previous values
+func (m *runConfigMetrics) publish(phase, mode, target string, targetQPS float64, concurrency, buckets, tenants, queries int) {
+	if m == nil {
+		return
+	}
+	m.info.Reset()
+	m.info.WithLabelValues(phase, mode, target).Set(1)
+	m.targetQPS.Set(targetQPS)
+	m.concurrency.Set(float64(concurrency))
+	m.buckets.Set(float64(buckets))
+	m.tenants.Set(float64(tenants))
+	m.queries.Set(float64(queries))
+}
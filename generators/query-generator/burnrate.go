@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// rollingSlots is the number of slots each rolling window is divided into
+const rollingSlots = 60
+
+// BurnRateConfig configures the error-budget and latency-SLO burn rates computed by the generator
+type BurnRateConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Availability     float64  `yaml:"availability"`     // Availability objective (default: 0.99)
+	LatencyThreshold string   `yaml:"latencyThreshold"` // Requests slower than this count against the latency SLO (default: 1s)
+	LatencyTarget    float64  `yaml:"latencyTarget"`    // Fraction of requests that must be faster than the threshold (default: 0.99)
+	Windows          []string `yaml:"windows"`          // Rolling windows (default: ["5m", "1h"])
+	AlertBurnRate    float64  `yaml:"alertBurnRate"`    // Notify when a burn rate reaches this value (0 = never)
+}
+
+// sloSlot holds the request outcomes of one slot of a rolling window
+type sloSlot struct {
+	total  float64
+	errors float64
+	slow   float64
+}
+
+// rollingWindow aggregates outcomes over a sliding time window
+type rollingWindow struct {
+	name   string
+	width  time.Duration // width of a single slot
+	slots  [rollingSlots]sloSlot
+	epochs [rollingSlots]int64 // slot epoch each slot currently holds
+}
+
+// slot returns the slot for the given time, resetting it if it holds stale data
+func (w *rollingWindow) slot(now time.Time) *sloSlot {
+	epoch := now.UnixNano() / int64(w.width)
+	pos := epoch % rollingSlots
+	if w.epochs[pos] != epoch {
+		w.slots[pos] = sloSlot{}
+		w.epochs[pos] = epoch
+	}
+	return &w.slots[pos]
+}
+
+// sum aggregates all slots within the window
+func (w *rollingWindow) sum(now time.Time) sloSlot {
+	epoch := now.UnixNano() / int64(w.width)
+	var total sloSlot
+	for i := range w.slots {
+		if w.epochs[i] > epoch-rollingSlots {
+			total.total += w.slots[i].total
+			total.errors += w.slots[i].errors
+			total.slow += w.slots[i].slow
+		}
+	}
+	return total
+}
+
+// burnRateTracker computes rolling burn rates per query and exports them as gauges
+type burnRateTracker struct {
+	availability     float64
+	latencyThreshold time.Duration
+	latencyTarget    float64
+	windows          []time.Duration
+	windowNames      []string
+	alertBurnRate    float64
+	notifier         *notifier
+
+	mu        sync.Mutex
+	queries   map[string][]*rollingWindow
+	alerted   map[string]time.Time
+	errorBR   *prometheus.GaugeVec
+	latencyBR *prometheus.GaugeVec
+}
+
+// newBurnRateTracker creates a tracker, applying defaults for unset settings
+func newBurnRateTracker(cfg BurnRateConfig, n *notifier) (*burnRateTracker, error) {
+	t := &burnRateTracker{
+		availability:     cfg.Availability,
+		latencyThreshold: time.Second,
+		latencyTarget:    cfg.LatencyTarget,
+		alertBurnRate:    cfg.AlertBurnRate,
+		notifier:         n,
+		queries:          make(map[string][]*rollingWindow),
+		alerted:          make(map[string]time.Time),
+	}
+	if t.availability <= 0 || t.availability >= 1 {
+		t.availability = 0.99
+	}
+	if t.latencyTarget <= 0 || t.latencyTarget >= 1 {
+		t.latencyTarget = 0.99
+	}
+	if cfg.LatencyThreshold != "" {
+		d, err := time.ParseDuration(cfg.LatencyThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latencyThreshold: %v", err)
+		}
+		t.latencyThreshold = d
+	}
+
+	windows := cfg.Windows
+	if len(windows) == 0 {
+		windows = []string{"5m", "1h"}
+	}
+	for _, w := range windows {
+		d, err := time.ParseDuration(w)
+		if err != nil || d < rollingSlots*time.Millisecond {
+			return nil, fmt.Errorf("invalid burn rate window %q", w)
+		}
+		t.windows = append(t.windows, d)
+		t.windowNames = append(t.windowNames, w)
+	}
+
+	t.errorBR = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "slo",
+		Name:      "error_budget_burn_rate",
+		Help:      "Rate at which the availability error budget is consumed over the window (1 = exactly on budget)",
+	}, []string{"name", "window"})
+	t.latencyBR = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "slo",
+		Name:      "latency_burn_rate",
+		Help:      "Rate at which the latency SLO budget is consumed over the window (1 = exactly on budget)",
+	}, []string{"name", "window"})
+
+	return t, nil
+}
+
+// record adds a request outcome for a query
+func (t *burnRateTracker) record(queryName string, failed bool, latency time.Duration) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	windows, ok := t.queries[queryName]
+	if !ok {
+		for i, d := range t.windows {
+			windows = append(windows, &rollingWindow{name: t.windowNames[i], width: d / rollingSlots})
+		}
+		t.queries[queryName] = windows
+	}
+
+	for _, w := range windows {
+		s := w.slot(now)
+		s.total++
+		if failed {
+			s.errors++
+		} else if latency > t.latencyThreshold {
+			s.slow++
+		}
+	}
+}
+
+// update recomputes the burn-rate gauges and raises alerts
+func (t *burnRateTracker) update() {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for queryName, windows := range t.queries {
+		for i, w := range windows {
+			sum := w.sum(now)
+			if sum.total == 0 {
+				continue
+			}
+			errorBurn := (sum.errors / sum.total) / (1 - t.availability)
+			latencyBurn := (sum.slow / sum.total) / (1 - t.latencyTarget)
+			t.errorBR.WithLabelValues(queryName, w.name).Set(errorBurn)
+			t.latencyBR.WithLabelValues(queryName, w.name).Set(latencyBurn)
+
+			if t.alertBurnRate > 0 {
+				t.maybeAlert(now, queryName, w.name, t.windows[i], "error budget", errorBurn)
+				t.maybeAlert(now, queryName, w.name, t.windows[i], "latency SLO", latencyBurn)
+			}
+		}
+	}
+}
+
+// maybeAlert notifies at most once per window when a burn rate crosses the alert threshold
+func (t *burnRateTracker) maybeAlert(now time.Time, queryName, windowName string, window time.Duration, kind string, burn float64) {
+	if burn < t.alertBurnRate {
+		return
+	}
+	key := queryName + "|" + windowName + "|" + kind
+	if last, ok := t.alerted[key]; ok && now.Sub(last) < window {
+		return
+	}
+	t.alerted[key] = now
+	t.notifier.notify(fmt.Sprintf("Query %s is burning its %s at %.1fx over the last %s", queryName, kind, burn, windowName))
+}
+
+// run periodically updates the burn-rate gauges
+func (t *burnRateTracker) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.update()
+	}
+}
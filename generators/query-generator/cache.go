@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxRememberedWindows bounds how many recent query windows are kept per executor for repeats
+const maxRememberedWindows = 64
+
+// CacheAnalysisConfig configures deliberate repeats of exact queries to measure frontend caching
+type CacheAnalysisConfig struct {
+	RepeatFraction float64 `yaml:"repeatFraction"` // Fraction of queries that repeat a recent query (0 disables)
+	RepeatWithin   string  `yaml:"repeatWithin"`   // Only repeat queries issued within this interval (default: 30s)
+}
+
+// rememberedWindow is a previously issued query window
+type rememberedWindow struct {
+	window   queryWindow
+	issuedAt time.Time
+}
+
+// repeatCache remembers recently issued query windows so they can be re-issued verbatim
+type repeatCache struct {
+	mu       sync.Mutex
+	fraction float64
+	within   time.Duration
+	windows  []rememberedWindow
+	next     int
+}
+
+// newRepeatCache creates a repeat cache, or returns nil when cache analysis is disabled
+func newRepeatCache(cfg CacheAnalysisConfig) (*repeatCache, error) {
+	if cfg.RepeatFraction <= 0 {
+		return nil, nil
+	}
+
+	within := 30 * time.Second
+	if cfg.RepeatWithin != "" {
+		d, err := time.ParseDuration(cfg.RepeatWithin)
+		if err != nil {
+			return nil, err
+		}
+		within = d
+	}
+
+	return &repeatCache{
+		fraction: cfg.RepeatFraction,
+		within:   within,
+	}, nil
+}
+
+// pick returns a recent window to repeat with the configured probability
+func (c *repeatCache) pick(now time.Time) (queryWindow, bool) {
+	if rand.Float64() >= c.fraction {
+		return queryWindow{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var candidates []queryWindow
+	for _, w := range c.windows {
+		if now.Sub(w.issuedAt) <= c.within {
+			candidates = append(candidates, w.window)
+		}
+	}
+	if len(candidates) == 0 {
+		return queryWindow{}, false
+	}
+	return candidates[rand.Intn(len(candidates))], true
+}
+
+// remember records a freshly issued window as a repeat candidate
+func (c *repeatCache) remember(w queryWindow, issuedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := rememberedWindow{window: w, issuedAt: issuedAt}
+	if len(c.windows) < maxRememberedWindows {
+		c.windows = append(c.windows, entry)
+		return
+	}
+	c.windows[c.next] = entry
+	c.next = (c.next + 1) % maxRememberedWindows
+}
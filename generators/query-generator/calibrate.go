@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalibrationConfig configures the calibration stage run before the load starts
+type CalibrationConfig struct {
+	// Run each query once per eligible bucket before the load, record the result counts and
+	// latencies in the report and seed the anomaly detectors with them
+	Enabled bool `yaml:"enabled"`
+}
+
+// calibration holds the results of the calibration stage (empty when disabled)
+var calibration []calibrationResult
+
+// calibrationResult is the baseline of a query in a bucket, measured without load
+type calibrationResult struct {
+	Query          string  `json:"query"`
+	Bucket         string  `json:"bucket"`
+	Spans          int     `json:"spans"`
+	Traces         int     `json:"traces"`
+	Bytes          int     `json:"bytes,omitempty"` // Response size
+	LatencySeconds float64 `json:"latencySeconds"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// calibrate runs each Tempo search query once per bucket eligible now ("immediate" without
+// buckets), one request at a time. clientFor returns the client of a query's class.
+func calibrate(queries []QueryConfig, buckets []timeBucket, dataEpoch time.Time, limit int, clientFor func(QueryConfig) *probeClient) []calibrationResult {
+	var results []calibrationResult
+	seen := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		if seen[q.Name] {
+			continue // duration sweep variants share their query's baselines
+		}
+		seen[q.Name] = true
+		if q.isZipkin() {
+			log.Printf("Calibration: skipping %s, Zipkin queries are not calibrated", q.Name)
+			continue
+		}
+		client := clientFor(q)
+
+		now := time.Now()
+		if len(buckets) == 0 {
+			results = append(results, calibrateOne(client, q, "immediate", time.Time{}, time.Time{}, limit))
+			continue
+		}
+		for i := range buckets {
+			b := &buckets[i]
+			if !b.eligible(now, now.Sub(dataEpoch)) {
+				continue
+			}
+			start, end := b.window(now)
+			results = append(results, calibrateOne(client, q, b.name, start, end, limit))
+		}
+	}
+	return results
+}
+
+// calibrateOne sends a query once and records what it returned
+func calibrateOne(client *probeClient, q QueryConfig, bucketName string, start, end time.Time, limit int) calibrationResult {
+	result := calibrationResult{Query: q.Name, Bucket: bucketName}
+	query := url.Values{}
+	q.setSearchParams(query)
+	params := map[string]string{"limit": strconv.Itoa(limit)}
+	for k := range query {
+		params[k] = query.Get(k)
+	}
+	if !start.IsZero() {
+		params["start"] = formatTimeParam(start, client.timeFormat)
+		params["end"] = formatTimeParam(end, client.timeFormat)
+	}
+
+	begin := time.Now()
+	res, err := client.get(searchURL(client.target, client.endpoint, client.tenant), params)
+	if err == nil {
+		var body []byte
+		body, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		var resp TempoSearchResponse
+		if err == nil {
+			err = json.Unmarshal(body, &resp)
+		}
+		result.Spans, result.Traces, result.Bytes = resp.spanCount(), len(resp.Traces), len(body)
+	}
+	result.LatencySeconds = time.Since(begin).Seconds()
+	if err != nil {
+		result.Error = redaction.error(err)
+		log.Printf("Calibration [%s] %s failed: %s", bucketName, q.Name, result.Error)
+		return result
+	}
+	log.Printf("Calibration [%s] %s: %d spans, %d traces in %.3fs", bucketName, q.Name, result.Spans, result.Traces, result.LatencySeconds)
+	return result
+}
+
+// spanCount returns the spans of every trace, in spanSets (structural queries) or spanSet
+func (r *TempoSearchResponse) spanCount() int {
+	spans := 0
+	for _, trace := range r.Traces {
+		for _, spanSet := range trace.SpanSets {
+			spans += len(spanSet.Spans)
+		}
+		if trace.SpanSet != nil {
+			spans += len(trace.SpanSet.Spans)
+		}
+	}
+	return spans
+}
+
+// seedAnomalyDetectors starts the result-count and latency moving averages at the calibration
+// baselines, so the main run flags anomalies without a warmup
+func seedAnomalyDetectors(results []calibrationResult) {
+	for _, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		if resultAnomalies != nil {
+			resultAnomalies.detector.seed(r.Query+"|"+r.Bucket+"|spans", float64(r.Spans))
+			resultAnomalies.detector.seed(r.Query+"|"+r.Bucket+"|traces", float64(r.Traces))
+		}
+		if latencyAnomalies != nil {
+			latencyAnomalies.detector.seed(r.Query+"|"+r.Bucket, r.LatencySeconds)
+		}
+	}
+}
+
+// writeCalibration appends the Markdown calibration baselines
+func writeCalibration(b *strings.Builder, results []calibrationResult) {
+	if len(results) == 0 {
+		return
+	}
+	b.WriteString("\n#### Calibration\n\n")
+	b.WriteString("| Query | Bucket | Spans | Traces | Latency |\n|:--|:--|--:|--:|--:|\n")
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(b, "| `%s` | `%s` | - | - | failed: %s |\n", r.Query, r.Bucket, strings.ReplaceAll(r.Error, "|", "\\|"))
+			continue
+		}
+		fmt.Fprintf(b, "| `%s` | `%s` | %d | %d | %s |\n", r.Query, r.Bucket, r.Spans, r.Traces, formatSeconds(r.LatencySeconds))
+	}
+}
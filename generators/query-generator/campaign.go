@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tCritical95 are the two-sided 95% Student's t critical values for 1 to 30 degrees of freedom
+var tCritical95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// campaignMetrics are the per-query summary values aggregated across runs
+var campaignMetrics = []struct {
+	name  string
+	value func(q querySummary) float64
+}{
+	{"p50Seconds", func(q querySummary) float64 { return q.P50Seconds }},
+	{"p99Seconds", func(q querySummary) float64 { return q.P99Seconds }},
+	{"achievedQPS", func(q querySummary) float64 { return q.AchievedQPS }},
+	{"errorRatePercent", func(q querySummary) float64 { return q.ErrorRatePct }},
+}
+
+// runCampaignCommand runs the same bounded scenario several times in job mode and reports the
+// spread of every query's percentiles, since single runs are too noisy to compare configurations
+func runCampaignCommand(args []string) error {
+	fs := flag.NewFlagSet("campaign", flag.ExitOnError)
+	configPath := fs.String("config", configPathFromEnv(), "config of the scenario; needs job.duration, job.untilPlanComplete or maxTotalQueries")
+	runs := fs.Int("runs", 5, "number of repetitions")
+	cooldown := fs.Duration("cooldown", 0, "pause between runs, e.g. to let compaction settle")
+	out := fs.String("out", "campaign", "directory the runs and the campaign report are written to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: campaign [flags] [-- generator flags]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *runs < 2 {
+		return fmt.Errorf("runs must be >= 2 to measure variance, got: %d", *runs)
+	}
+
+	tree, err := loadConfigTree(*configPath, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	config, err := decodeConfigTree(tree)
+	if err != nil {
+		return err
+	}
+	zone, err := loadTimezone(config.Timezone)
+	if err != nil {
+		return err
+	}
+	useLogTimezone(zone)
+	if config.Job.Duration == "" && !config.Job.UntilPlanComplete && !config.budgetBounded() {
+		return fmt.Errorf("%s: a campaign needs a bounded scenario (job.duration, job.untilPlanComplete or maxTotalQueries)", *configPath)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var summaries []*runSummary
+	var failed []string
+	for i := 1; i <= *runs; i++ {
+		if i > 1 && *cooldown > 0 {
+			log.Printf("Cooling down for %s", *cooldown)
+			time.Sleep(*cooldown)
+		}
+		dir := filepath.Join(*out, fmt.Sprintf("run-%d", i))
+		log.Printf("Campaign run %d/%d (output: %s)", i, *runs, dir)
+		summary, err := runCampaignRun(executable, tree, dir, fs.Args())
+		if summary != nil {
+			summaries = append(summaries, summary)
+		}
+		if err != nil {
+			log.Printf("Campaign run %d/%d: %v", i, *runs, err)
+			failed = append(failed, fmt.Sprintf("run %d: %v", i, err))
+		}
+	}
+	if len(summaries) < 2 {
+		return fmt.Errorf("only %d of %d runs produced a summary: %s", len(summaries), *runs, strings.Join(failed, "; "))
+	}
+
+	report := newCampaignReport(summaries)
+	if err := writeCampaignReport(*out, report); err != nil {
+		return err
+	}
+	log.Printf("Campaign of %d runs written to %s:\n%s", len(summaries), *out, report.markdown())
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d runs failed: %s", len(failed), *runs, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// runCampaignRun runs the generator once in job mode with its reports redirected to dir; the
+// summary is returned even when the run failed its SLOs
+func runCampaignRun(executable string, tree map[string]interface{}, dir string, extraArgs []string) (*runSummary, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// Each run writes its reports into its own directory
+	report, _ := tree["report"].(map[string]interface{})
+	runReport := map[string]interface{}{}
+	for k, v := range report {
+		runReport[k] = v
+	}
+	summaryPath := filepath.Join(dir, "summary.json")
+	runReport["json"] = summaryPath
+	if report["html"] != nil {
+		runReport["html"] = filepath.Join(dir, "report.html")
+	}
+	if report["markdown"] != nil {
+		runReport["markdown"] = filepath.Join(dir, "summary.md")
+	}
+	runTree := map[string]interface{}{}
+	for k, v := range tree {
+		runTree[k] = v
+	}
+	runTree["report"] = runReport
+	data, err := yaml.Marshal(runTree)
+	if err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, data, 0o644); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.Create(filepath.Join(dir, "generator.log"))
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	cmd := exec.Command(executable, append([]string{"--mode=job"}, extraArgs...)...)
+	cmd.Env = append(os.Environ(), "CONFIG_FILE="+configPath)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	runErr := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr) && exitErr.ExitCode() == exitSLOFailed:
+		runErr = fmt.Errorf("SLO failed (see %s)", logFile.Name())
+	default:
+		return nil, fmt.Errorf("generator failed: %v (see %s)", runErr, logFile.Name())
+	}
+
+	summary, err := loadSummaryJSON(summaryPath)
+	if err != nil {
+		return nil, err
+	}
+	return summary, runErr
+}
+
+// campaignStat is the spread of one metric across runs
+type campaignStat struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"` // sample standard deviation
+	CILow  float64 `json:"ci95Low"`
+	CIHigh float64 `json:"ci95High"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// newCampaignStat computes the mean, sample standard deviation and 95% confidence interval of
+// the mean (Student's t) of at least two values
+func newCampaignStat(values []float64) campaignStat {
+	n := float64(len(values))
+	s := campaignStat{Min: values[0], Max: values[0]}
+	for _, v := range values {
+		s.Mean += v
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+	}
+	s.Mean /= n
+	var squares float64
+	for _, v := range values {
+		squares += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(squares / (n - 1))
+	half := tCritical(len(values)-1) * s.StdDev / math.Sqrt(n)
+	s.CILow, s.CIHigh = s.Mean-half, s.Mean+half
+	return s
+}
+
+// tCritical returns the two-sided 95% t critical value for the degrees of freedom
+func tCritical(df int) float64 {
+	switch {
+	case df <= len(tCritical95):
+		return tCritical95[df-1]
+	case df <= 40:
+		return 2.021
+	case df <= 60:
+		return 2.000
+	case df <= 120:
+		return 1.980
+	default:
+		return 1.960
+	}
+}
+
+// campaignQuery is the spread of a query's results across the runs it appeared in
+type campaignQuery struct {
+	Name    string                  `json:"name"`
+	Runs    int                     `json:"runs"`
+	Metrics map[string]campaignStat `json:"metrics"`
+}
+
+// campaignReport aggregates the summaries of a campaign's runs
+type campaignReport struct {
+	Runs    int             `json:"runs"`
+	Queries []campaignQuery `json:"queries"`
+}
+
+// newCampaignReport aggregates per-query results across runs
+func newCampaignReport(summaries []*runSummary) *campaignReport {
+	byName := map[string][]querySummary{}
+	for _, s := range summaries {
+		for _, q := range s.Queries {
+			byName[q.Name] = append(byName[q.Name], q)
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &campaignReport{Runs: len(summaries)}
+	for _, name := range names {
+		results := byName[name]
+		q := campaignQuery{Name: name, Runs: len(results), Metrics: map[string]campaignStat{}}
+		if len(results) >= 2 {
+			for _, m := range campaignMetrics {
+				values := make([]float64, len(results))
+				for i, r := range results {
+					values[i] = m.value(r)
+				}
+				q.Metrics[m.name] = newCampaignStat(values)
+			}
+		}
+		report.Queries = append(report.Queries, q)
+	}
+	return report
+}
+
+// markdown renders the campaign as a Markdown table
+func (r *campaignReport) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Campaign: %d runs\n\n", r.Runs)
+	b.WriteString("| Query | Metric | Mean | Std dev | 95% CI | Min | Max |\n")
+	b.WriteString("|---|---|---:|---:|---|---:|---:|\n")
+	for _, q := range r.Queries {
+		if len(q.Metrics) == 0 {
+			fmt.Fprintf(&b, "| %s | - | only in %d run(s) | | | | |\n", q.Name, q.Runs)
+			continue
+		}
+		for _, m := range campaignMetrics {
+			s := q.Metrics[m.name]
+			format := func(v float64) string { return fmt.Sprintf("%.2f", v) }
+			if strings.HasSuffix(m.name, "Seconds") {
+				format = formatSeconds
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s – %s | %s | %s |\n", q.Name, m.name,
+				format(s.Mean), format(s.StdDev), format(s.CILow), format(s.CIHigh), format(s.Min), format(s.Max))
+		}
+	}
+	return b.String()
+}
+
+// writeCampaignReport writes campaign.json and campaign.md to dir
+func writeCampaignReport(dir string, r *campaignReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "campaign.json"), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "campaign.md"), []byte(r.markdown()), 0o644)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTCritical(t *testing.T) {
+	for _, tc := range []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706},
+		{2, 4.303},
+		{4, 2.776},
+		{10, 2.228},
+		{30, 2.042},
+		{31, 2.021},
+		{40, 2.021},
+		{41, 2.000},
+		{60, 2.000},
+		{61, 1.980},
+		{120, 1.980},
+		{121, 1.960},
+		{10000, 1.960},
+	} {
+		if got := tCritical(tc.df); got != tc.want {
+			t.Errorf("tCritical(%d) = %v, want %v", tc.df, got, tc.want)
+		}
+	}
+}
+
+func TestNewCampaignStat(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		want   campaignStat
+	}{
+		{
+			// mean 2, sample variance 1, half-width 4.303 * 1 / sqrt(3)
+			"three runs",
+			[]float64{1, 2, 3},
+			campaignStat{Mean: 2, StdDev: 1, CILow: 2 - 4.303/math.Sqrt(3), CIHigh: 2 + 4.303/math.Sqrt(3), Min: 1, Max: 3},
+		},
+		{
+			// mean 5, sample variance 2, half-width 12.706 * sqrt(2) / sqrt(2)
+			"two runs",
+			[]float64{4, 6},
+			campaignStat{Mean: 5, StdDev: math.Sqrt(2), CILow: 5 - 12.706, CIHigh: 5 + 12.706, Min: 4, Max: 6},
+		},
+		{
+			"no spread",
+			[]float64{0.25, 0.25, 0.25, 0.25},
+			campaignStat{Mean: 0.25, CILow: 0.25, CIHigh: 0.25, Min: 0.25, Max: 0.25},
+		},
+		{
+			// mean 5, sample variance 32/7, df 7 → t = 2.365
+			"eight runs",
+			[]float64{2, 4, 4, 4, 5, 5, 7, 9},
+			campaignStat{
+				Mean: 5, StdDev: math.Sqrt(32.0 / 7),
+				CILow: 5 - 2.365*math.Sqrt(32.0/7)/math.Sqrt(8), CIHigh: 5 + 2.365*math.Sqrt(32.0/7)/math.Sqrt(8),
+				Min: 2, Max: 9,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newCampaignStat(tc.values)
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"mean", got.Mean, tc.want.Mean},
+				{"stddev", got.StdDev, tc.want.StdDev},
+				{"ci95Low", got.CILow, tc.want.CILow},
+				{"ci95High", got.CIHigh, tc.want.CIHigh},
+				{"min", got.Min, tc.want.Min},
+				{"max", got.Max, tc.want.Max},
+			} {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewCampaignReport(t *testing.T) {
+	summaries := []*runSummary{
+		{Queries: []querySummary{{Name: "b", P99Seconds: 1}, {Name: "a", P99Seconds: 2, AchievedQPS: 10}}},
+		{Queries: []querySummary{{Name: "a", P99Seconds: 4, AchievedQPS: 12}}},
+	}
+	report := newCampaignReport(summaries)
+	if report.Runs != 2 || len(report.Queries) != 2 {
+		t.Fatalf("report = %+v, want 2 runs of 2 queries", report)
+	}
+	a, b := report.Queries[0], report.Queries[1]
+	if a.Name != "a" || a.Runs != 2 || a.Metrics["p99Seconds"].Mean != 3 || a.Metrics["achievedQPS"].Mean != 11 {
+		t.Errorf("query a = %+v, want 2 runs with mean p99 3 and QPS 11", a)
+	}
+	if b.Name != "b" || b.Runs != 1 || len(b.Metrics) != 0 {
+		t.Errorf("query b = %+v, want 1 run without statistics", b)
+	}
+}
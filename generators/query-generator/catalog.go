@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultCatalogTimeout bounds a catalog fetch
+const defaultCatalogTimeout = 30 * time.Second
+
+// catalogKeys are the parts of a config a query catalog may provide
+var catalogKeys = []string{"queries", "executionPlan", "attributes"}
+
+// CatalogConfig configures how queriesURL is fetched
+type CatalogConfig struct {
+	Headers         map[string]string `yaml:"headers"`         // Extra request headers
+	BearerTokenFile string            `yaml:"bearerTokenFile"` // Send the token in this file as a bearer token
+	BasicAuth       BasicAuthConfig   `yaml:"basicAuth"`       // HTTP basic auth (when username is set)
+	Timeout         string            `yaml:"timeout"`         // Fetch timeout (default: 30s)
+	// Re-fetch this often in service mode; a changed catalog restarts the generator to apply it
+	// (default: 0 = fetched at startup only)
+	Refresh string `yaml:"refresh"`
+}
+
+// get downloads a document with the configured headers, credentials and timeout
+func (cfg CatalogConfig) get(rawURL string) ([]byte, error) {
+	timeout := defaultCatalogTimeout
+	if cfg.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", cfg.Timeout)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if cfg.BearerTokenFile != "" {
+		token, err := os.ReadFile(cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearerTokenFile: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	if cfg.BasicAuth.Username != "" {
+		password, err := cfg.BasicAuth.password()
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(cfg.BasicAuth.Username, password)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d: %s", req.URL.Redacted(), res.StatusCode, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// fetchCatalog downloads a query catalog, a YAML or JSON document with queries and/or an
+// executionPlan, and returns those parts as a config tree along with the other keys it ignored
+func fetchCatalog(rawURL string, cfg CatalogConfig) (catalog map[string]interface{}, ignored []string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil, fmt.Errorf("queriesURL must be an http(s) URL, got %q", rawURL)
+	}
+	data, err := cfg.get(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query catalog: %w", err)
+	}
+
+	// The URL path extension selects JSON or TOML like for files; YAML also parses JSON
+	doc, err := parseConfigDocument(path.Base(u.Path), data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse query catalog %s: %w", u.Redacted(), err)
+	}
+	catalog = map[string]interface{}{}
+	for _, key := range catalogKeys {
+		if v, ok := doc[key]; ok {
+			catalog[key] = v
+		}
+	}
+	if len(catalog) == 0 {
+		return nil, nil, fmt.Errorf("query catalog %s has neither queries nor an executionPlan", u.Redacted())
+	}
+	for key := range doc {
+		if _, ok := catalog[key]; !ok {
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(ignored)
+	return catalog, ignored, nil
+}
+
+// loadedCatalog is the catalog merged into the configuration, kept for the run artifacts (nil
+// without queriesURL)
+var loadedCatalog map[string]interface{}
+
+// mergeCatalog fetches the queriesURL of a config tree and merges it under the tree like an
+// include: local queries override catalog queries of the same name, a local executionPlan
+// replaces the catalog's
+func mergeCatalog(tree map[string]interface{}) (map[string]interface{}, error) {
+	config, err := decodeConfigTree(tree)
+	if err != nil || config.QueriesURL == "" {
+		return tree, err
+	}
+	catalog, ignored, err := fetchCatalog(config.QueriesURL, config.QueriesCatalog)
+	if err != nil {
+		return nil, err
+	}
+	if len(ignored) > 0 {
+		log.Printf("Warning: Query catalog ignores %s (a catalog provides %s)", strings.Join(ignored, ", "), strings.Join(catalogKeys, " and "))
+	}
+	loadedCatalog = catalog
+	return mergeConfigMaps(catalog, tree), nil
+}
+
+// catalogDigest identifies the content of a catalog to detect changes
+func catalogDigest(catalog map[string]interface{}) ([32]byte, error) {
+	data, err := yaml.Marshal(catalog)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// catalogWatcher re-fetches the query catalog and calls onChange when it differs from the
+// catalog the generator started with
+type catalogWatcher struct {
+	url      string
+	cfg      CatalogConfig
+	interval time.Duration
+	digest   [32]byte
+	onChange func()
+	fetches  *prometheus.CounterVec
+}
+
+// newCatalogWatcher fetches the current catalog as the reference; nil when refresh is off
+func newCatalogWatcher(rawURL string, cfg CatalogConfig, onChange func()) (*catalogWatcher, error) {
+	if cfg.Refresh == "" {
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(cfg.Refresh)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid queriesCatalog.refresh %q", cfg.Refresh)
+	}
+	catalog, _, err := fetchCatalog(rawURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+	w := &catalogWatcher{url: rawURL, cfg: cfg, interval: interval, onChange: onChange}
+	if w.digest, err = catalogDigest(catalog); err != nil {
+		return nil, err
+	}
+	w.fetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "catalog",
+		Name:      "fetches_total",
+		Help:      "Query catalog refreshes by result (unchanged, changed, error)",
+	}, []string{"result"})
+	return w, nil
+}
+
+// run re-fetches the catalog every interval; errors keep the current catalog
+func (w *catalogWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		catalog, _, err := fetchCatalog(w.url, w.cfg)
+		var digest [32]byte
+		if err == nil {
+			digest, err = catalogDigest(catalog)
+		}
+		switch {
+		case err != nil:
+			w.fetches.WithLabelValues("error").Inc()
+			log.Printf("Warning: Query catalog refresh failed, keeping the current queries: %v", err)
+		case digest == w.digest:
+			w.fetches.WithLabelValues("unchanged").Inc()
+		default:
+			w.fetches.WithLabelValues("changed").Inc()
+			log.Printf("Query catalog changed, restarting to apply it")
+			w.onChange()
+			return
+		}
+	}
+}
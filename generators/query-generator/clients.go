@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// clientIdentityCustom names the identity of a query's userAgent
+const clientIdentityCustom = "custom"
+
+// builtinClientIdentities are the identities available without configuration; a configured
+// identity of the same name replaces them (e.g. to match the deployed Grafana version)
+var builtinClientIdentities = []ClientIdentityConfig{
+	{Name: "grafana", UserAgent: "Grafana/11.1.0", Headers: map[string]string{"X-Grafana-Org-Id": "1"}},
+	// tempo-cli sends the Go default of its net/http client
+	{Name: "tempo-cli", UserAgent: "Go-http-client/1.1"},
+}
+
+// ClientIdentityConfig is a client the generator poses as: its User-Agent and other headers
+// identifying it, since gateways may apply different limits per client
+type ClientIdentityConfig struct {
+	Name      string            `yaml:"name"`
+	UserAgent string            `yaml:"userAgent"`
+	Headers   map[string]string `yaml:"headers"` // Other identifying headers, e.g. X-Grafana-Org-Id
+}
+
+// clientIdentities sets the client identity of each query's requests (nil when no query uses one)
+var clientIdentities *clientRotator
+
+// clientRotator rotates requests across the client identities of their query and records
+// latency and outcomes by client
+type clientRotator struct {
+	queries  map[string][]clientIdentity // identities by query name
+	latency  *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+}
+
+// clientIdentity is an identity with canonical header names
+type clientIdentity struct {
+	name    string
+	headers http.Header
+}
+
+// resolveClientIdentities validates the configured identities and returns every identity by
+// name, built-in ones included
+func resolveClientIdentities(identities []ClientIdentityConfig) (map[string]ClientIdentityConfig, error) {
+	byName := make(map[string]ClientIdentityConfig, len(builtinClientIdentities)+len(identities))
+	for _, c := range builtinClientIdentities {
+		byName[c.Name] = c
+	}
+	configured := make(map[string]bool, len(identities))
+	for _, c := range identities {
+		if c.Name == "" {
+			return nil, fmt.Errorf("client identity without a name")
+		}
+		if c.Name == clientIdentityCustom {
+			return nil, fmt.Errorf("client identity %s is reserved for the userAgent of queries", c.Name)
+		}
+		if configured[c.Name] {
+			return nil, fmt.Errorf("client identity %s is defined twice", c.Name)
+		}
+		configured[c.Name] = true
+		if c.UserAgent == "" && len(c.Headers) == 0 {
+			return nil, fmt.Errorf("client identity %s has neither a userAgent nor headers", c.Name)
+		}
+		byName[c.Name] = c
+	}
+	return byName, nil
+}
+
+// checkClientIdentities validates the identities and the identities queries refer to
+func checkClientIdentities(identities []ClientIdentityConfig, queries []QueryConfig) error {
+	byName, err := resolveClientIdentities(identities)
+	if err != nil {
+		return err
+	}
+	for _, q := range queries {
+		if q.UserAgent != "" && len(q.Clients) > 0 {
+			return fmt.Errorf("query %s: set either userAgent or clients", q.Name)
+		}
+		for _, name := range q.Clients {
+			if _, ok := byName[name]; !ok {
+				return fmt.Errorf("query %s: undefined client identity %s", q.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// newClientRotator resolves the identities of each query and registers the metrics; it returns
+// nil when no query sets a client identity or userAgent
+func newClientRotator(identities []ClientIdentityConfig, queries []QueryConfig) (*clientRotator, error) {
+	if err := checkClientIdentities(identities, queries); err != nil {
+		return nil, err
+	}
+	byName, _ := resolveClientIdentities(identities)
+	c := &clientRotator{queries: make(map[string][]clientIdentity)}
+	for _, q := range queries {
+		if _, ok := c.queries[q.Name]; ok {
+			continue // duration sweep variants share their query's identities
+		}
+		if q.UserAgent != "" {
+			c.queries[q.Name] = []clientIdentity{newClientIdentity(ClientIdentityConfig{Name: clientIdentityCustom, UserAgent: q.UserAgent})}
+			continue
+		}
+		for _, name := range q.Clients {
+			c.queries[q.Name] = append(c.queries[q.Name], newClientIdentity(byName[name]))
+		}
+	}
+	if len(c.queries) == 0 {
+		return nil, nil
+	}
+
+	c.latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "client_identity",
+		Name:      "duration_seconds",
+		Help:      "Query latency by name and client identity",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"name", "client"})
+	c.requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "client_identity",
+		Name:      "requests_total",
+		Help:      "Requests by name, client identity and outcome (status class, or error for transport errors and client timeouts)",
+	}, []string{"name", "client", "outcome"})
+	return c, nil
+}
+
+func newClientIdentity(cfg ClientIdentityConfig) clientIdentity {
+	headers := http.Header{}
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
+	}
+	if cfg.UserAgent != "" {
+		headers.Set("User-Agent", cfg.UserAgent)
+	}
+	return clientIdentity{name: cfg.Name, headers: headers}
+}
+
+// apply sets the headers of an identity picked at random among the query's identities and
+// returns its name ("" when the query uses none)
+func (c *clientRotator) apply(queryName string, req *http.Request) string {
+	if c == nil {
+		return ""
+	}
+	identities := c.queries[queryName]
+	if len(identities) == 0 {
+		return ""
+	}
+	identity := identities[rand.Intn(len(identities))]
+	for k, v := range identity.headers {
+		req.Header[k] = v
+	}
+	return identity.name
+}
+
+// record counts the outcome of a request sent as a client; status is 0 for transport errors
+func (c *clientRotator) record(queryName, client string, status int, latency time.Duration) {
+	if c == nil || client == "" {
+		return
+	}
+	outcome := "error"
+	if status > 0 {
+		outcome = statusClass(status)
+		c.latency.WithLabelValues(queryName, client).Observe(latency.Seconds())
+	}
+	c.requests.WithLabelValues(queryName, client, outcome).Inc()
+}
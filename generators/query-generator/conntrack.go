@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// connTracker exports how the query transport obtains its connections, to tell whether a run
+// measures Tempo or TCP/TLS setup: new vs reused connections, idle-pool hits and open connections
+// per target (host:port)
+type connTracker struct {
+	acquired *prometheus.CounterVec
+	idleHits *prometheus.CounterVec
+	open     *prometheus.GaugeVec
+}
+
+// newConnTracker registers the connection metrics
+func newConnTracker() *connTracker {
+	return &connTracker{
+		acquired: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "connections",
+			Name:      "acquired_total",
+			Help:      "Connections handed to requests by target, newly dialed (reused=false) or reused",
+		}, []string{"target", "reused"}),
+		idleHits: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "connections",
+			Name:      "idle_hits_total",
+			Help:      "Requests served by a connection taken from the idle pool, by target",
+		}, []string{"target"}),
+		open: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Subsystem: "connections",
+			Name:      "open",
+			Help:      "Connections currently open by target",
+		}, []string{"target"}),
+	}
+}
+
+// instrumentDial counts the open connections of an *http.Transport (other transports are left
+// as they are); it must run before wrappers that need the *http.Transport
+func (c *connTracker) instrumentDial(rt http.RoundTripper) {
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return
+	}
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		open := c.open.WithLabelValues(addr)
+		open.Inc()
+		return &trackedConn{Conn: conn, open: open}, nil
+	}
+}
+
+// wrap returns a transport recording how each request got its connection
+func (c *connTracker) wrap(next http.RoundTripper) http.RoundTripper {
+	return &connTrackingTransport{next: next, tracker: c}
+}
+
+// connTrackingTransport adds a GotConn hook to every request
+type connTrackingTransport struct {
+	next    http.RoundTripper
+	tracker *connTracker
+}
+
+func (t *connTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := canonicalAddr(req)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.tracker.acquired.WithLabelValues(target, strconv.FormatBool(info.Reused)).Inc()
+			if info.WasIdle {
+				t.tracker.idleHits.WithLabelValues(target).Inc()
+			}
+		},
+	}
+	// WithClientTrace keeps the hooks already on the request (e.g. the slow-query log)
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// canonicalAddr returns the host:port a request connects to, matching the address the
+// transport dials
+func canonicalAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// trackedConn decrements the open connections gauge once when closed
+type trackedConn struct {
+	net.Conn
+	open  prometheus.Gauge
+	close sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.close.Do(c.open.Dec)
+	return c.Conn.Close()
+}
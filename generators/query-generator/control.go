@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// controlPrefix is the path of the control API on the metrics server
+const controlPrefix = "/control/queries"
+
+// controls serves the control API (nil when server.control is off)
+var controls *controlAPI
+
+// controlAPI changes the QPS and worker count of running queries:
+//
+//	GET  /control/queries                  list queries with their workers and QPS
+//	POST /control/queries/{name}/workers   {"workers": N}, {"add": N} or {"remove": N}
+//	POST /control/queries/{name}/qps       {"qps": X}
+//
+// Removed workers drain: each finishes its current request before exiting.
+type controlAPI struct {
+	mu      sync.Mutex
+	queries map[string]*queryControl
+}
+
+// queryControl is what the control API can change of one query
+type queryControl struct {
+	pool    *workerPool
+	limiter *rate.Limiter
+}
+
+// queryStatus is a query as listed by the control API
+type queryStatus struct {
+	Name     string  `json:"name"`
+	Workers  int     `json:"workers"`  // running workers, including draining ones
+	Draining int     `json:"draining"` // workers finishing their request before exiting
+	QPS      float64 `json:"qps"`
+}
+
+// controlRequest is the body of the POST endpoints
+type controlRequest struct {
+	Workers *int     `json:"workers"`
+	Add     int      `json:"add"`
+	Remove  int      `json:"remove"`
+	QPS     *float64 `json:"qps"`
+}
+
+func newControlAPI() *controlAPI {
+	return &controlAPI{queries: make(map[string]*queryControl)}
+}
+
+// register makes a query's worker pool and rate limiter controllable
+func (c *controlAPI) register(name string, pool *workerPool, limiter *rate.Limiter) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.queries[name] = &queryControl{pool: pool, limiter: limiter}
+	c.mu.Unlock()
+}
+
+func (c *controlAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, controlPrefix), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, c.list())
+		return
+	}
+
+	i := strings.LastIndexByte(rest, '/')
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	name, setting := rest[:i], rest[i+1:]
+	c.mu.Lock()
+	q, ok := c.queries[name]
+	c.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown query %q", name), http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req controlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch setting {
+	case "workers":
+		err = q.setWorkers(name, req)
+	case "qps":
+		err = q.setQPS(name, req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, q.status(name))
+}
+
+// setWorkers applies a workers request
+func (q *queryControl) setWorkers(name string, req controlRequest) error {
+	if q.pool.autoscaled() {
+		return fmt.Errorf("workers of %s are managed by the autoscaler", name)
+	}
+	if stairStep != nil {
+		return fmt.Errorf("workers are managed by the stair-step experiment")
+	}
+	current := q.pool.size() - q.pool.draining()
+	target := current + req.Add - req.Remove
+	if req.Workers != nil {
+		target = *req.Workers
+	}
+	if target < 1 {
+		return fmt.Errorf("a query needs at least one worker, got %d", target)
+	}
+	log.Printf("Control API: %s workers %d -> %d", name, current, target)
+	q.pool.setWorkers(target)
+	return nil
+}
+
+// setQPS applies a qps request
+func (q *queryControl) setQPS(name string, req controlRequest) error {
+	if req.QPS == nil || *req.QPS <= 0 {
+		return fmt.Errorf("qps must be > 0")
+	}
+	log.Printf("Control API: %s QPS %.4f -> %.4f", name, float64(q.limiter.Limit()), *req.QPS)
+	q.limiter.SetLimit(rate.Limit(*req.QPS))
+	return nil
+}
+
+// status returns the current settings of a query
+func (q *queryControl) status(name string) queryStatus {
+	return queryStatus{
+		Name:     name,
+		Workers:  q.pool.size(),
+		Draining: q.pool.draining(),
+		QPS:      float64(q.limiter.Limit()),
+	}
+}
+
+// list returns every controllable query by name
+func (c *controlAPI) list() []queryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	statuses := make([]queryStatus, 0, len(c.queries))
+	for name, q := range c.queries {
+		statuses = append(statuses, q.status(name))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: Failed to write control API response: %v", err)
+	}
+}
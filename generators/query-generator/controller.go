@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TempoPerfTest custom resource coordinates
+const (
+	perfTestGroup    = "perf.tempo-perf-test.io"
+	perfTestVersion  = "v1alpha1"
+	perfTestResource = "tempoperftests"
+	perfTestKind     = "TempoPerfTest"
+)
+
+// defaultGeneratorImage is used when a TempoPerfTest does not set spec.image
+const defaultGeneratorImage = "quay.io/rvargasp/query-load-generator:latest"
+
+// TempoPerfTest lifecycle phases reported in status.phase
+const (
+	perfTestRunning   = "Running"
+	perfTestSucceeded = "Succeeded"
+	perfTestFailed    = "Failed"
+)
+
+// perfTest is a TempoPerfTest custom resource
+type perfTest struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UID       string `json:"uid"`
+	} `json:"metadata"`
+	Spec   perfTestSpec   `json:"spec"`
+	Status perfTestStatus `json:"status"`
+}
+
+// perfTestSpec describes an experiment: the generator config, QPS phases and optional write load
+type perfTestSpec struct {
+	Image              string                 `json:"image"`
+	ServiceAccountName string                 `json:"serviceAccountName"`
+	Config             map[string]interface{} `json:"config"` // Generator config (same schema as config.yaml)
+	Phases             []perfTestPhase        `json:"phases"` // Run one after another; empty = a single run of config as is
+	WriteLoad          *perfTestWriteLoad     `json:"writeLoad"`
+}
+
+// perfTestPhase is a bounded run of the generator with its own QPS and SLOs
+type perfTestPhase struct {
+	Name         string  `json:"name"`
+	Duration     string  `json:"duration"`
+	TargetQPS    float64 `json:"targetQPS"`
+	MaxErrorRate float64 `json:"maxErrorRate"`
+	MaxP99       string  `json:"maxP99"`
+}
+
+// perfTestWriteLoad is a trace generator Job started with the experiment
+type perfTestWriteLoad struct {
+	Image    string   `json:"image"`
+	Args     []string `json:"args"`
+	Replicas int32    `json:"replicas"`
+}
+
+// perfTestStatus is aggregated from the Jobs back into the custom resource
+type perfTestStatus struct {
+	Phase        string                `json:"phase,omitempty"`
+	CurrentPhase int                   `json:"currentPhase"`
+	Phases       []perfTestPhaseStatus `json:"phases,omitempty"`
+	Message      string                `json:"message,omitempty"`
+}
+
+// perfTestPhaseStatus is the outcome of a phase
+type perfTestPhaseStatus struct {
+	Name     string `json:"name"`
+	Job      string `json:"job,omitempty"`
+	Result   string `json:"result"` // Pending, Running, Passed, SLOFailed or Error
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// runControllerCommand implements the "controller" subcommand: it reconciles TempoPerfTest
+// resources into generator ConfigMaps and Jobs (one per phase, run in job mode) and reports
+// each phase's outcome in the resource status
+func runControllerCommand(args []string) error {
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	namespace := fs.String("namespace", "tempo-perf-test", "namespace to watch for TempoPerfTest resources")
+	interval := fs.Duration("interval", 10*time.Second, "how often resources are reconciled")
+	apiServer := fs.String("api-server", "", "API server URL (default: in-cluster), e.g. http://localhost:8001 with kubectl proxy")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newInClusterKubeClient(*apiServer)
+	if err != nil {
+		return err
+	}
+	c := &perfTestController{kube: client, namespace: *namespace}
+	log.Printf("Reconciling %s resources in namespace %s every %s", perfTestKind, *namespace, *interval)
+
+	// Polling keeps the controller free of watch bookkeeping; experiments last minutes to hours
+	for {
+		if err := c.reconcileAll(); err != nil {
+			log.Printf("Warning: Reconcile failed: %v", err)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// perfTestController reconciles TempoPerfTest resources of a namespace
+type perfTestController struct {
+	kube      *kubeClient
+	namespace string
+}
+
+func (c *perfTestController) perfTestsPath() string {
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", perfTestGroup, perfTestVersion, c.namespace, perfTestResource)
+}
+
+// reconcileAll lists the resources and reconciles each of them
+func (c *perfTestController) reconcileAll() error {
+	var list struct {
+		Items []perfTest `json:"items"`
+	}
+	if err := c.kube.do(http.MethodGet, c.perfTestsPath(), "", nil, &list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		pt := &list.Items[i]
+		if err := c.reconcile(pt); err != nil {
+			log.Printf("Warning: %s %s: %v", perfTestKind, pt.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+// phases returns the phases of a test; without phases the config runs once as is
+func (pt *perfTest) phases() []perfTestPhase {
+	if len(pt.Spec.Phases) == 0 {
+		return []perfTestPhase{{Name: "run"}}
+	}
+	return pt.Spec.Phases
+}
+
+// reconcile advances a test by at most one step and updates its status
+func (c *perfTestController) reconcile(pt *perfTest) error {
+	status := pt.Status
+	if status.Phase == perfTestSucceeded || status.Phase == perfTestFailed {
+		return nil
+	}
+	phases := pt.phases()
+
+	if status.Phase == "" {
+		// First reconcile: validate every phase config up front so a typo fails fast
+		for _, phase := range phases {
+			if _, err := renderPhaseConfig(pt.Spec.Config, phase); err != nil {
+				status.Phase = perfTestFailed
+				status.Message = fmt.Sprintf("phase %s: %v", phase.Name, err)
+				return c.updateStatus(pt, status)
+			}
+		}
+		if pt.Spec.WriteLoad != nil {
+			if pt.Spec.WriteLoad.Image == "" {
+				status.Phase = perfTestFailed
+				status.Message = "writeLoad.image must be set"
+				return c.updateStatus(pt, status)
+			}
+			if err := c.kube.create(c.jobsPath(), c.writeLoadJob(pt)); err != nil {
+				return fmt.Errorf("failed to create write load job: %w", err)
+			}
+		}
+		status.Phase = perfTestRunning
+		status.Phases = make([]perfTestPhaseStatus, len(phases))
+		for i, phase := range phases {
+			status.Phases[i] = perfTestPhaseStatus{Name: phase.Name, Result: "Pending"}
+		}
+	}
+
+	i := status.CurrentPhase
+	if i >= len(phases) || i >= len(status.Phases) {
+		status.Phase = perfTestSucceeded
+		return c.updateStatus(pt, status)
+	}
+	jobName := fmt.Sprintf("%s-%d", pt.Metadata.Name, i)
+
+	var job struct {
+		Status struct {
+			Succeeded int `json:"succeeded"`
+			Failed    int `json:"failed"`
+		} `json:"status"`
+	}
+	err := c.kube.do(http.MethodGet, c.jobsPath()+"/"+jobName, "", nil, &job)
+	switch {
+	case isNotFound(err):
+		config, err := renderPhaseConfig(pt.Spec.Config, phases[i])
+		if err != nil {
+			return err
+		}
+		if err := c.kube.create(c.configMapsPath(), c.configMap(pt, jobName, config)); err != nil {
+			return fmt.Errorf("failed to create config map: %w", err)
+		}
+		if err := c.kube.create(c.jobsPath(), c.generatorJob(pt, jobName, phases[i].Name)); err != nil {
+			return fmt.Errorf("failed to create job: %w", err)
+		}
+		log.Printf("%s %s: started phase %s (job %s)", perfTestKind, pt.Metadata.Name, phases[i].Name, jobName)
+		status.Phases[i].Job = jobName
+		status.Phases[i].Result = "Running"
+	case err != nil:
+		return err
+	case job.Status.Succeeded > 0:
+		code := exitPass
+		status.Phases[i].Result = "Passed"
+		status.Phases[i].ExitCode = &code
+		status.CurrentPhase++
+		if status.CurrentPhase >= len(phases) {
+			status.Phase = perfTestSucceeded
+			status.Message = fmt.Sprintf("all %d phase(s) passed", len(phases))
+		}
+	case job.Status.Failed > 0:
+		code, err := c.jobExitCode(jobName)
+		if err != nil {
+			return err
+		}
+		status.Phases[i].ExitCode = &code
+		status.Phases[i].Result = "Error"
+		if code == exitSLOFailed {
+			status.Phases[i].Result = "SLOFailed"
+		}
+		status.Phase = perfTestFailed
+		status.Message = fmt.Sprintf("phase %s: %s (exit code %d), see logs of job %s", phases[i].Name, status.Phases[i].Result, code, jobName)
+	default:
+		return nil // still running
+	}
+	return c.updateStatus(pt, status)
+}
+
+// renderPhaseConfig applies the phase overrides to the generator config, validates it and
+// returns it as YAML
+func renderPhaseConfig(base map[string]interface{}, phase perfTestPhase) ([]byte, error) {
+	// Deep copy through JSON so phases do not share nested maps
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	if phase.TargetQPS > 0 {
+		query, _ := config["query"].(map[string]interface{})
+		if query == nil {
+			query = map[string]interface{}{}
+		}
+		query["targetQPS"] = phase.TargetQPS
+		config["query"] = query
+	}
+	jobConfig, _ := config["job"].(map[string]interface{})
+	if jobConfig == nil {
+		jobConfig = map[string]interface{}{}
+	}
+	if phase.Duration != "" {
+		jobConfig["duration"] = phase.Duration
+	}
+	if phase.MaxErrorRate > 0 {
+		jobConfig["maxErrorRate"] = phase.MaxErrorRate
+	}
+	if phase.MaxP99 != "" {
+		jobConfig["maxP99"] = phase.MaxP99
+	}
+	config["job"] = jobConfig
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed Config
+	if err := yaml.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if problems := validateConfig(&parsed); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config: %v", problems[0])
+	}
+	if parsed.Job.Duration == "" && !parsed.Job.UntilPlanComplete && !parsed.budgetBounded() {
+		return nil, fmt.Errorf("needs a duration (phase or config job.duration), job.untilPlanComplete or maxTotalQueries")
+	}
+	return out, nil
+}
+
+// jobExitCode returns the exit code of the generator container of a failed job
+func (c *perfTestController) jobExitCode(jobName string) (int, error) {
+	var pods struct {
+		Items []struct {
+			Status struct {
+				ContainerStatuses []struct {
+					State struct {
+						Terminated *struct {
+							ExitCode int `json:"exitCode"`
+						} `json:"terminated"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s", c.namespace, url.QueryEscape("job-name="+jobName))
+	if err := c.kube.do(http.MethodGet, path, "", nil, &pods); err != nil {
+		return 0, err
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+				return t.ExitCode, nil
+			}
+		}
+	}
+	return exitRuntimeError, nil
+}
+
+// updateStatus writes the status subresource
+func (c *perfTestController) updateStatus(pt *perfTest, status perfTestStatus) error {
+	return c.kube.mergePatch(c.perfTestsPath()+"/"+pt.Metadata.Name+"/status", map[string]interface{}{"status": status})
+}
+
+func (c *perfTestController) jobsPath() string {
+	return fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs", c.namespace)
+}
+
+func (c *perfTestController) configMapsPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps", c.namespace)
+}
+
+// objectMeta returns metadata owned by the test so its objects are deleted with it
+func (c *perfTestController) objectMeta(pt *perfTest, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      name,
+		"namespace": c.namespace,
+		"labels":    map[string]string{"app": "query-load-generator", "tempoperftest": pt.Metadata.Name},
+		"ownerReferences": []map[string]interface{}{{
+			"apiVersion":         perfTestGroup + "/" + perfTestVersion,
+			"kind":               perfTestKind,
+			"name":               pt.Metadata.Name,
+			"uid":                pt.Metadata.UID,
+			"controller":         true,
+			"blockOwnerDeletion": true,
+		}},
+	}
+}
+
+// configMap holds the rendered generator config of a phase
+func (c *perfTestController) configMap(pt *perfTest, name string, config []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   c.objectMeta(pt, name),
+		"data":       map[string]string{"config.yaml": string(config)},
+	}
+}
+
+// generatorJob runs the generator in job mode with the phase's config map
+func (c *perfTestController) generatorJob(pt *perfTest, name, phase string) map[string]interface{} {
+	image := pt.Spec.Image
+	if image == "" {
+		image = defaultGeneratorImage
+	}
+	serviceAccount := pt.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "query-load-account"
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   c.objectMeta(pt, name),
+		"spec": map[string]interface{}{
+			"backoffLimit": 0,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]string{"app": "query-load-generator"}},
+				"spec": map[string]interface{}{
+					"serviceAccountName": serviceAccount,
+					"restartPolicy":      "Never",
+					"containers": []map[string]interface{}{{
+						"name":  "app",
+						"image": image,
+						"args":  []string{"--mode=job"},
+						"env": []map[string]interface{}{
+							{"name": "CONFIG_FILE", "value": "/config/config.yaml"},
+							{"name": "PHASE", "value": phase},
+							{"name": "POD_NAMESPACE", "valueFrom": map[string]interface{}{"fieldRef": map[string]string{"fieldPath": "metadata.namespace"}}},
+							{"name": "POD_NAME", "valueFrom": map[string]interface{}{"fieldRef": map[string]string{"fieldPath": "metadata.name"}}},
+							{"name": "NODE_NAME", "valueFrom": map[string]interface{}{"fieldRef": map[string]string{"fieldPath": "spec.nodeName"}}},
+						},
+						"ports":        []map[string]interface{}{{"containerPort": 2112, "name": "metrics"}},
+						"volumeMounts": []map[string]interface{}{{"mountPath": "/config", "name": "config", "readOnly": true}},
+					}},
+					"volumes": []map[string]interface{}{{
+						"name":      "config",
+						"configMap": map[string]string{"name": name},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// writeLoadJob runs the trace generator alongside the query phases
+func (c *perfTestController) writeLoadJob(pt *perfTest) map[string]interface{} {
+	w := pt.Spec.WriteLoad
+	replicas := w.Replicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   c.objectMeta(pt, pt.Metadata.Name+"-write"),
+		"spec": map[string]interface{}{
+			"completions": replicas,
+			"parallelism": replicas,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]string{"app": "trace-generator"}},
+				"spec": map[string]interface{}{
+					"restartPolicy": "Never",
+					"containers": []map[string]interface{}{{
+						"name":  "loadgen",
+						"image": w.Image,
+						"args":  w.Args,
+					}},
+				},
+			},
+		},
+	}
+}
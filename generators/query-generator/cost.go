@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Defaults of the cost attribution
+const (
+	defaultCostCPUMetric = "process_cpu_seconds_total"
+	defaultCostInterval  = 30 * time.Second
+)
+
+// CostConfig attributes the CPU Tempo spends to the queries of the generator, to rank which
+// TraceQL patterns are the most expensive to serve
+type CostConfig struct {
+	// Prometheus endpoints of every Tempo component serving queries, e.g. http://tempo:3200/metrics
+	MetricsURLs []string `yaml:"metricsURLs"`
+	CPUMetric   string   `yaml:"cpuMetric"` // Counter of CPU seconds, summed over its series (default: process_cpu_seconds_total)
+	Interval    string   `yaml:"interval"`  // Scrape interval; each interval's CPU goes to the queries sent in it (default: 30s)
+	// CPU cores Tempo uses without query load (ingestion, compaction), not attributed to queries
+	BaselineCores float64       `yaml:"baselineCores"`
+	Fetch         CatalogConfig `yaml:"fetch"` // Headers, credentials and timeout of the scrapes
+}
+
+// costs attributes Tempo CPU to queries (nil when disabled)
+var costs *costAttribution
+
+// costAttribution scrapes the CPU seconds of Tempo every interval and splits the CPU used in
+// the interval, less the baseline, across queries in proportion to the bytes their searches
+// inspected, or to their request time when Tempo reports no inspected bytes
+type costAttribution struct {
+	urls     []string
+	metric   string
+	interval time.Duration
+	baseline float64
+	fetch    CatalogConfig
+
+	mu           sync.Mutex
+	last         map[string]float64 // CPU seconds by URL at the last scrape
+	lastScrape   time.Time
+	window       map[string]*costUsage // requests since the last scrape by query
+	totals       map[string]*costUsage
+	unattributed float64 // CPU seconds of intervals without requests, above the baseline
+
+	cpu *prometheus.CounterVec
+}
+
+// costUsage is the load of a query and the CPU attributed to it
+type costUsage struct {
+	requests int64
+	bytes    int64
+	seconds  float64
+	cpu      float64
+}
+
+// queryCost is the estimated cost of a query over the run
+type queryCost struct {
+	Query                string  `json:"query"`
+	Requests             int64   `json:"requests"`
+	InspectedBytes       int64   `json:"inspectedBytes"`
+	CPUSeconds           float64 `json:"cpuSeconds"`
+	CPUSecondsPerRequest float64 `json:"cpuSecondsPerRequest"`
+	SharePct             float64 `json:"sharePercent"` // Share of the attributed CPU
+}
+
+// check validates the config
+func (cfg CostConfig) check() error {
+	if cfg.Interval != "" {
+		if d, err := time.ParseDuration(cfg.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval %q", cfg.Interval)
+		}
+	}
+	if cfg.BaselineCores < 0 {
+		return fmt.Errorf("baselineCores must not be negative")
+	}
+	return nil
+}
+
+// newCostAttribution validates the config (nil without metricsURLs)
+func newCostAttribution(cfg CostConfig) (*costAttribution, error) {
+	if len(cfg.MetricsURLs) == 0 {
+		return nil, nil
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	c := &costAttribution{
+		urls:     cfg.MetricsURLs,
+		metric:   cfg.CPUMetric,
+		interval: defaultCostInterval,
+		baseline: cfg.BaselineCores,
+		fetch:    cfg.Fetch,
+		last:     make(map[string]float64),
+		window:   make(map[string]*costUsage),
+		totals:   make(map[string]*costUsage),
+	}
+	if c.metric == "" {
+		c.metric = defaultCostCPUMetric
+	}
+	if cfg.Interval != "" {
+		c.interval, _ = time.ParseDuration(cfg.Interval)
+	}
+	c.cpu = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "cost",
+		Name:      "cpu_seconds_total",
+		Help:      "Tempo CPU seconds attributed to each query by name",
+	}, []string{"name"})
+	return c, nil
+}
+
+// record adds a request to the current interval; throttled requests cost nothing
+func (c *costAttribution) record(sample *requestSample) {
+	if c == nil || sample.Throttled {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := c.window[sample.Query]
+	if u == nil {
+		u = &costUsage{}
+		c.window[sample.Query] = u
+	}
+	u.requests++
+	u.bytes += sample.InspectedBytes
+	u.seconds += sample.LatencySeconds
+}
+
+// run scrapes at startup and every interval until ctx is done
+func (c *costAttribution) run(ctx context.Context) {
+	c.scrape()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.scrape()
+		}
+	}
+}
+
+// scrape reads the CPU seconds of every URL and attributes the CPU used since the last scrape
+// to the queries of the interval. A URL failing a scrape has its CPU attributed at its next
+// successful one.
+func (c *costAttribution) scrape() {
+	var used float64
+	values := make(map[string]float64, len(c.urls))
+	for _, u := range c.urls {
+		data, err := c.fetch.get(u)
+		if err == nil {
+			values[u], err = sumCounter(data, c.metric)
+		}
+		if err != nil {
+			log.Printf("Warning: Cost attribution: failed to scrape %s: %v", u, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	first := c.lastScrape.IsZero()
+	for u, v := range values {
+		if last, ok := c.last[u]; ok {
+			if v >= last {
+				used += v - last
+			} else {
+				used += v // the component restarted
+			}
+		}
+		c.last[u] = v
+	}
+	elapsed := now.Sub(c.lastScrape)
+	c.lastScrape = now
+	if first {
+		c.window = make(map[string]*costUsage) // requests before the first scrape have no CPU to compare with
+		return
+	}
+	used -= c.baseline * elapsed.Seconds()
+	if used < 0 {
+		used = 0
+	}
+
+	var inspected int64
+	var seconds float64
+	for _, u := range c.window {
+		inspected += u.bytes
+		seconds += u.seconds
+	}
+	if inspected == 0 && seconds == 0 {
+		c.unattributed += used
+	}
+	for name, u := range c.window {
+		share := 0.0
+		if inspected > 0 {
+			share = float64(u.bytes) / float64(inspected)
+		} else if seconds > 0 {
+			share = u.seconds / seconds
+		}
+		t := c.totals[name]
+		if t == nil {
+			t = &costUsage{}
+			c.totals[name] = t
+		}
+		t.requests += u.requests
+		t.bytes += u.bytes
+		t.seconds += u.seconds
+		t.cpu += used * share
+		c.cpu.WithLabelValues(name).Add(used * share)
+	}
+	c.window = make(map[string]*costUsage)
+}
+
+// sumCounter returns the sum of the samples of a metric in the Prometheus text format
+func sumCounter(data []byte, metric string) (float64, error) {
+	var sum float64
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, metric) {
+			continue
+		}
+		rest := line[len(metric):]
+		switch {
+		case strings.HasPrefix(rest, "{"):
+			end := strings.LastIndex(rest, "}")
+			if end < 0 {
+				continue
+			}
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, " "):
+		default:
+			continue // another metric sharing the prefix
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s sample %q", metric, line)
+		}
+		sum += v
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no %s samples", metric)
+	}
+	return sum, nil
+}
+
+// results scrapes once more to attribute the last interval and returns the cost of every query,
+// the most expensive per request first, with the CPU seconds that no query was running for
+func (c *costAttribution) results() ([]queryCost, float64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.scrape()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total float64
+	for _, t := range c.totals {
+		total += t.cpu
+	}
+	var results []queryCost
+	for name, t := range c.totals {
+		r := queryCost{Query: name, Requests: t.requests, InspectedBytes: t.bytes, CPUSeconds: t.cpu}
+		if t.requests > 0 {
+			r.CPUSecondsPerRequest = t.cpu / float64(t.requests)
+		}
+		if total > 0 {
+			r.SharePct = t.cpu / total * 100
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].CPUSecondsPerRequest != results[j].CPUSecondsPerRequest {
+			return results[i].CPUSecondsPerRequest > results[j].CPUSecondsPerRequest
+		}
+		return results[i].Query < results[j].Query
+	})
+	return results, c.unattributed
+}
+
+// writeCosts appends the Markdown cost attribution
+func writeCosts(b *strings.Builder, results []queryCost, unattributed float64) {
+	if len(results) == 0 {
+		return
+	}
+	b.WriteString("\n#### Estimated cost per query\n\n")
+	b.WriteString("| Query | Requests | Inspected per request | CPU | CPU per request | Share |\n|:--|--:|--:|--:|--:|--:|\n")
+	for _, r := range results {
+		perRequest := 0.0
+		if r.Requests > 0 {
+			perRequest = float64(r.InspectedBytes) / float64(r.Requests)
+		}
+		fmt.Fprintf(b, "| `%s` | %d | %s | %s | %s | %.1f%% |\n", r.Query, r.Requests, formatByteSize(perRequest),
+			formatSeconds(r.CPUSeconds), formatSeconds(r.CPUSecondsPerRequest), r.SharePct)
+	}
+	if unattributed > 0 {
+		fmt.Fprintf(b, "\n%.1f CPU seconds above the baseline were used while no query ran.\n", unattributed)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Deadline hint formats
+const (
+	deadlineFormatGRPC    = "grpc"         // Grpc-Timeout style: up to 8 digits and a unit, e.g. "900S" or "1500m"
+	deadlineFormatSeconds = "seconds"      // decimal seconds, e.g. "900" or "1.5"
+	deadlineFormatMillis  = "milliseconds" // integer milliseconds
+	deadlineFormatGo      = "duration"     // Go duration, e.g. "15m0s"
+	deadlineFormatRFC3339 = "rfc3339"      // absolute deadline, e.g. "2025-11-27T00:15:00.000Z"
+	deadlineFormatUnixMs  = "unix-ms"      // absolute deadline in Unix milliseconds
+
+	// grpcTimeoutMaxValue is the largest value of a Grpc-Timeout header
+	grpcTimeoutMaxValue = 99999999
+)
+
+// DeadlineHintConfig sends the client timeout of each request as a header, so the server can
+// give up on requests the client no longer waits for
+type DeadlineHintConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Header  string `yaml:"header"` // Header name (default: Grpc-Timeout)
+	Format  string `yaml:"format"` // "grpc" (default), "seconds", "milliseconds", "duration", "rfc3339" or "unix-ms"
+	// Fraction of requests sent with the hint (default: 1); the others run without it to compare
+	// latency and outcomes with and without the hint
+	Ratio *float64 `yaml:"ratio"`
+}
+
+// deadlineHints adds the deadline hint to requests (nil when disabled)
+var deadlineHints *deadlineHinter
+
+// deadlineHinter sets the hint header and records latency and outcomes with and without it
+type deadlineHinter struct {
+	header   string
+	format   string
+	ratio    float64
+	latency  *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+}
+
+// newDeadlineHinter validates the deadline hint config and registers its metrics
+func newDeadlineHinter(cfg DeadlineHintConfig) (*deadlineHinter, error) {
+	h := &deadlineHinter{header: "Grpc-Timeout", format: deadlineFormatGRPC, ratio: 1}
+	if cfg.Header != "" {
+		h.header = http.CanonicalHeaderKey(cfg.Header)
+	}
+	if cfg.Format != "" {
+		h.format = strings.ToLower(cfg.Format)
+	}
+	switch h.format {
+	case deadlineFormatGRPC, deadlineFormatSeconds, deadlineFormatMillis, deadlineFormatGo, deadlineFormatRFC3339, deadlineFormatUnixMs:
+	default:
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	if cfg.Ratio != nil {
+		if *cfg.Ratio < 0 || *cfg.Ratio > 1 {
+			return nil, fmt.Errorf("ratio must be between 0 and 1, got %g", *cfg.Ratio)
+		}
+		h.ratio = *cfg.Ratio
+	}
+
+	h.latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "deadline_hint",
+		Name:      "duration_seconds",
+		Help:      "Query latency by name, with (hint=true) or without the deadline hint header",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"name", "hint"})
+	h.requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "deadline_hint",
+		Name:      "requests_total",
+		Help:      "Requests by name, deadline hint and outcome (status class, or error for transport errors and client timeouts)",
+	}, []string{"name", "hint", "outcome"})
+	return h, nil
+}
+
+// apply adds the hint for a request sent now with the given client timeout, to the configured
+// ratio of requests; it reports whether the hint was sent
+func (h *deadlineHinter) apply(req *http.Request, timeout time.Duration) bool {
+	if h == nil {
+		return false
+	}
+	if h.ratio < 1 && rand.Float64() >= h.ratio {
+		req.Header.Del(h.header)
+		return false
+	}
+	req.Header.Set(h.header, h.value(time.Now(), timeout))
+	return true
+}
+
+// value formats the hint of a timeout starting at now
+func (h *deadlineHinter) value(now time.Time, timeout time.Duration) string {
+	switch h.format {
+	case deadlineFormatSeconds:
+		return strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+	case deadlineFormatMillis:
+		return strconv.FormatInt(timeout.Milliseconds(), 10)
+	case deadlineFormatGo:
+		return timeout.String()
+	case deadlineFormatRFC3339:
+		return now.Add(timeout).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	case deadlineFormatUnixMs:
+		return strconv.FormatInt(now.Add(timeout).UnixNano()/int64(time.Millisecond), 10)
+	default:
+		return grpcTimeout(timeout)
+	}
+}
+
+// grpcTimeout encodes a timeout like gRPC: the finest unit whose value fits in 8 digits,
+// rounded up so the server never sees a shorter deadline than the client's
+func grpcTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "0n"
+	}
+	units := []struct {
+		d    time.Duration
+		unit string
+	}{
+		{time.Nanosecond, "n"}, {time.Microsecond, "u"}, {time.Millisecond, "m"},
+		{time.Second, "S"}, {time.Minute, "M"}, {time.Hour, "H"},
+	}
+	for _, u := range units {
+		if v := (timeout + u.d - 1) / u.d; v <= grpcTimeoutMaxValue {
+			return strconv.FormatInt(int64(v), 10) + u.unit
+		}
+	}
+	return strconv.Itoa(grpcTimeoutMaxValue) + "H"
+}
+
+// record counts the outcome of a request; status is 0 for transport errors
+func (h *deadlineHinter) record(queryName string, hinted bool, status int, latency time.Duration) {
+	if h == nil {
+		return
+	}
+	hint := strconv.FormatBool(hinted)
+	outcome := "error"
+	if status > 0 {
+		outcome = statusClass(status)
+		h.latency.WithLabelValues(queryName, hint).Observe(latency.Seconds())
+	}
+	h.requests.WithLabelValues(queryName, hint, outcome).Inc()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// debugSamplesPrefix is the path of the response samples on the metrics server
+	debugSamplesPrefix = "/debug/samples"
+
+	defaultDebugSampleBytes = 1 << 20
+)
+
+// DebugSamplesConfig keeps the last responses of each query in memory for spot checks
+type DebugSamplesConfig struct {
+	PerQuery     int `yaml:"perQuery"`     // Responses kept per query (default: 0 = disabled)
+	MaxBodyBytes int `yaml:"maxBodyBytes"` // Longer bodies are truncated (default: 1 MiB)
+}
+
+// debugSamples keeps recent responses per query (nil when disabled)
+var debugSamples *responseSamples
+
+// responseSamples is a ring buffer of the last responses of each query, served as JSON:
+//
+//	GET /debug/samples          queries with the status and size of their kept responses
+//	GET /debug/samples/{name}   the kept responses of a query with their bodies, newest first
+type responseSamples struct {
+	perQuery int
+	maxBytes int
+
+	mu      sync.Mutex
+	queries map[string]*responseRing
+}
+
+// responseRing holds the last responses of one query
+type responseRing struct {
+	entries []responseSample
+	next    int // index the next response is written to
+}
+
+// responseSample is a response kept for inspection; the URL, tenant and body are redacted like
+// failure captures
+type responseSample struct {
+	Timestamp      time.Time   `json:"timestamp"`
+	Bucket         string      `json:"bucket"`
+	Tenant         string      `json:"tenant"`
+	URL            string      `json:"url"`
+	Status         int         `json:"status"`
+	LatencySeconds float64     `json:"latencySeconds"`
+	Spans          int         `json:"spans"`
+	Bytes          int64       `json:"bytes"`
+	Truncated      bool        `json:"truncated,omitempty"`
+	Body           interface{} `json:"body,omitempty"` // JSON bodies as-is, others as a string
+}
+
+// newResponseSamples validates the config; the endpoint serves response data, so it is only
+// available behind the server's basic auth
+func newResponseSamples(cfg DebugSamplesConfig, server ServerConfig) (*responseSamples, error) {
+	if cfg.PerQuery < 0 || cfg.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("perQuery and maxBodyBytes must be >= 0")
+	}
+	if server.BasicAuth.Username == "" {
+		return nil, fmt.Errorf("%s serves response bodies and needs server.basicAuth", debugSamplesPrefix)
+	}
+	s := &responseSamples{perQuery: cfg.PerQuery, maxBytes: cfg.MaxBodyBytes, queries: make(map[string]*responseRing)}
+	if s.maxBytes == 0 {
+		s.maxBytes = defaultDebugSampleBytes
+	}
+	return s, nil
+}
+
+// capture copies a response body, which may come from a pooled buffer, for a later record
+func (s *responseSamples) capture(body []byte) []byte {
+	if s == nil {
+		return nil
+	}
+	n := len(body)
+	if n > s.maxBytes {
+		n = s.maxBytes
+	}
+	return append([]byte(nil), body[:n]...)
+}
+
+// record keeps a response of a query, replacing its oldest kept response when the ring is full
+func (s *responseSamples) record(sample *requestSample, u *url.URL, body []byte) {
+	if s == nil {
+		return
+	}
+	entry := responseSample{
+		Timestamp:      sample.Timestamp,
+		Bucket:         sample.Bucket,
+		Tenant:         redaction.tenant(sample.Tenant),
+		URL:            redaction.url(u),
+		Status:         sample.Status,
+		LatencySeconds: sample.LatencySeconds,
+		Spans:          sample.Spans,
+		Bytes:          sample.Bytes,
+		Truncated:      int64(len(body)) < sample.Bytes,
+	}
+	if len(body) > 0 {
+		body = redaction.body(body)
+		if !entry.Truncated && json.Valid(body) {
+			entry.Body = json.RawMessage(body)
+		} else {
+			entry.Body = string(body)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.queries[sample.Query]
+	if !ok {
+		ring = &responseRing{}
+		s.queries[sample.Query] = ring
+	}
+	if len(ring.entries) < s.perQuery {
+		ring.entries = append(ring.entries, entry)
+	} else {
+		ring.entries[ring.next] = entry
+	}
+	ring.next = (ring.next + 1) % s.perQuery
+}
+
+// newest returns the kept responses of a query, newest first
+func (r *responseRing) newest() []responseSample {
+	out := make([]responseSample, 0, len(r.entries))
+	for i := 1; i <= len(r.entries); i++ {
+		out = append(out, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return out
+}
+
+func (s *responseSamples) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, debugSamplesPrefix), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		type querySamples struct {
+			Name      string           `json:"name"`
+			Responses []responseSample `json:"responses"`
+		}
+		list := make([]querySamples, 0, len(s.queries))
+		for query, ring := range s.queries {
+			responses := ring.newest()
+			for i := range responses {
+				responses[i].Body = nil
+			}
+			list = append(list, querySamples{Name: query, Responses: responses})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		writeJSON(w, list)
+		return
+	}
+	ring, ok := s.queries[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("no responses kept for query %q", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, ring.newest())
+}
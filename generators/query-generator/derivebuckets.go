@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tempo defaults of the settings the derived buckets are based on
+const (
+	tempoDefaultMaxBlockDuration     = 30 * time.Minute
+	tempoDefaultCompleteBlockTimeout = 15 * time.Minute
+	tempoDefaultBlockRetention       = 14 * 24 * time.Hour
+	tempoDefaultQueryBackendAfter    = 15 * time.Minute
+	tempoDefaultQueryIngestersUntil  = 30 * time.Minute
+
+	defaultDerivedBackendWindow = time.Hour
+	defaultDerivedEdgeWindow    = time.Hour
+)
+
+// DerivedBucketsConfig derives the time buckets from the configuration of the Tempo under test,
+// so bucket boundaries follow its ingester, query-frontend and retention settings
+type DerivedBucketsConfig struct {
+	TempoConfig string        `yaml:"tempoConfig"` // Path of the Tempo config file, e.g. a mounted copy of its ConfigMap
+	StatusURL   string        `yaml:"statusURL"`   // Tempo's /status/config endpoint, e.g. http://tempo:3200/status/config
+	Fetch       CatalogConfig `yaml:"fetch"`       // Headers, credentials and timeout of statusURL
+	// Length of the backend bucket after the ingesters stop being queried (default: 1h)
+	BackendWindow string `yaml:"backendWindow"`
+	// Length of the retention-edge bucket, which ends at the block retention (default: 1h)
+	EdgeWindow string `yaml:"edgeWindow"`
+}
+
+// tempoSettings are the Tempo settings that decide where a query's data is read from
+type tempoSettings struct {
+	Ingester struct {
+		MaxBlockDuration     string `yaml:"max_block_duration"`
+		CompleteBlockTimeout string `yaml:"complete_block_timeout"`
+	} `yaml:"ingester"`
+	Compactor struct {
+		Compaction struct {
+			BlockRetention string `yaml:"block_retention"`
+		} `yaml:"compaction"`
+	} `yaml:"compactor"`
+	QueryFrontend struct {
+		Search struct {
+			QueryBackendAfter   string `yaml:"query_backend_after"`
+			QueryIngestersUntil string `yaml:"query_ingesters_until"`
+		} `yaml:"search"`
+	} `yaml:"query_frontend"`
+}
+
+// applyDerivedBuckets adds the buckets derived from the Tempo configuration to the config;
+// configured buckets of the same name take precedence
+func applyDerivedBuckets(config *Config) error {
+	cfg := config.TimeBucketsFrom
+	if cfg.TempoConfig == "" && cfg.StatusURL == "" {
+		return nil
+	}
+	derived, err := deriveTimeBuckets(cfg)
+	if err != nil {
+		return fmt.Errorf("timeBucketsFrom: %w", err)
+	}
+	configured := make(map[string]bool, len(config.TimeBuckets))
+	for _, b := range config.TimeBuckets {
+		configured[b.Name] = true
+	}
+	var buckets []TimeBucketConfig
+	for _, b := range derived {
+		if configured[b.Name] {
+			continue
+		}
+		log.Printf("Derived time bucket %s: %s to %s ago", b.Name, b.AgeStart, b.AgeEnd)
+		buckets = append(buckets, b)
+	}
+	config.TimeBuckets = append(buckets, config.TimeBuckets...)
+	return nil
+}
+
+// deriveTimeBuckets reads the Tempo settings and returns the buckets they imply:
+//
+//	ingester          only ingesters hold the data (until query_backend_after)
+//	ingester-backend  both ingesters and backend are searched (until query_ingesters_until, or
+//	                  until the ingesters flushed their blocks if that is earlier)
+//	backend           only the backend is searched (backendWindow long)
+//	retention-edge    the oldest data, about to be deleted by the compactor
+func deriveTimeBuckets(cfg DerivedBucketsConfig) ([]TimeBucketConfig, error) {
+	var data []byte
+	var err error
+	switch {
+	case cfg.TempoConfig != "" && cfg.StatusURL != "":
+		return nil, fmt.Errorf("set only one of tempoConfig and statusURL")
+	case cfg.TempoConfig != "":
+		data, err = os.ReadFile(cfg.TempoConfig)
+	default:
+		data, err = cfg.Fetch.get(cfg.StatusURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var settings tempoSettings
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse the Tempo configuration: %w", err)
+	}
+
+	var maxBlock, completeTimeout, retention, backendAfter, ingestersUntil, backendWindow, edgeWindow time.Duration
+	for _, d := range []struct {
+		name  string
+		value string
+		def   time.Duration
+		out   *time.Duration
+	}{
+		{"ingester.max_block_duration", settings.Ingester.MaxBlockDuration, tempoDefaultMaxBlockDuration, &maxBlock},
+		{"ingester.complete_block_timeout", settings.Ingester.CompleteBlockTimeout, tempoDefaultCompleteBlockTimeout, &completeTimeout},
+		{"compactor.compaction.block_retention", settings.Compactor.Compaction.BlockRetention, tempoDefaultBlockRetention, &retention},
+		{"query_frontend.search.query_backend_after", settings.QueryFrontend.Search.QueryBackendAfter, tempoDefaultQueryBackendAfter, &backendAfter},
+		{"query_frontend.search.query_ingesters_until", settings.QueryFrontend.Search.QueryIngestersUntil, tempoDefaultQueryIngestersUntil, &ingestersUntil},
+		{"backendWindow", cfg.BackendWindow, defaultDerivedBackendWindow, &backendWindow},
+		{"edgeWindow", cfg.EdgeWindow, defaultDerivedEdgeWindow, &edgeWindow},
+	} {
+		*d.out = d.def
+		if d.value == "" {
+			continue
+		}
+		v, err := parseExtendedDuration(d.value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid %s %q", d.name, d.value)
+		}
+		*d.out = v
+	}
+
+	// Ingesters keep a block until it is cut and flushed
+	inIngesters := ingestersUntil
+	if flushed := maxBlock + completeTimeout; flushed < inIngesters {
+		inIngesters = flushed
+	}
+	edgeStart := retention - edgeWindow
+	backendEnd := inIngesters + backendWindow
+	if backendEnd > edgeStart {
+		backendEnd = edgeStart
+	}
+
+	var buckets []TimeBucketConfig
+	add := func(name string, start, end time.Duration, weight int) {
+		if end > start && start >= 0 {
+			buckets = append(buckets, TimeBucketConfig{Name: name, AgeStart: start.String(), AgeEnd: end.String(), Weight: weight})
+		}
+	}
+	add("ingester", 0, backendAfter, 40)
+	add("ingester-backend", backendAfter, inIngesters, 30)
+	add("backend", inIngesters, backendEnd, 20)
+	add("retention-edge", edgeStart, retention, 10)
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("the Tempo settings leave no bucket")
+	}
+	return buckets, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTempoConfig writes a Tempo config file and returns its path
+func writeTempoConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tempo.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDeriveTimeBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tempo string
+		cfg   DerivedBucketsConfig
+		want  []TimeBucketConfig
+	}{
+		{
+			"tempo defaults",
+			"server:\n  http_listen_port: 3200\n",
+			DerivedBucketsConfig{},
+			[]TimeBucketConfig{
+				{Name: "ingester", AgeStart: "0s", AgeEnd: "15m0s", Weight: 40},
+				{Name: "ingester-backend", AgeStart: "15m0s", AgeEnd: "30m0s", Weight: 30},
+				{Name: "backend", AgeStart: "30m0s", AgeEnd: "1h30m0s", Weight: 20},
+				{Name: "retention-edge", AgeStart: "335h0m0s", AgeEnd: "336h0m0s", Weight: 10},
+			},
+		},
+		{
+			// Blocks are flushed before query_ingesters_until, so the backend takes over earlier
+			"early flush",
+			`
+ingester:
+  max_block_duration: 5m
+  complete_block_timeout: 10m
+compactor:
+  compaction:
+    block_retention: 2d
+query_frontend:
+  search:
+    query_backend_after: 5m
+    query_ingesters_until: 1h
+`,
+			DerivedBucketsConfig{BackendWindow: "2h", EdgeWindow: "30m"},
+			[]TimeBucketConfig{
+				{Name: "ingester", AgeStart: "0s", AgeEnd: "5m0s", Weight: 40},
+				{Name: "ingester-backend", AgeStart: "5m0s", AgeEnd: "15m0s", Weight: 30},
+				{Name: "backend", AgeStart: "15m0s", AgeEnd: "2h15m0s", Weight: 20},
+				{Name: "retention-edge", AgeStart: "47h30m0s", AgeEnd: "48h0m0s", Weight: 10},
+			},
+		},
+		{
+			// The backend bucket stops where the retention edge starts
+			"short retention",
+			"compactor:\n  compaction:\n    block_retention: 2h\n",
+			DerivedBucketsConfig{BackendWindow: "6h"},
+			[]TimeBucketConfig{
+				{Name: "ingester", AgeStart: "0s", AgeEnd: "15m0s", Weight: 40},
+				{Name: "ingester-backend", AgeStart: "15m0s", AgeEnd: "30m0s", Weight: 30},
+				{Name: "backend", AgeStart: "30m0s", AgeEnd: "1h0m0s", Weight: 20},
+				{Name: "retention-edge", AgeStart: "1h0m0s", AgeEnd: "2h0m0s", Weight: 10},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.TempoConfig = writeTempoConfig(t, tc.tempo)
+			got, err := deriveTimeBuckets(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("buckets = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeriveTimeBucketsStatusURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/config" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "query_frontend:\n  search:\n    query_backend_after: 10m\n")
+	}))
+	defer server.Close()
+
+	buckets, err := deriveTimeBuckets(DerivedBucketsConfig{StatusURL: server.URL + "/status/config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buckets[0].Name != "ingester" || buckets[0].AgeEnd != "10m0s" {
+		t.Errorf("first bucket = %+v, want ingester up to 10m", buckets[0])
+	}
+	if _, err := deriveTimeBuckets(DerivedBucketsConfig{StatusURL: server.URL + "/missing"}); err == nil {
+		t.Errorf("a 404 from statusURL was accepted")
+	}
+}
+
+func TestDeriveTimeBucketsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tempo string
+		cfg   DerivedBucketsConfig
+	}{
+		{"both sources", "", DerivedBucketsConfig{StatusURL: "http://tempo:3200/status/config"}},
+		{"invalid duration", "ingester:\n  max_block_duration: soon\n", DerivedBucketsConfig{}},
+		{"invalid window", "", DerivedBucketsConfig{BackendWindow: "-1h"}},
+		{"not YAML", "ingester: [", DerivedBucketsConfig{}},
+		{"no bucket left", `
+compactor:
+  compaction:
+    block_retention: 0s
+query_frontend:
+  search:
+    query_backend_after: 0s
+    query_ingesters_until: 0s
+`, DerivedBucketsConfig{}},
+	} {
+		tc.cfg.TempoConfig = writeTempoConfig(t, tc.tempo)
+		if buckets, err := deriveTimeBuckets(tc.cfg); err == nil {
+			t.Errorf("%s: deriveTimeBuckets = %+v, want an error", tc.name, buckets)
+		}
+	}
+}
+
+func TestApplyDerivedBuckets(t *testing.T) {
+	config := &Config{
+		TimeBucketsFrom: DerivedBucketsConfig{TempoConfig: writeTempoConfig(t, "{}\n")},
+		TimeBuckets:     []TimeBucketConfig{{Name: "backend", AgeStart: "2h", AgeEnd: "3h"}, {Name: "custom", AgeStart: "1d", AgeEnd: "2d"}},
+	}
+	if err := applyDerivedBuckets(config); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range config.TimeBuckets {
+		names = append(names, b.Name+"="+b.AgeStart)
+	}
+	// Configured buckets of the same name take precedence over the derived ones
+	want := []string{"ingester=0s", "ingester-backend=15m0s", "retention-edge=335h0m0s", "backend=2h", "custom=1d"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("buckets = %v, want %v", names, want)
+	}
+
+	unset := &Config{TimeBuckets: []TimeBucketConfig{{Name: "custom"}}}
+	if err := applyDerivedBuckets(unset); err != nil || len(unset.TimeBuckets) != 1 {
+		t.Errorf("without timeBucketsFrom: %v, %d buckets, want the configured bucket only", err, len(unset.TimeBuckets))
+	}
+}
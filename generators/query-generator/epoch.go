@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// resolveDataEpoch determines the moment from which data is assumed to exist, used for bucket eligibility.
+//
+// dataEpoch may be an RFC3339 timestamp or "now-<duration>" (e.g. "now-24h" for a cluster pre-seeded
+// with a day of data). When unset, the test start time is used.
+func resolveDataEpoch(dataEpoch string, testStart, now time.Time) (time.Time, error) {
+	if dataEpoch != "" {
+		if strings.HasPrefix(dataEpoch, "now-") {
+			d, err := parseExtendedDuration(strings.TrimPrefix(dataEpoch, "now-"))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid dataEpoch %q: %v", dataEpoch, err)
+			}
+			return now.Add(-d), nil
+		}
+		t, err := time.Parse(time.RFC3339, dataEpoch)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid dataEpoch %q: expected RFC3339 or now-<duration>", dataEpoch)
+		}
+		return t, nil
+	}
+	return testStart, nil
+}
+
+// resolveTestStart returns the test start time; if startTimeFile is set, the start time is persisted
+// there so a restarted pod keeps the original epoch and query schedules instead of starting over.
+func resolveTestStart(startTimeFile string, now time.Time) (time.Time, error) {
+	if startTimeFile == "" {
+		return now, nil
+	}
+
+	data, err := os.ReadFile(startTimeFile)
+	if err == nil {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid start time in %s: %v", startTimeFile, err)
+		}
+		log.Printf("Restored test start time %s from %s", t.Format(time.RFC3339), startTimeFile)
+		return t, nil
+	}
+	if !os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("failed to read start time file: %w", err)
+	}
+
+	if err := os.WriteFile(startTimeFile, []byte(now.Format(time.RFC3339)+"\n"), 0o644); err != nil {
+		return time.Time{}, fmt.Errorf("failed to persist start time: %w", err)
+	}
+	log.Printf("Persisted test start time %s to %s", now.Format(time.RFC3339), startTimeFile)
+	return now, nil
+}
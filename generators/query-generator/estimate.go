@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// loadEstimate is the theoretical request volume of a config over a duration, and the response
+// data it returns when a previous run tells the size of the responses
+type loadEstimate struct {
+	Duration time.Duration
+	TotalQPS float64
+	Queries  []queryEstimate
+	Tenants  []string
+	Capped   bool // maxTotalQueries ends the run before the duration
+}
+
+// queryEstimate is the volume of a query, split by bucket
+type queryEstimate struct {
+	Name     string
+	QPS      float64
+	Active   time.Duration // time the query runs: without its startAfter/stopAfter offsets and pauses
+	Requests float64
+	Buckets  []bucketEstimate
+}
+
+// bucketEstimate is the volume of a query in one bucket; Bytes is negative when unknown
+type bucketEstimate struct {
+	Bucket   string
+	Requests float64
+	Bytes    float64
+}
+
+// estimateLoad computes the request volume of every query over the duration from the target
+// QPS, the execution plan, the query schedules and the pause windows; baseline (optional) is
+// the summary of a previous run providing response sizes from its calibration or its queries
+func estimateLoad(config *Config, duration time.Duration, baseline *runSummary) (*loadEstimate, error) {
+	queries, plan, err := expandDurationSweeps(config.Queries, config.ExecutionPlan)
+	if err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries to estimate")
+	}
+	pauseWindows, err := parsePauseWindows(config.Pauses, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &loadEstimate{Duration: duration, TotalQPS: config.Query.TargetQPS, Tenants: config.Tenants}
+	if e.TotalQPS == 0 {
+		e.TotalQPS = defaultTargetQPS
+	}
+	if config.Query.QPSMultiplier > 0 {
+		e.TotalQPS *= config.Query.QPSMultiplier
+	}
+	if len(e.Tenants) == 0 {
+		e.Tenants = []string{config.TenantID}
+	}
+	expensiveQPS := config.Query.Expensive.MaxQPS
+	if expensiveQPS == 0 {
+		expensiveQPS = defaultExpensiveMaxQPS
+	}
+
+	if len(plan) == 0 {
+		plan = defaultExecutionPlan(queries, config.TimeBuckets)
+	}
+	sizes := newResponseSizes(baseline)
+
+	var total float64
+	for _, q := range queries {
+		startAfter, stopAfter, err := q.offsets()
+		if err != nil {
+			return nil, err
+		}
+		end := duration
+		if stopAfter > 0 && stopAfter < end {
+			end = stopAfter
+		}
+		qe := queryEstimate{Name: q.Name, QPS: e.TotalQPS / float64(len(queries))}
+		if q.Class == queryClassExpensive && qe.QPS > expensiveQPS {
+			qe.QPS = expensiveQPS
+		}
+		if end > startAfter {
+			qe.Active = end - startAfter - pausedTime(pauseWindows, q.Name, startAfter, end)
+		}
+		qe.Requests = qe.QPS * qe.Active.Seconds()
+		total += qe.Requests
+
+		// Lanes share the QPS of a query in proportion to their plan entries
+		entries := make(map[string]int)
+		var buckets []string
+		for _, entry := range plan {
+			if entry.QueryName != q.Name {
+				continue
+			}
+			if entries[entry.BucketName] == 0 {
+				buckets = append(buckets, entry.BucketName)
+			}
+			entries[entry.BucketName]++
+		}
+		var n int
+		for _, count := range entries {
+			n += count
+		}
+		for _, bucket := range buckets {
+			be := bucketEstimate{Bucket: bucket, Requests: qe.Requests * float64(entries[bucket]) / float64(n), Bytes: -1}
+			if size, ok := sizes.lookup(q.Name, bucket); ok {
+				be.Bytes = be.Requests * size
+			}
+			qe.Buckets = append(qe.Buckets, be)
+		}
+		e.Queries = append(e.Queries, qe)
+	}
+
+	// The run stops once maxTotalQueries is used: scale every query down alike
+	if limit := float64(config.Query.MaxTotalQueries); limit > 0 && total > limit {
+		e.Capped = true
+		for i := range e.Queries {
+			q := &e.Queries[i]
+			q.Requests *= limit / total
+			for j := range q.Buckets {
+				b := &q.Buckets[j]
+				b.Requests *= limit / total
+				if b.Bytes > 0 {
+					b.Bytes *= limit / total
+				}
+			}
+		}
+	}
+	return e, nil
+}
+
+// pausedTime returns how long the pause windows of a query overlap [from, to] (offsets from the
+// test start), counting overlapping windows once
+func pausedTime(windows []*pauseWindow, queryName string, from, to time.Duration) time.Duration {
+	type interval struct{ start, end time.Duration }
+	var intervals []interval
+	for _, w := range windows {
+		if !w.applies(queryName) {
+			continue
+		}
+		for start := w.at; start < to; start += w.every {
+			if end := start + w.duration; end > from {
+				intervals = append(intervals, interval{start, end})
+			}
+			if w.every == 0 {
+				break
+			}
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+
+	var paused, covered time.Duration
+	covered = from
+	for _, in := range intervals {
+		start, end := in.start, in.end
+		if start < covered {
+			start = covered
+		}
+		if end > to {
+			end = to
+		}
+		if end > start {
+			paused += end - start
+			covered = end
+		}
+	}
+	return paused
+}
+
+// responseSizes holds the mean response size per query and bucket (calibration) and per query
+// (run totals) of a previous run
+type responseSizes struct {
+	buckets map[string]float64 // by query + "|" + bucket
+	queries map[string]float64
+}
+
+func newResponseSizes(baseline *runSummary) responseSizes {
+	s := responseSizes{buckets: make(map[string]float64), queries: make(map[string]float64)}
+	if baseline == nil {
+		return s
+	}
+	for _, c := range baseline.Calibration {
+		if c.Error == "" && c.Bytes > 0 {
+			s.buckets[c.Query+"|"+c.Bucket] = float64(c.Bytes)
+		}
+	}
+	for _, q := range baseline.Queries {
+		if q.AvgBytes > 0 {
+			s.queries[q.Name] = q.AvgBytes
+		}
+	}
+	return s
+}
+
+// lookup returns the response size of a query in a bucket: its calibration baseline, or else
+// the mean of the query over the whole run
+func (s responseSizes) lookup(query, bucket string) (float64, bool) {
+	if size, ok := s.buckets[query+"|"+bucket]; ok {
+		return size, true
+	}
+	size, ok := s.queries[query]
+	return size, ok
+}
+
+// writeLoadEstimate prints the estimate per query, per query and bucket and per tenant
+func writeLoadEstimate(out io.Writer, e *loadEstimate) {
+	fmt.Fprintf(out, "\nLoad estimate over %s at %.4g QPS in total:\n\n", e.Duration, e.TotalQPS)
+
+	var requests, bytes float64
+	unknown := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUERY\tBUCKET\tQPS\tACTIVE\tREQUESTS\tRESPONSE DATA")
+	for _, q := range e.Queries {
+		fmt.Fprintf(w, "%s\t*\t%.4g\t%s\t%.0f\t\n", q.Name, q.QPS, q.Active, q.Requests)
+		for _, b := range q.Buckets {
+			data := "unknown"
+			if b.Bytes >= 0 {
+				data = formatByteSize(b.Bytes)
+				bytes += b.Bytes
+			} else {
+				unknown++
+			}
+			fmt.Fprintf(w, "\t%s\t\t\t%.0f\t%s\n", b.Bucket, b.Requests, data)
+		}
+		requests += q.Requests
+	}
+	w.Flush()
+
+	if len(e.Tenants) > 1 {
+		fmt.Fprintf(out, "\nRequests rotate across %d tenants: %.0f each (%s)\n",
+			len(e.Tenants), requests/float64(len(e.Tenants)), strings.Join(e.Tenants, ", "))
+	}
+	fmt.Fprintf(out, "\nTotal: %.0f requests", requests)
+	if e.Capped {
+		fmt.Fprintf(out, " (maxTotalQueries ends the run early)")
+	}
+	fmt.Fprintf(out, ", %s of response data", formatByteSize(bytes))
+	if unknown > 0 {
+		fmt.Fprintf(out, " plus %d query/bucket pairs of unknown size (pass -baseline with the JSON summary of a previous run)", unknown)
+	}
+	fmt.Fprintln(out)
+}
+
+// formatByteSize formats a byte count with a binary unit, e.g. "1.5 GiB"
+func formatByteSize(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", b)
+	}
+	return fmt.Sprintf("%.1f %s", b, units[i])
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Query classes
+const (
+	queryClassStandard  = "standard"
+	queryClassExpensive = "expensive" // Long-range (e.g. 24h/7d) queries with their own limits
+)
+
+// Defaults of request timeouts and the expensive query class
+const (
+	defaultQueryTimeout     = 15 * time.Minute
+	defaultExpensiveTimeout = 30 * time.Minute
+	defaultExpensiveMaxQPS  = 0.1
+	defaultBreakerThreshold = 5
+	defaultBreakerOpenFor   = time.Minute
+)
+
+// defaultExpensiveBuckets are latency histogram buckets (seconds) sized for long-range queries
+var defaultExpensiveBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800}
+
+// Circuit breaker states exported by query_load_test_expensive_circuit_breaker_state
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+// ExpensiveConfig configures the expensive query class
+type ExpensiveConfig struct {
+	Timeout        string               `yaml:"timeout"`        // Request timeout (default: 30m)
+	MaxQPS         float64              `yaml:"maxQPS"`         // QPS cap of each expensive query (default: 0.1)
+	Buckets        []float64            `yaml:"buckets"`        // Latency histogram buckets in seconds (default: 1s to 30m)
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"` // Stop sending a query while it keeps failing
+}
+
+// CircuitBreakerConfig configures the circuit breaker of each expensive query
+type CircuitBreakerConfig struct {
+	FailureThreshold int    `yaml:"failureThreshold"` // Consecutive failures that open the breaker (default: 5)
+	OpenFor          string `yaml:"openFor"`          // How long requests are skipped before a probe (default: 1m)
+}
+
+// validateQueryClass checks the class of a query
+func validateQueryClass(class string) error {
+	switch class {
+	case "", queryClassStandard, queryClassExpensive:
+		return nil
+	default:
+		return fmt.Errorf("unknown class %q (expected %s or %s)", class, queryClassStandard, queryClassExpensive)
+	}
+}
+
+// expensiveClass holds the settings and metrics shared by the expensive queries
+type expensiveClass struct {
+	timeout   time.Duration
+	maxQPS    float64
+	threshold int
+	openFor   time.Duration
+
+	latency      *prometheus.HistogramVec
+	breakerState *prometheus.GaugeVec
+	skipped      *prometheus.CounterVec
+}
+
+// newExpensiveClass validates the expensive class settings and registers its metrics
+func newExpensiveClass(cfg ExpensiveConfig) (*expensiveClass, error) {
+	c := &expensiveClass{
+		timeout:   defaultExpensiveTimeout,
+		maxQPS:    defaultExpensiveMaxQPS,
+		threshold: defaultBreakerThreshold,
+		openFor:   defaultBreakerOpenFor,
+	}
+	var err error
+	if cfg.Timeout != "" {
+		if c.timeout, err = time.ParseDuration(cfg.Timeout); err != nil || c.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", cfg.Timeout)
+		}
+	}
+	if cfg.MaxQPS < 0 {
+		return nil, fmt.Errorf("maxQPS must not be negative")
+	}
+	if cfg.MaxQPS > 0 {
+		c.maxQPS = cfg.MaxQPS
+	}
+	if cfg.CircuitBreaker.FailureThreshold < 0 {
+		return nil, fmt.Errorf("circuitBreaker.failureThreshold must not be negative")
+	}
+	if cfg.CircuitBreaker.FailureThreshold > 0 {
+		c.threshold = cfg.CircuitBreaker.FailureThreshold
+	}
+	if cfg.CircuitBreaker.OpenFor != "" {
+		if c.openFor, err = time.ParseDuration(cfg.CircuitBreaker.OpenFor); err != nil || c.openFor <= 0 {
+			return nil, fmt.Errorf("invalid circuitBreaker.openFor %q", cfg.CircuitBreaker.OpenFor)
+		}
+	}
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = defaultExpensiveBuckets
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, fmt.Errorf("buckets must be increasing")
+		}
+	}
+
+	c.latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "expensive",
+		Name:      "duration_seconds",
+		Help:      "Latency of expensive (long-range) queries",
+		Buckets:   buckets,
+	}, []string{"name"})
+	c.breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "expensive",
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state of expensive queries (0 = closed, 1 = open, 2 = half-open)",
+	}, []string{"name"})
+	c.skipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "expensive",
+		Name:      "skipped_total",
+		Help:      "Requests of expensive queries skipped while their circuit breaker was open",
+	}, []string{"name"})
+	return c, nil
+}
+
+// newBreaker creates the circuit breaker of an expensive query
+func (c *expensiveClass) newBreaker(query string) *circuitBreaker {
+	b := &circuitBreaker{
+		query:     query,
+		threshold: c.threshold,
+		openFor:   c.openFor,
+		state:     c.breakerState.WithLabelValues(query),
+		skipped:   c.skipped.WithLabelValues(query),
+	}
+	b.state.Set(breakerClosed)
+	return b
+}
+
+// circuitBreaker stops a query's requests after consecutive failures, so a long-range query
+// that keeps timing out does not tie up workers and server capacity. Once openFor has passed
+// a single probe is let through; its outcome closes or re-opens the breaker.
+type circuitBreaker struct {
+	query     string
+	threshold int
+	openFor   time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time // zero while closed
+	probing   bool
+
+	state   prometheus.Gauge
+	skipped prometheus.Counter
+}
+
+// allow reports whether a request may be sent (always true for a nil breaker)
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		b.skipped.Inc()
+		return false
+	}
+	b.probing = true
+	b.state.Set(breakerHalfOpen)
+	return true
+}
+
+// record adds the outcome of a request
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		if !b.openUntil.IsZero() {
+			log.Printf("Query %s: circuit breaker closed", b.query)
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		b.state.Set(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.probing || (b.openUntil.IsZero() && b.failures >= b.threshold) {
+		log.Printf("Query %s: circuit breaker open for %s after %d consecutive failures", b.query, b.openFor, b.failures)
+		b.openUntil = time.Now().Add(b.openFor)
+		b.probing = false
+		b.state.Set(breakerOpen)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runFederateCommand merges the JSON summaries of generators running against different
+// clusters (regions, hardware profiles, ...) into one report comparing them query by query
+func runFederateCommand(args []string) error {
+	fs := flag.NewFlagSet("federate", flag.ExitOnError)
+	out := fs.String("out", "federation", "directory federation.json and federation.md are written to")
+	timezone := fs.String("timezone", "", "timezone of log timestamps and the clusters' start times in federation.md, e.g. Europe/Berlin (default: UTC)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: federate [flags] [cluster=]summary.json...\n")
+		fmt.Fprintf(fs.Output(), "The cluster label defaults to the summary's cluster (report.cluster), else its file name.\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf("federate needs the summaries of at least two clusters")
+	}
+	zone, err := loadTimezone(*timezone)
+	if err != nil {
+		return err
+	}
+	useLogTimezone(zone)
+
+	var clusters []federatedSummary
+	seen := make(map[string]string)
+	for _, arg := range fs.Args() {
+		label, path := "", arg
+		if i := strings.Index(arg, "="); i > 0 {
+			label, path = arg[:i], arg[i+1:]
+		}
+		summary, err := loadSummaryJSON(path)
+		if err != nil {
+			return err
+		}
+		if label == "" {
+			label = summary.Cluster
+		}
+		if label == "" {
+			label = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if other, ok := seen[label]; ok {
+			return fmt.Errorf("%s and %s are both labeled cluster %s, label them with cluster=path", other, path, label)
+		}
+		seen[label] = path
+		clusters = append(clusters, federatedSummary{cluster: label, summary: summary})
+	}
+
+	report := newFederationReport(clusters)
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	if err := writeFederationReport(*out, report, zone); err != nil {
+		return err
+	}
+	log.Printf("Federation of %d clusters written to %s:\n%s", len(clusters), *out, report.markdown(zone))
+	return nil
+}
+
+// federatedSummary is the summary of one cluster with its label
+type federatedSummary struct {
+	cluster string
+	summary *runSummary
+}
+
+// federationCluster describes the run of one cluster
+type federationCluster struct {
+	Name            string    `json:"name"`
+	Namespace       string    `json:"namespace"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Requests        int64     `json:"requests"`
+	AchievedQPS     float64   `json:"achievedQPS"`
+}
+
+// federationResult is the result of a query in one cluster, or across all clusters
+type federationResult struct {
+	Cluster      string  `json:"cluster"`
+	Requests     int64   `json:"requests"`
+	AchievedQPS  float64 `json:"achievedQPS"`
+	P50Seconds   float64 `json:"p50Seconds"`
+	P99Seconds   float64 `json:"p99Seconds"`
+	ErrorRatePct float64 `json:"errorRatePercent"`
+	P99VsFastest float64 `json:"p99VsFastest,omitempty"` // p99 relative to the cluster with the lowest p99
+}
+
+// federationQuery compares a query across the clusters it ran in
+type federationQuery struct {
+	Name     string             `json:"name"`
+	Clusters []federationResult `json:"clusters"`
+	// Requests and QPS summed over the clusters, request-weighted error rate and the p50 and
+	// p99 of the slowest cluster (percentiles of different runs cannot be merged)
+	Combined federationResult `json:"combined"`
+}
+
+// federationReport is the combined report of several clusters
+type federationReport struct {
+	Clusters []federationCluster `json:"clusters"`
+	Queries  []federationQuery   `json:"queries"`
+}
+
+// newFederationReport merges per-query results across clusters
+func newFederationReport(clusters []federatedSummary) *federationReport {
+	report := &federationReport{}
+	byName := map[string][]federationResult{}
+	for _, c := range clusters {
+		s := c.summary
+		fc := federationCluster{Name: c.cluster, Namespace: s.Namespace, Start: s.Start, DurationSeconds: s.DurationSeconds}
+		for _, q := range s.Queries {
+			fc.Requests += q.Requests
+			fc.AchievedQPS += q.AchievedQPS
+			byName[q.Name] = append(byName[q.Name], federationResult{
+				Cluster:      c.cluster,
+				Requests:     q.Requests,
+				AchievedQPS:  q.AchievedQPS,
+				P50Seconds:   q.P50Seconds,
+				P99Seconds:   q.P99Seconds,
+				ErrorRatePct: q.ErrorRatePct,
+			})
+		}
+		report.Clusters = append(report.Clusters, fc)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		results := byName[name]
+		combined := federationResult{Cluster: "*"}
+		var fastest, errors float64
+		for _, r := range results {
+			combined.Requests += r.Requests
+			combined.AchievedQPS += r.AchievedQPS
+			errors += r.ErrorRatePct * float64(r.Requests)
+			if r.P50Seconds > combined.P50Seconds {
+				combined.P50Seconds = r.P50Seconds
+			}
+			if r.P99Seconds > combined.P99Seconds {
+				combined.P99Seconds = r.P99Seconds
+			}
+			if r.P99Seconds > 0 && (fastest == 0 || r.P99Seconds < fastest) {
+				fastest = r.P99Seconds
+			}
+		}
+		if combined.Requests > 0 {
+			combined.ErrorRatePct = errors / float64(combined.Requests)
+		}
+		if fastest > 0 {
+			for i := range results {
+				results[i].P99VsFastest = results[i].P99Seconds / fastest
+			}
+		}
+		report.Queries = append(report.Queries, federationQuery{Name: name, Clusters: results, Combined: combined})
+	}
+	return report
+}
+
+// markdown renders the federation as Markdown tables, with the clusters' start times in loc
+func (r *federationReport) markdown(loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Federation: %d clusters\n\n", len(r.Clusters))
+	b.WriteString("| Cluster | Namespace | Start | Duration | Requests | QPS |\n|:--|:--|:--|--:|--:|--:|\n")
+	for _, c := range r.Clusters {
+		fmt.Fprintf(&b, "| `%s` | `%s` | %s | %s | %d | %.2f |\n", c.Name, c.Namespace, formatZoned(c.Start, loc),
+			time.Duration(c.DurationSeconds*float64(time.Second)).Round(time.Second), c.Requests, c.AchievedQPS)
+	}
+
+	b.WriteString("\n| Query | Cluster | Requests | QPS | p50 | p99 | p99 vs fastest | Errors |\n")
+	b.WriteString("|:--|:--|--:|--:|--:|--:|--:|--:|\n")
+	for _, q := range r.Queries {
+		for _, c := range q.Clusters {
+			ratio := "-"
+			if c.P99VsFastest > 0 {
+				ratio = fmt.Sprintf("×%.2f", c.P99VsFastest)
+			}
+			fmt.Fprintf(&b, "| `%s` | `%s` | %d | %.2f | %s | %s | %s | %.2f%% |\n", q.Name, c.Cluster, c.Requests, c.AchievedQPS,
+				formatSeconds(c.P50Seconds), formatSeconds(c.P99Seconds), ratio, c.ErrorRatePct)
+		}
+		if len(q.Clusters) > 1 {
+			c := q.Combined
+			fmt.Fprintf(&b, "| `%s` | **all** | %d | %.2f | ≤ %s | ≤ %s | | %.2f%% |\n", q.Name, c.Requests, c.AchievedQPS,
+				formatSeconds(c.P50Seconds), formatSeconds(c.P99Seconds), c.ErrorRatePct)
+		}
+	}
+	return b.String()
+}
+
+// writeFederationReport writes federation.json and federation.md, with times in loc, to dir
+func writeFederationReport(dir string, r *federationReport, loc *time.Location) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "federation.json"), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "federation.md"), []byte(r.markdown(loc)), 0o644)
+}
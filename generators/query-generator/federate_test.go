@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewFederationReport(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	clusters := []federatedSummary{
+		{cluster: "eu", summary: &runSummary{Namespace: "tempo-eu", Start: start, DurationSeconds: 60, Queries: []querySummary{
+			{Name: "search", Requests: 300, AchievedQPS: 5, P50Seconds: 0.2, P99Seconds: 1, ErrorRatePct: 2},
+			{Name: "only-eu", Requests: 60, AchievedQPS: 1, P50Seconds: 0.1, P99Seconds: 0.5},
+		}}},
+		{cluster: "us", summary: &runSummary{Namespace: "tempo-us", Start: start.Add(time.Minute), DurationSeconds: 120, Queries: []querySummary{
+			{Name: "search", Requests: 100, AchievedQPS: 1, P50Seconds: 0.3, P99Seconds: 2, ErrorRatePct: 10},
+		}}},
+		{cluster: "idle", summary: &runSummary{Namespace: "tempo-idle", Queries: []querySummary{
+			{Name: "search"},
+		}}},
+	}
+
+	report := newFederationReport(clusters)
+
+	wantClusters := []federationCluster{
+		{Name: "eu", Namespace: "tempo-eu", Start: start, DurationSeconds: 60, Requests: 360, AchievedQPS: 6},
+		{Name: "us", Namespace: "tempo-us", Start: start.Add(time.Minute), DurationSeconds: 120, Requests: 100, AchievedQPS: 1},
+		{Name: "idle", Namespace: "tempo-idle"},
+	}
+	if !reflect.DeepEqual(report.Clusters, wantClusters) {
+		t.Errorf("clusters = %+v, want %+v", report.Clusters, wantClusters)
+	}
+
+	if len(report.Queries) != 2 || report.Queries[0].Name != "only-eu" || report.Queries[1].Name != "search" {
+		t.Fatalf("queries = %+v, want only-eu and search in name order", report.Queries)
+	}
+	only := report.Queries[0]
+	if len(only.Clusters) != 1 || only.Clusters[0].P99VsFastest != 1 || only.Combined.Requests != 60 {
+		t.Errorf("only-eu = %+v, want one cluster, its own fastest", only)
+	}
+
+	search := report.Queries[1]
+	for i, want := range []struct {
+		cluster      string
+		p99VsFastest float64
+	}{{"eu", 1}, {"us", 2}, {"idle", 0}} {
+		got := search.Clusters[i]
+		if got.Cluster != want.cluster || got.P99VsFastest != want.p99VsFastest {
+			t.Errorf("search in %s: p99 vs fastest = %v, want %v", got.Cluster, got.P99VsFastest, want.p99VsFastest)
+		}
+	}
+	combined := search.Combined
+	// Errors weighted by requests: (300*2 + 100*10) / 400; percentiles of the slowest cluster
+	if combined.Cluster != "*" || combined.Requests != 400 || combined.AchievedQPS != 6 ||
+		combined.P50Seconds != 0.3 || combined.P99Seconds != 2 || math.Abs(combined.ErrorRatePct-4) > 1e-9 {
+		t.Errorf("combined = %+v, want 400 requests at 6 QPS, p50 0.3s, p99 2s and 4%% errors", combined)
+	}
+}
+
+func TestNewFederationReportNoRequests(t *testing.T) {
+	report := newFederationReport([]federatedSummary{
+		{cluster: "a", summary: &runSummary{Queries: []querySummary{{Name: "q"}}}},
+		{cluster: "b", summary: &runSummary{Queries: []querySummary{{Name: "q"}}}},
+	})
+	c := report.Queries[0].Combined
+	if c.Requests != 0 || c.ErrorRatePct != 0 || math.IsNaN(c.ErrorRatePct) {
+		t.Errorf("combined = %+v, want no requests and no error rate", c)
+	}
+	for _, r := range report.Queries[0].Clusters {
+		if r.P99VsFastest != 0 {
+			t.Errorf("p99 vs fastest of %s = %v without a p99, want 0", r.Cluster, r.P99VsFastest)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// defaultFreshnessTraceQL matches the marker the collector adds to everything the write
+// generator sends (see deploy/otel-collector/collector.yaml)
+const defaultFreshnessTraceQL = `{ resource.perftest.writer = "loadgen" }`
+
+// FreshnessConfig measures how long new data takes to become searchable (ingestion lag)
+type FreshnessConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Interval   string `yaml:"interval"`   // How often the probe searches (default: 15s)
+	Lookback   string `yaml:"lookback"`   // Window ending now that is searched (default: 60s)
+	TraceQL    string `yaml:"traceql"`    // Matches the write generator's marker (default: { resource.perftest.writer = "loadgen" })
+	MostRecent bool   `yaml:"mostRecent"` // Ask for the newest traces first (Tempo 2.5+), more accurate with many matches
+}
+
+// freshness probes the ingestion lag (nil when disabled)
+var freshness *freshnessProbe
+
+// freshnessProbe periodically searches the last seconds for the write generator's marker and
+// exports how old the newest searchable trace is
+type freshnessProbe struct {
+	interval time.Duration
+	lookback time.Duration
+	traceql  string
+
+	client *probeClient
+
+	freshness prometheus.Gauge
+	probes    *prometheus.CounterVec
+}
+
+// newFreshnessProbe validates the freshness config; the probe queries the first tenant
+func newFreshnessProbe(cfg FreshnessConfig, transport http.RoundTripper, target, endpoint, tenant, timeFormat string) (*freshnessProbe, error) {
+	p := &freshnessProbe{
+		interval: 15 * time.Second,
+		lookback: 60 * time.Second,
+		traceql:  cfg.TraceQL,
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval %q", cfg.Interval)
+		}
+		p.interval = d
+	}
+	if cfg.Lookback != "" {
+		d, err := time.ParseDuration(cfg.Lookback)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid lookback %q", cfg.Lookback)
+		}
+		p.lookback = d
+	}
+	if p.traceql == "" {
+		p.traceql = defaultFreshnessTraceQL
+	}
+	if err := validateTraceQL(p.traceql); err != nil {
+		return nil, fmt.Errorf("invalid traceql %q: %v", p.traceql, err)
+	}
+	if cfg.MostRecent {
+		p.traceql += " " + mostRecentHint
+	}
+	p.client = newProbeClient(transport, p.interval, target, endpoint, tenant, timeFormat)
+
+	p.freshness = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tempo_freshness_seconds",
+		Help: "Age of the newest searchable trace of the write generator, i.e. the time until new data is searchable",
+	})
+	p.probes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "freshness",
+		Name:      "probes_total",
+		Help:      "Freshness probes by result (found, empty: no marker within the lookback, error)",
+	}, []string{"result"})
+	return p, nil
+}
+
+// run probes every interval until ctx is done
+func (p *freshnessProbe) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.probe()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe searches the lookback window once and updates the freshness gauge
+func (p *freshnessProbe) probe() {
+	now := time.Now()
+	newest, err := p.newestTraceEnd(now)
+	switch {
+	case err != nil:
+		p.probes.WithLabelValues("error").Inc()
+		log.Printf("Warning: Freshness probe failed: %s", redaction.error(err))
+	case newest.IsZero():
+		// Nothing searchable yet: the lag is at least the lookback
+		p.probes.WithLabelValues("empty").Inc()
+		p.freshness.Set(p.lookback.Seconds())
+	default:
+		p.probes.WithLabelValues("found").Inc()
+		lag := now.Sub(newest)
+		if lag < 0 {
+			lag = 0
+		}
+		p.freshness.Set(lag.Seconds())
+	}
+}
+
+// newestTraceEnd returns the end of the newest matching trace in the lookback window, or the
+// zero time when none is searchable yet
+func (p *freshnessProbe) newestTraceEnd(now time.Time) (time.Time, error) {
+	resp, err := p.client.search(p.traceql, now.Add(-p.lookback), now, 20)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var newest time.Time
+	for _, trace := range resp.Traces {
+		if end := traceEnd(trace.StartTimeUnixNano, trace.DurationMs); end.After(newest) {
+			newest = end
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GoldenResponse describes the expected structure of a query's search response
+type GoldenResponse struct {
+	Bucket             string   `yaml:"bucket"`             // Only compare responses for this bucket (default: all)
+	TraceCount         int      `yaml:"traceCount"`         // Expected number of traces (0 = not checked)
+	Tolerance          float64  `yaml:"tolerance"`          // Allowed relative deviation from traceCount (e.g. 0.2 = ±20%)
+	MinTraces          int      `yaml:"minTraces"`          // Minimum number of traces (0 = not checked)
+	MaxTraces          int      `yaml:"maxTraces"`          // Maximum number of traces (0 = not checked)
+	RequiredAttributes []string `yaml:"requiredAttributes"` // Span attribute keys that must appear in the response
+}
+
+// goldenChecker periodically compares live responses of a query against its golden file
+type goldenChecker struct {
+	golden   GoldenResponse
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// loadGoldenChecker reads a golden file; interval limits how often responses are compared
+func loadGoldenChecker(path string, interval time.Duration) (*goldenChecker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden file: %w", err)
+	}
+
+	var golden GoldenResponse
+	if err := yaml.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("failed to parse golden file %s: %w", path, err)
+	}
+
+	return &goldenChecker{golden: golden, interval: interval}, nil
+}
+
+// due reports whether a response for the given bucket should be compared now
+func (g *goldenChecker) due(bucketName string, now time.Time) bool {
+	if g.golden.Bucket != "" && g.golden.Bucket != bucketName {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.last) < g.interval {
+		return false
+	}
+	g.last = now
+	return true
+}
+
+// compare returns the names of the checks the response fails
+func (g *goldenChecker) compare(resp *TempoSearchResponse) []string {
+	var mismatches []string
+	traces := len(resp.Traces)
+
+	if g.golden.TraceCount > 0 {
+		allowed := float64(g.golden.TraceCount) * g.golden.Tolerance
+		if diff := float64(traces - g.golden.TraceCount); diff > allowed || -diff > allowed {
+			mismatches = append(mismatches, "trace_count")
+		}
+	}
+	if g.golden.MinTraces > 0 && traces < g.golden.MinTraces {
+		mismatches = append(mismatches, "min_traces")
+	}
+	if g.golden.MaxTraces > 0 && traces > g.golden.MaxTraces {
+		mismatches = append(mismatches, "max_traces")
+	}
+
+	if len(g.golden.RequiredAttributes) > 0 {
+		present := resp.attributeKeys()
+		for _, key := range g.golden.RequiredAttributes {
+			if !present[key] {
+				mismatches = append(mismatches, "attribute")
+				break
+			}
+		}
+	}
+
+	return mismatches
+}
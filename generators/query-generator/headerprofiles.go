@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// headerProfileNone is the built-in profile sending no extra headers, the control group of
+// header experiments
+const headerProfileNone = "none"
+
+// HeaderProfileConfig is a named set of experimental request headers, e.g. to bypass the
+// query-frontend results cache or hint the shard count where the deployment honors it
+type HeaderProfileConfig struct {
+	Name    string            `yaml:"name"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// headerProfiles applies the header profiles of each query (nil when no query uses one)
+var headerProfiles *headerProfiler
+
+// headerProfiler rotates requests across the header profiles of their query and records
+// latency and outcomes by profile
+type headerProfiler struct {
+	queries  map[string][]headerProfile // profiles by query name
+	latency  *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+}
+
+// headerProfile is a profile with canonical header names
+type headerProfile struct {
+	name    string
+	headers http.Header
+}
+
+// checkHeaderProfiles validates the profiles and the profile names queries refer to
+func checkHeaderProfiles(profiles []HeaderProfileConfig, queries []QueryConfig) error {
+	names := map[string]bool{headerProfileNone: true}
+	for _, p := range profiles {
+		if p.Name == "" {
+			return fmt.Errorf("header profile without a name")
+		}
+		if p.Name == headerProfileNone {
+			return fmt.Errorf("header profile %s is built in", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("header profile %s is defined twice", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.Headers) == 0 {
+			return fmt.Errorf("header profile %s has no headers", p.Name)
+		}
+	}
+	for _, q := range queries {
+		for _, name := range q.HeaderProfiles {
+			if !names[name] {
+				return fmt.Errorf("query %s: undefined header profile %s", q.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// newHeaderProfiler resolves the profiles of each query and registers the metrics; it returns
+// nil when no query uses a profile
+func newHeaderProfiler(profiles []HeaderProfileConfig, queries []QueryConfig) (*headerProfiler, error) {
+	if err := checkHeaderProfiles(profiles, queries); err != nil {
+		return nil, err
+	}
+	byName := map[string]headerProfile{headerProfileNone: {name: headerProfileNone}}
+	for _, p := range profiles {
+		headers := http.Header{}
+		for k, v := range p.Headers {
+			headers.Set(k, v)
+		}
+		byName[p.Name] = headerProfile{name: p.Name, headers: headers}
+	}
+	h := &headerProfiler{queries: make(map[string][]headerProfile)}
+	for _, q := range queries {
+		for _, name := range q.HeaderProfiles {
+			h.queries[q.Name] = append(h.queries[q.Name], byName[name])
+		}
+	}
+	if len(h.queries) == 0 {
+		return nil, nil
+	}
+
+	h.latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "header_profile",
+		Name:      "duration_seconds",
+		Help:      "Query latency by name and header profile",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"name", "profile"})
+	h.requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "header_profile",
+		Name:      "requests_total",
+		Help:      "Requests by name, header profile and outcome (status class, or error for transport errors and client timeouts)",
+	}, []string{"name", "profile", "outcome"})
+	return h, nil
+}
+
+// apply sets the headers of a profile picked at random among the query's profiles and returns
+// its name ("" when the query uses no profile)
+func (h *headerProfiler) apply(queryName string, req *http.Request) string {
+	if h == nil {
+		return ""
+	}
+	profiles := h.queries[queryName]
+	if len(profiles) == 0 {
+		return ""
+	}
+	p := profiles[rand.Intn(len(profiles))]
+	for k, v := range p.headers {
+		req.Header[k] = v
+	}
+	return p.name
+}
+
+// record counts the outcome of a request sent with a profile; status is 0 for transport errors
+func (h *headerProfiler) record(queryName, profile string, status int, latency time.Duration) {
+	if h == nil || profile == "" {
+		return
+	}
+	outcome := "error"
+	if status > 0 {
+		outcome = statusClass(status)
+		h.latency.WithLabelValues(queryName, profile).Observe(latency.Seconds())
+	}
+	h.requests.WithLabelValues(queryName, profile, outcome).Inc()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// highThroughputIdleConns is the number of idle connections kept per host in high-throughput mode,
+// so connections are reused instead of re-dialed at high request rates
+const highThroughputIdleConns = 1024
+
+// tuneTransportForThroughput keeps enough idle connections open for high request rates;
+// the default of 2 idle connections per host makes most requests dial a new connection
+func tuneTransportForThroughput(rt http.RoundTripper) {
+	if t, ok := rt.(*http.Transport); ok {
+		t.MaxIdleConns = 0 // unlimited
+		t.MaxIdleConnsPerHost = highThroughputIdleConns
+	}
+}
+
+// queryBufPool holds buffers used to build request query strings
+var queryBufPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, 512)
+	return &b
+}}
+
+// requestTemplate pre-builds the parts of a search request that do not change between requests:
+// the search URL and encoded parameters of each tenant and its static headers. The hot path only
+// appends the time range and copies the headers, which auth and tracing extend per request.
+// Gateway targets use the Observatorium API pattern: /api/traces/v1/{tenant}/tempo/api/search
+type requestTemplate struct {
+	urls    map[string]*url.URL    // search URL per tenant
+	headers map[string]http.Header // headers per tenant
+	query   string                 // encoded query parameters other than the time range
+	format  string                 // start/end parameter format
+}
+
+// newRequestTemplate builds the template of a query executor's search requests
+func newRequestTemplate(target, endpoint string, tenants []string, query QueryConfig, limit int, timeFormat string) (*requestTemplate, error) {
+	params := url.Values{}
+	query.setSearchParams(params)
+	params.Set("limit", strconv.Itoa(limit))
+
+	t := &requestTemplate{
+		urls:    make(map[string]*url.URL, len(tenants)),
+		headers: make(map[string]http.Header, len(tenants)),
+		query:   params.Encode(),
+		format:  timeFormat,
+	}
+	for _, tenant := range tenants {
+		u, err := url.Parse(searchURL(target, endpoint, tenant))
+		if err != nil {
+			return nil, fmt.Errorf("invalid search URL for tenant %q: %w", tenant, err)
+		}
+		t.urls[tenant] = u
+
+		header := http.Header{}
+		if tenant != "" && sendsOrgID(target) {
+			header.Set("X-Scope-OrgID", tenant)
+		}
+		t.headers[tenant] = header
+	}
+	return t, nil
+}
+
+// request returns a new search request for the tenant and time window
+func (t *requestTemplate) request(tenant string, window queryWindow) *http.Request {
+	u := *t.urls[tenant]
+
+	buf := queryBufPool.Get().(*[]byte)
+	b := append((*buf)[:0], t.query...)
+	if window.bucket != nil {
+		b = append(b, "&start="...)
+		b = appendTimeParam(b, window.start, t.format)
+		b = append(b, "&end="...)
+		b = appendTimeParam(b, window.end, t.format)
+	}
+	u.RawQuery = string(b)
+	*buf = b
+	queryBufPool.Put(buf)
+
+	return &http.Request{
+		Method:     http.MethodGet,
+		URL:        &u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     t.headers[tenant].Clone(),
+		Host:       u.Host,
+	}
+}
+
+// workerMetrics caches the metric children a worker records into, so the hot path skips the
+// label hashing and lookups of the metric vectors. Every worker owns its own instance, so the
+// caches need no lock; the children themselves are shared by all workers of a query (metrics
+// are not sharded per core).
+type workerMetrics struct {
+	query     string
+	latency   prometheus.Observer
+	failures  prometheus.Counter
+	spans     prometheus.Observer
+	heartbeat prometheus.Gauge
+	buckets   map[string]bucketMetrics
+	status    map[string]prometheus.Observer
+	protocol  map[string]prometheus.Observer
+}
+
+// bucketMetrics are the metric children of one time bucket
+type bucketMetrics struct {
+	duration prometheus.Observer
+	requests prometheus.Counter
+}
+
+// newWorkerMetrics creates the metric cache of a worker of the given query
+func newWorkerMetrics(query string) *workerMetrics {
+	return &workerMetrics{
+		query:     query,
+		latency:   queryLatencyHist.WithLabelValues(query),
+		failures:  queryFailuresCounter.WithLabelValues(query),
+		spans:     spansReturnedHist.WithLabelValues(query),
+		heartbeat: heartbeatGauge.WithLabelValues(query),
+		buckets:   make(map[string]bucketMetrics),
+		status:    make(map[string]prometheus.Observer),
+		protocol:  make(map[string]prometheus.Observer),
+	}
+}
+
+// bucket returns the metric children of a time bucket
+func (m *workerMetrics) bucket(name string) bucketMetrics {
+	b, ok := m.buckets[name]
+	if !ok {
+		b = bucketMetrics{
+			duration: bucketDurationHist.WithLabelValues(name, m.query),
+			requests: bucketQueryCounter.WithLabelValues(name, m.query),
+		}
+		m.buckets[name] = b
+	}
+	return b
+}
+
+// statusLatency returns the latency histogram of a status class
+func (m *workerMetrics) statusLatency(class string) prometheus.Observer {
+	o, ok := m.status[class]
+	if !ok {
+		o = statusLatencyHist.WithLabelValues(m.query, class)
+		m.status[class] = o
+	}
+	return o
+}
+
+// protocolLatency returns the latency histogram of a negotiated protocol
+func (m *workerMetrics) protocolLatency(protocol string) prometheus.Observer {
+	o, ok := m.protocol[protocol]
+	if !ok {
+		o = protocolLatencyHist.WithLabelValues(m.query, protocol)
+		m.protocol[protocol] = o
+	}
+	return o
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// benchmarkQuery is a search with a TraceQL expression and duration bounds, whose parameters
+// need escaping
+var benchmarkQuery = QueryConfig{
+	Name:        "bench",
+	TraceQL:     `{ resource.service.name = "frontend" && span.http.status_code >= 500 }`,
+	MinDuration: "100ms",
+	MaxDuration: "5s",
+}
+
+// benchmarkWindow is a bucket window of the last hour
+func benchmarkWindow() queryWindow {
+	now := time.Now()
+	return queryWindow{bucketName: "recent", bucket: &timeBucket{name: "recent"}, start: now.Add(-time.Hour), end: now}
+}
+
+// perRequestSearch builds a search request the way the executors did before request templates:
+// parse the URL, then decode, extend and re-encode its query string
+func perRequestSearch(endpoint, tenant string, query QueryConfig, limit int, window queryWindow) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, searchURL(targetGateway, endpoint, tenant), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Scope-OrgID", tenant)
+	params := req.URL.Query()
+	query.setSearchParams(params)
+	if window.bucket != nil {
+		params.Set("start", formatTimeParam(window.start, timeFormatUnix))
+		params.Set("end", formatTimeParam(window.end, timeFormatUnix))
+	}
+	params.Set("limit", fmt.Sprintf("%d", limit))
+	req.URL.RawQuery = params.Encode()
+	return req, nil
+}
+
+func TestRequestTemplateMatchesPerRequestSearch(t *testing.T) {
+	tmpl, err := newRequestTemplate(targetGateway, "http://tempo:8080", []string{"t1"}, benchmarkQuery, 20, timeFormatUnix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := benchmarkWindow()
+	want, err := perRequestSearch("http://tempo:8080", "t1", benchmarkQuery, 20, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tmpl.request("t1", window)
+	if got.URL.Path != want.URL.Path {
+		t.Errorf("path = %s, want %s", got.URL.Path, want.URL.Path)
+	}
+	if got.URL.Query().Encode() != want.URL.Query().Encode() {
+		t.Errorf("query = %s, want %s", got.URL.Query().Encode(), want.URL.Query().Encode())
+	}
+	if got.Header.Get("X-Scope-OrgID") != "t1" {
+		t.Errorf("X-Scope-OrgID = %q, want t1", got.Header.Get("X-Scope-OrgID"))
+	}
+}
+
+func BenchmarkRequestTemplate(b *testing.B) {
+	tmpl, err := newRequestTemplate(targetGateway, "http://tempo:8080", []string{"t1"}, benchmarkQuery, 20, timeFormatUnix)
+	if err != nil {
+		b.Fatal(err)
+	}
+	window := benchmarkWindow()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tmpl.request("t1", window)
+	}
+}
+
+func BenchmarkPerRequestSearch(b *testing.B) {
+	window := benchmarkWindow()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := perRequestSearch("http://tempo:8080", "t1", benchmarkQuery, 20, window); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runIdentity is where the generator runs, as exposed by the Kubernetes Downward API
+type runIdentity struct {
+	Namespace string
+	Pod       string
+	Node      string
+}
+
+// identity is detected at startup; fields are empty outside Kubernetes
+var identity runIdentity
+
+// detectIdentity reads POD_NAMESPACE, POD_NAME and NODE_NAME (set from the Downward API in the
+// manifests), falling back to the service account namespace and the hostname
+func detectIdentity() runIdentity {
+	id := runIdentity{
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Pod:       os.Getenv("POD_NAME"),
+		Node:      os.Getenv("NODE_NAME"),
+	}
+	if id.Namespace == "" {
+		if data, err := os.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+			id.Namespace = strings.TrimSpace(string(data))
+		}
+	}
+	if id.Pod == "" && id.Namespace != "" {
+		// Inside a pod the hostname is the pod name
+		id.Pod, _ = os.Hostname()
+	}
+	return id
+}
+
+// labels returns the constant labels identifying this generator instance. They are prefixed so
+// they do not clash with the pod/node target labels added by the PodMonitor scrape.
+func (id runIdentity) labels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if id.Pod != "" {
+		labels["generator_pod"] = id.Pod
+	}
+	if id.Node != "" {
+		labels["generator_node"] = id.Node
+	}
+	return labels
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importedRequest is a search request found in an access log
+type importedRequest struct {
+	ts         time.Time
+	tenant     string
+	query      QueryConfig // kind, traceql or logfmt, min/maxDuration
+	start, end time.Time   // zero when the request had no time range
+}
+
+// runImportCommand implements the "import" subcommand: it turns the search requests of Tempo
+// query-frontend, gateway or Grafana data-proxy access logs (logfmt or JSON lines, or Loki
+// output) into queries, time buckets and an execution plan replaying the production mix
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "-", "access log file (- = stdin): logfmt or JSON lines, logcli --output=jsonl or a Loki query_range response")
+	out := fs.String("out", "-", "output config fragment (- = stdout)")
+	tenant := fs.String("tenant", "", "only import the requests of this tenant")
+	round := fs.Duration("round", time.Minute, "granularity the time-range offsets are rounded to, so similar ranges share a time bucket")
+	prefix := fs.String("prefix", "imported", "prefix of the generated query names")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *round <= 0 {
+		return fmt.Errorf("round must be > 0, got: %s", *round)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	requests, skipped, err := readAccessLog(r)
+	if err != nil {
+		return err
+	}
+	if *tenant != "" {
+		kept := requests[:0]
+		for _, req := range requests {
+			if req.tenant == *tenant {
+				kept = append(kept, req)
+			}
+		}
+		requests = kept
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("no search requests found (%d lines skipped)", skipped)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d lines that are not search requests", skipped)
+	}
+
+	doc := importedConfig(requests, *round, *prefix)
+	log.Printf("Imported %d requests: %d queries, %d time buckets", len(requests), len(doc.Queries), len(doc.TimeBuckets))
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// importedDoc is the config fragment written by the import subcommand
+type importedDoc struct {
+	TimeBuckets   []importedBucketConfig `yaml:"timeBuckets,omitempty"`
+	Queries       []importedQuery        `yaml:"queries"`
+	ExecutionPlan []PlanEntry            `yaml:"executionPlan"`
+}
+
+// importedBucketConfig is the subset of TimeBucketConfig an access log provides
+type importedBucketConfig struct {
+	Name     string `yaml:"name"`
+	AgeStart string `yaml:"ageStart"`
+	AgeEnd   string `yaml:"ageEnd"`
+	Weight   int    `yaml:"weight"`
+}
+
+// importedQuery is the subset of QueryConfig an access log provides
+type importedQuery struct {
+	Name        string `yaml:"name"`
+	Kind        string `yaml:"kind,omitempty"`
+	TraceQL     string `yaml:"traceql,omitempty"`
+	Logfmt      string `yaml:"logfmt,omitempty"`
+	MinDuration string `yaml:"minDuration,omitempty"`
+	MaxDuration string `yaml:"maxDuration,omitempty"`
+	Weight      int    `yaml:"weight"`
+}
+
+// importedConfig groups identical searches into queries weighted by their count and maps each
+// request's time range to a relative bucket (its age at the time of the request), keeping the
+// requests' order in the plan
+func importedConfig(requests []importedRequest, round time.Duration, prefix string) *importedDoc {
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].ts.Before(requests[j].ts) })
+
+	doc := &importedDoc{}
+	queryIndex := make(map[string]int)
+	bucketIndex := make(map[string]int)
+	for _, req := range requests {
+		key := req.query.Kind + "\x00" + req.query.TraceQL + "\x00" + req.query.Logfmt + "\x00" + req.query.MinDuration + "\x00" + req.query.MaxDuration
+		i, ok := queryIndex[key]
+		if !ok {
+			i = len(doc.Queries)
+			queryIndex[key] = i
+			q := req.query
+			q.Name = fmt.Sprintf("%s-%d", prefix, i+1)
+			kind := ""
+			if q.kind() != queryKindTraceQL {
+				kind = q.Kind
+			}
+			doc.Queries = append(doc.Queries, importedQuery{
+				Name: q.Name, Kind: kind, TraceQL: q.TraceQL, Logfmt: q.Logfmt,
+				MinDuration: q.MinDuration, MaxDuration: q.MaxDuration,
+			})
+		}
+		doc.Queries[i].Weight++
+
+		bucket := "immediate"
+		if !req.start.IsZero() {
+			b := importedBucket(req, round)
+			bucket = b.Name
+			j, ok := bucketIndex[bucket]
+			if !ok {
+				j = len(doc.TimeBuckets)
+				bucketIndex[bucket] = j
+				doc.TimeBuckets = append(doc.TimeBuckets, b)
+			}
+			doc.TimeBuckets[j].Weight++
+		}
+		doc.ExecutionPlan = append(doc.ExecutionPlan, PlanEntry{QueryName: doc.Queries[i].Name, BucketName: bucket})
+	}
+	return doc
+}
+
+// importedBucket returns the relative time bucket of a request: how old its range was when it
+// was sent, rounded so that ranges such as "last 1h" sent a few seconds apart share a bucket
+func importedBucket(req importedRequest, round time.Duration) importedBucketConfig {
+	ageStart := req.ts.Sub(req.end).Round(round)
+	if ageStart < 0 {
+		ageStart = 0
+	}
+	ageEnd := req.ts.Sub(req.start).Round(round)
+	if ageEnd <= ageStart {
+		ageEnd = ageStart + round
+	}
+	start, end := "0s", promDuration(ageEnd)
+	if ageStart > 0 {
+		start = promDuration(ageStart)
+	}
+	return importedBucketConfig{Name: "age-" + start + "-" + end, AgeStart: start, AgeEnd: end}
+}
+
+// readAccessLog extracts the search requests of an access log; lines that are not search
+// requests (other endpoints, other log lines) are counted as skipped
+func readAccessLog(r io.Reader) (requests []importedRequest, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var records []map[string]string
+		if strings.HasPrefix(line, "{") {
+			records, err = jsonLogRecords([]byte(line))
+			if err != nil {
+				return nil, 0, err
+			}
+		} else {
+			records = []map[string]string{logfmtFields(line)}
+		}
+		for _, record := range records {
+			req, ok := parseAccessRecord(record)
+			if !ok {
+				skipped++
+				continue
+			}
+			requests = append(requests, req)
+		}
+	}
+	return requests, skipped, scanner.Err()
+}
+
+// jsonLogRecords returns the log records of a JSON line: a JSON-formatted log line, a logcli
+// jsonl entry (whose line is logfmt or JSON) or a whole Loki query_range response
+func jsonLogRecords(data []byte) ([]map[string]string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON log line: %w", err)
+	}
+
+	// Loki query_range response: data.result[].values[] = [ns timestamp, line]
+	if d, ok := doc["data"].(map[string]interface{}); ok {
+		var records []map[string]string
+		results, _ := d["result"].([]interface{})
+		for _, result := range results {
+			stream, _ := result.(map[string]interface{})
+			values, _ := stream["values"].([]interface{})
+			for _, v := range values {
+				pair, _ := v.([]interface{})
+				if len(pair) != 2 {
+					continue
+				}
+				ts, _ := pair[0].(string)
+				line, _ := pair[1].(string)
+				records = append(records, lokiLineRecords(line, ts)...)
+			}
+		}
+		return records, nil
+	}
+
+	// logcli --output=jsonl
+	if line, ok := doc["line"].(string); ok {
+		ts, _ := doc["timestamp"].(string)
+		return lokiLineRecords(line, ts), nil
+	}
+
+	record := make(map[string]string, len(doc))
+	for k, v := range doc {
+		switch v := v.(type) {
+		case string:
+			record[k] = v
+		case float64:
+			record[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return []map[string]string{record}, nil
+}
+
+// lokiLineRecords parses a log line returned by Loki; the Loki timestamp is used when the line
+// has none of its own
+func lokiLineRecords(line, ts string) []map[string]string {
+	var records []map[string]string
+	if strings.HasPrefix(line, "{") {
+		records, _ = jsonLogRecords([]byte(line))
+	} else {
+		records = []map[string]string{logfmtFields(line)}
+	}
+	for _, record := range records {
+		if _, ok := record["ts"]; !ok && ts != "" {
+			record["ts"] = ts
+		}
+	}
+	return records
+}
+
+// logfmtFields parses the key=value pairs of a logfmt line, skipping anything else (e.g. the
+// timestamp and labels logcli prints before the line)
+func logfmtFields(line string) map[string]string {
+	fields := make(map[string]string)
+	rest := line
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t=")
+		if end < 0 {
+			break
+		}
+		if rest[end] != '=' {
+			rest = rest[end:]
+			continue
+		}
+		key := rest[:end]
+		rest = rest[end+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				break
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			n := strings.IndexAny(rest, " \t")
+			if n < 0 {
+				n = len(rest)
+			}
+			value = rest[:n]
+			rest = rest[n:]
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// parseAccessRecord turns an access log record into a search request. The request URL is taken
+// from url (Tempo), path (Grafana data proxy) or uri, and the time from ts, time or timestamp.
+func parseAccessRecord(record map[string]string) (importedRequest, bool) {
+	var raw string
+	for _, key := range []string{"url", "path", "uri"} {
+		if raw = record[key]; raw != "" {
+			break
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !isSearchPath(u.Path) {
+		return importedRequest{}, false
+	}
+	var ts time.Time
+	for _, key := range []string{"ts", "time", "timestamp"} {
+		if ts, err = parseLogTime(record[key]); err == nil {
+			break
+		}
+	}
+	if ts.IsZero() {
+		return importedRequest{}, false
+	}
+
+	params := u.Query()
+	req := importedRequest{ts: ts, tenant: record["tenant"]}
+	if req.tenant == "" {
+		req.tenant = record["orgID"]
+	}
+	if req.tenant == "" {
+		// Gateway paths carry the tenant: /api/traces/v1/<tenant>/tempo/api/search
+		if parts := strings.Split(u.Path, "/"); len(parts) > 4 && parts[1] == "api" && parts[2] == "traces" {
+			req.tenant = parts[4]
+		}
+	}
+	switch {
+	case params.Get("q") != "":
+		req.query = QueryConfig{Kind: queryKindTraceQL, TraceQL: params.Get("q")}
+	case params.Get("tags") != "" || params.Get("minDuration") != "" || params.Get("maxDuration") != "":
+		req.query = QueryConfig{Kind: queryKindLegacy, Logfmt: params.Get("tags")}
+	default:
+		req.query = QueryConfig{Kind: queryKindTraceQL, TraceQL: "{}"}
+	}
+	req.query.MinDuration = params.Get("minDuration")
+	req.query.MaxDuration = params.Get("maxDuration")
+	if err := req.query.validate(); err != nil {
+		log.Printf("Warning: Skipping a search the generator cannot replay: %v", err)
+		return importedRequest{}, false
+	}
+
+	start, errStart := strconv.ParseInt(params.Get("start"), 10, 64)
+	end, errEnd := strconv.ParseInt(params.Get("end"), 10, 64)
+	if errStart == nil && errEnd == nil && end > start {
+		req.start, req.end = time.Unix(start, 0), time.Unix(end, 0)
+	}
+	return req, true
+}
+
+// isSearchPath reports whether a request path is a Tempo search, directly, through the gateway
+// or through Grafana's data-source proxy (tag and trace lookups are not searches)
+func isSearchPath(p string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(p, "/"), "/api/search")
+}
+
+// parseLogTime parses an RFC3339 log timestamp or Unix seconds/nanoseconds (Loki)
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	if f > 1e15 {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return time.Unix(0, n), nil
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAccessLog mixes the formats the import subcommand reads, out of order
+var testAccessLog = strings.Join([]string{
+	// Loki query_range response
+	`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"tempo"},"values":[` +
+		`["1764230520000000000","level=info tenant=t1 url=\"/api/search?q=%7B%7D&start=1764144120&end=1764147720\""]]}]}}`,
+	// Tempo query-frontend logfmt
+	`level=info ts=2025-11-27T08:00:00Z caller=handler.go:134 tenant=t1 method=GET url="/api/search?q=%7B+status+%3D+error+%7D&start=1764226800&end=1764230400" duration=1.2s status=200`,
+	// JSON log line, 30s later over the same relative range
+	`{"ts":"2025-11-27T08:00:30Z","orgID":"t1","url":"/api/search?q=%7B+status+%3D+error+%7D&start=1764226830&end=1764230430"}`,
+	// logcli --output=jsonl of a gateway access log without a time of its own
+	`{"labels":{"app":"gateway"},"timestamp":"2025-11-27T08:01:00Z","line":"method=GET path=/api/traces/v1/t2/tempo/api/search?tags=service.name%3Dapi&minDuration=100ms"}`,
+	// Not searches
+	`level=info ts=2025-11-27T08:00:10Z tenant=t1 url=/api/traces/0123456789abcdef status=200`,
+	`level=info msg="starting query-frontend"`,
+	``,
+}, "\n")
+
+func TestReadAccessLog(t *testing.T) {
+	requests, skipped, err := readAccessLog(strings.NewReader(testAccessLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+	want := []struct {
+		ts         string
+		tenant     string
+		query      QueryConfig
+		start, end int64 // 0 without a time range
+	}{
+		{"2025-11-27T08:02:00Z", "t1", QueryConfig{Kind: queryKindTraceQL, TraceQL: "{}"}, 1764144120, 1764147720},
+		{"2025-11-27T08:00:00Z", "t1", QueryConfig{Kind: queryKindTraceQL, TraceQL: "{ status = error }"}, 1764226800, 1764230400},
+		{"2025-11-27T08:00:30Z", "t1", QueryConfig{Kind: queryKindTraceQL, TraceQL: "{ status = error }"}, 1764226830, 1764230430},
+		{"2025-11-27T08:01:00Z", "t2", QueryConfig{Kind: queryKindLegacy, Logfmt: "service.name=api", MinDuration: "100ms"}, 0, 0},
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %+v, want %d", requests, len(want))
+	}
+	for i, w := range want {
+		got := requests[i]
+		ts, _ := time.Parse(time.RFC3339, w.ts)
+		var start, end time.Time
+		if w.start != 0 {
+			start, end = time.Unix(w.start, 0), time.Unix(w.end, 0)
+		}
+		if !got.ts.Equal(ts) || got.tenant != w.tenant || !reflect.DeepEqual(got.query, w.query) ||
+			!got.start.Equal(start) || !got.end.Equal(end) {
+			t.Errorf("request %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestImportedConfig(t *testing.T) {
+	requests, _, err := readAccessLog(strings.NewReader(testAccessLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := importedConfig(requests, time.Minute, "prod")
+
+	wantQueries := []importedQuery{
+		{Name: "prod-1", TraceQL: "{ status = error }", Weight: 2},
+		{Name: "prod-2", Kind: queryKindLegacy, Logfmt: "service.name=api", MinDuration: "100ms", Weight: 1},
+		{Name: "prod-3", TraceQL: "{}", Weight: 1},
+	}
+	if !reflect.DeepEqual(doc.Queries, wantQueries) {
+		t.Errorf("queries = %+v, want %+v", doc.Queries, wantQueries)
+	}
+	// Ranges keep their age relative to when they were sent
+	wantBuckets := []importedBucketConfig{
+		{Name: "age-0s-1h", AgeStart: "0s", AgeEnd: "1h", Weight: 2},
+		{Name: "age-23h-24h", AgeStart: "23h", AgeEnd: "24h", Weight: 1},
+	}
+	if !reflect.DeepEqual(doc.TimeBuckets, wantBuckets) {
+		t.Errorf("buckets = %+v, want %+v", doc.TimeBuckets, wantBuckets)
+	}
+	// The plan replays the requests in the order they were sent
+	wantPlan := []PlanEntry{
+		{QueryName: "prod-1", BucketName: "age-0s-1h"},
+		{QueryName: "prod-1", BucketName: "age-0s-1h"},
+		{QueryName: "prod-2", BucketName: "immediate"},
+		{QueryName: "prod-3", BucketName: "age-23h-24h"},
+	}
+	if !reflect.DeepEqual(doc.ExecutionPlan, wantPlan) {
+		t.Errorf("plan = %+v, want %+v", doc.ExecutionPlan, wantPlan)
+	}
+}
+
+func TestImportedBucket(t *testing.T) {
+	sent := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		start, end time.Duration // before the request was sent
+		want       string
+	}{
+		{time.Hour, 0, "age-0s-1h"},
+		{time.Hour + 20*time.Second, 20 * time.Second, "age-0s-1h"},
+		{90 * time.Minute, 30 * time.Minute, "age-30m-90m"},
+		{2 * time.Hour, -time.Minute, "age-0s-2h"}, // a range ending in the future
+		{10 * time.Second, 5 * time.Second, "age-0s-1m"},
+	} {
+		req := importedRequest{ts: sent, start: sent.Add(-tc.start), end: sent.Add(-tc.end)}
+		if got := importedBucket(req, time.Minute).Name; got != tc.want {
+			t.Errorf("range %s to %s ago: bucket %s, want %s", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestLogfmtFields(t *testing.T) {
+	line := `2025-11-27T08:00:00Z level=info msg="search done" url="/api/search?q=%7B%7D" status=200 bare`
+	want := map[string]string{"level": "info", "msg": "search done", "url": "/api/search?q=%7B%7D", "status": "200"}
+	if got := logfmtFields(line); !reflect.DeepEqual(got, want) {
+		t.Errorf("logfmtFields = %v, want %v", got, want)
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	want := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	for _, s := range []string{"2025-11-27T08:00:00Z", "2025-11-27T09:00:00+01:00", "1764230400", "1764230400000000000"} {
+		got, err := parseLogTime(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseLogTime(%s) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	if _, err := parseLogTime("yesterday"); err == nil {
+		t.Errorf("parseLogTime(yesterday) succeeded")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// maxIncludeDepth bounds nested includes
+const maxIncludeDepth = 10
+
+// loadConfigTree reads a config file (YAML, JSON or TOML) and the files it lists under include:,
+// returning the merged document. Included files are merged in order and the including file is
+// merged last, so it overrides them. Relative include paths are resolved against the including file.
+func loadConfigTree(path string, visiting map[string]bool) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if visiting[abs] {
+		return nil, fmt.Errorf("include cycle at %s", path)
+	}
+	if len(visiting) >= maxIncludeDepth {
+		return nil, fmt.Errorf("includes nested deeper than %d at %s", maxIncludeDepth, path)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc, err := parseConfigDocument(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	includes, err := includePaths(doc["include"])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(doc, "include")
+
+	merged := map[string]interface{}{}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		included, err := loadConfigTree(inc, visiting)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeConfigMaps(merged, included)
+	}
+	return mergeConfigMaps(merged, doc), nil
+}
+
+// parseConfigDocument parses a YAML, JSON or TOML config file, detected by its extension, into a
+// generic document with YAML types (maps with string keys, []interface{} lists)
+func parseConfigDocument(path string, data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		// Normalize TOML types (e.g. []map[string]interface{} for arrays of tables) to YAML's
+		normalized, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		doc = nil
+		if err := yaml.Unmarshal(normalized, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc, nil
+}
+
+// isYAMLConfig reports whether a config file is parsed as YAML
+func isYAMLConfig(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext != ".json" && ext != ".toml"
+}
+
+// includePaths returns the file names of an include: list
+func includePaths(v interface{}) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("include must be a list of file paths")
+	}
+	paths := make([]string, 0, len(list))
+	for _, p := range list {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("include entries must be file paths, got %v", p)
+		}
+		paths = append(paths, s)
+	}
+	return paths, nil
+}
+
+// mergeConfigMaps merges override into base: maps are merged key by key, lists whose items all
+// have a name (queries, timeBuckets, ...) are merged by name, anything else is replaced
+func mergeConfigMaps(base, override map[string]interface{}) map[string]interface{} {
+	for k, v := range override {
+		base[k] = mergeConfigValues(base[k], v)
+	}
+	return base
+}
+
+func mergeConfigValues(base, override interface{}) interface{} {
+	switch o := override.(type) {
+	case map[string]interface{}:
+		if b, ok := base.(map[string]interface{}); ok {
+			return mergeConfigMaps(b, o)
+		}
+	case []interface{}:
+		if b, ok := base.([]interface{}); ok && namedItems(b) && namedItems(o) {
+			return mergeNamedLists(b, o)
+		}
+	}
+	return override
+}
+
+// namedItems reports whether every item of a list is a map with a name
+func namedItems(list []interface{}) bool {
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeNamedLists merges items with the same name and appends new ones, keeping base order
+func mergeNamedLists(base, override []interface{}) []interface{} {
+	index := make(map[string]int, len(base))
+	for i, item := range base {
+		index[item.(map[string]interface{})["name"].(string)] = i
+	}
+	for _, item := range override {
+		m := item.(map[string]interface{})
+		if i, ok := index[m["name"].(string)]; ok {
+			base[i] = mergeConfigMaps(base[i].(map[string]interface{}), m)
+			continue
+		}
+		index[m["name"].(string)] = len(base)
+		base = append(base, item)
+	}
+	return base
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// inFlightLimiter caps the number of outstanding requests across all executors
+type inFlightLimiter struct {
+	sem     chan struct{} // nil when unlimited
+	gauge   prometheus.Gauge
+	blocked prometheus.Counter
+	count   int64 // outstanding requests (atomic)
+}
+
+// newInFlightLimiter creates the global limiter; max <= 0 disables the cap but still tracks in-flight requests
+func newInFlightLimiter(max int) *inFlightLimiter {
+	l := &inFlightLimiter{
+		gauge: promauto.NewGauge(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Name:      "in_flight_requests",
+			Help:      "Current number of outstanding query requests",
+		}),
+		blocked: promauto.NewCounter(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "in_flight_blocked_total",
+			Help:      "Total request acquisitions that had to wait for the global in-flight cap",
+		}),
+	}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire blocks until a request slot is available
+func (l *inFlightLimiter) acquire() {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			l.blocked.Inc()
+			l.sem <- struct{}{}
+		}
+	}
+	l.gauge.Inc()
+	atomic.AddInt64(&l.count, 1)
+}
+
+// release frees a request slot acquired with acquire
+func (l *inFlightLimiter) release() {
+	atomic.AddInt64(&l.count, -1)
+	l.gauge.Dec()
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// current returns the number of outstanding requests
+func (l *inFlightLimiter) current() int {
+	return int(atomic.LoadInt64(&l.count))
+}
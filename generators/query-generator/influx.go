@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// influxSink periodically writes snapshots of the generator's metrics in InfluxDB line protocol,
+// appended to a file and/or posted to a write endpoint. Counters are written as cumulative values.
+type influxSink struct {
+	prefix string
+	path   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newInfluxSink validates the sink config
+func newInfluxSink(cfg MetricsSinkConfig) (*influxSink, error) {
+	if cfg.Path == "" && cfg.URL == "" {
+		return nil, fmt.Errorf("influx: path or url must be set")
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "query_load_test"
+	}
+	if cfg.Path != "" {
+		log.Printf("Appending Influx line protocol snapshots to %s", cfg.Path)
+	}
+	if cfg.URL != "" {
+		log.Printf("Posting Influx line protocol snapshots to %s", cfg.URL)
+	}
+	return &influxSink{
+		prefix: prefix,
+		path:   cfg.Path,
+		url:    cfg.URL,
+		token:  cfg.Token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// run writes a snapshot every interval
+func (s *influxSink) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := s.write(prometheus.DefaultGatherer, now); err != nil {
+			log.Printf("Warning: Failed to write Influx snapshot: %v", err)
+		}
+	}
+}
+
+// write encodes the current registry and sends it to the configured destinations
+func (s *influxSink) write(g prometheus.Gatherer, now time.Time) error {
+	points, err := gatherMetricPoints(g)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, p := range points {
+		s.encode(&buf, p, now)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	if s.path != "" {
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf.Bytes())
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.url != "" {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if s.token != "" {
+			req.Header.Set("Authorization", "Token "+s.token)
+		}
+		res, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			return fmt.Errorf("influx write returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+		}
+	}
+	return nil
+}
+
+// encode writes a point as a line: <prefix>_<name>,<label>=<value>... value=<v> <unix ns>
+func (s *influxSink) encode(buf *bytes.Buffer, p metricPoint, now time.Time) {
+	buf.WriteString(influxEscape(s.prefix+"_"+p.name, false))
+	for _, l := range p.labels {
+		if l.value == "" {
+			continue // empty tag values are rejected by InfluxDB
+		}
+		buf.WriteByte(',')
+		buf.WriteString(influxEscape(l.name, true))
+		buf.WriteByte('=')
+		buf.WriteString(influxEscape(l.value, true))
+	}
+	buf.WriteString(" value=")
+	buf.WriteString(strconv.FormatFloat(p.value, 'g', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(now.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
+
+// influxEscape escapes measurement names (commas, spaces) and tag keys/values (also equal signs)
+func influxEscape(s string, tag bool) string {
+	r := strings.NewReplacer(",", `\,`, " ", `\ `)
+	if tag {
+		r = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	}
+	return r.Replace(s)
+}
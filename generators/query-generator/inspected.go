@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// inspectedBytesKey is the key of the bytes Tempo read to answer a search, in the metrics object
+// of search responses
+var inspectedBytesKey = []byte(`"inspectedBytes"`)
+
+// scanInspectedBytes returns the inspectedBytes of a search response without decoding it; Tempo
+// encodes the value as a string (uint64 in protobuf JSON) or, in older versions, a number
+func scanInspectedBytes(body []byte) (int64, bool) {
+	return scanMetricValue(body, inspectedBytesKey)
+}
+
+// scanMetricValue returns the integer value of a key of a search response without decoding it,
+// whether encoded as a string or a number
+func scanMetricValue(body, key []byte) (int64, bool) {
+	i := bytes.Index(body, key)
+	if i < 0 {
+		return 0, false
+	}
+	rest := bytes.TrimLeft(body[i+len(key):], " \t\r\n")
+	if len(rest) == 0 || rest[0] != ':' {
+		return 0, false
+	}
+	rest = bytes.TrimLeft(rest[1:], " \t\r\n\"")
+	end := 0
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+	n, err := strconv.ParseInt(string(rest[:end]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// inspection exports how many bytes Tempo scans per result span (nil until metrics are initialized)
+var inspection *inspectionTracker
+
+// inspectionTracker combines the inspectedBytes of search responses with the spans they returned
+// per query and bucket. Queries that scan a lot to return little stand out with a high
+// bytes-per-span ratio, and the bytes of searches returning nothing are counted separately.
+type inspectionTracker struct {
+	mu     sync.Mutex
+	totals map[[2]string]*inspectionTotals
+
+	bytes      *prometheus.CounterVec
+	emptyBytes *prometheus.CounterVec
+	spans      *prometheus.CounterVec
+	perSpan    *prometheus.GaugeVec
+}
+
+// inspectionTotals are the run totals of a query and bucket
+type inspectionTotals struct {
+	bytes, spans int64
+}
+
+// newInspectionTracker registers the efficiency metrics
+func newInspectionTracker() *inspectionTracker {
+	return &inspectionTracker{
+		totals: make(map[[2]string]*inspectionTotals),
+		bytes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "inspected_bytes_total",
+			Help:      "Bytes Tempo inspected to answer successful searches, by query name and bucket",
+		}, []string{"name", "bucket"}),
+		emptyBytes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "inspected_bytes_empty_total",
+			Help:      "Bytes Tempo inspected for searches that returned no spans, by query name and bucket",
+		}, []string{"name", "bucket"}),
+		spans: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "inspected_result_spans_total",
+			Help:      "Spans returned by the searches counted in query_load_test_inspected_bytes_total",
+		}, []string{"name", "bucket"}),
+		perSpan: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "query_load_test",
+			Name:      "inspected_bytes_per_span",
+			Help:      "Bytes inspected per returned span over the run, by query name and bucket (bytes inspected while no span was returned yet count against one span)",
+		}, []string{"name", "bucket"}),
+	}
+}
+
+// observe records the inspected bytes of a successful search and the spans it returned
+func (t *inspectionTracker) observe(queryName, bucketName string, inspectedBytes int64, spans int) {
+	if t == nil {
+		return
+	}
+	t.bytes.WithLabelValues(queryName, bucketName).Add(float64(inspectedBytes))
+	t.spans.WithLabelValues(queryName, bucketName).Add(float64(spans))
+	if spans == 0 {
+		t.emptyBytes.WithLabelValues(queryName, bucketName).Add(float64(inspectedBytes))
+	}
+
+	t.mu.Lock()
+	key := [2]string{queryName, bucketName}
+	totals, ok := t.totals[key]
+	if !ok {
+		totals = &inspectionTotals{}
+		t.totals[key] = totals
+	}
+	totals.bytes += inspectedBytes
+	totals.spans += int64(spans)
+	perSpan := float64(totals.bytes)
+	if totals.spans > 0 {
+		perSpan /= float64(totals.spans)
+	}
+	t.mu.Unlock()
+	t.perSpan.WithLabelValues(queryName, bucketName).Set(perSpan)
+}
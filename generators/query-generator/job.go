@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runMode selects between serving metrics forever and a bounded run
+var runMode = flag.String("mode", "service", `"service" runs until stopped; "job" runs for job.duration, until the plan completes or until maxTotalQueries is used, then exits with 0 (pass), 2 (SLO failed) or 3 (runtime error)`)
+
+// Exit codes of job mode
+const (
+	exitPass         = 0
+	exitSLOFailed    = 2
+	exitRuntimeError = 3
+)
+
+// jobDrainTimeout bounds how long in-flight requests are awaited once a job ends
+const jobDrainTimeout = 30 * time.Second
+
+// JobConfig configures a bounded run in job mode
+type JobConfig struct {
+	Duration          string  `yaml:"duration"`          // Stop after this long (e.g. "30m", "7d" or "P1W")
+	UntilPlanComplete bool    `yaml:"untilPlanComplete"` // Stop once every query has executed its plan entries once (or used its maxTotalQueries)
+	MaxErrorRate      float64 `yaml:"maxErrorRate"`      // SLO: maximum fraction of failed requests per query (0 = not checked)
+	MaxP99            string  `yaml:"maxP99"`            // SLO: maximum p99 latency per query (empty = not checked)
+}
+
+// job coordinates a bounded run (nil in service mode)
+var job *jobController
+
+// jobController stops the workers when the run is over and waits for them to drain
+type jobController struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	duration          time.Duration
+	untilPlanComplete bool
+	maxErrorRate      float64
+	maxP99            time.Duration
+
+	workers   sync.WaitGroup
+	mu        sync.Mutex
+	pending   map[string]bool // queries whose plan has not completed yet
+	interrupt bool
+	idle      bool      // this replica has nothing to send, so a run without requests passes
+	endAt     time.Time // end of job.duration (zero until the job waits, or without a duration)
+}
+
+// parse validates the fields of the job section and returns its durations
+func (c JobConfig) parse() (duration, maxP99 time.Duration, err error) {
+	if c.Duration != "" {
+		duration, err = parseExtendedDuration(c.Duration)
+		if err != nil || duration <= 0 {
+			return 0, 0, fmt.Errorf("invalid job.duration %q", c.Duration)
+		}
+	}
+	if c.MaxP99 != "" {
+		maxP99, err = time.ParseDuration(c.MaxP99)
+		if err != nil || maxP99 <= 0 {
+			return 0, 0, fmt.Errorf("invalid job.maxP99 %q", c.MaxP99)
+		}
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		return 0, 0, fmt.Errorf("job.maxErrorRate must be between 0 and 1, got %v", c.MaxErrorRate)
+	}
+	return duration, maxP99, nil
+}
+
+// newJobController validates the job config; queries lists the query names that must complete
+// their plan when untilPlanComplete is set; hasBudget tells whether maxTotalQueries bounds the run
+func newJobController(cfg JobConfig, queries []string, hasPlan, hasBudget bool) (*jobController, error) {
+	j := &jobController{
+		untilPlanComplete: cfg.UntilPlanComplete,
+		maxErrorRate:      cfg.MaxErrorRate,
+		pending:           make(map[string]bool),
+	}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+
+	var err error
+	if j.duration, j.maxP99, err = cfg.parse(); err != nil {
+		return nil, err
+	}
+	if j.untilPlanComplete && !hasPlan {
+		return nil, fmt.Errorf("job.untilPlanComplete needs an executionPlan")
+	}
+	if j.duration == 0 && !j.untilPlanComplete && !hasBudget {
+		return nil, fmt.Errorf("job mode needs job.duration, job.untilPlanComplete or maxTotalQueries")
+	}
+
+	for _, q := range queries {
+		j.pending[q] = true
+	}
+	return j, nil
+}
+
+// context returns the context workers run under (never done in service mode)
+func (j *jobController) context() context.Context {
+	if j == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// workerStarted and workerDone track running workers so the job can drain them
+func (j *jobController) workerStarted() {
+	if j != nil {
+		j.workers.Add(1)
+	}
+}
+
+func (j *jobController) workerDone() {
+	if j != nil {
+		j.workers.Done()
+	}
+}
+
+// planExhausted reports whether a query has executed all its plan entries once; the first
+// call for a query marks it complete
+func (j *jobController) planExhausted(queryName string, idx, entries int64) bool {
+	if j == nil || !j.untilPlanComplete || idx < entries {
+		return false
+	}
+	if j.queryDone(queryName) {
+		log.Printf("Query '%s': execution plan completed", queryName)
+	}
+	return true
+}
+
+// queryDone marks a query as finished (plan completed or budget used) and ends the job once
+// every query is; it reports whether the query was still pending
+func (j *jobController) queryDone(queryName string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.pending[queryName] {
+		return false
+	}
+	delete(j.pending, queryName)
+	if len(j.pending) == 0 {
+		log.Printf("All queries completed, ending job")
+		j.cancel()
+	}
+	return true
+}
+
+// end ends the job normally before its duration, e.g. once the query budget is used
+func (j *jobController) end(reason string) {
+	log.Printf("Ending job: %s", reason)
+	j.cancel()
+}
+
+// idleRun marks a replica that has nothing to send, e.g. a shard without plan entries: it keeps
+// serving metrics until job.duration elapses, or ends right away without a duration, and passes
+func (j *jobController) idleRun(reason string) {
+	j.mu.Lock()
+	j.idle = true
+	j.mu.Unlock()
+	if j.duration > 0 {
+		log.Printf("Nothing to send on this replica (%s), idling until the job duration elapses", reason)
+		return
+	}
+	j.end(fmt.Sprintf("nothing to send on this replica (%s)", reason))
+}
+
+// stop ends the job early, e.g. on SIGTERM; the run is then reported as a runtime error
+func (j *jobController) stop(reason string) {
+	j.mu.Lock()
+	j.interrupt = true
+	j.mu.Unlock()
+	log.Printf("Job interrupted: %s", reason)
+	j.cancel()
+}
+
+// endsAt returns when job.duration elapses (zero in service mode or without a duration)
+func (j *jobController) endsAt() time.Time {
+	if j == nil {
+		return time.Time{}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.endAt
+}
+
+// wait blocks until the job ends and its workers have drained (bounded by jobDrainTimeout)
+func (j *jobController) wait() {
+	if j.duration > 0 {
+		j.mu.Lock()
+		j.endAt = time.Now().Add(j.duration)
+		j.mu.Unlock()
+		timer := time.NewTimer(j.duration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.Printf("Job duration %s elapsed, ending job", j.duration)
+			j.cancel()
+		case <-j.ctx.Done():
+		}
+	} else {
+		<-j.ctx.Done()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		j.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(jobDrainTimeout):
+		log.Printf("Warning: Requests still in flight after %s, not waiting for them", jobDrainTimeout)
+	}
+}
+
+// evaluate checks the SLOs against the run statistics and returns the exit code
+func (j *jobController) evaluate(stats *runStats) int {
+	j.mu.Lock()
+	interrupted, idle := j.interrupt, j.idle
+	j.mu.Unlock()
+	if interrupted {
+		return exitRuntimeError
+	}
+
+	queries, _ := stats.snapshot()
+	var requests int64
+	var violations []string
+	for _, q := range queries {
+		requests += q.total.count
+		if j.maxErrorRate > 0 && q.total.errorRate() > j.maxErrorRate {
+			violations = append(violations, fmt.Sprintf("%s: error rate %.2f%% > %.2f%%", q.name, q.total.errorRate()*100, j.maxErrorRate*100))
+		}
+		if p99 := q.total.latency.quantile(0.99); j.maxP99 > 0 && p99 > j.maxP99.Seconds() {
+			violations = append(violations, fmt.Sprintf("%s: p99 %s > %s", q.name, formatSeconds(p99), j.maxP99))
+		}
+	}
+	violations = append(violations, bucketSLOs.violations()...)
+
+	if requests == 0 && idle {
+		log.Printf("Job PASSED (idle replica, no requests to send)")
+		return exitPass
+	}
+	if requests == 0 {
+		log.Printf("Job FAILED: no requests were completed")
+		return exitRuntimeError
+	}
+	if len(violations) > 0 {
+		log.Printf("Job FAILED, SLO violations:\n  %s", strings.Join(violations, "\n  "))
+		return exitSLOFailed
+	}
+	log.Printf("Job PASSED (%d requests)", requests)
+	return exitPass
+}
+
+// fatalf logs and exits; in job mode the exit code marks a runtime error
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if *runMode == "job" {
+		os.Exit(exitRuntimeError)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobConfigParse(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      JobConfig
+		duration time.Duration
+		maxP99   time.Duration
+		ok       bool
+	}{
+		{JobConfig{}, 0, 0, true},
+		{JobConfig{Duration: "30m", MaxP99: "5s", MaxErrorRate: 0.01}, 30 * time.Minute, 5 * time.Second, true},
+		{JobConfig{Duration: "7d"}, 7 * 24 * time.Hour, 0, true},
+		{JobConfig{Duration: "P1W"}, 7 * 24 * time.Hour, 0, true},
+		{JobConfig{Duration: "1w2d"}, 9 * 24 * time.Hour, 0, true},
+		{JobConfig{Duration: "0s"}, 0, 0, false},
+		{JobConfig{Duration: "soon"}, 0, 0, false},
+		{JobConfig{MaxP99: "1d"}, 0, 0, false},
+		{JobConfig{MaxErrorRate: 1.5}, 0, 0, false},
+	} {
+		duration, maxP99, err := tc.cfg.parse()
+		if (err == nil) != tc.ok || duration != tc.duration || maxP99 != tc.maxP99 {
+			t.Errorf("parse(%+v) = %s, %s, %v, want %s, %s, ok: %v", tc.cfg, duration, maxP99, err, tc.duration, tc.maxP99, tc.ok)
+		}
+	}
+}
+
+func TestNewJobControllerExtendedDuration(t *testing.T) {
+	j, err := newJobController(JobConfig{Duration: "7d"}, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.duration != 7*24*time.Hour {
+		t.Errorf("duration = %s, want 168h", j.duration)
+	}
+}
+
+func TestValidateConfigJob(t *testing.T) {
+	config := &Config{Queries: []QueryConfig{{Name: "q", TraceQL: "{}"}}, Job: JobConfig{Duration: "7 days"}}
+	var found bool
+	for _, p := range validateConfig(config) {
+		found = found || strings.Contains(p.Error(), "job.duration")
+	}
+	if !found {
+		t.Errorf("validateConfig did not report the invalid job.duration")
+	}
+	config.Job.Duration = "7d"
+	for _, p := range validateConfig(config) {
+		if strings.Contains(p.Error(), "job.") {
+			t.Errorf("validateConfig reported %v for a valid job section", p)
+		}
+	}
+}
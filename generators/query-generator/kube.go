@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// In-cluster service account files
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// kubeClient is a minimal Kubernetes REST client for the controller; it only needs a handful of
+// JSON calls, which does not justify pulling client-go into the generator image
+type kubeClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// kubeStatusError is a non-2xx response of the API server
+type kubeStatusError struct {
+	code    int
+	message string
+}
+
+func (e *kubeStatusError) Error() string {
+	return fmt.Sprintf("kubernetes API returned %d: %s", e.code, e.message)
+}
+
+// isNotFound and isConflict classify API errors
+func isNotFound(err error) bool {
+	se, ok := err.(*kubeStatusError)
+	return ok && se.code == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	se, ok := err.(*kubeStatusError)
+	return ok && se.code == http.StatusConflict
+}
+
+// newInClusterKubeClient creates a client from the pod's service account; apiServer overrides the
+// in-cluster address (e.g. http://localhost:8001 with kubectl proxy, in which case no token is used)
+func newInClusterKubeClient(apiServer string) (*kubeClient, error) {
+	if apiServer != "" {
+		return &kubeClient{baseURL: strings.TrimSuffix(apiServer, "/"), http: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster (KUBERNETES_SERVICE_HOST/PORT unset), use --api-server")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s/ca.crt", serviceAccountDir)
+	}
+	return &kubeClient{
+		baseURL: "https://" + host + ":" + port,
+		token:   strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out (when not nil)
+func (c *kubeClient) do(method, path, contentType string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &status)
+		if status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		return &kubeStatusError{code: res.StatusCode, message: status.Message}
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// create posts an object to a collection; an existing object is not an error
+func (c *kubeClient) create(collection string, obj interface{}) error {
+	err := c.do(http.MethodPost, collection, "", obj, nil)
+	if isConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// mergePatch applies a JSON merge patch
+func (c *kubeClient) mergePatch(path string, patch interface{}) error {
+	return c.do(http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// planLane is the share of a query's plan entries served by one worker pool. Buckets with
+// dedicated workers get a lane each, so a pile-up of slow long-range requests only occupies
+// their own workers; the other entries share the query's main lane.
+type planLane struct {
+	bucket  string      // dedicated bucket ("" for the shared lane)
+	key     string      // plan index key
+	entries []PlanEntry // plan entries of the query served by the lane
+	workers int
+	qps     float64 // share of the query's target QPS, by plan entries
+	pool    *workerPool
+
+	countsCycles bool // the lane's cycles count as plan cycles of the query
+
+	done    int32  // 1 once the lane executed its entries (atomic)
+	pending *int32 // lanes of the query that have not (atomic, shared)
+
+	retries planRetries // failed entries awaiting another attempt (planFailures)
+}
+
+// newPlanLanes splits a query's plan entries into the shared lane and one lane per bucket with
+// dedicated workers. The shared lane comes first; it is omitted when dedicated lanes serve
+// every entry.
+func newPlanLanes(queryName string, plan []PlanEntry, buckets []timeBucket, concurrency int, targetQPS float64) []*planLane {
+	dedicated := make(map[string]*planLane)
+	shared := &planLane{key: queryName, workers: concurrency}
+	lanes := []*planLane{shared}
+	total := 0
+	for _, entry := range plan {
+		if entry.QueryName != queryName {
+			continue
+		}
+		total++
+		lane := shared
+		for i := range buckets {
+			if buckets[i].name == entry.BucketName && buckets[i].workers > 0 {
+				lane = dedicated[entry.BucketName]
+				if lane == nil {
+					lane = &planLane{bucket: entry.BucketName, key: queryName + "|" + entry.BucketName, workers: buckets[i].workers}
+					dedicated[entry.BucketName] = lane
+					lanes = append(lanes, lane)
+				}
+				break
+			}
+		}
+		lane.entries = append(lane.entries, entry)
+	}
+	if len(shared.entries) == 0 && len(lanes) > 1 {
+		lanes = lanes[1:]
+	}
+
+	pending := int32(len(lanes))
+	for _, lane := range lanes {
+		lane.pending = &pending
+		lane.qps = targetQPS
+		if total > 0 {
+			lane.qps = targetQPS * float64(len(lane.entries)) / float64(total)
+		}
+	}
+	return lanes
+}
+
+// accepts reports whether a window of the bucket belongs to the lane
+func (l *planLane) accepts(bucketName string, buckets []timeBucket) bool {
+	if l.bucket != "" {
+		return bucketName == l.bucket
+	}
+	for i := range buckets {
+		if buckets[i].name == bucketName {
+			return buckets[i].workers == 0
+		}
+	}
+	return true
+}
+
+// exhausted reports whether the lane executed each of its entries once in a job running until
+// plan completion; the query completes with its last lane, once no failed entry awaits another
+// attempt
+func (l *planLane) exhausted(queryName string, idx int64) bool {
+	entries := int64(len(l.entries))
+	if job == nil || !job.untilPlanComplete || idx < entries {
+		return false
+	}
+	if !l.unsettled() {
+		l.complete(queryName)
+	}
+	return true
+}
+
+// complete marks the lane done when it is past its entries in a job running until plan
+// completion
+func (l *planLane) complete(queryName string) {
+	entries := int64(len(l.entries))
+	if job == nil || !job.untilPlanComplete || atomic.LoadInt64(getPlanIndex(l.key)) < entries {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&l.done, 0, 1) && atomic.AddInt32(l.pending, -1) == 0 {
+		job.planExhausted(queryName, entries, entries)
+	}
+}
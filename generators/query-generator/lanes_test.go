@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewPlanLanes(t *testing.T) {
+	buckets := []timeBucket{{name: "recent"}, {name: "backend-24h", workers: 2}, {name: "retention-edge", workers: 1}}
+	plan := []PlanEntry{
+		{QueryName: "q", BucketName: "recent"},
+		{QueryName: "other", BucketName: "backend-24h"},
+		{QueryName: "q", BucketName: "backend-24h"},
+		{QueryName: "q", BucketName: "immediate"},
+		{QueryName: "q", BucketName: "backend-24h"},
+	}
+	lanes := newPlanLanes("q", plan, buckets, 4, 8)
+
+	want := []struct {
+		bucket, key string
+		entries     int
+		workers     int
+		qps         float64
+	}{
+		{"", "q", 2, 4, 4},
+		{"backend-24h", "q|backend-24h", 2, 2, 4},
+	}
+	if len(lanes) != len(want) {
+		t.Fatalf("lanes = %d, want %d", len(lanes), len(want))
+	}
+	for i, w := range want {
+		l := lanes[i]
+		if l.bucket != w.bucket || l.key != w.key || len(l.entries) != w.entries || l.workers != w.workers || l.qps != w.qps {
+			t.Errorf("lane %d = bucket %q, key %q, %d entries, %d workers at %v QPS, want %+v",
+				i, l.bucket, l.key, len(l.entries), l.workers, l.qps, w)
+		}
+		if l.pending != lanes[0].pending || atomic.LoadInt32(l.pending) != 2 {
+			t.Errorf("lane %d does not share the query's pending count of 2", i)
+		}
+	}
+
+	// Dedicated lanes serving every entry leave no shared lane
+	lanes = newPlanLanes("other", plan, buckets, 4, 1)
+	if len(lanes) != 1 || lanes[0].bucket != "backend-24h" || lanes[0].workers != 2 || lanes[0].qps != 1 {
+		t.Errorf("lanes of other = %+v, want only the backend-24h lane at the full QPS", lanes)
+	}
+
+	// A query without plan entries keeps a shared lane at its QPS
+	if lanes := newPlanLanes("none", plan, buckets, 4, 3); len(lanes) != 1 || lanes[0].bucket != "" || lanes[0].qps != 3 {
+		t.Errorf("lanes of a query without entries = %+v, want one shared lane at 3 QPS", lanes)
+	}
+}
+
+func TestPlanLaneAccepts(t *testing.T) {
+	buckets := []timeBucket{{name: "recent"}, {name: "backend-24h", workers: 2}}
+	shared := &planLane{}
+	dedicated := &planLane{bucket: "backend-24h"}
+	for _, tc := range []struct {
+		bucket            string
+		shared, dedicated bool
+	}{
+		{"recent", true, false},
+		{"backend-24h", false, true},
+		{"immediate", true, false},
+	} {
+		if got := shared.accepts(tc.bucket, buckets); got != tc.shared {
+			t.Errorf("shared lane accepts %s = %v, want %v", tc.bucket, got, tc.shared)
+		}
+		if got := dedicated.accepts(tc.bucket, buckets); got != tc.dedicated {
+			t.Errorf("dedicated lane accepts %s = %v, want %v", tc.bucket, got, tc.dedicated)
+		}
+	}
+}
+
+func TestPlanLanesComplete(t *testing.T) {
+	saved := job
+	t.Cleanup(func() { job = saved })
+	var err error
+	job, err = newJobController(JobConfig{UntilPlanComplete: true}, []string{"lanes-test"}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buckets := []timeBucket{{name: "recent"}, {name: "backend-24h", workers: 1}}
+	plan := []PlanEntry{{QueryName: "lanes-test", BucketName: "recent"}, {QueryName: "lanes-test", BucketName: "backend-24h"}}
+	lanes := newPlanLanes("lanes-test", plan, buckets, 1, 1)
+
+	// The query completes once every lane executed its entries
+	atomic.StoreInt64(getPlanIndex(lanes[0].key), 1)
+	if !lanes[0].exhausted("lanes-test", 1) {
+		t.Fatalf("shared lane not exhausted past its entry")
+	}
+	if job.context().Err() != nil {
+		t.Fatalf("job ended while the backend-24h lane has not executed its entry")
+	}
+	if lanes[1].exhausted("lanes-test", 0) {
+		t.Fatalf("backend-24h lane exhausted before its entry")
+	}
+	atomic.StoreInt64(getPlanIndex(lanes[1].key), 1)
+	lanes[1].exhausted("lanes-test", 1)
+	select {
+	case <-job.context().Done():
+	case <-time.After(time.Second):
+		t.Errorf("job did not end once every lane executed its entries")
+	}
+}
+
+func TestConvertTimeBucketsWorkers(t *testing.T) {
+	buckets, err := convertTimeBuckets([]TimeBucketConfig{{Name: "backend-24h", AgeStart: "24h", AgeEnd: "48h", Workers: 2}}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buckets[0].workers != 2 {
+		t.Errorf("workers = %d, want 2", buckets[0].workers)
+	}
+	if _, err := convertTimeBuckets([]TimeBucketConfig{{Name: "b", AgeStart: "0s", AgeEnd: "1h", Workers: -1}}, time.UTC); err == nil {
+		t.Errorf("negative workers accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Keys of the search job counters in the metrics object of Tempo search responses; fewer
+// completed than total jobs means some blocks were not searched
+var (
+	completedJobsKey = []byte(`"completedJobs"`)
+	totalJobsKey     = []byte(`"totalJobs"`)
+)
+
+// limitHits counts truncated and partial responses (nil until metrics are initialized)
+var limitHits *limitHitTracker
+
+// limitHitTracker detects responses that returned as many traces as the limit allowed, and
+// responses Tempo marks as partial. Their latency measures a search cut short rather than the
+// whole search, so they are counted per query and bucket and logged once.
+type limitHitTracker struct {
+	limitHit *prometheus.CounterVec
+	partial  *prometheus.CounterVec
+
+	logged sync.Map // query name + "|" + bucket + "|" + kind of the first truncated response
+}
+
+// newLimitHitTracker registers the truncation metrics
+func newLimitHitTracker() *limitHitTracker {
+	return &limitHitTracker{
+		limitHit: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "limit_hit_total",
+			Help:      "Successful responses that returned as many traces as the limit, by query name and bucket",
+		}, []string{"name", "bucket"}),
+		partial: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Name:      "partial_responses_total",
+			Help:      "Successful search responses with fewer completed than total jobs, by query name and bucket",
+		}, []string{"name", "bucket"}),
+	}
+}
+
+// limited reports whether the limit parameter caps the traces of a query's responses
+func (q QueryConfig) limited() bool {
+	switch q.kind() {
+	case queryKindZipkinServices, queryKindZipkinTrace:
+		return false
+	}
+	return true
+}
+
+// observe checks a successful response of a query; it reports whether the response hit the
+// limit and whether Tempo marked it partial
+func (t *limitHitTracker) observe(q QueryConfig, bucketName string, traces, limit int, body []byte) (limitHit, partial bool) {
+	if t == nil {
+		return false, false
+	}
+	if q.limited() && limit > 0 && traces >= limit {
+		limitHit = true
+		t.limitHit.WithLabelValues(q.Name, bucketName).Inc()
+		t.logOnce(q.Name, bucketName, "limit", "responses hit the limit of %d traces, latency measures a truncated search", limit)
+	}
+	if !q.isZipkin() {
+		completed, ok := scanMetricValue(body, completedJobsKey)
+		total, ok2 := scanMetricValue(body, totalJobsKey)
+		if ok && ok2 && completed < total {
+			partial = true
+			t.partial.WithLabelValues(q.Name, bucketName).Inc()
+			t.logOnce(q.Name, bucketName, "partial", "partial responses (%d of %d jobs completed)", completed, total)
+		}
+	}
+	return limitHit, partial
+}
+
+// logOnce logs the first truncated response of a query and bucket
+func (t *limitHitTracker) logOnce(queryName, bucketName, kind, format string, args ...interface{}) {
+	if _, seen := t.logged.LoadOrStore(queryName+"|"+bucketName+"|"+kind, true); seen {
+		return
+	}
+	log.Printf("Warning: Query %s [%s]: "+format, append([]interface{}{queryName, bucketName}, args...)...)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loadSampleInterval is how often outstanding requests and running workers are sampled
+const loadSampleInterval = 100 * time.Millisecond
+
+// Thresholds of the Little's-law check
+const (
+	// Average fraction of busy workers from which a missed QPS target is blamed on the generator
+	saturatedWorkers = 0.8
+	// Achieved/target QPS below which the target counts as missed
+	qpsShortfall = 0.95
+	// Relative and absolute gap between observed and implied in-flight requests that is tolerated
+	inFlightTolerance    = 0.2
+	inFlightMinDeviation = 0.5
+)
+
+// loadSamples samples outstanding requests and workers for the Little's-law check (nil when no
+// report is configured)
+var loadSamples *loadSampler
+
+// loadSampler periodically samples the outstanding requests and the workers of every executor
+type loadSampler struct {
+	mu        sync.Mutex
+	pools     []*workerPool
+	targetQPS float64     // sum of the executors' target QPS
+	whole     loadAverage // samples of the whole run
+}
+
+// loadAverage accumulates samples of outstanding requests and running workers
+type loadAverage struct {
+	samples  int64
+	inFlight float64
+	workers  float64
+}
+
+// add records one sample
+func (a *loadAverage) add(inFlight, workers int) {
+	a.samples++
+	a.inFlight += float64(inFlight)
+	a.workers += float64(workers)
+}
+
+// averages returns the time-averaged outstanding requests and workers
+func (a loadAverage) averages() (inFlight, workers float64) {
+	if a.samples == 0 {
+		return 0, 0
+	}
+	return a.inFlight / float64(a.samples), a.workers / float64(a.samples)
+}
+
+func newLoadSampler() *loadSampler {
+	return &loadSampler{}
+}
+
+// register adds the worker pool and target QPS of an executor
+func (s *loadSampler) register(pool *workerPool, targetQPS float64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pools = append(s.pools, pool)
+	s.targetQPS += targetQPS
+	s.mu.Unlock()
+}
+
+// run samples until ctx is done
+func (s *loadSampler) run(ctx context.Context) {
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			inFlightNow := inFlight.current()
+			s.mu.Lock()
+			workers := 0
+			for _, pool := range s.pools {
+				workers += pool.size()
+			}
+			s.whole.add(inFlightNow, workers)
+			s.mu.Unlock()
+			stairStep.addLoad(now, inFlightNow, workers)
+		}
+	}
+}
+
+// check returns the Little's-law check of the whole run (nil when not sampled)
+func (s *loadSampler) check(achievedQPS, meanLatency float64) *littlesLawCheck {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := newLittlesLawCheck(s.whole, s.targetQPS, achievedQPS, meanLatency)
+	return &c
+}
+
+// total returns the target QPS across all executors
+func (s *loadSampler) total() float64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.targetQPS
+}
+
+// littlesLawCheck compares the observed average of outstanding requests with the one implied by
+// Little's law (throughput x mean latency) and tells whether the generator limited the run
+type littlesLawCheck struct {
+	ObservedInFlight float64 // time-averaged outstanding requests
+	ImpliedInFlight  float64 // achieved QPS x mean latency
+	Workers          float64 // time-averaged workers across all queries
+	TargetQPS        float64
+	AchievedQPS      float64
+	Verdict          string
+}
+
+// newLittlesLawCheck evaluates the load samples of a run or stage
+func newLittlesLawCheck(load loadAverage, targetQPS, achievedQPS, meanLatency float64) littlesLawCheck {
+	c := littlesLawCheck{
+		ImpliedInFlight: achievedQPS * meanLatency,
+		TargetQPS:       targetQPS,
+		AchievedQPS:     achievedQPS,
+	}
+	c.ObservedInFlight, c.Workers = load.averages()
+
+	deviation := c.ObservedInFlight - c.ImpliedInFlight
+	switch {
+	case load.samples == 0:
+		c.Verdict = "not sampled"
+	case targetQPS > 0 && achievedQPS < targetQPS*qpsShortfall && c.Workers > 0 && meanLatency > 0 && c.ObservedInFlight >= c.Workers*saturatedWorkers:
+		// Every worker is busy, so the worker count caps throughput at workers / latency
+		c.Verdict = fmt.Sprintf("generator-bound: %.1f of %.0f workers busy, at most %.1f QPS at this latency; add workers before blaming the server",
+			c.ObservedInFlight, c.Workers, c.Workers/meanLatency)
+	case deviation > c.ImpliedInFlight*inFlightTolerance && deviation >= inFlightMinDeviation:
+		// Requests hold their slot while the response is read and decoded, which latency excludes
+		c.Verdict = fmt.Sprintf("generator overhead: %.1f more requests in flight than latency explains (response reading/decoding or client CPU)", deviation)
+	case -deviation > c.ImpliedInFlight*inFlightTolerance && -deviation >= inFlightMinDeviation:
+		c.Verdict = "inconsistent: fewer requests in flight than throughput x latency implies (dropped samples?)"
+	default:
+		c.Verdict = "consistent"
+	}
+	return c
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loki batching limits: a batch is pushed when it holds lokiBatchSize entries or its oldest
+// entry is older than lokiBatchWait
+const (
+	lokiBatchSize = 1000
+	lokiBatchWait = time.Second
+)
+
+// lokiSink pushes samples as structured log lines to Loki, in streams labeled by query, bucket
+// and status class so failures can be queried next to Tempo's own logs
+type lokiSink struct {
+	url      string
+	tenantID string
+	labels   map[string]string
+	client   *http.Client
+
+	streams map[string]*lokiStream
+	entries int
+	oldest  time.Time
+}
+
+// lokiStream is a stream of the Loki push API
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// newLokiSink creates a Loki sink from a sample output config
+func newLokiSink(out SampleOutputConfig) (*lokiSink, error) {
+	if out.URL == "" {
+		return nil, fmt.Errorf("loki sample output needs a url")
+	}
+	labels := out.Labels
+	if len(labels) == 0 {
+		labels = map[string]string{"job": "query-load-generator"}
+	}
+	log.Printf("Pushing request logs to Loki at %s", out.URL)
+	return &lokiSink{
+		url:      out.URL,
+		tenantID: out.TenantID,
+		labels:   labels,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		streams:  make(map[string]*lokiStream),
+	}, nil
+}
+
+func (s *lokiSink) write(sample *requestSample) error {
+	status := "error"
+	if sample.Status != 0 {
+		status = statusClass(sample.Status)
+	}
+	key := sample.Query + "\x00" + sample.Bucket + "\x00" + status
+
+	stream, ok := s.streams[key]
+	if !ok {
+		labels := make(map[string]string, len(s.labels)+3)
+		for k, v := range s.labels {
+			labels[k] = v
+		}
+		labels["query"] = sample.Query
+		labels["bucket"] = sample.Bucket
+		labels["status_class"] = status
+		stream = &lokiStream{Stream: labels}
+		s.streams[key] = stream
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	ts := sample.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), string(line)})
+	if s.entries == 0 {
+		s.oldest = time.Now()
+	}
+	s.entries++
+
+	if s.entries >= lokiBatchSize || time.Since(s.oldest) >= lokiBatchWait {
+		return s.push()
+	}
+	return nil
+}
+
+func (s *lokiSink) close() error {
+	return s.push()
+}
+
+// push sends the buffered entries; the batch is dropped on failure so a Loki outage cannot
+// grow memory without bound
+func (s *lokiSink) push() error {
+	if s.entries == 0 {
+		return nil
+	}
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, stream := range s.streams {
+		body.Streams = append(body.Streams, stream)
+	}
+	s.streams = make(map[string]*lokiStream)
+	s.entries = 0
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenantID)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("loki push failed: %w", err)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("loki push returned %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
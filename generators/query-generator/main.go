@@ -1,21 +1,20 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math"
-	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -41,6 +40,59 @@ var (
 
 	// Spans returned histogram with query name label
 	spansReturnedHist *prometheus.HistogramVec
+
+	// Duration sweep latency histogram with query name and threshold labels
+	sweepDurationHist *prometheus.HistogramVec
+
+	// Counter of plan entries that fell back to the immediate bucket
+	bucketFallbackCounter *prometheus.CounterVec
+
+	// Cache analysis latency histogram with query name and type (fresh/repeat) labels
+	cacheAnalysisHist *prometheus.HistogramVec
+
+	// Golden response checks and mismatches with query name label
+	goldenChecksCounter     *prometheus.CounterVec
+	goldenMismatchesCounter *prometheus.CounterVec
+
+	// Query latency histogram with query name and status class labels
+	statusLatencyHist *prometheus.HistogramVec
+
+	// Query latency histogram with query name and negotiated HTTP protocol labels
+	protocolLatencyHist *prometheus.HistogramVec
+
+	// Query latency histogram with query name and kind (traceql, legacy, zipkin-*) labels
+	kindLatencyHist *prometheus.HistogramVec
+
+	// Current number of workers per query
+	workersGauge *prometheus.GaugeVec
+
+	// Rate-limited (429) responses and seconds spent backing off with query name label
+	rateLimitedCounter        *prometheus.CounterVec
+	rateLimitBackoffCounter   *prometheus.CounterVec
+	rateLimitPausesCounter    *prometheus.CounterVec
+	rateLimitThrottledCounter *prometheus.CounterVec
+
+	// Result order checks of mostRecent queries with query name and result (sorted/unsorted) labels
+	resultOrderCounter *prometheus.CounterVec
+
+	// Unix time of the last completed request with query name label, for stall alerts
+	heartbeatGauge *prometheus.GaugeVec
+
+	// Execution plan length, entries executed and full cycles completed with query name label
+	planEntriesGauge  *prometheus.GaugeVec
+	planExecutedGauge *prometheus.GaugeVec
+	planCyclesGauge   *prometheus.GaugeVec
+
+	// Whether a query is running per its startAfter/stopAfter schedule, with query name label
+	queryActiveGauge *prometheus.GaugeVec
+)
+
+// Defaults of optional settings
+const (
+	defaultNamespace         = "default"
+	defaultQueryDelay        = "1s"
+	defaultConcurrentQueries = 5
+	defaultTargetQPS         = 10.0
 )
 
 // PlanEntry represents a single entry in the execution plan from config
@@ -52,61 +104,158 @@ type PlanEntry struct {
 // TempoSearchResponse represents the response from Tempo /api/search endpoint
 type TempoSearchResponse struct {
 	Traces []struct {
-		TraceID  string `json:"traceID"`
-		SpanSets []struct {
-			Spans []struct {
-				SpanID string `json:"spanID"`
-			} `json:"spans"`
-			Matched int `json:"matched"`
-		} `json:"spanSets"`
+		TraceID           string         `json:"traceID"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		DurationMs        int64          `json:"durationMs"`
+		SpanSets          []TempoSpanSet `json:"spanSets"`
 		// For non-structural queries, spans may be at trace level
-		SpanSet *struct {
-			Spans []struct {
-				SpanID string `json:"spanID"`
-			} `json:"spans"`
-			Matched int `json:"matched"`
-		} `json:"spanSet,omitempty"`
+		SpanSet *TempoSpanSet `json:"spanSet,omitempty"`
 	} `json:"traces"`
 }
 
+// TempoSpanSet represents a set of matching spans within a trace
+type TempoSpanSet struct {
+	Spans []struct {
+		SpanID     string `json:"spanID"`
+		Attributes []struct {
+			Key string `json:"key"`
+		} `json:"attributes"`
+	} `json:"spans"`
+	Matched int `json:"matched"`
+}
+
+// attributeKeys returns the set of span attribute keys present in the response
+func (r *TempoSearchResponse) attributeKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, trace := range r.Traces {
+		spanSets := trace.SpanSets
+		if trace.SpanSet != nil {
+			spanSets = append(spanSets, *trace.SpanSet)
+		}
+		for _, spanSet := range spanSets {
+			for _, span := range spanSet.Spans {
+				for _, attr := range span.Attributes {
+					keys[attr.Key] = true
+				}
+			}
+		}
+	}
+	return keys
+}
+
 // Config represents the YAML configuration structure
 type Config struct {
-	Tempo struct {
-		QueryEndpoint string `yaml:"queryEndpoint"`
+	Include []string `yaml:"include"` // Config files merged before this one; this file overrides them
+	// HTTP(S) URL of a query catalog (queries and/or executionPlan) fetched at startup; this file overrides it
+	QueriesURL     string        `yaml:"queriesURL"`
+	QueriesCatalog CatalogConfig `yaml:"queriesCatalog"` // Auth, timeout and refresh of queriesURL
+	// Attributes the write side emits, e.g. "span.http.status_code" (usually from the catalog);
+	// queries filtering on other attributes are reported at startup
+	Attributes       []string `yaml:"attributes"`
+	StrictAttributes bool     `yaml:"strictAttributes"` // Refuse to start instead of warning about unknown attributes
+	Tempo            struct {
+		QueryEndpoint  string `yaml:"queryEndpoint"`  // Base URL, or unix:///path/to.sock for a unix domain socket
+		ZipkinEndpoint string `yaml:"zipkinEndpoint"` // Base URL of a Zipkin-compatible read API, for zipkin-* queries
+		Protocol       string `yaml:"protocol"`       // "auto" (default, HTTP/1.1), "http1" or "http2"
+		Target         string `yaml:"target"`         // "gateway" (default), "grafanaCloud" or "grafana"; sets the URL layout
+		TimeFormat     string `yaml:"timeFormat"`     // start/end format: "unix" seconds (default), "rfc3339" or "nanoseconds"
+		// Tempo data source of the grafana target, whose queryEndpoint is the Grafana URL: numeric ID or "uid:<uid>"
+		GrafanaDatasource string `yaml:"grafanaDatasource"`
+		// Also pause after 429 responses without Retry-After, doubling up to 1m (always on for grafanaCloud);
+		// Retry-After is always honored
+		RateLimitBackoff bool `yaml:"rateLimitBackoff"`
+		// Cap of pauses requested by Retry-After, e.g. "5m" (default: none, the header is honored)
+		MaxRetryAfter string `yaml:"maxRetryAfter"`
 	} `yaml:"tempo"`
-	Namespace string `yaml:"namespace"`
-	TenantID  string `yaml:"tenantId"`
-	Query     struct {
+	Namespace     string   `yaml:"namespace"` // Defaults to the deployment namespace (POD_NAMESPACE)
+	TenantID      string   `yaml:"tenantId"`
+	Tenants       []string `yaml:"tenants"`               // Rotate requests across several tenants (default: [tenantId])
+	VerifyTenants bool     `yaml:"verifyTenantIsolation"` // Check that no trace ID is returned to more than one tenant
+	DataEpoch     string   `yaml:"dataEpoch"`             // Moment data is assumed to exist from: RFC3339 or "now-<duration>" (default: test start)
+	StartTimeFile string   `yaml:"startTimeFile"`         // File used to persist the test start time across restarts (optional)
+	Query         struct {
 		Delay             string  `yaml:"delay"`
 		ConcurrentQueries int     `yaml:"concurrentQueries"`
 		TargetQPS         float64 `yaml:"targetQPS"`
 		BurstMultiplier   float64 `yaml:"burstMultiplier"` // Multiplier for rate limiter burst size (default: 2.0)
 		QPSMultiplier     float64 `yaml:"qpsMultiplier"`   // Multiplier to apply to targetQPS for compensation (default: 1.0)
 		Limit             int     `yaml:"limit"`           // Maximum number of results to return per query (default: 1000)
+		MaxInFlight       int     `yaml:"maxInFlight"`     // Global cap on outstanding requests across all queries (default: 0 = unlimited)
+		Timeout           string  `yaml:"timeout"`         // Request timeout of standard queries (default: 15m)
+		MaxTotalQueries   int64   `yaml:"maxTotalQueries"` // Stop cleanly after this many requests across all queries (default: 0 = unlimited)
+
+		CacheAnalysis  CacheAnalysisConfig `yaml:"cacheAnalysis"`  // Repeat recent queries to compare cached vs fresh latency
+		GoldenInterval string              `yaml:"goldenInterval"` // How often responses are compared against golden files (default: 1m)
+		ResultAnomaly  AnomalyConfig       `yaml:"resultAnomaly"`  // Detect sudden changes in results returned per query and bucket
+		LatencyAnomaly AnomalyConfig       `yaml:"latencyAnomaly"` // Detect sudden changes in latency per query and bucket
+		BurnRate       BurnRateConfig      `yaml:"burnRate"`       // Rolling error-budget and latency-SLO burn rates
+		Apdex          ApdexConfig         `yaml:"apdex"`          // Apdex score per query over rolling windows and the run
+		Autoscale      AutoscaleConfig     `yaml:"autoscale"`      // Grow/shrink workers per query from limiter backlog
+		HighThroughput bool                `yaml:"highThroughput"` // More idle connections and no per-request success logs, for >10k QPS
+		SpanCounting   string              `yaml:"spanCounting"`   // "json" (default) decodes responses, "scan" only counts span/trace keys
+		Expensive      ExpensiveConfig     `yaml:"expensive"`      // Timeout, QPS cap, histogram and circuit breaker of expensive queries
+		WorkerStart    WorkerStartConfig   `yaml:"workerStart"`    // Jitter and stagger of the workers' first requests
+		DeadlineHint   DeadlineHintConfig  `yaml:"deadlineHint"`   // Send the client timeout as a header (e.g. Grpc-Timeout)
+		Calibration    CalibrationConfig   `yaml:"calibration"`    // Baseline each query per bucket before the load
+		LatencyBuckets BucketTuningConfig  `yaml:"latencyBuckets"` // Recommend latency histogram buckets from observed latencies
 	} `yaml:"query"`
-	TimeBuckets []struct {
-		Name     string `yaml:"name"`
-		AgeStart string `yaml:"ageStart"`
-		AgeEnd   string `yaml:"ageEnd"`
-		Weight   int    `yaml:"weight"`
-	} `yaml:"timeBuckets"`
-	Queries []struct {
-		Name    string `yaml:"name"`
-		TraceQL string `yaml:"traceql"`
-	} `yaml:"queries"`
-	ExecutionPlan []PlanEntry `yaml:"executionPlan"` // Execution plan defined in config
+	TimeBuckets   []TimeBucketConfig   `yaml:"timeBuckets"`
+	Queries       []QueryConfig        `yaml:"queries"`
+	Suites        []SuiteConfig        `yaml:"suites"`        // Named groups of queries selectable at startup
+	Notifier      NotifierConfig       `yaml:"notifier"`      // Where alerts raised by the generator are sent
+	Samples       []SampleOutputConfig `yaml:"samples"`       // Per-request sample outputs (NDJSON/CSV files)
+	Report        ReportConfig         `yaml:"report"`        // Reports written when the run ends
+	Tracing       TracingConfig        `yaml:"tracing"`       // Trace context propagation and exemplars
+	MetricsSinks  []MetricsSinkConfig  `yaml:"metricsSinks"`  // Where metrics are published (default: Prometheus only)
+	Network       NetworkConfig        `yaml:"network"`       // Client-side network impairments (WAN simulation)
+	ExecutionPlan []PlanEntry          `yaml:"executionPlan"` // Execution plan defined in config
+	StrictPlan    bool                 `yaml:"strictPlan"`    // Refuse to start when the plan references unknown buckets
+	PlanFailures  PlanFailureConfig    `yaml:"planFailures"`  // Skip, retry or requeue plan entries whose request failed
+	Job           JobConfig            `yaml:"job"`           // Bounded run and SLOs used with --mode=job
+	Server        ServerConfig         `yaml:"server"`        // Metrics/status server listen address, path, auth and TLS
+	StairStep     StairStepConfig      `yaml:"stairStep"`     // Sweep workers per query in timed stages at a fixed QPS
+	Redaction     RedactionConfig      `yaml:"redaction"`     // What logs, samples and failure captures hide (credentials always)
+	SlowLog       SlowLogConfig        `yaml:"slowLog"`       // Log requests slower than a per-class threshold with a timing breakdown
+	Auth          AuthConfig           `yaml:"auth"`          // Credentials of query requests (service account, OIDC, API key or basic auth)
+	Freshness     FreshnessConfig      `yaml:"freshness"`     // Probe how long new data takes to become searchable
+	Audit         AuditConfig          `yaml:"audit"`         // Check that traces written during the run stay retrievable as they age
+	BucketProbe   BucketProbeConfig    `yaml:"bucketProbe"`   // Make buckets eligible once a probe finds data in them
+	Pauses        []PauseWindowConfig  `yaml:"pauses"`        // Scheduled windows without queries, to measure the recovery
+	Cost          CostConfig           `yaml:"cost"`          // Attribute Tempo CPU to queries from its metrics
+	PhaseGrace    string               `yaml:"phaseGrace"`    // Cancel requests outliving their stair-step stage, pause or run by more than this (e.g. "5s")
+	Timezone      string               `yaml:"timezone"`      // Timezone of logs, reports and absolute bucket times without an offset (default: UTC)
+	Artifacts     ArtifactsConfig      `yaml:"artifacts"`     // Write the files of each run under a per-run directory
+	// Named sets of experimental request headers that queries rotate through (query headerProfiles)
+	HeaderProfiles []HeaderProfileConfig `yaml:"headerProfiles"`
+	// Derive ingester, backend and retention-edge buckets from the Tempo configuration
+	TimeBucketsFrom DerivedBucketsConfig `yaml:"timeBucketsFrom"`
+	// Clients queries pose as (query clients), in addition to the built-in grafana and tempo-cli
+	ClientIdentities []ClientIdentityConfig `yaml:"clientIdentities"`
 }
 
-// timeBucket defines a time range for queries
-type timeBucket struct {
-	name     string        // bucket name (e.g., "ingester", "backend-1h")
-	ageStart time.Duration // how far back to end the query window
-	ageEnd   time.Duration // how far back to start the query window
-	weight   int           // weight for random selection
+// loadConfig loads and parses the configuration file (YAML, or JSON/TOML by extension) and
+// adds the time buckets derived from the Tempo configuration
+func loadConfig(configPath string) (*Config, error) {
+	config, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return config, applyDerivedBuckets(config)
 }
 
-// loadConfig loads and parses the YAML configuration file
-func loadConfig(configPath string) (*Config, error) {
+// readConfig parses the configuration file with its includes and query catalog
+func readConfig(configPath string) (*Config, error) {
+	if !isYAMLConfig(configPath) {
+		tree, err := loadConfigTree(configPath, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		if tree, err = mergeCatalog(tree); err != nil {
+			return nil, err
+		}
+		return decodeConfigTree(tree)
+	}
+
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -116,78 +265,37 @@ func loadConfig(configPath string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
-	return &config, nil
-}
-
-// convertTimeBuckets converts config time buckets to internal timeBucket struct
-func convertTimeBuckets(configBuckets []struct {
-	Name     string `yaml:"name"`
-	AgeStart string `yaml:"ageStart"`
-	AgeEnd   string `yaml:"ageEnd"`
-	Weight   int    `yaml:"weight"`
-}) ([]timeBucket, error) {
-	buckets := make([]timeBucket, 0, len(configBuckets))
-
-	for _, cb := range configBuckets {
-		ageStart, err := time.ParseDuration(cb.AgeStart)
-		if err != nil {
-			return nil, fmt.Errorf("invalid ageStart duration in bucket %s: %v", cb.Name, err)
-		}
-
-		ageEnd, err := time.ParseDuration(cb.AgeEnd)
-		if err != nil {
-			return nil, fmt.Errorf("invalid ageEnd duration in bucket %s: %v", cb.Name, err)
-		}
-
-		buckets = append(buckets, timeBucket{
-			name:     cb.Name,
-			ageStart: ageStart,
-			ageEnd:   ageEnd,
-			weight:   cb.Weight,
-		})
+	if len(config.Include) == 0 && config.QueriesURL == "" {
+		return &config, nil
 	}
 
-	return buckets, nil
-}
-
-// selectTimeBucket selects a time bucket based on weighted random selection
-// Only buckets where data could exist (ageEnd <= elapsed time) are considered
-func selectTimeBucket(buckets []timeBucket, testStartTime time.Time) *timeBucket {
-	elapsed := time.Since(testStartTime)
-
-	// Filter to only buckets where data could exist
-	var eligible []timeBucket
-	for _, bucket := range buckets {
-		if bucket.ageEnd <= elapsed {
-			eligible = append(eligible, bucket)
-		}
+	// Merge the included files and the query catalog, and parse the result again
+	tree, err := loadConfigTree(configPath, map[string]bool{})
+	if err != nil {
+		return nil, err
 	}
-
-	// If no buckets are eligible yet, return nil
-	if len(eligible) == 0 {
-		return nil
+	if tree, err = mergeCatalog(tree); err != nil {
+		return nil, err
 	}
+	return decodeConfigTree(tree)
+}
 
-	// Weighted selection from eligible buckets only
-	totalWeight := 0
-	for _, bucket := range eligible {
-		totalWeight += bucket.weight
+// decodeConfigTree parses a merged config document
+func decodeConfigTree(tree map[string]interface{}) (*Config, error) {
+	merged, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config files: %w", err)
 	}
-
-	r := rand.Intn(totalWeight)
-	cumulative := 0
-	for i := range eligible {
-		cumulative += eligible[i].weight
-		if r < cumulative {
-			return &eligible[i]
-		}
+	var config Config
+	if err := yaml.Unmarshal(merged, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse merged config: %w", err)
 	}
-	return &eligible[0]
+	return &config, nil
 }
 
-// initMetrics initializes all Prometheus metrics once at startup
-func initMetrics(namespace string) {
+// initMetrics initializes all Prometheus metrics once at startup; latencyBuckets replaces the
+// default buckets of the query latency histograms when set
+func initMetrics(namespace string, latencyBuckets []float64) {
 	// Sanitize namespace for metric names
 	sanitizedNs := strings.ReplaceAll(namespace, "-", "_")
 
@@ -196,6 +304,7 @@ func initMetrics(namespace string) {
 		Namespace: "query_load_test",
 		Name:      sanitizedNs,
 		Help:      "Query latency in seconds",
+		Buckets:   latencyBuckets,
 	}, []string{"name"})
 
 	// Query failures counter with query name label
@@ -219,6 +328,7 @@ func initMetrics(namespace string) {
 		Subsystem: "time_bucket",
 		Name:      "duration_seconds",
 		Help:      "Query duration per time bucket",
+		Buckets:   latencyBuckets,
 	}, []string{"bucket", "query_name"})
 
 	// Spans returned histogram with query name label
@@ -230,69 +340,309 @@ func initMetrics(namespace string) {
 		Buckets:   []float64{0, 10, 50, 100, 250, 500, 1000, 2500, 5000},
 	}, []string{"name"})
 
+	// Duration sweep latency histogram with query name and threshold labels
+	sweepDurationHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "duration_sweep",
+		Name:      "duration_seconds",
+		Help:      "Query latency per duration sweep threshold",
+	}, []string{"name", "threshold"})
+
+	// Counter of plan entries that fell back to the immediate bucket
+	bucketFallbackCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "time_bucket",
+		Name:      "fallback_total",
+		Help:      "Plan entries that fell back to the immediate bucket, by reason (not_found, not_eligible)",
+	}, []string{"bucket", "query_name", "reason"})
+
+	// Cache analysis latency histogram with query name and type (fresh/repeat) labels
+	cacheAnalysisHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "cache_analysis",
+		Name:      "duration_seconds",
+		Help:      "Query latency of first-seen (fresh) vs repeated identical queries",
+	}, []string{"name", "type"})
+
+	// Query latency histogram with query name and status class (2xx/4xx/5xx) labels
+	statusLatencyHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "status",
+		Name:      "duration_seconds",
+		Help:      "Query latency per response status class",
+	}, []string{"name", "status_class"})
+
+	// Query latency histogram with query name and negotiated HTTP protocol labels
+	protocolLatencyHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "protocol",
+		Name:      "duration_seconds",
+		Help:      "Query latency per negotiated HTTP protocol",
+	}, []string{"name", "protocol"})
+
+	// Query latency histogram with query name and kind labels, e.g. to follow the legacy search
+	kindLatencyHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "query_load_test",
+		Subsystem: "kind",
+		Name:      "duration_seconds",
+		Help:      "Query latency per query kind (traceql, legacy tags search, zipkin-*)",
+	}, []string{"name", "kind"})
+
+	// Current number of workers per query
+	workersGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "executor",
+		Name:      "workers",
+		Help:      "Current number of workers per query",
+	}, []string{"name"})
+
+	// Golden response checks and mismatches with query name label
+	goldenChecksCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "golden",
+		Name:      "checks_total",
+		Help:      "Responses compared against the query's golden file",
+	}, []string{"name"})
+	goldenMismatchesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "golden",
+		Name:      "mismatches_total",
+		Help:      "Golden file checks failed by live responses, by check",
+	}, []string{"name", "check"})
+
+	// Rate-limited (429) responses and seconds spent backing off with query name label
+	rateLimitedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "rate_limit",
+		Name:      "responses_total",
+		Help:      "Responses rejected with 429 Too Many Requests",
+	}, []string{"name"})
+	rateLimitBackoffCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "rate_limit",
+		Name:      "backoff_seconds_total",
+		Help:      "Time workers paused after 429 responses",
+	}, []string{"name"})
+	rateLimitPausesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "rate_limit",
+		Name:      "pauses_total",
+		Help:      "Times a query was paused by a 429 response while not already paused",
+	}, []string{"name"})
+	rateLimitThrottledCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "rate_limit",
+		Name:      "throttled_seconds_total",
+		Help:      "Wall-clock time a query was paused by 429 responses (Retry-After or backoff)",
+	}, []string{"name"})
+
+	// Result order checks of mostRecent queries with query name and result (sorted/unsorted) labels
+	resultOrderCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "result_order",
+		Name:      "checks_total",
+		Help:      "Responses of mostRecent queries by whether traces came back newest first (sorted) or not (unsorted)",
+	}, []string{"name", "result"})
+
+	// Unix time of the last completed request with query name label
+	heartbeatGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Name:      "heartbeat_timestamp_seconds",
+		Help:      "Unix time of the last completed request of a query; alert when it stops advancing",
+	}, []string{"name"})
+
+	// Execution plan progress with query name label
+	planEntriesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "plan",
+		Name:      "entries",
+		Help:      "Execution plan entries of a query",
+	}, []string{"name"})
+	planExecutedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "plan",
+		Name:      "entries_executed",
+		Help:      "Execution plan entries a query has executed, across all cycles",
+	}, []string{"name"})
+	planCyclesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "plan",
+		Name:      "cycles_completed",
+		Help:      "Times a query has executed all of its execution plan entries",
+	}, []string{"name"})
+
+	queryActiveGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Name:      "query_active",
+		Help:      "1 while a query runs per its startAfter/stopAfter schedule, 0 before and after",
+	}, []string{"name"})
+
 	log.Printf("Metrics initialized for namespace: %s (sanitized: %s)", namespace, sanitizedNs)
 }
 
-// formatRequest formats the full HTTP request details for logging
-func formatRequest(req *http.Request) string {
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("Method: %s\n", req.Method))
-	buf.WriteString(fmt.Sprintf("URL: %s\n", req.URL.String()))
-	buf.WriteString("Headers:\n")
-	for key, values := range req.Header {
-		for _, value := range values {
-			// Mask authorization token for security
-			if key == "Authorization" {
-				if len(value) > 20 {
-					buf.WriteString(fmt.Sprintf("  %s: Bearer %s...\n", key, value[:20]))
-				} else {
-					buf.WriteString(fmt.Sprintf("  %s: %s\n", key, value))
-				}
-			} else {
-				buf.WriteString(fmt.Sprintf("  %s: %s\n", key, value))
-			}
-		}
-	}
-	return buf.String()
+// statusClass returns the status class label (e.g. "2xx") for an HTTP status code
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
 }
 
-func main() {
-	flag.Parse()
+// subcommands maps utility command names to their entry points; without a command the generator runs
+var subcommands = map[string]func(args []string) error{
+	"plan":       runPlanCommand,
+	"validate":   runValidateCommand,
+	"controller": runControllerCommand,
+	"campaign":   runCampaignCommand,
+	"rules":      runRulesCommand,
+	"import":     runImportCommand,
+	"federate":   runFederateCommand,
+}
 
-	// Get config file path from environment variable (default to /config/config.yaml)
+// configPathFromEnv returns the config file path from CONFIG_FILE (default to /config/config.yaml)
+func configPathFromEnv() string {
 	configPath := os.Getenv("CONFIG_FILE")
 	if configPath == "" {
 		configPath = "/config/config.yaml"
 	}
+	return configPath
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
+	flag.Parse()
+
+	// Get config file path from environment variable
+	configPath := configPathFromEnv()
 
 	log.Printf("Loading configuration from: %s", configPath)
 
-	// Load and parse configuration
-	config, err := loadConfig(configPath)
+	// Load and parse configuration, over a built-in preset if one is selected
+	var config *Config
+	var err error
+	if *presetFlag != "" {
+		if !modeFlagSet() {
+			*runMode = "job"
+		}
+		config, err = loadPresetConfig(*presetFlag, configPath)
+		log.Printf("Using preset %s (mode: %s)", *presetFlag, *runMode)
+	} else {
+		config, err = loadConfig(configPath)
+	}
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatalf("Failed to load config: %v", err)
+	}
+	zone, err := loadTimezone(config.Timezone)
+	if err != nil {
+		fatalf("Invalid timezone: %v", err)
+	}
+	useLogTimezone(zone)
+	log.Printf("Timestamps of logs and reports are in %s", zone)
+
+	// Fill in the namespace from the deployment and label metrics with the pod identity
+	identity = detectIdentity()
+	switch {
+	case config.Namespace == "" && identity.Namespace != "":
+		config.Namespace = identity.Namespace
+		log.Printf("Namespace not set in config, using deployment namespace: %s", config.Namespace)
+	case identity.Namespace != "" && identity.Namespace != config.Namespace:
+		log.Printf("Warning: Config namespace %q differs from deployment namespace %q", config.Namespace, identity.Namespace)
+	case config.Namespace == "":
+		config.Namespace = defaultNamespace
+		log.Printf("Namespace not set, using: %s", config.Namespace)
+	}
+	if labels := identity.labels(); len(labels) > 0 {
+		prometheus.DefaultRegisterer = prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
+		log.Printf("Generator identity: pod=%s node=%s", identity.Pod, identity.Node)
+	}
+
+	if config.Artifacts.Dir != "" {
+		dir, err := prepareArtifacts(config, configPath, time.Now())
+		if err != nil {
+			fatalf("Invalid artifacts configuration: %v", err)
+		}
+		log.Printf("Run artifacts are written to %s", dir)
+	}
+
+	// Latency histogram buckets recommended by the previous run or phase
+	latencyBuckets, err = newBucketTuner(config.Query.LatencyBuckets)
+	if err != nil {
+		fatalf("Invalid query.latencyBuckets: %v", err)
+	}
+	var tunedBuckets []float64
+	if config.Query.LatencyBuckets.File != "" {
+		tunedBuckets, err = loadTunedBuckets(config.Query.LatencyBuckets.File)
+		if err != nil {
+			fatalf("Invalid query.latencyBuckets.file: %v", err)
+		}
+		if tunedBuckets != nil {
+			log.Printf("Latency histograms use the buckets recommended by the previous run: %s", formatBuckets(tunedBuckets))
+		}
 	}
 
 	// Initialize metrics ONCE with the configured namespace
-	initMetrics(config.Namespace)
+	initMetrics(config.Namespace, tunedBuckets)
+	inspection = newInspectionTracker()
+	limitHits = newLimitHitTracker()
+	publishBuildInfo()
+	log.Printf("Generator version %s (commit %s, %s)", version, buildCommit(), runtime.Version())
 
 	// Parse query delay (kept for backward compatibility, but not used if targetQPS is set)
+	if config.Query.Delay == "" {
+		config.Query.Delay = defaultQueryDelay
+	}
 	queryDelay, err := time.ParseDuration(config.Query.Delay)
 	if err != nil {
-		log.Fatalf("Could not parse query delay: %v", err)
+		fatalf("Could not parse query delay: %v", err)
 	}
 
-	// Validate concurrent queries
+	// Validate concurrent queries (default: 5)
 	concurrentQueries := config.Query.ConcurrentQueries
+	if concurrentQueries == 0 {
+		concurrentQueries = defaultConcurrentQueries
+	}
 	if concurrentQueries < 1 {
-		log.Fatalf("CONCURRENT_QUERIES must be >= 1, got: %d", concurrentQueries)
+		fatalf("CONCURRENT_QUERIES must be >= 1, got: %d", concurrentQueries)
+	}
+
+	// The stair-step experiment overrides the concurrency stage by stage
+	if config.StairStep.Enabled {
+		if config.Query.Autoscale.Enabled {
+			fatalf("stairStep and query.autoscale both change the worker count, enable only one")
+		}
+		stairStep, err = newStairStepExperiment(config.StairStep)
+		if err != nil {
+			fatalf("Invalid stairStep configuration: %v", err)
+		}
+		concurrentQueries = stairStep.initialConcurrency()
+		log.Printf("Concurrency stair-step: %v workers per query, %s per stage", stairStep.levels, stairStep.stageDuration)
+		if config.Job.Duration == "" && !config.Job.UntilPlanComplete {
+			// A job ends with the last stage unless given its own duration
+			config.Job.Duration = stairStep.duration().String()
+		}
 	}
 	log.Printf("Concurrent queries per executor: %d", concurrentQueries)
 
-	// Validate and calculate QPS
+	workerStart, err := newWorkerStart(config.Query.WorkerStart)
+	if err != nil {
+		fatalf("Invalid query.workerStart: %v", err)
+	}
+	if workerStart.stagger > 0 {
+		log.Printf("Worker start: stagger %s, jitter up to %s", workerStart.stagger, workerStart.jitter)
+	}
+
+	// Validate and calculate QPS (default: 10)
 	targetQPS := config.Query.TargetQPS
+	if targetQPS == 0 {
+		targetQPS = defaultTargetQPS
+	}
 	if targetQPS <= 0 {
-		log.Fatalf("targetQPS must be > 0, got: %f", targetQPS)
+		fatalf("targetQPS must be > 0, got: %f", targetQPS)
 	}
 
 	// Apply QPS multiplier if configured (for compensation)
@@ -322,28 +672,134 @@ func main() {
 	log.Printf("Query result limit: %d", queryLimit)
 
 	// Convert time buckets
-	timeBuckets, err := convertTimeBuckets(config.TimeBuckets)
+	timeBuckets, err := convertTimeBuckets(config.TimeBuckets, zone)
 	if err != nil {
-		log.Fatalf("Failed to parse time buckets: %v", err)
+		fatalf("Failed to parse time buckets: %v", err)
 	}
 	log.Printf("Using time buckets: %+v", timeBuckets)
+	bucketSLOs, err = newBucketSLOTracker(config.TimeBuckets)
+	if err != nil {
+		fatalf("Invalid time bucket SLO: %v", err)
+	}
+
+	// Resolve the test start, which query schedules are relative to, and the data epoch used for
+	// bucket eligibility
+	now := time.Now()
+	testStart, err := resolveTestStart(config.StartTimeFile, now)
+	if err != nil {
+		fatalf("Failed to resolve test start time: %v", err)
+	}
+	dataEpoch, err := resolveDataEpoch(config.DataEpoch, testStart, now)
+	if err != nil {
+		fatalf("Failed to resolve data epoch: %v", err)
+	}
+	log.Printf("Data epoch for bucket eligibility: %s", dataEpoch.Format(time.RFC3339))
+	pauses, err = newPauseSchedule(config.Pauses, config.Queries, testStart)
+	if err != nil {
+		fatalf("Invalid pause window: %v", err)
+	}
+	phaseGrace, err = newPhaseGraceLimiter(config.PhaseGrace)
+	if err != nil {
+		fatalf("Invalid phase grace: %v", err)
+	}
+	planFailures, err = newPlanFailurePolicy(config.PlanFailures)
+	if err != nil {
+		fatalf("Invalid planFailures: %v", err)
+	}
+
+	// Keep only the queries of the selected suites
+	var suites []string
+	config.Queries, config.ExecutionPlan, suites, err = selectSuites(config.Suites, selectedSuites(), config.Queries, config.ExecutionPlan)
+	if err != nil {
+		fatalf("Invalid suite selection: %v", err)
+	}
+	if len(suites) > 0 {
+		log.Printf("Running query suites: %s", strings.Join(suites, ", "))
+	}
+
+	// Expand duration sweeps into one query variant per threshold
+	config.Queries, config.ExecutionPlan, err = expandDurationSweeps(config.Queries, config.ExecutionPlan)
+	if err != nil {
+		fatalf("Invalid query configuration: %v", err)
+	}
 
 	// Validate queries
 	if len(config.Queries) == 0 {
-		log.Fatalf("No queries defined in configuration")
+		fatalf("No queries defined in configuration")
+	}
+	for _, q := range config.Queries {
+		if err := q.validate(); err != nil {
+			fatalf("Invalid query configuration: %v", err)
+		}
+		if q.isZipkin() && config.Tempo.ZipkinEndpoint == "" {
+			fatalf("Query %s: %s queries need tempo.zipkinEndpoint", q.Name, q.kind())
+		}
+	}
+	attributeProblems := checkAttributes(config.Queries, config.Attributes)
+	for _, p := range attributeProblems {
+		log.Printf("Warning: %v", p)
+	}
+	if len(attributeProblems) > 0 && config.StrictAttributes {
+		fatalf("%d query attribute(s) missing from the attribute catalog (strictAttributes)", len(attributeProblems))
 	}
 	log.Printf("Loaded %d queries from configuration", len(config.Queries))
 
+	queryTimeout := defaultQueryTimeout
+	if config.Query.Timeout != "" {
+		queryTimeout, err = time.ParseDuration(config.Query.Timeout)
+		if err != nil || queryTimeout <= 0 {
+			fatalf("Invalid query.timeout %q", config.Query.Timeout)
+		}
+	}
+
+	// Long-range queries get their own timeout, QPS cap, histogram and circuit breakers
+	var expensive *expensiveClass
+	for _, q := range config.Queries {
+		if q.Class != queryClassExpensive {
+			continue
+		}
+		if expensive == nil {
+			expensive, err = newExpensiveClass(config.Query.Expensive)
+			if err != nil {
+				fatalf("Invalid query.expensive: %v", err)
+			}
+			log.Printf("Expensive queries: timeout %s, QPS cap %.4f, circuit breaker after %d failures for %s",
+				expensive.timeout, expensive.maxQPS, expensive.threshold, expensive.openFor)
+		}
+		log.Printf("  %s is expensive", q.Name)
+	}
+
 	// Calculate per-query QPS: total QPS divided by number of query types
 	perQueryQPS := targetQPS / float64(len(config.Queries))
 	log.Printf("Per-query QPS: %.4f (distributed across %d concurrent workers)", perQueryQPS, concurrentQueries)
 
-	// Validate execution plan from config
+	// Without an execution plan, every query cycles round-robin over every bucket
 	if len(config.ExecutionPlan) == 0 {
-		log.Fatalf("No executionPlan defined in configuration. Please define an execution plan in config.yaml")
+		config.ExecutionPlan = defaultExecutionPlan(config.Queries, config.TimeBuckets)
+		log.Printf("No executionPlan defined, using %d entries covering every query and bucket", len(config.ExecutionPlan))
+	} else {
+		log.Printf("Loaded execution plan with %d entries from config", len(config.ExecutionPlan))
 	}
 
-	log.Printf("Loaded execution plan with %d entries from config", len(config.ExecutionPlan))
+	// Shard the plan across generator replicas; each replica runs the share of every query's QPS
+	// matching its share of the query's plan entries
+	shard, err := detectPlanShard(identity.Pod)
+	if err != nil {
+		fatalf("Invalid replica sharding: %v", err)
+	}
+	fleetPlan := config.ExecutionPlan
+	if shard.count > 1 {
+		config.ExecutionPlan = shard.filter(config.ExecutionPlan)
+		if len(config.ExecutionPlan) == 0 {
+			log.Printf("Replica %d of %d has no execution plan entries (the plan has %d), idling and serving metrics",
+				shard.index, shard.count, len(fleetPlan))
+		} else {
+			log.Printf("Replica %d of %d: executing %d of %d plan entries",
+				shard.index, shard.count, len(config.ExecutionPlan), len(fleetPlan))
+		}
+	}
+	// Reports compare queries with the replica's average share of the per-query QPS
+	reportQPS := perQueryQPS / float64(shard.count)
 
 	// Validate plan: count entries per query and check for undefined queries
 	queryDist := make(map[string]int)
@@ -352,58 +808,637 @@ func main() {
 		queryMap[q.Name] = true
 	}
 
+	bucketMap := map[string]bool{"immediate": true}
+	for _, b := range timeBuckets {
+		bucketMap[b.name] = true
+	}
+
+	unknownBuckets := make(map[string]int)
 	for _, entry := range config.ExecutionPlan {
 		if !queryMap[entry.QueryName] {
-			log.Fatalf("Execution plan references undefined query: %s", entry.QueryName)
+			fatalf("Execution plan references undefined query: %s", entry.QueryName)
+		}
+		if !bucketMap[entry.BucketName] {
+			unknownBuckets[entry.BucketName]++
 		}
 		queryDist[entry.QueryName]++
 	}
 
+	for bucketName, count := range unknownBuckets {
+		if config.StrictPlan {
+			fatalf("Execution plan references undefined bucket: %s (%d entries)", bucketName, count)
+		}
+		log.Printf("Warning: Execution plan references undefined bucket '%s' in %d entries, they will use immediate", bucketName, count)
+	}
+
 	log.Printf("Plan distribution across queries:")
 	for queryName, count := range queryDist {
 		log.Printf("  %s: %d entries (will cycle/repeat as needed)", queryName, count)
 	}
 
+	// Request budgets of the queries this replica runs
+	var running []QueryConfig
+	for _, q := range config.Queries {
+		if shard.count <= 1 || queryDist[q.Name] > 0 {
+			running = append(running, q)
+		}
+	}
+	budget, err = newQueryBudget(config.Query.MaxTotalQueries, running, shard, fleetPlan)
+	if err != nil {
+		fatalf("Invalid maxTotalQueries: %v", err)
+	}
+	if budget != nil && budget.limited {
+		if shard.count > 1 {
+			log.Printf("Query budget: %d of %d requests on this replica, workers stop once it is used", budget.max, config.Query.MaxTotalQueries)
+		} else {
+			log.Printf("Query budget: %d requests in total, workers stop once it is used", budget.max)
+		}
+	}
+
+	switch *runMode {
+	case "service":
+	case "job":
+		planned := make([]string, 0, len(queryDist))
+		for queryName := range queryDist {
+			planned = append(planned, queryName)
+		}
+		job, err = newJobController(config.Job, planned, len(fleetPlan) > 0, config.budgetBounded())
+		if err != nil {
+			fatalf("Invalid job configuration: %v", err)
+		}
+		if len(config.ExecutionPlan) == 0 {
+			job.idleRun(fmt.Sprintf("replica %d of %d has no plan entries", shard.index, shard.count))
+		}
+		log.Printf("Job mode (duration: %s, until plan complete: %v)", config.Job.Duration, config.Job.UntilPlanComplete)
+	default:
+		fatalf("Unknown --mode %q (expected service or job)", *runMode)
+	}
+	if len(config.ExecutionPlan) > 0 {
+		budget.start()
+	}
+
+	// What logs, samples and failure captures may show of requests and responses
+	redaction, err = newRedactor(config.Redaction, config.Auth.apiKeyHeaders()...)
+	if err != nil {
+		fatalf("Invalid redaction configuration: %v", err)
+	}
+
+	// Tenants to rotate requests across
+	tenants := config.Tenants
+	if len(tenants) == 0 {
+		tenants = []string{config.TenantID}
+	}
+	shownTenants := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		shownTenants[i] = redaction.tenant(tenant)
+	}
+	log.Printf("Querying tenants: %v", shownTenants)
+	if config.VerifyTenants {
+		if len(tenants) < 2 {
+			log.Printf("Warning: verifyTenantIsolation needs at least two tenants to detect violations")
+		}
+		tenantIsolation = newIsolationChecker()
+	}
+
+	if err := validateTarget(config.Tempo.Target); err != nil {
+		fatalf("Invalid tempo.target: %v", err)
+	}
+	target := normalizeTarget(config.Tempo.Target)
+	rateLimitBackoff := config.Tempo.RateLimitBackoff || target == targetGrafanaCloud
+	var maxRetryAfter time.Duration
+	if config.Tempo.MaxRetryAfter != "" {
+		maxRetryAfter, err = time.ParseDuration(config.Tempo.MaxRetryAfter)
+		if err != nil || maxRetryAfter <= 0 {
+			fatalf("Invalid tempo.maxRetryAfter %q", config.Tempo.MaxRetryAfter)
+		}
+	}
+	if target == targetGrafanaCloud && config.Auth.Type == "" {
+		// Grafana Cloud authenticates with the stack's instance ID and an API key
+		config.Auth.Type = authBasic
+	}
+	if target == targetGrafana {
+		// Requests go through Grafana's proxy of the Tempo data source, including its overhead
+		config.Tempo.QueryEndpoint, err = grafanaProxyEndpoint(config.Tempo.QueryEndpoint, config.Tempo.GrafanaDatasource)
+		if err != nil {
+			fatalf("Invalid tempo.grafanaDatasource: %v", err)
+		}
+		if config.Auth.Type == "" {
+			// Grafana authenticates with an API key or service account token as a bearer token
+			config.Auth.Type = authAPIKey
+		}
+		log.Printf("Querying through the Grafana data source proxy %s", config.Tempo.QueryEndpoint)
+	}
+	log.Printf("Query target: %s (429s pause queries for their Retry-After; backoff without it: %v)", target, rateLimitBackoff)
+	if maxRetryAfter > 0 {
+		log.Printf("Retry-After pauses are capped at %s", maxRetryAfter)
+	}
+	if err := validateTimeFormat(config.Tempo.TimeFormat); err != nil {
+		fatalf("Invalid tempo.timeFormat: %v", err)
+	}
+
+	// Let dashboards annotate results with what this run was configured with
+	configMetrics.publish(runPhase(), *runMode, target, targetQPS, concurrentQueries, len(timeBuckets), len(tenants), len(config.Queries))
+
+	// Credentials of query requests, refreshed ahead of expiry
+	auth, err = newAuthenticator(config.Auth)
+	if err != nil {
+		fatalf("Invalid auth configuration: %v", err)
+	}
+	if auth != nil {
+		log.Printf("Authenticating requests (auth type: %s, tenants with own credentials: %d)", normalizeAuthType(config.Auth.Type), len(config.Auth.Tenants))
+	}
+
+	// Global in-flight request cap shared by all executors
+	inFlight = newInFlightLimiter(config.Query.MaxInFlight)
+	if config.Query.MaxInFlight > 0 {
+		log.Printf("Global in-flight request cap: %d", config.Query.MaxInFlight)
+	}
+
+	if config.Query.CacheAnalysis.RepeatFraction > 0 {
+		log.Printf("Cache analysis enabled: repeating %.0f%% of queries issued within %s",
+			config.Query.CacheAnalysis.RepeatFraction*100, config.Query.CacheAnalysis.RepeatWithin)
+	}
+
+	if config.Query.ResultAnomaly.Enabled {
+		resultAnomalies = newResultAnomalyDetector(config.Query.ResultAnomaly)
+		log.Printf("Result-count anomaly detection enabled (alpha: %.2f, factor: %.1f)",
+			resultAnomalies.detector.alpha, resultAnomalies.detector.factor)
+	}
+
+	if config.Query.LatencyAnomaly.Enabled {
+		latencyAnomalies = newLatencyAnomalyDetector(config.Query.LatencyAnomaly)
+		log.Printf("Latency anomaly detection enabled (alpha: %.2f, factor: %.1f)",
+			latencyAnomalies.detector.alpha, latencyAnomalies.detector.factor)
+	}
+
+	if config.Query.BurnRate.Enabled {
+		burnRates, err = newBurnRateTracker(config.Query.BurnRate, newNotifier(config.Notifier))
+		if err != nil {
+			fatalf("Invalid burnRate configuration: %v", err)
+		}
+		go burnRates.run(10 * time.Second)
+		log.Printf("SLO burn rates enabled (availability: %.3f, latency: %.3f < %s, windows: %v)",
+			burnRates.availability, burnRates.latencyTarget, burnRates.latencyThreshold, burnRates.windowNames)
+	}
+
+	if config.Query.Apdex.Enabled {
+		apdex, err = newApdexTracker(config.Query.Apdex)
+		if err != nil {
+			fatalf("Invalid apdex configuration: %v", err)
+		}
+		go apdex.run(10 * time.Second)
+		log.Printf("Apdex scores enabled (standard: T=%s, expensive: T=%s, windows: %v)",
+			apdex.classes[queryClassStandard].satisfied, apdex.classes[queryClassExpensive].satisfied, apdex.windowNames)
+	}
+
+	if config.Query.DeadlineHint.Enabled {
+		deadlineHints, err = newDeadlineHinter(config.Query.DeadlineHint)
+		if err != nil {
+			fatalf("Invalid query.deadlineHint: %v", err)
+		}
+		log.Printf("Deadline hints enabled (header: %s, format: %s, ratio: %g)", deadlineHints.header, deadlineHints.format, deadlineHints.ratio)
+	}
+	headerProfiles, err = newHeaderProfiler(config.HeaderProfiles, config.Queries)
+	if err != nil {
+		fatalf("Invalid headerProfiles: %v", err)
+	}
+	if headerProfiles != nil {
+		log.Printf("Header profiles enabled for %d queries", len(headerProfiles.queries))
+	}
+	clientIdentities, err = newClientRotator(config.ClientIdentities, config.Queries)
+	if err != nil {
+		fatalf("Invalid client identities: %v", err)
+	}
+	if clientIdentities != nil {
+		log.Printf("Client identities set for %d queries", len(clientIdentities.queries))
+	}
+
+	if config.SlowLog.Enabled {
+		slowQueries, err = newSlowQueryLog(config.SlowLog)
+		if err != nil {
+			fatalf("Invalid slowLog configuration: %v", err)
+		}
+		destination := config.SlowLog.Path
+		if destination == "" {
+			destination = "the log"
+		}
+		log.Printf("Slow-query log enabled (standard: %s, expensive: %s) writing to %s",
+			slowQueries.thresholds[queryClassStandard], slowQueries.thresholds[queryClassExpensive], destination)
+	}
+
+	var extraSinks []sampleSink
+	if stairStep != nil {
+		extraSinks = append(extraSinks, stairStep)
+	}
+	if config.Report.enabled() || *tuiMode || job != nil {
+		// The dashboard needs a fine resolution for its recent window
+		resolution := 10 * time.Second
+		if *tuiMode {
+			resolution = time.Second
+		}
+		if config.Report.Resolution != "" {
+			resolution, err = time.ParseDuration(config.Report.Resolution)
+			if err != nil || resolution <= 0 {
+				fatalf("Invalid report.resolution: %q", config.Report.Resolution)
+			}
+		}
+		stats = newRunStats(time.Now(), resolution)
+		extraSinks = append(extraSinks, stats)
+		loadSamples = newLoadSampler()
+		if config.Report.HTML != "" {
+			log.Printf("HTML report will be written to %s at the end of the run", config.Report.HTML)
+		}
+		if config.Report.Markdown != "" {
+			log.Printf("Markdown summary will be written to %s at the end of the run", config.Report.Markdown)
+		}
+	}
+
+	if len(config.Samples) > 0 || len(extraSinks) > 0 {
+		samples, err = newSampleRecorder(config.Samples, extraSinks...)
+		if err != nil {
+			fatalf("Invalid samples configuration: %v", err)
+		}
+		if len(config.Samples) > 0 {
+			log.Printf("Recording per-request samples to %d output(s)", len(config.Samples))
+		}
+	}
+
+	if config.Server.Control {
+		controls = newControlAPI()
+	}
+	if config.Server.DebugSamples.PerQuery > 0 {
+		debugSamples, err = newResponseSamples(config.Server.DebugSamples, config.Server)
+		if err != nil {
+			fatalf("Invalid server.debugSamples: %v", err)
+		}
+	}
+
+	servePrometheus, err := startMetricsSinks(config.MetricsSinks)
+	if err != nil {
+		fatalf("Invalid metricsSinks configuration: %v", err)
+	}
+
+	tracer, err = newRequestTracer(config.Tracing)
+	if err != nil {
+		fatalf("Invalid tracing configuration: %v", err)
+	}
+	if tracer != nil {
+		log.Printf("Propagating trace context on requests (sample ratio: %.2f), latency exemplars enabled", tracer.sampleRatio)
+	}
+
+	goldenInterval := time.Minute
+	if config.Query.GoldenInterval != "" {
+		goldenInterval, err = time.ParseDuration(config.Query.GoldenInterval)
+		if err != nil {
+			fatalf("Invalid goldenInterval: %v", err)
+		}
+	}
+
+	queryEndpoint, socketPath := splitUnixEndpoint(config.Tempo.QueryEndpoint)
+	transport, err := newTransport(config.Tempo.Protocol, socketPath)
+	if err != nil {
+		fatalf("Invalid tempo.protocol: %v", err)
+	}
+	log.Printf("HTTP protocol: %s", normalizeProtocol(config.Tempo.Protocol))
+	if socketPath != "" {
+		log.Printf("Sending requests over unix socket %s", socketPath)
+	}
+	if err := validateSpanCounting(config.Query.SpanCounting); err != nil {
+		fatalf("Invalid query.spanCounting: %v", err)
+	}
+	if config.Query.HighThroughput {
+		tuneTransportForThroughput(transport)
+		log.Printf("High-throughput mode: %d idle connections per host, no per-request success logs", highThroughputIdleConns)
+	}
+	// Connection reuse metrics: open connections are counted at dial time, below the network
+	// impairments, and how requests got their connection on top of them
+	connections := newConnTracker()
+	connections.instrumentDial(transport)
+	transport, err = wrapNetworkTransport(transport, config.Network)
+	if err != nil {
+		fatalf("Invalid network configuration: %v", err)
+	}
+	transport = connections.wrap(transport)
+	transport = phaseGrace.wrap(transport)
+	if config.Network.RequestDelay != "" || config.Network.ResponseDelay != "" {
+		log.Printf("Injecting client-side latency (request: %s, response: %s, jitter: %s)",
+			config.Network.RequestDelay, config.Network.ResponseDelay, config.Network.Jitter)
+	}
+	if config.Network.EgressBytesPerSecond > 0 || config.Network.IngressBytesPerSecond > 0 {
+		log.Printf("Throttling bandwidth per connection (egress: %d B/s, ingress: %d B/s, 0 = unlimited)",
+			config.Network.EgressBytesPerSecond, config.Network.IngressBytesPerSecond)
+	}
+
+	if config.Freshness.Enabled {
+		freshness, err = newFreshnessProbe(config.Freshness, transport, target, queryEndpoint, tenants[0], config.Tempo.TimeFormat)
+		if err != nil {
+			fatalf("Invalid freshness configuration: %v", err)
+		}
+		go freshness.run(job.context())
+		log.Printf("Freshness probe enabled (every %s, last %s): %s", freshness.interval, freshness.lookback, freshness.traceql)
+	}
+	if config.Audit.Enabled {
+		audits, err = newCompletenessAuditor(config.Audit, transport, target, queryEndpoint, tenants[0], config.Tempo.TimeFormat)
+		if err != nil {
+			fatalf("Invalid audit configuration: %v", err)
+		}
+		go audits.run(job.context())
+		log.Printf("Completeness audits enabled at ages %v (a new trace every %s)", audits.ageLabels, audits.interval)
+	}
+
+	if pauses != nil {
+		go pauses.run(job.context())
+		log.Printf("Pause windows scheduled: %d", len(pauses.windows))
+	}
+
+	if latencyBuckets != nil {
+		go latencyBuckets.run(job.context())
+		log.Printf("Recommending latency buckets every %s", latencyBuckets.interval)
+	}
+
+	costs, err = newCostAttribution(config.Cost)
+	if err != nil {
+		fatalf("Invalid cost configuration: %v", err)
+	}
+	if costs != nil {
+		go costs.run(job.context())
+		log.Printf("Attributing Tempo CPU (%s) of %d endpoints to queries every %s", costs.metric, len(costs.urls), costs.interval)
+	}
+
+	if config.BucketProbe.Enabled && len(timeBuckets) > 0 {
+		bucketProbes, err = newBucketProber(config.BucketProbe, timeBuckets, transport, queryTimeout, target, queryEndpoint, tenants[0], config.Tempo.TimeFormat)
+		if err != nil {
+			fatalf("Invalid bucketProbe configuration: %v", err)
+		}
+		log.Printf("Probing %d time buckets for data (%s, again every %s while empty)", len(timeBuckets), bucketProbes.traceql, bucketProbes.interval)
+		bucketProbes.probeAll()
+		go bucketProbes.run(job.context())
+	}
+
+	if config.Query.Calibration.Enabled {
+		var calibrated []QueryConfig
+		for _, q := range config.Queries {
+			if shard.count <= 1 || queryDist[q.Name] > 0 {
+				calibrated = append(calibrated, q)
+			}
+		}
+		log.Printf("Calibrating %d queries before the load", len(calibrated))
+		clients := map[bool]*probeClient{}
+		calibration = calibrate(calibrated, timeBuckets, dataEpoch, queryLimit, func(q QueryConfig) *probeClient {
+			isExpensive := q.Class == queryClassExpensive
+			if clients[isExpensive] == nil {
+				timeout := queryTimeout
+				if isExpensive {
+					timeout = expensive.timeout
+				}
+				clients[isExpensive] = newProbeClient(transport, timeout, target, queryEndpoint, tenants[0], config.Tempo.TimeFormat)
+			}
+			return clients[isExpensive]
+		})
+		seedAnomalyDetectors(calibration)
+	}
+
 	// Create and start query executors
 	for _, q := range config.Queries {
+		if shard.count > 1 && queryDist[q.Name] == 0 {
+			log.Printf("Query %s has no plan entries on this replica, not starting it", q.Name)
+			continue
+		}
+		repeats, err := newRepeatCache(config.Query.CacheAnalysis)
+		if err != nil {
+			fatalf("Invalid cacheAnalysis.repeatWithin: %v", err)
+		}
+
+		var golden *goldenChecker
+		if q.Golden != "" {
+			golden, err = loadGoldenChecker(q.Golden, goldenInterval)
+			if err != nil {
+				fatalf("Query %s: %v", q.Name, err)
+			}
+			log.Printf("Query %s: comparing responses against golden file %s every %s", q.Name, q.Golden, goldenInterval)
+		}
+		schedule, err := newQuerySchedule(q, testStart)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if schedule.scheduled() && stairStep != nil {
+			fatalf("Query %s: startAfter/stopAfter and stairStep both change the running workers, use only one", q.Name)
+		}
+		timeout, qps := queryTimeout, perQueryQPS
+		var breaker *circuitBreaker
+		var classLatency *prometheus.HistogramVec
+		if q.Class == queryClassExpensive {
+			timeout = expensive.timeout
+			if qps > expensive.maxQPS {
+				qps = expensive.maxQPS
+			}
+			breaker = expensive.newBreaker(q.Name)
+			classLatency = expensive.latency
+		}
+		if shard.count > 1 {
+			share := shard.share(fleetPlan, q.Name)
+			qps *= share
+			log.Printf("Query %s: %.0f%% of its plan entries run on this replica, QPS: %.4f", q.Name, share*100, qps)
+		}
 		qs := queryExecutor{
 			name:            q.Name,
 			namespace:       config.Namespace,
-			queryEndpoint:   config.Tempo.QueryEndpoint,
-			traceQL:         q.TraceQL,
+			queryEndpoint:   queryEndpoint,
+			zipkinEndpoint:  config.Tempo.ZipkinEndpoint,
+			target:          target,
+			backoffOn429:    rateLimitBackoff,
+			maxRetryAfter:   maxRetryAfter,
+			timeFormat:      config.Tempo.TimeFormat,
+			query:           q,
 			delay:           queryDelay,
 			timeBuckets:     timeBuckets,
 			concurrency:     concurrentQueries,
-			tenantID:        config.TenantID,
-			targetQPS:       perQueryQPS,
+			tenants:         newTenantRotation(tenants),
+			targetQPS:       qps,
+			timeout:         timeout,
+			breaker:         breaker,
+			classLatency:    classLatency,
 			burstMultiplier: burstMultiplier,
 			limit:           queryLimit,
 			executionPlan:   config.ExecutionPlan,
+			dataEpoch:       dataEpoch,
+			schedule:        schedule,
+			repeats:         repeats,
+			golden:          golden,
+			transport:       transport,
+			autoscale:       config.Query.Autoscale,
+			workerStart:     workerStart,
+			highThroughput:  config.Query.HighThroughput,
+			scanSpans:       config.Query.SpanCounting == spanCountingScan,
 		}
 		if err := qs.run(); err != nil {
-			log.Fatalf("Could not run query executor: %v", err)
+			fatalf("Could not run query executor: %v", err)
+		}
+	}
+
+	if stairStep != nil {
+		go stairStep.run(job.context())
+	}
+	if loadSamples != nil {
+		go loadSamples.run(job.context())
+	}
+
+	if *tuiMode {
+		dashboard = newTUIDashboard(stats, config.Namespace, reportQPS)
+		go dashboard.run(time.Second)
+	}
+
+	go handleShutdown(config, reportQPS, zone)
+
+	if config.QueriesURL != "" && config.QueriesCatalog.Refresh != "" {
+		if job != nil {
+			log.Printf("queriesCatalog.refresh is ignored in job mode, the catalog fetched at startup is used")
+		} else {
+			// The generator restarts to apply a changed catalog, like after a config change
+			watcher, err := newCatalogWatcher(config.QueriesURL, config.QueriesCatalog, func() {
+				finishRun(config, reportQPS, zone)
+				os.Exit(0)
+			})
+			if err != nil {
+				fatalf("Invalid queriesCatalog: %v", err)
+			}
+			go watcher.run()
 		}
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	http.ListenAndServe(":2112", nil)
+	if servePrometheus {
+		// Exemplars are only exposed in the OpenMetrics format
+		http.Handle(config.Server.metricsPath(), promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: tracer != nil})))
+	}
+	if controls != nil {
+		http.Handle(controlPrefix, controls)
+		http.Handle(controlPrefix+"/", controls)
+		log.Printf("Control API enabled at %s", controlPrefix)
+	}
+	if debugSamples != nil {
+		http.Handle(debugSamplesPrefix, debugSamples)
+		http.Handle(debugSamplesPrefix+"/", debugSamples)
+		log.Printf("Last %d responses per query served at %s", debugSamples.perQuery, debugSamplesPrefix)
+	}
+	if servePrometheus || controls != nil || debugSamples != nil {
+		if err := startServer(job.context(), config.Server, http.DefaultServeMux); err != nil {
+			fatalf("Could not start metrics server: %v", err)
+		}
+	}
+	if job == nil {
+		select {}
+	}
+
+	job.wait()
+	finishRun(config, reportQPS, zone)
+	os.Exit(job.evaluate(stats))
+}
+
+// handleShutdown flushes buffered outputs, writes the reports and exits on SIGINT/SIGTERM
+func handleShutdown(config *Config, targetQPS float64, zone *time.Location) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigCh
+	if job != nil {
+		// The main goroutine drains the workers, writes the reports and exits
+		job.stop(fmt.Sprintf("received %s", sig))
+		return
+	}
+	log.Printf("Received %s, shutting down", sig)
+	finishRun(config, targetQPS, zone)
+	os.Exit(0)
+}
+
+// finishRun flushes buffered outputs and writes the end-of-run reports, with times in zone
+func finishRun(config *Config, targetQPS float64, zone *time.Location) {
+	samples.close()
+	slowQueries.close()
+	dashboard.stop()
+	if err := latencyBuckets.writeFile(); err != nil {
+		log.Printf("Warning: Failed to write latency bucket recommendations: %v", err)
+	}
+
+	if stats == nil || !config.Report.enabled() {
+		return
+	}
+	report := newRunReport(stats, config.Namespace, targetQPS)
+
+	if config.Report.HTML != "" {
+		if err := writeHTMLReport(config.Report.HTML, report, zone); err != nil {
+			log.Printf("Warning: Failed to write HTML report: %v", err)
+		} else {
+			log.Printf("HTML report written to %s", config.Report.HTML)
+		}
+	}
+
+	summary := newRunSummary(report)
+	summary.Cluster = config.Report.cluster()
+	if config.Report.JSON != "" {
+		if err := writeSummaryJSON(config.Report.JSON, summary); err != nil {
+			log.Printf("Warning: Failed to write JSON summary: %v", err)
+		} else {
+			log.Printf("JSON summary written to %s", config.Report.JSON)
+		}
+	}
+	if config.Report.Markdown != "" {
+		var baseline *runSummary
+		if config.Report.Baseline != "" {
+			var err error
+			baseline, err = loadSummaryJSON(config.Report.Baseline)
+			if err != nil {
+				log.Printf("Warning: Failed to load baseline, verdicts are skipped: %v", err)
+			}
+		}
+		if err := writeMarkdownSummary(config.Report.Markdown, summary, baseline, config.Report.Tolerance, zone); err != nil {
+			log.Printf("Warning: Failed to write Markdown summary: %v", err)
+		} else {
+			log.Printf("Markdown summary written to %s", config.Report.Markdown)
+		}
+	}
 }
 
 type queryExecutor struct {
 	name            string
 	namespace       string
 	queryEndpoint   string
-	traceQL         string
+	zipkinEndpoint  string        // Base URL of the Zipkin read API of zipkin-* queries
+	target          string        // Search URL layout (gateway or grafanaCloud)
+	backoffOn429    bool          // Also pause after 429 responses without Retry-After
+	maxRetryAfter   time.Duration // Cap of Retry-After pauses, 0 = none
+	timeFormat      string        // Format of the start/end parameters
+	query           QueryConfig
 	delay           time.Duration
 	timeBuckets     []timeBucket
 	concurrency     int
-	tenantID        string
+	tenants         *tenantRotation
 	targetQPS       float64
+	timeout         time.Duration            // Request timeout of the query's class
+	breaker         *circuitBreaker          // Skips requests while the query keeps failing (nil for standard queries)
+	classLatency    *prometheus.HistogramVec // Latency histogram of the query's class (nil for standard queries)
 	burstMultiplier float64
 	limit           int
-	executionPlan   []PlanEntry // Execution plan from config
+	executionPlan   []PlanEntry       // Execution plan from config
+	dataEpoch       time.Time         // Moment from which data is assumed to exist
+	schedule        querySchedule     // When the query's workers start and stop
+	repeats         *repeatCache      // Recently issued windows for cache-hit analysis (nil when disabled)
+	golden          *goldenChecker    // Golden response checks (nil when disabled)
+	transport       http.RoundTripper // Shared HTTP transport
+	autoscale       AutoscaleConfig   // Worker pool autoscaling
+	workerStart     workerStart       // Delay of each worker's first request
+	highThroughput  bool              // Skip per-request success logs
+	scanSpans       bool              // Count spans by scanning responses instead of decoding them
 }
 
+// tenantIsolation verifies cross-tenant result isolation (nil when disabled)
+var tenantIsolation *isolationChecker
+
+// burnRates computes rolling SLO burn rates per query (nil when disabled)
+var burnRates *burnRateTracker
+
+// inFlight limits and tracks outstanding requests across all executors
+var inFlight *inFlightLimiter
+
 // planIndices stores atomic counters for each query name to cycle through plan entries
 var planIndices = make(map[string]*int64)
 var planIndicesMutex sync.Mutex
@@ -422,229 +1457,518 @@ func getPlanIndex(queryName string) *int64 {
 	return idx
 }
 
-func (queryExecutor queryExecutor) run() error {
-	tokenPath := "/var/run/secrets/kubernetes.io/serviceaccount/token"
+// queryWindow is the bucket and time range a single query is issued for
+type queryWindow struct {
+	bucketName string
+	bucket     *timeBucket // nil for immediate queries without a time range
+	start      time.Time
+	end        time.Time
+	done       bool        // the plan is exhausted and the job runs until plan completion
+	attempt    planAttempt // the plan entry the window was resolved for
+}
 
-	token, err := os.ReadFile(tokenPath)
-	if err != nil {
-		log.Printf("Warning: Failed to read token: %v", err)
+// nextWindow picks the next plan entry of a lane of this query and resolves its time range;
+// retry is the failed entry the worker sends again (retry policy of planFailures)
+func (queryExecutor queryExecutor) nextWindow(id int, lane *planLane, retry *planAttempt) queryWindow {
+	queryName := queryExecutor.name
+	bucketName := "immediate"
+	var startTime, endTime time.Time
+	var bucket *timeBucket
+	var attempt planAttempt
+
+	// Plan entries of this query served by the lane
+	matchingEntries := lane.entries
+
+	if len(matchingEntries) > 0 {
+		// Get or create index counter for this lane
+		planIdx := getPlanIndex(lane.key)
+		if retry != nil {
+			attempt = *retry
+		} else if requeued, ok := lane.requeued(atomic.LoadInt64(planIdx)); ok {
+			// Entries requeued after failing run before the next cycle starts
+			attempt = requeued
+		} else {
+			idx := atomic.AddInt64(planIdx, 1) - 1
+			if lane.exhausted(queryName, idx) {
+				return queryWindow{done: true}
+			}
+			entryIdx := int(idx) % len(matchingEntries) // Cycle through matching entries - repeats when exhausted
+			attempt = planFailures.take(lane, matchingEntries[entryIdx])
+			planExecutedGauge.WithLabelValues(queryName).Inc()
+			if lane.countsCycles && (idx+1)%int64(len(matchingEntries)) == 0 {
+				planCyclesGauge.WithLabelValues(queryName).Inc()
+			}
+
+			// Log when we've cycled through all entries once
+			if idx > 0 && idx%int64(len(matchingEntries)) == 0 {
+				log.Printf("[worker-%d] Query '%s': Cycled through all %d plan entries, repeating from start (cycle: %d)",
+					id, queryExecutor.name, len(matchingEntries), idx/int64(len(matchingEntries)))
+			}
+		}
+		entry := attempt.entry
+
+		bucketName = entry.BucketName
+		if bucketName != "immediate" {
+			// Find the bucket by name
+			for i := range queryExecutor.timeBuckets {
+				if queryExecutor.timeBuckets[i].name == bucketName {
+					bucket = &queryExecutor.timeBuckets[i]
+					break
+				}
+			}
+
+			if bucket != nil {
+				// Check if bucket is eligible based on elapsed time (or its last probe)
+				now := time.Now()
+				if bucket.eligible(now, now.Sub(queryExecutor.dataEpoch)) {
+					// Use the bucket boundaries, a random sub-window if the bucket defines window lengths,
+					// or the worker's next window when it slides
+					startTime, endTime = bucket.windowFor(lane.key, id, now)
+				} else {
+					// Bucket not eligible yet, use immediate
+					bucketFallbackCounter.WithLabelValues(bucketName, queryName, "not_eligible").Inc()
+					bucket = nil
+					bucketName = "immediate"
+				}
+			} else {
+				// Bucket not found, use immediate
+				log.Printf("[worker-%d] Warning: Bucket '%s' not found in timeBuckets config, using immediate", id, bucketName)
+				bucketFallbackCounter.WithLabelValues(bucketName, queryName, "not_found").Inc()
+				bucketName = "immediate"
+			}
+		}
 	} else {
-		log.Printf("ServiceAccount Token loaded")
+		// No matching entries in plan for this query - this shouldn't happen if config is valid
+		log.Printf("[worker-%d] Warning: No plan entries for query '%s', using immediate bucket", id, queryExecutor.name)
 	}
 
-	// Create custom transport with TLS config that allows self-signed certificates
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
+	return queryWindow{bucketName: bucketName, bucket: bucket, start: startTime, end: endTime, attempt: attempt}
+}
 
+func (queryExecutor queryExecutor) run() error {
+	var err error
 	client := http.Client{
-		Transport: transport,
-		Timeout:   time.Minute * 15,
+		Transport: queryExecutor.transport,
+		Timeout:   queryExecutor.timeout,
 	}
 
 	// Use global metrics with this executor's query name as label
 	queryName := queryExecutor.name
 
-	log.Printf("Starting query executor for: %s (concurrency: %d, target QPS: %.4f)\n", queryExecutor.name, queryExecutor.concurrency, queryExecutor.targetQPS)
+	// Plan length, against which plan_entries_executed shows progress
+	entries := 0
+	for _, entry := range queryExecutor.executionPlan {
+		if entry.QueryName == queryName {
+			entries++
+		}
+	}
+	if entries > 0 {
+		planEntriesGauge.WithLabelValues(queryName).Set(float64(entries))
+	}
 
-	// Track when this executor started for time-aware bucket selection
-	testStartTime := time.Now()
+	// Tempo searches are built from a template: only the time range is encoded per request
+	var reqTemplate *requestTemplate
+	if !queryExecutor.query.isZipkin() {
+		reqTemplate, err = newRequestTemplate(queryExecutor.target, queryExecutor.queryEndpoint, queryExecutor.tenants.tenants, queryExecutor.query, queryExecutor.limit, queryExecutor.timeFormat)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Create a shared rate limiter for all workers of this query type
-	// The limiter ensures total QPS for this query type equals targetQPS
-	// Calculate burst size: allow 1-2 seconds of burst capacity for better rate accuracy
-	burstSize := int(math.Max(10, queryExecutor.targetQPS*queryExecutor.burstMultiplier))
-	limiter := rate.NewLimiter(rate.Limit(queryExecutor.targetQPS), burstSize)
-	log.Printf("Rate limiter for %s: QPS=%.4f, burst=%d (multiplier=%.2f)", queryExecutor.name, queryExecutor.targetQPS, burstSize, queryExecutor.burstMultiplier)
-	ctx := context.Background()
+	log.Printf("Starting query executor for: %s [%s] %s (concurrency: %d, target QPS: %.4f)\n", queryExecutor.name, queryExecutor.query.kind(), queryExecutor.query.describe(), queryExecutor.concurrency, queryExecutor.targetQPS)
 
-	// Launch N independent workers for concurrent execution
-	for i := 0; i < queryExecutor.concurrency; i++ {
-		workerID := i + 1
-		// Each worker starts with a small random initial delay to spread the load
-		initialDelay := time.Duration(rand.Int63n(int64(time.Second)))
+	// Buckets with dedicated workers get their own pool and share of the target QPS
+	lanes := newPlanLanes(queryName, queryExecutor.executionPlan, queryExecutor.timeBuckets, queryExecutor.concurrency, queryExecutor.targetQPS)
+	ctx := queryExecutor.schedule.context(job.context(), queryName)
+
+	// 429 responses pause every worker of the query
+	backoff := newRateLimitBackoff(queryName, queryExecutor.backoffOn429, queryExecutor.maxRetryAfter)
+
+	// worker issues requests for a lane until the job ends or the pool scales down
+	worker := func(lane *planLane, id int) {
+		pool := lane.pool
+		defer pool.exited()
+		metrics := newWorkerMetrics(queryName)
+		var classLatency prometheus.Observer
+		if queryExecutor.classLatency != nil {
+			classLatency = queryExecutor.classLatency.WithLabelValues(queryName)
+		}
+		kindLatency := kindLatencyHist.WithLabelValues(queryName, queryExecutor.query.kind())
+		// Each worker starts after its stagger slot and a random jitter to spread the load
+		if !queryExecutor.workerStart.wait(ctx, id, lane.workers) {
+			return
+		}
 
-		go func(id int) {
-			// Initial delay to spread workers
-			time.Sleep(initialDelay)
+		var retry *planAttempt // failed plan entry sent again (retry policy of planFailures)
+		defer func() {
+			if retry != nil {
+				planFailures.drop(queryName, lane, *retry)
+			}
+		}()
+		for {
+			if pool.shouldExit() {
+				return
+			}
 
-			for {
-				// Wait for rate limiter permission (blocks until allowed)
-				if err := limiter.Wait(ctx); err != nil {
+			// Wait for rate limiter permission (blocks until allowed)
+			if err := pool.waitLimiter(ctx); err != nil {
+				if ctx.Err() == nil {
 					log.Printf("[worker-%d] Rate limiter error: %v", id, err)
-					return
 				}
+				return
+			}
+			if !backoff.wait(ctx) {
+				return
+			}
+			if !pauses.wait(ctx, queryName) {
+				return
+			}
 
-				// Determine bucket name and time range using execution plan from config
-				bucketName := "immediate"
-				var startTime, endTime time.Time
-				var startTimeStamp, endTimeStamp string
-				var bucket *timeBucket
-
-				// Filter plan entries for this query name
-				var matchingEntries []PlanEntry
-				for _, entry := range queryExecutor.executionPlan {
-					if entry.QueryName == queryExecutor.name {
-						matchingEntries = append(matchingEntries, entry)
-					}
+			// Determine bucket name and time range using execution plan from config
+			window := queryExecutor.nextWindow(id, lane, retry)
+			retry = nil
+			if window.done {
+				return
+			}
+
+			// Expensive queries skip requests while their circuit breaker is open
+			if !queryExecutor.breaker.allow() {
+				planFailures.drop(queryName, lane, window.attempt)
+				continue
+			}
+			if !budget.take(queryName) {
+				planFailures.drop(queryName, lane, window.attempt)
+				return
+			}
+
+			// Cache-hit analysis: occasionally re-issue a recently executed query verbatim
+			repeated := false
+			if queryExecutor.repeats != nil {
+				if w, ok := queryExecutor.repeats.pick(time.Now()); ok && lane.accepts(w.bucketName, queryExecutor.timeBuckets) {
+					w.attempt = window.attempt // the repeat takes the plan entry's slot
+					window = w
+					repeated = true
 				}
+			}
 
-				if len(matchingEntries) > 0 {
-					// Get or create index counter for this query
-					planIdx := getPlanIndex(queryExecutor.name)
-					idx := atomic.AddInt64(planIdx, 1) - 1
-					entryIdx := int(idx) % len(matchingEntries) // Cycle through matching entries - repeats when exhausted
-					entry := matchingEntries[entryIdx]
-
-					// Log when we've cycled through all entries once
-					if idx > 0 && idx%int64(len(matchingEntries)) == 0 {
-						log.Printf("[worker-%d] Query '%s': Cycled through all %d plan entries, repeating from start (cycle: %d)",
-							id, queryExecutor.name, len(matchingEntries), idx/int64(len(matchingEntries)))
-					}
+			bucketName := window.bucketName
+			bucket := window.bucket
+			startTime, endTime := window.start, window.end
 
-					bucketName = entry.BucketName
-					if bucketName != "immediate" {
-						// Find the bucket by name
-						for i := range queryExecutor.timeBuckets {
-							if queryExecutor.timeBuckets[i].name == bucketName {
-								bucket = &queryExecutor.timeBuckets[i]
-								break
-							}
-						}
+			tenantID := queryExecutor.tenants.pick()
 
-						if bucket != nil {
-							// Check if bucket is eligible based on elapsed time
-							elapsed := time.Since(testStartTime)
-							if bucket.ageEnd <= elapsed {
-								// Calculate time range dynamically without jitter for stable query windows
-								now := time.Now()
-								// Use fixed bucket boundaries for consistent results
-								endTime = now.Add(-bucket.ageStart)
-								startTime = now.Add(-bucket.ageEnd)
-								endTimeStamp = fmt.Sprintf("%d", endTime.Unix())
-								startTimeStamp = fmt.Sprintf("%d", startTime.Unix())
-							} else {
-								// Bucket not eligible yet, use immediate
-								bucket = nil
-								bucketName = "immediate"
-							}
-						} else {
-							// Bucket not found, use immediate
-							bucketName = "immediate"
-							log.Printf("[worker-%d] Warning: Bucket '%s' not found in timeBuckets config, using immediate", id, bucketName)
-						}
-					}
-				} else {
-					// No matching entries in plan for this query - this shouldn't happen if config is valid
-					log.Printf("[worker-%d] Warning: No plan entries for query '%s', using immediate bucket", id, queryExecutor.name)
-				}
+			sample := &requestSample{Query: queryName, Bucket: bucketName, Tenant: tenantID}
+			if bucket != nil {
+				sample.WindowStart = startTime.Unix()
+				sample.WindowEnd = endTime.Unix()
+			}
 
-				// Create a new request for Tempo TraceQL search via gateway
-				// Gateway uses Observatorium API pattern: /api/traces/v1/{tenant}/api/search
-				req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/traces/v1/%s/tempo/api/search", queryExecutor.queryEndpoint, queryExecutor.tenantID), nil)
+			var req *http.Request
+			if reqTemplate != nil {
+				req = reqTemplate.request(tenantID, window)
+			} else {
+				// Zipkin API requests carry the time range in their path and parameters
+				var err error
+				rawURL := queryExecutor.query.zipkinURL(queryExecutor.zipkinEndpoint, bucket != nil, startTime, endTime, queryExecutor.limit)
+				req, err = http.NewRequest(http.MethodGet, rawURL, nil)
 				if err != nil {
 					log.Printf("[worker-%d] error creating http request: %v", id, err)
-					queryFailuresCounter.WithLabelValues(queryName).Inc()
-					bucketQueryCounter.WithLabelValues(bucketName, queryName).Inc()
+					metrics.failures.Inc()
+					metrics.bucket(bucketName).requests.Inc()
+					planFailures.drop(queryName, lane, window.attempt)
 					continue
 				}
 
-				if token != nil {
-					req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", string(token)))
+				// Add tenant ID header for multitenancy
+				if tenantID != "" && sendsOrgID(queryExecutor.target) {
+					req.Header.Set("X-Scope-OrgID", tenantID)
 				}
+			}
 
-				// Add tenant ID header for multitenancy
-				if queryExecutor.tenantID != "" {
-					req.Header.Set("X-Scope-OrgID", queryExecutor.tenantID)
+			auth.apply(tenantID, req)
+			hinted := deadlineHints.apply(req, queryExecutor.timeout)
+			profile := headerProfiles.apply(queryName, req)
+			sample.HeaderProfile = profile
+			clientName := clientIdentities.apply(queryName, req)
+			sample.Client = clientName
+			traceID := tracer.start(req)
+			req, timings := slowQueries.trace(req)
+			req = phaseGrace.bound(req, queryName, queryExecutor.schedule)
+
+			inFlight.acquire()
+			start := time.Now()
+			res, err := client.Do(req)
+			if err == nil && res.StatusCode == http.StatusUnauthorized && auth.retryUnauthorized(tenantID, req) {
+				// Retry once with the refreshed credentials
+				res.Body.Close()
+				start = time.Now()
+				res, err = client.Do(req)
+			}
+			if err != nil {
+				inFlight.release()
+				if burnRates != nil {
+					burnRates.record(queryName, true, 0)
+				}
+				bucketSLOs.record(bucketName, time.Since(start), true)
+				apdex.record(queryName, queryExecutor.query.Class, time.Since(start), true)
+				deadlineHints.record(queryName, hinted, 0, time.Since(start))
+				headerProfiles.record(queryName, profile, 0, time.Since(start))
+				clientIdentities.record(queryName, clientName, 0, time.Since(start))
+				queryExecutor.breaker.record(true)
+				if phaseGrace.record(queryName, req, err) {
+					log.Printf("[worker-%d] request cancelled: it outlived its phase by more than %s", id, phaseGrace.grace)
 				}
+				log.Printf("[worker-%d] error making http request: %s", id, redaction.error(err))
+				log.Printf("[worker-%d] Full request details:\n%s", id, redaction.request(req))
+				metrics.failures.Inc()
+				metrics.bucket(bucketName).requests.Inc()
+				sample.Timestamp = start
+				sample.LatencySeconds = time.Since(start).Seconds()
+				sample.Error = redaction.error(err)
+				metrics.heartbeat.SetToCurrentTime()
+				slowQueries.observe(queryExecutor.query.Class, req, sample, timings)
+				samples.record(sample)
+				pauses.observe(sample)
+				retry = planFailures.settle(queryName, lane, window.attempt, true)
+				continue
+			}
 
-				queryParams := req.URL.Query()
-				queryParams.Set("q", queryExecutor.traceQL)
-				// Only add time range parameters if bucket is available
-				if bucket != nil {
-					queryParams.Set("start", startTimeStamp)
-					queryParams.Set("end", endTimeStamp)
+			if backoff.observe(res) {
+				// Throttled: the query pauses, and the response is neither a failure nor a latency sample
+				inFlight.release()
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				metrics.bucket(bucketName).requests.Inc()
+				metrics.heartbeat.SetToCurrentTime()
+				sample.Timestamp = start
+				sample.Status = res.StatusCode
+				sample.LatencySeconds = time.Since(start).Seconds()
+				sample.Throttled = true
+				samples.record(sample)
+				retry = planFailures.settle(queryName, lane, window.attempt, true)
+				continue
+			}
+
+			queryDuration := time.Since(start).Seconds()
+			sample.Timestamp = start
+			sample.Status = res.StatusCode
+			sample.LatencySeconds = queryDuration
+			observeWithTrace(metrics.latency, queryDuration, traceID)
+			if classLatency != nil {
+				observeWithTrace(classLatency, queryDuration, traceID)
+			}
+			observeWithTrace(metrics.bucket(bucketName).duration, queryDuration, traceID)
+			observeWithTrace(metrics.statusLatency(statusClass(res.StatusCode)), queryDuration, traceID)
+			metrics.protocolLatency(protocolLabel(res)).Observe(queryDuration)
+			kindLatency.Observe(queryDuration)
+			statsd.timing("query_latency", queryDuration, labelPair{"bucket", bucketName}, labelPair{"name", queryName}, labelPair{"status_class", statusClass(res.StatusCode)})
+			if queryExecutor.query.threshold != "" {
+				sweepDurationHist.WithLabelValues(queryExecutor.query.sweep, queryExecutor.query.threshold).Observe(queryDuration)
+			}
+			if queryExecutor.repeats != nil {
+				if repeated {
+					cacheAnalysisHist.WithLabelValues(queryName, "repeat").Observe(queryDuration)
+				} else {
+					cacheAnalysisHist.WithLabelValues(queryName, "fresh").Observe(queryDuration)
+					queryExecutor.repeats.remember(window, start)
 				}
-				// Set query result limit from configuration
-				queryParams.Set("limit", fmt.Sprintf("%d", queryExecutor.limit))
-				req.URL.RawQuery = queryParams.Encode()
+			}
+			metrics.bucket(bucketName).requests.Inc()
 
-				start := time.Now()
-				res, err := client.Do(req)
-				if err != nil {
-					log.Printf("[worker-%d] error making http request: %v", id, err)
-					log.Printf("[worker-%d] Full request details:\n%s", id, formatRequest(req))
-					queryFailuresCounter.WithLabelValues(queryName).Inc()
-					bucketQueryCounter.WithLabelValues(bucketName, queryName).Inc()
-					continue
+			if burnRates != nil {
+				burnRates.record(queryName, res.StatusCode >= 300, time.Since(start))
+			}
+			bucketSLOs.record(bucketName, time.Since(start), res.StatusCode >= 300)
+			apdex.record(queryName, queryExecutor.query.Class, time.Since(start), res.StatusCode >= 300)
+			deadlineHints.record(queryName, hinted, res.StatusCode, time.Since(start))
+			headerProfiles.record(queryName, profile, res.StatusCode, time.Since(start))
+			clientIdentities.record(queryName, clientName, res.StatusCode, time.Since(start))
+			queryExecutor.breaker.record(res.StatusCode >= 500)
+
+			var debugBody []byte // copy of the body kept at /debug/samples
+			if res.StatusCode >= 300 {
+				metrics.failures.Inc()
+
+				// Read response body before closing
+				body, readErr := io.ReadAll(res.Body)
+				res.Body.Close()
+				timings.bodyReadDone()
+				sample.Bytes = int64(len(body))
+				if readErr != nil {
+					sample.Error = readErr.Error()
 				}
+				debugBody = debugSamples.capture(body)
 
-				queryDuration := time.Since(start).Seconds()
-				queryLatencyHist.WithLabelValues(queryName).Observe(queryDuration)
-				bucketDurationHist.WithLabelValues(bucketName, queryName).Observe(queryDuration)
-				bucketQueryCounter.WithLabelValues(bucketName, queryName).Inc()
+				// Log full request details
+				log.Printf("[worker-%d] Query failed [%s]: status: %d", id, bucketName, res.StatusCode)
+				log.Printf("[worker-%d] Full request details:\n%s", id, redaction.request(req))
 
-				if res.StatusCode >= 300 {
-					queryFailuresCounter.WithLabelValues(queryName).Inc()
+				// Log response body
+				if readErr != nil {
+					log.Printf("[worker-%d] Failed to read response body: %v", id, readErr)
+				} else {
+					log.Printf("[worker-%d] Response body:\n%s", id, redaction.body(body))
+				}
+			} else {
+				if latencyAnomalies != nil {
+					latencyAnomalies.observe(queryName, bucketName, queryDuration)
+				}
 
-					// Read response body before closing
-					body, readErr := io.ReadAll(res.Body)
-					res.Body.Close()
+				// Read and parse response to count spans
+				var body []byte
+				release := func() {}
+				if queryExecutor.scanSpans {
+					body, release, err = readPooledBody(res.Body)
+				} else {
+					body, err = io.ReadAll(res.Body)
+				}
+				res.Body.Close()
+				timings.bodyReadDone()
 
-					// Log full request details
-					log.Printf("[worker-%d] Query failed [%s]: status: %d", id, bucketName, res.StatusCode)
-					log.Printf("[worker-%d] Full request details:\n%s", id, formatRequest(req))
+				sample.Bytes = int64(len(body))
+				debugBody = debugSamples.capture(body)
 
-					// Log response body
-					if readErr != nil {
-						log.Printf("[worker-%d] Failed to read response body: %v", id, readErr)
-					} else {
-						log.Printf("[worker-%d] Response body:\n%s", id, string(body))
+				// Golden checks, tenant isolation and result order checks need the decoded response
+				goldenDue := queryExecutor.golden != nil && queryExecutor.golden.due(bucketName, time.Now())
+
+				var spansCount int
+				if err != nil {
+					phaseGrace.record(queryName, req, err)
+					log.Printf("[worker-%d] error reading response body: %v", id, err)
+					sample.Error = err.Error()
+				} else if queryExecutor.query.isZipkin() {
+					var parseErr error
+					spansCount, sample.Traces, parseErr = countZipkinResponse(queryExecutor.query.kind(), body)
+					if parseErr != nil {
+						log.Printf("[worker-%d] error parsing Zipkin response JSON: %v", id, parseErr)
+						sample.Error = parseErr.Error()
+					} else if resultAnomalies != nil {
+						resultAnomalies.observe(queryName, bucketName, spansCount, sample.Traces)
+					}
+				} else if queryExecutor.scanSpans && !goldenDue && tenantIsolation == nil && !queryExecutor.query.MostRecent {
+					spansCount, sample.Traces = scanSearchResponse(body)
+					if resultAnomalies != nil {
+						resultAnomalies.observe(queryName, bucketName, spansCount, sample.Traces)
 					}
 				} else {
-					// Read and parse response to count spans
-					body, err := io.ReadAll(res.Body)
-					res.Body.Close()
-
-					var spansCount int
-					if err != nil {
-						log.Printf("[worker-%d] error reading response body: %v", id, err)
+					var searchResp TempoSearchResponse
+					if err := json.Unmarshal(body, &searchResp); err != nil {
+						log.Printf("[worker-%d] error parsing response JSON: %v", id, err)
+						sample.Error = err.Error()
 					} else {
-						var searchResp TempoSearchResponse
-						if err := json.Unmarshal(body, &searchResp); err != nil {
-							log.Printf("[worker-%d] error parsing response JSON: %v", id, err)
-						} else {
-							// Count total spans across all traces (Tempo format)
-							for _, trace := range searchResp.Traces {
-								// Check SpanSets (for structural queries)
-								for _, spanSet := range trace.SpanSets {
-									spansCount += len(spanSet.Spans)
-								}
-								// Check SpanSet (for non-structural queries)
-								if trace.SpanSet != nil {
-									spansCount += len(trace.SpanSet.Spans)
-								}
+						// Count total spans across all traces (Tempo format)
+						spansCount = searchResp.spanCount()
+						sample.Traces = len(searchResp.Traces)
+
+						if resultAnomalies != nil {
+							resultAnomalies.observe(queryName, bucketName, spansCount, len(searchResp.Traces))
+						}
+
+						if queryExecutor.query.MostRecent {
+							if searchResp.newestFirst() {
+								resultOrderCounter.WithLabelValues(queryName, "sorted").Inc()
+							} else {
+								resultOrderCounter.WithLabelValues(queryName, "unsorted").Inc()
 							}
 						}
-					}
 
-					// Always record spans returned metric (0 if parsing failed, actual count otherwise)
-					spansReturnedHist.WithLabelValues(queryName).Observe(float64(spansCount))
+						if goldenDue {
+							goldenChecksCounter.WithLabelValues(queryName).Inc()
+							for _, check := range queryExecutor.golden.compare(&searchResp) {
+								goldenMismatchesCounter.WithLabelValues(queryName, check).Inc()
+								log.Printf("[worker-%d] [%s] %s: golden check '%s' failed (traces: %d)", id, bucketName, queryName, check, len(searchResp.Traces))
+							}
+						}
 
-					// Format log message with or without time range
-					if bucket != nil {
-						log.Printf("[worker-%d] [%s] %s took %.3f seconds --> status: %d, spans: %d, timeRange: %s to %s\n",
-							id, bucketName, queryExecutor.name, queryDuration, res.StatusCode, spansCount,
-							startTime.Format("15:04:05"), endTime.Format("15:04:05"))
-					} else {
-						log.Printf("[worker-%d] [%s] %s took %.3f seconds --> status: %d, spans: %d (immediate data, no time range)\n",
-							id, bucketName, queryExecutor.name, queryDuration, res.StatusCode, spansCount)
+						if tenantIsolation != nil {
+							traceIDs := make([]string, 0, len(searchResp.Traces))
+							for _, trace := range searchResp.Traces {
+								traceIDs = append(traceIDs, trace.TraceID)
+							}
+							tenantIsolation.check(tenantID, queryName, traceIDs)
+						}
+					}
+				}
+				if err == nil && !queryExecutor.query.isZipkin() {
+					// Scan cost of the search, when Tempo reports it
+					if inspected, ok := scanInspectedBytes(body); ok {
+						sample.InspectedBytes = inspected
+						inspection.observe(queryName, bucketName, inspected, spansCount)
 					}
 				}
-				// Rate limiter will control the next iteration
+				if sample.Error == "" {
+					sample.LimitHit, sample.Partial = limitHits.observe(queryExecutor.query, bucketName, sample.Traces, queryExecutor.limit, body)
+				}
+				release()
+
+				// Always record spans returned metric (0 if parsing failed, actual count otherwise)
+				metrics.spans.Observe(float64(spansCount))
+				sample.Spans = spansCount
+
+				// Format log message with or without time range
+				switch {
+				case queryExecutor.highThroughput:
+					// No per-request log: the log mutex would serialize the workers
+				case bucket != nil:
+					log.Printf("[worker-%d] [%s] %s took %.3f seconds --> status: %d, spans: %d, timeRange: %s to %s\n",
+						id, bucketName, queryExecutor.name, queryDuration, res.StatusCode, spansCount,
+						startTime.Format("15:04:05"), endTime.Format("15:04:05"))
+				default:
+					log.Printf("[worker-%d] [%s] %s took %.3f seconds --> status: %d, spans: %d (immediate data, no time range)\n",
+						id, bucketName, queryExecutor.name, queryDuration, res.StatusCode, spansCount)
+				}
 			}
-		}(workerID)
+			inFlight.release()
+			metrics.heartbeat.SetToCurrentTime()
+			slowQueries.observe(queryExecutor.query.Class, req, sample, timings)
+			samples.record(sample)
+			debugSamples.record(sample, req.URL, debugBody)
+			bucketProbes.observe(sample)
+			pauses.observe(sample)
+			latencyBuckets.record(sample)
+			costs.record(sample)
+			retry = planFailures.settle(queryName, lane, window.attempt, sample.failed())
+			// Rate limiter will control the next iteration
+		}
 	}
 
+	// Launch N independent workers per lane for concurrent execution
+	for i, lane := range lanes {
+		lane := lane
+		// Create a shared rate limiter for all workers of the lane
+		// The limiters ensure total QPS for this query type equals targetQPS
+		// Calculate burst size: allow 1-2 seconds of burst capacity for better rate accuracy
+		burstSize := int(math.Max(10, lane.qps*queryExecutor.burstMultiplier))
+		limiter := rate.NewLimiter(rate.Limit(lane.qps), burstSize)
+		autoscale := queryExecutor.autoscale
+		if lane.bucket != "" {
+			autoscale = AutoscaleConfig{} // dedicated workers stay fixed
+			log.Printf("Query %s: %d workers dedicated to bucket %s (%d plan entries)", queryName, lane.workers, lane.bucket, len(lane.entries))
+		}
+		log.Printf("Rate limiter for %s: QPS=%.4f, burst=%d (multiplier=%.2f)", lane.key, lane.qps, burstSize, queryExecutor.burstMultiplier)
+		lane.countsCycles = i == 0
+		lane.pool, err = newWorkerPool(lane.key, autoscale, lane.workers, limiter, func(id int) { worker(lane, id) })
+		if err != nil {
+			return err
+		}
+	}
+	start := func() {
+		queryActiveGauge.WithLabelValues(queryName).Set(1)
+		for i, lane := range lanes {
+			lane.pool.start(ctx, lane.workers)
+			loadSamples.register(lane.pool, lane.qps)
+			if i == 0 {
+				// Stair-step and the control API resize the query's main lane
+				stairStep.register(lane.pool)
+				controls.register(queryName, lane.pool, lane.pool.limiter)
+			}
+		}
+	}
+	if queryExecutor.schedule.scheduled() {
+		// Delayed queries start their workers once startAfter is reached
+		go queryExecutor.schedule.start(ctx, queryName, start)
+		return nil
+	}
+	start()
 	return nil
 }
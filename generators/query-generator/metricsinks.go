@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Metrics sink types
+const (
+	metricsSinkPrometheus = "prometheus"
+	metricsSinkStatsD     = "statsd"
+	metricsSinkInflux     = "influx"
+)
+
+// MetricsSinkConfig selects where the generator's metrics are published
+type MetricsSinkConfig struct {
+	Type     string `yaml:"type"`     // "prometheus" (scrape endpoint of server.listen), "statsd" or "influx"
+	Address  string `yaml:"address"`  // statsd: UDP host:port of the agent (default: localhost:8125)
+	Prefix   string `yaml:"prefix"`   // statsd, influx: metric/measurement name prefix (default: query_load_test)
+	Tags     bool   `yaml:"tags"`     // statsd: send labels as DogStatsD tags instead of name segments
+	Interval string `yaml:"interval"` // statsd, influx: how often metrics are flushed (default: 10s)
+	Path     string `yaml:"path"`     // influx: file the snapshots are appended to
+	URL      string `yaml:"url"`      // influx: write endpoint, e.g. http://influxdb:8086/api/v2/write?org=perf&bucket=tempo
+	Token    string `yaml:"token"`    // influx: API token sent as "Authorization: Token ..."
+}
+
+// metricsPrefix selects the generator's own metrics in the registry
+const metricsPrefix = "query_load_test_"
+
+// metricPoint is a single flattened value of the Prometheus registry
+type metricPoint struct {
+	name   string // without metricsPrefix, with a suffix for histogram parts (_count, _sum)
+	labels []labelPair
+	value  float64
+	gauge  bool // false for monotonic counters (counters, histogram counts and sums)
+}
+
+// labelPair is a label of a metric point
+type labelPair struct {
+	name, value string
+}
+
+// key identifies the series of a point
+func (p metricPoint) key() string {
+	var b strings.Builder
+	b.WriteString(p.name)
+	for _, l := range p.labels {
+		fmt.Fprintf(&b, ",%s=%s", l.name, l.value)
+	}
+	return b.String()
+}
+
+// gatherMetricPoints flattens the generator's metrics of the registry; histograms and summaries
+// become their count and sum
+func gatherMetricPoints(g prometheus.Gatherer) ([]metricPoint, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var points []metricPoint
+	for _, mf := range families {
+		if !strings.HasPrefix(mf.GetName(), metricsPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(mf.GetName(), metricsPrefix)
+		for _, m := range mf.GetMetric() {
+			labels := make([]labelPair, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels = append(labels, labelPair{l.GetName(), l.GetValue()})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				points = append(points, metricPoint{name: name, labels: labels, value: m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				points = append(points, metricPoint{name: name, labels: labels, value: m.GetGauge().GetValue(), gauge: true})
+			case dto.MetricType_HISTOGRAM:
+				points = append(points,
+					metricPoint{name: name + "_count", labels: labels, value: float64(m.GetHistogram().GetSampleCount())},
+					metricPoint{name: name + "_sum", labels: labels, value: m.GetHistogram().GetSampleSum()})
+			case dto.MetricType_SUMMARY:
+				points = append(points,
+					metricPoint{name: name + "_count", labels: labels, value: float64(m.GetSummary().GetSampleCount())},
+					metricPoint{name: name + "_sum", labels: labels, value: m.GetSummary().GetSampleSum()})
+			}
+		}
+	}
+	return points, nil
+}
+
+// startMetricsSinks starts the configured non-Prometheus sinks and reports whether the
+// Prometheus endpoint should be served (the default when no sink is configured)
+func startMetricsSinks(configs []MetricsSinkConfig) (bool, error) {
+	if len(configs) == 0 {
+		return true, nil
+	}
+
+	servePrometheus := false
+	for _, cfg := range configs {
+		switch strings.ToLower(cfg.Type) {
+		case metricsSinkPrometheus:
+			servePrometheus = true
+		case metricsSinkStatsD:
+			interval, err := parseSinkInterval(cfg.Interval)
+			if err != nil {
+				return false, err
+			}
+			sink, err := newStatsDSink(cfg)
+			if err != nil {
+				return false, err
+			}
+			statsd = sink
+			go sink.run(interval)
+		case metricsSinkInflux:
+			interval, err := parseSinkInterval(cfg.Interval)
+			if err != nil {
+				return false, err
+			}
+			sink, err := newInfluxSink(cfg)
+			if err != nil {
+				return false, err
+			}
+			go sink.run(interval)
+		default:
+			return false, fmt.Errorf("unknown metrics sink type %q", cfg.Type)
+		}
+	}
+	return servePrometheus, nil
+}
+
+// parseSinkInterval parses a sink flush interval, defaulting to 10s
+func parseSinkInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 10 * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid metrics sink interval %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// NetworkConfig simulates a remote client on top of the real network path
+type NetworkConfig struct {
+	RequestDelay  string `yaml:"requestDelay"`  // Delay before each request is sent (e.g. "40ms")
+	ResponseDelay string `yaml:"responseDelay"` // Delay before the response is handed back to the caller
+	Jitter        string `yaml:"jitter"`        // Uniform +/- jitter applied to each delay (e.g. "10ms")
+
+	// Bandwidth caps per connection; a worker uses one connection at a time, so this is
+	// effectively a per-worker cap (0 = unlimited)
+	EgressBytesPerSecond  int64 `yaml:"egressBytesPerSecond"`
+	IngressBytesPerSecond int64 `yaml:"ingressBytesPerSecond"`
+}
+
+// maxThrottleChunk bounds the bytes read or written per limiter wait
+const maxThrottleChunk = 64 * 1024
+
+// wanTransport injects artificial latency around requests so timeout and hedging behavior can
+// be studied without tc/netem privileges. Injected delays are part of the measured latency.
+type wanTransport struct {
+	next          http.RoundTripper
+	requestDelay  time.Duration
+	responseDelay time.Duration
+	jitter        time.Duration
+}
+
+// wrapNetworkTransport wraps the transport with the configured impairments (unchanged when none)
+func wrapNetworkTransport(next http.RoundTripper, cfg NetworkConfig) (http.RoundTripper, error) {
+	w := &wanTransport{next: next}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"requestDelay", cfg.RequestDelay, &w.requestDelay},
+		{"responseDelay", cfg.ResponseDelay, &w.responseDelay},
+		{"jitter", cfg.Jitter, &w.jitter},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid %s %q", d.name, d.value)
+		}
+		*d.dst = parsed
+	}
+
+	if cfg.EgressBytesPerSecond < 0 || cfg.IngressBytesPerSecond < 0 {
+		return nil, fmt.Errorf("bandwidth caps must not be negative")
+	}
+	if cfg.EgressBytesPerSecond > 0 || cfg.IngressBytesPerSecond > 0 {
+		t, ok := next.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("bandwidth caps need an *http.Transport, got %T", next)
+		}
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return newThrottledConn(conn, cfg.EgressBytesPerSecond, cfg.IngressBytesPerSecond), nil
+		}
+	}
+
+	if w.requestDelay == 0 && w.responseDelay == 0 {
+		return next, nil
+	}
+	return w, nil
+}
+
+// delay returns base with jitter applied, never negative
+func (w *wanTransport) delay(base time.Duration) time.Duration {
+	if base == 0 {
+		return 0
+	}
+	if w.jitter > 0 {
+		base += time.Duration(rand.Int63n(int64(2*w.jitter)+1)) - w.jitter
+	}
+	if base < 0 {
+		return 0
+	}
+	return base
+}
+
+func (w *wanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := sleepContext(req.Context(), w.delay(w.requestDelay)); err != nil {
+		return nil, err
+	}
+	res, err := w.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	// Hold the response back as if it had travelled the return path
+	if err := sleepContext(req.Context(), w.delay(w.responseDelay)); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// sleepContext sleeps for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledConn caps the bytes per second written to and read from a connection
+type throttledConn struct {
+	net.Conn
+	egress  *rate.Limiter // nil = unlimited
+	ingress *rate.Limiter // nil = unlimited
+}
+
+// newThrottledConn wraps a connection with the given caps (0 = unlimited)
+func newThrottledConn(conn net.Conn, egress, ingress int64) *throttledConn {
+	return &throttledConn{Conn: conn, egress: bandwidthLimiter(egress), ingress: bandwidthLimiter(ingress)}
+}
+
+// bandwidthLimiter creates a limiter for a bytes-per-second cap (nil when unlimited)
+func bandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst > maxThrottleChunk {
+		burst = maxThrottleChunk
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if c.ingress == nil {
+		return c.Conn.Read(p)
+	}
+	if len(p) > c.ingress.Burst() {
+		p = p[:c.ingress.Burst()]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if werr := c.ingress.WaitN(context.Background(), n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	if c.egress == nil {
+		return c.Conn.Write(p)
+	}
+	written := 0
+	for written < len(p) {
+		chunk := len(p) - written
+		if chunk > c.egress.Burst() {
+			chunk = c.egress.Burst()
+		}
+		if err := c.egress.WaitN(context.Background(), chunk); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// NotifierConfig configures where generator alerts are sent
+type NotifierConfig struct {
+	WebhookURL string `yaml:"webhookURL"` // Slack-compatible incoming webhook; alerts are only logged when empty
+}
+
+// notifier sends alerts raised by the generator itself
+type notifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// newNotifier creates a notifier for the given config
+func newNotifier(cfg NotifierConfig) *notifier {
+	return &notifier{
+		webhookURL: cfg.WebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// notify logs the alert and posts it to the webhook, if configured
+func (n *notifier) notify(message string) {
+	log.Printf("ALERT: %s", message)
+	if n == nil || n.webhookURL == "" {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]string{"text": message})
+	if err != nil {
+		log.Printf("Warning: Failed to encode notification: %v", err)
+		return
+	}
+
+	go func() {
+		res, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("Warning: Failed to send notification: %v", err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			log.Printf("Warning: Notification webhook returned status %d", res.StatusCode)
+		}
+	}()
+}
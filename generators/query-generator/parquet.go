@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A minimal Parquet writer for request samples: flat schema of REQUIRED columns, PLAIN encoding,
+// GZIP-compressed v1 data pages, one data page per column chunk. The Thrift structures of the
+// file format are encoded by hand with the compact protocol to avoid pulling in a Parquet library.
+
+// parquetRowGroupSize is the number of samples buffered per row group
+const parquetRowGroupSize = 50000
+
+// Parquet physical types, repetition types, converted types, encodings and codecs used by the writer
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMicros = 10
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecGzip = 2
+)
+
+// parquetColumn describes a column of the sample schema and how to encode its value
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 when none
+	encode    func(buf *bytes.Buffer, s *requestSample)
+}
+
+// parquetSampleColumns is the schema of the sample Parquet files
+var parquetSampleColumns = []parquetColumn{
+	{"timestamp", parquetInt64, parquetConvertedTimestampMicros, func(b *bytes.Buffer, s *requestSample) { putInt64(b, s.Timestamp.UnixNano()/1000) }},
+	{"query", parquetByteArray, parquetConvertedUTF8, func(b *bytes.Buffer, s *requestSample) { putByteArray(b, s.Query) }},
+	{"bucket", parquetByteArray, parquetConvertedUTF8, func(b *bytes.Buffer, s *requestSample) { putByteArray(b, s.Bucket) }},
+	{"tenant", parquetByteArray, parquetConvertedUTF8, func(b *bytes.Buffer, s *requestSample) { putByteArray(b, s.Tenant) }},
+	{"status", parquetInt32, -1, func(b *bytes.Buffer, s *requestSample) { putInt32(b, int32(s.Status)) }},
+	{"latency_seconds", parquetDouble, -1, func(b *bytes.Buffer, s *requestSample) { putInt64(b, int64(math.Float64bits(s.LatencySeconds))) }},
+	{"spans", parquetInt32, -1, func(b *bytes.Buffer, s *requestSample) { putInt32(b, int32(s.Spans)) }},
+	{"traces", parquetInt32, -1, func(b *bytes.Buffer, s *requestSample) { putInt32(b, int32(s.Traces)) }},
+	{"bytes", parquetInt64, -1, func(b *bytes.Buffer, s *requestSample) { putInt64(b, s.Bytes) }},
+	{"window_start", parquetInt64, -1, func(b *bytes.Buffer, s *requestSample) { putInt64(b, s.WindowStart) }},
+	{"window_end", parquetInt64, -1, func(b *bytes.Buffer, s *requestSample) { putInt64(b, s.WindowEnd) }},
+	{"error", parquetByteArray, parquetConvertedUTF8, func(b *bytes.Buffer, s *requestSample) { putByteArray(b, s.Error) }},
+}
+
+func putInt32(b *bytes.Buffer, v int32) {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], uint32(v))
+	b.Write(tmp[:])
+}
+
+func putInt64(b *bytes.Buffer, v int64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], uint64(v))
+	b.Write(tmp[:])
+}
+
+func putByteArray(b *bytes.Buffer, v string) {
+	putInt32(b, int32(len(v)))
+	b.WriteString(v)
+}
+
+// parquetChunkMeta is the metadata of a written column chunk
+type parquetChunkMeta struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// parquetRowGroupMeta is the metadata of a written row group
+type parquetRowGroupMeta struct {
+	rows   int64
+	chunks []parquetChunkMeta
+}
+
+// parquetSink writes samples to rotating Parquet files
+type parquetSink struct {
+	dir, prefix string
+	maxBytes    int64
+	interval    time.Duration
+
+	f         *os.File
+	offset    int64
+	opened    time.Time
+	rows      int64 // rows written to the current file
+	rowGroups []parquetRowGroupMeta
+
+	columns []bytes.Buffer // PLAIN-encoded values of the pending row group
+	pending int64
+}
+
+// newParquetSink creates a Parquet sink; files are rotated after maxBytes written or interval
+func newParquetSink(dir, prefix string, maxBytes int64, interval time.Duration) *parquetSink {
+	return &parquetSink{
+		dir:      dir,
+		prefix:   prefix,
+		maxBytes: maxBytes,
+		interval: interval,
+		columns:  make([]bytes.Buffer, len(parquetSampleColumns)),
+	}
+}
+
+func (p *parquetSink) write(s *requestSample) error {
+	now := time.Now()
+	if p.f != nil && ((p.maxBytes > 0 && p.offset >= p.maxBytes) || (p.interval > 0 && now.Sub(p.opened) >= p.interval)) {
+		if err := p.close(); err != nil {
+			return err
+		}
+	}
+	if p.f == nil {
+		if err := p.open(now); err != nil {
+			return err
+		}
+	}
+
+	for i, col := range parquetSampleColumns {
+		col.encode(&p.columns[i], s)
+	}
+	p.pending++
+
+	if p.pending >= parquetRowGroupSize {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// open starts a new Parquet file
+func (p *parquetSink) open(now time.Time) error {
+	name := filepath.Join(p.dir, fmt.Sprintf("%s-%s.parquet", p.prefix, now.UTC().Format("20060102-150405.000")))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("PAR1")); err != nil {
+		f.Close()
+		return err
+	}
+	p.f = f
+	p.offset = 4
+	p.opened = now
+	p.rows = 0
+	p.rowGroups = nil
+	return nil
+}
+
+// flushRowGroup writes the pending rows as a row group with one compressed page per column
+func (p *parquetSink) flushRowGroup() error {
+	if p.pending == 0 {
+		return nil
+	}
+
+	group := parquetRowGroupMeta{rows: p.pending}
+	for i := range parquetSampleColumns {
+		values := p.columns[i].Bytes()
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(values); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		header := encodePageHeader(len(values), compressed.Len(), p.pending)
+		chunk := parquetChunkMeta{
+			offset:           p.offset,
+			uncompressedSize: int64(len(header) + len(values)),
+			compressedSize:   int64(len(header) + compressed.Len()),
+		}
+		if _, err := p.f.Write(header); err != nil {
+			return err
+		}
+		if _, err := p.f.Write(compressed.Bytes()); err != nil {
+			return err
+		}
+		p.offset += chunk.compressedSize
+		group.chunks = append(group.chunks, chunk)
+		p.columns[i].Reset()
+	}
+
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows += p.pending
+	p.pending = 0
+	return nil
+}
+
+func (p *parquetSink) close() error {
+	if p.f == nil {
+		return nil
+	}
+	if err := p.flushRowGroup(); err != nil {
+		p.f.Close()
+		p.f = nil
+		return err
+	}
+
+	footer := encodeFileMetaData(p.rows, p.rowGroups)
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, tail[:], []byte("PAR1")} {
+		if _, err := p.f.Write(b); err != nil {
+			p.f.Close()
+			p.f = nil
+			return err
+		}
+	}
+
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+// encodePageHeader encodes a Thrift PageHeader for a v1 data page of PLAIN values
+func encodePageHeader(uncompressed, compressed int, numValues int64) []byte {
+	var w thriftCompactWriter
+	w.i32(1, 0) // type: DATA_PAGE
+	w.i32(2, int32(uncompressed))
+	w.i32(3, int32(compressed))
+	w.beginStruct(5) // data_page_header
+	w.i32(1, int32(numValues))
+	w.i32(2, parquetEncodingPlain)
+	w.i32(3, parquetEncodingRLE)
+	w.i32(4, parquetEncodingRLE)
+	w.endStruct()
+	w.stop()
+	return w.buf.Bytes()
+}
+
+// encodeFileMetaData encodes the Thrift FileMetaData footer
+func encodeFileMetaData(rows int64, rowGroups []parquetRowGroupMeta) []byte {
+	var w thriftCompactWriter
+	w.i32(1, 1) // version
+
+	w.listHeader(2, thriftStruct, len(parquetSampleColumns)+1) // schema
+	w.beginListStruct()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(parquetSampleColumns)))
+	w.endStruct()
+	for _, col := range parquetSampleColumns {
+		w.beginListStruct()
+		w.i32(1, col.typ)
+		w.i32(3, parquetRequired)
+		w.binary(4, col.name)
+		if col.converted >= 0 {
+			w.i32(6, col.converted)
+		}
+		w.endStruct()
+	}
+
+	w.i64(3, rows)
+
+	w.listHeader(4, thriftStruct, len(rowGroups)) // row_groups
+	for _, group := range rowGroups {
+		w.beginListStruct()
+		w.listHeader(1, thriftStruct, len(group.chunks)) // columns
+		var total int64
+		for i, chunk := range group.chunks {
+			col := parquetSampleColumns[i]
+			w.beginListStruct()
+			w.i64(2, chunk.offset)
+			w.beginStruct(3) // meta_data
+			w.i32(1, col.typ)
+			w.listHeader(2, thriftI32, 1)
+			w.varint(zigzag(parquetEncodingPlain))
+			w.listHeader(3, thriftBinary, 1)
+			w.rawBinary(col.name)
+			w.i32(4, parquetCodecGzip)
+			w.i64(5, group.rows)
+			w.i64(6, chunk.uncompressedSize)
+			w.i64(7, chunk.compressedSize)
+			w.i64(9, chunk.offset)
+			w.endStruct()
+			w.endStruct()
+			total += chunk.uncompressedSize
+		}
+		w.i64(2, total)
+		w.i64(3, group.rows)
+		w.endStruct()
+	}
+
+	w.binary(6, "query-load-generator")
+	w.stop()
+	return w.buf.Bytes()
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompactWriter encodes Thrift structs with the compact protocol
+type thriftCompactWriter struct {
+	buf    bytes.Buffer
+	last   int16   // last field id of the current struct
+	parent []int16 // last field ids of enclosing structs
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (w *thriftCompactWriter) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	w.buf.Write(tmp[:n])
+}
+
+func (w *thriftCompactWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.last = id
+}
+
+func (w *thriftCompactWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftCompactWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftCompactWriter) binary(id int16, v string) {
+	w.fieldHeader(id, thriftBinary)
+	w.rawBinary(v)
+}
+
+func (w *thriftCompactWriter) rawBinary(v string) {
+	w.varint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *thriftCompactWriter) listHeader(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.varint(uint64(size))
+	}
+}
+
+// beginStruct starts a struct-typed field
+func (w *thriftCompactWriter) beginStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginListStruct()
+}
+
+// beginListStruct starts a struct that is a list element (no field header)
+func (w *thriftCompactWriter) beginListStruct() {
+	w.parent = append(w.parent, w.last)
+	w.last = 0
+}
+
+func (w *thriftCompactWriter) endStruct() {
+	w.stop()
+	w.last = w.parent[len(w.parent)-1]
+	w.parent = w.parent[:len(w.parent)-1]
+}
+
+func (w *thriftCompactWriter) stop() {
+	w.buf.WriteByte(0)
+}
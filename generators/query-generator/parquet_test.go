@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The test reads the files back with a decoder written from the Parquet and Thrift compact
+// protocol specifications, independent of the writer's encoder.
+
+// thriftStructValue is a decoded Thrift struct by field id
+type thriftStructValue map[int16]interface{}
+
+// thriftReader decodes Thrift compact protocol values
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) uvarint() uint64 {
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (t *thriftReader) zigzag() int64 {
+	v := t.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) byte() byte {
+	b, err := t.r.ReadByte()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int8(t.byte())
+	case 4, 5, 6:
+		return t.zigzag()
+	case 7:
+		var tmp [8]byte
+		if _, err := io.ReadFull(t.r, tmp[:]); err != nil {
+			panic(err)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(tmp[:]))
+	case 8:
+		b := make([]byte, t.uvarint())
+		if _, err := io.ReadFull(t.r, b); err != nil {
+			panic(err)
+		}
+		return string(b)
+	case 9, 10:
+		header := t.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(t.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = t.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		return t.structValue()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+func (t *thriftReader) structValue() thriftStructValue {
+	s := thriftStructValue{}
+	var last int16
+	for {
+		header := t.byte()
+		if header == 0 {
+			return s
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(t.zigzag())
+		}
+		s[id] = t.value(header & 0x0f)
+		last = id
+	}
+}
+
+// decodeThrift decodes a Thrift struct from the start of b and returns it with its length
+func decodeThrift(b []byte) (s thriftStructValue, n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoding thrift: %v", r)
+		}
+	}()
+	r := bytes.NewReader(b)
+	s = (&thriftReader{r: r}).structValue()
+	return s, len(b) - r.Len(), nil
+}
+
+// parquetTestSamples returns n distinct samples
+func parquetTestSamples(n int) []requestSample {
+	base := time.Date(2025, 11, 27, 8, 0, 0, 123456000, time.UTC)
+	samples := make([]requestSample, n)
+	for i := range samples {
+		samples[i] = requestSample{
+			Timestamp:      base.Add(time.Duration(i) * time.Millisecond),
+			Query:          fmt.Sprintf("query-%d", i%7),
+			Bucket:         "recent",
+			Tenant:         fmt.Sprintf("tenant-%d", i%3),
+			Status:         200 + i%2*300,
+			LatencySeconds: float64(i) / 1000,
+			Spans:          i * 10,
+			Traces:         i,
+			Bytes:          int64(i) << 20,
+			WindowStart:    int64(1000 + i),
+			WindowEnd:      int64(2000 + i),
+		}
+		if samples[i].Status != 200 {
+			samples[i].Error = fmt.Sprintf("HTTP %d: ünïcode", samples[i].Status)
+		}
+	}
+	return samples
+}
+
+// parquetPlainValues decodes n PLAIN values of a physical type
+func parquetPlainValues(typ int64, data []byte, n int) ([]interface{}, error) {
+	values := make([]interface{}, 0, n)
+	for len(values) < n {
+		switch typ {
+		case parquetInt32:
+			if len(data) < 4 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			values = append(values, int64(int32(binary.LittleEndian.Uint32(data))))
+			data = data[4:]
+		case parquetInt64:
+			if len(data) < 8 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			values = append(values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case parquetDouble:
+			if len(data) < 8 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case parquetByteArray:
+			if len(data) < 4 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			size := int(binary.LittleEndian.Uint32(data))
+			if len(data) < 4+size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			values = append(values, string(data[4:4+size]))
+			data = data[4+size:]
+		default:
+			return nil, fmt.Errorf("unsupported physical type %d", typ)
+		}
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(data))
+	}
+	return values, nil
+}
+
+// parquetSampleValue is the value a column holds for a sample, as the test decoder returns it
+func parquetSampleValue(column string, s requestSample) interface{} {
+	switch column {
+	case "timestamp":
+		return s.Timestamp.UnixNano() / 1000
+	case "query":
+		return s.Query
+	case "bucket":
+		return s.Bucket
+	case "tenant":
+		return s.Tenant
+	case "status":
+		return int64(s.Status)
+	case "latency_seconds":
+		return s.LatencySeconds
+	case "spans":
+		return int64(s.Spans)
+	case "traces":
+		return int64(s.Traces)
+	case "bytes":
+		return s.Bytes
+	case "window_start":
+		return s.WindowStart
+	case "window_end":
+		return s.WindowEnd
+	case "error":
+		return s.Error
+	}
+	return nil
+}
+
+func TestParquetSinkRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 3, parquetRowGroupSize + 5} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			dir := t.TempDir()
+			samples := parquetTestSamples(n)
+			sink := newParquetSink(dir, "samples", 0, 0)
+			for i := range samples {
+				if err := sink.write(&samples[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.close(); err != nil {
+				t.Fatal(err)
+			}
+			files, err := filepath.Glob(filepath.Join(dir, "samples-*.parquet"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("files = %v (%v), want one", files, err)
+			}
+			data, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkParquetSamples(t, data, samples)
+		})
+	}
+}
+
+// checkParquetSamples decodes a Parquet file and compares its schema and rows with samples
+func checkParquetSamples(t *testing.T, data []byte, samples []requestSample) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	if footerStart < 4 {
+		t.Fatalf("footer length %d exceeds the file", footerLen)
+	}
+	meta, n, err := decodeThrift(data[footerStart : len(data)-8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != footerLen {
+		t.Fatalf("footer decoded %d bytes, want %d", n, footerLen)
+	}
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v, want 1", meta[1])
+	}
+	if meta[3] != int64(len(samples)) {
+		t.Errorf("num_rows = %v, want %d", meta[3], len(samples))
+	}
+
+	schema := meta[2].([]interface{})
+	if len(schema) != len(parquetSampleColumns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(parquetSampleColumns)+1)
+	}
+	root := schema[0].(thriftStructValue)
+	if root[5] != int64(len(parquetSampleColumns)) {
+		t.Errorf("root num_children = %v, want %d", root[5], len(parquetSampleColumns))
+	}
+	for i, col := range parquetSampleColumns {
+		el := schema[i+1].(thriftStructValue)
+		if el[4] != col.name || el[1] != int64(col.typ) || el[3] != int64(parquetRequired) {
+			t.Errorf("schema element %d = %v, want %s of type %d, required", i+1, el, col.name, col.typ)
+		}
+		if converted, ok := el[6]; ok != (col.converted >= 0) || (ok && converted != int64(col.converted)) {
+			t.Errorf("column %s converted type = %v, want %d", col.name, converted, col.converted)
+		}
+	}
+
+	var row int
+	var lastEnd int64 = 4
+	for g, rg := range meta[4].([]interface{}) {
+		group := rg.(thriftStructValue)
+		rows := int(group[3].(int64))
+		var total int64
+		for c, cc := range group[1].([]interface{}) {
+			col := parquetSampleColumns[c]
+			chunk := cc.(thriftStructValue)
+			cm := chunk[3].(thriftStructValue)
+			offset := cm[9].(int64)
+			if offset != lastEnd || chunk[2] != offset {
+				t.Fatalf("row group %d column %s starts at %d (file_offset %v), want %d", g, col.name, offset, chunk[2], lastEnd)
+			}
+			if path := cm[3].([]interface{}); len(path) != 1 || path[0] != col.name {
+				t.Errorf("row group %d column %s path = %v", g, col.name, path)
+			}
+			if cm[1] != int64(col.typ) || cm[4] != int64(parquetCodecGzip) || cm[5] != int64(rows) {
+				t.Errorf("row group %d column %s metadata = %v", g, col.name, cm)
+			}
+
+			header, headerLen, err := decodeThrift(data[offset:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := header[5].(thriftStructValue)
+			if header[1] != int64(0) || page[1] != int64(rows) || page[2] != int64(parquetEncodingPlain) {
+				t.Fatalf("row group %d column %s page header = %v", g, col.name, header)
+			}
+			compressedSize := header[3].(int64)
+			if int64(headerLen)+compressedSize != cm[7] {
+				t.Errorf("row group %d column %s total_compressed_size = %v, want %d", g, col.name, cm[7], int64(headerLen)+compressedSize)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(data[offset+int64(headerLen) : offset+int64(headerLen)+compressedSize]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(plain)) != header[2] || int64(headerLen+len(plain)) != cm[6] {
+				t.Errorf("row group %d column %s uncompressed sizes = %v and %v, want %d and %d", g, col.name, header[2], cm[6], len(plain), headerLen+len(plain))
+			}
+			values, err := parquetPlainValues(int64(col.typ), plain, rows)
+			if err != nil {
+				t.Fatalf("row group %d column %s: %v", g, col.name, err)
+			}
+			for i, v := range values {
+				if want := parquetSampleValue(col.name, samples[row+i]); v != want {
+					t.Fatalf("row %d column %s = %v, want %v", row+i, col.name, v, want)
+				}
+			}
+			lastEnd = offset + int64(headerLen) + compressedSize
+			total += cm[6].(int64)
+		}
+		if group[2] != total {
+			t.Errorf("row group %d total_byte_size = %v, want %d", g, group[2], total)
+		}
+		row += rows
+	}
+	if row != len(samples) {
+		t.Errorf("row groups hold %d rows, want %d", row, len(samples))
+	}
+	if lastEnd != int64(footerStart) {
+		t.Errorf("column chunks end at %d, footer starts at %d", lastEnd, footerStart)
+	}
+}
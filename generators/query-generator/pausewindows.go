@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const defaultPauseRecovery = 5 * time.Minute
+
+// PauseWindowConfig stops querying for a while at a scheduled offset from the test start, to
+// simulate reader downtime, upgrades or gateway restarts and measure the recovery
+type PauseWindowConfig struct {
+	Name     string   `yaml:"name"`
+	At       string   `yaml:"at"`       // Offset from the test start, e.g. "3h"
+	Duration string   `yaml:"duration"` // How long the queries stop, e.g. "10m"
+	Every    string   `yaml:"every"`    // Repeat this often after at (default: once)
+	Queries  []string `yaml:"queries"`  // Paused queries (default: all)
+	// Period before and after each pause whose results are compared in the reports (default: 5m)
+	Recovery string `yaml:"recovery"`
+}
+
+// pauses holds the scheduled pause windows (nil when none are configured)
+var pauses *pauseSchedule
+
+// pauseSchedule pauses the workers of the affected queries during each window, and compares
+// the results of the recovery period after each pause with the period before it
+type pauseSchedule struct {
+	testStart time.Time
+	windows   []*pauseWindow
+
+	mu      sync.Mutex
+	periods map[pauseKey]*pausePeriods
+
+	active *prometheus.GaugeVec
+}
+
+// pauseWindow is a parsed pause window
+type pauseWindow struct {
+	name     string
+	at       time.Duration
+	duration time.Duration
+	every    time.Duration
+	recovery time.Duration
+	queries  map[string]bool // nil = all queries
+}
+
+// pauseKey identifies an occurrence of a window
+type pauseKey struct {
+	window string
+	n      int
+}
+
+// pausePeriods are the results around an occurrence of a window
+type pausePeriods struct {
+	before, after pausePeriodStats
+	first         float64 // latency of the first response after the pause
+}
+
+type pausePeriodStats struct {
+	requests, failures int64
+	latency            float64 // sum, seconds
+}
+
+// pauseResult is an occurrence of a pause window with the results around it
+type pauseResult struct {
+	Window               string            `json:"window"`
+	Start                time.Time         `json:"start"`
+	End                  time.Time         `json:"end"`
+	Before               pausePeriodResult `json:"before"`
+	After                pausePeriodResult `json:"after"`
+	FirstResponseSeconds float64           `json:"firstResponseSeconds,omitempty"` // Latency of the first response after the pause
+}
+
+// pausePeriodResult summarizes the requests of the period before or after a pause
+type pausePeriodResult struct {
+	Requests     int64   `json:"requests"`
+	ErrorRatePct float64 `json:"errorRatePercent"`
+	MeanSeconds  float64 `json:"meanSeconds"`
+}
+
+// newPauseSchedule validates the windows and registers their metrics; it returns nil when no
+// window is configured
+func newPauseSchedule(configs []PauseWindowConfig, queries []QueryConfig, testStart time.Time) (*pauseSchedule, error) {
+	windows, err := parsePauseWindows(configs, queries)
+	if err != nil || len(windows) == 0 {
+		return nil, err
+	}
+	p := &pauseSchedule{testStart: testStart, windows: windows, periods: make(map[pauseKey]*pausePeriods)}
+	p.active = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "pause",
+		Name:      "active",
+		Help:      "Whether the scheduled pause window is in progress (1) or not (0), for dashboard annotations",
+	}, []string{"window"})
+	for _, w := range p.windows {
+		p.active.WithLabelValues(w.name).Set(0)
+	}
+	return p, nil
+}
+
+// parsePauseWindows validates the pause windows and the queries they refer to
+func parsePauseWindows(configs []PauseWindowConfig, queries []QueryConfig) ([]*pauseWindow, error) {
+	known := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		known[q.Name] = true
+		if q.sweep != "" {
+			known[q.sweep] = true
+		}
+	}
+	var windows []*pauseWindow
+	names := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("pause window without a name")
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("pause window %s is defined twice", cfg.Name)
+		}
+		names[cfg.Name] = true
+		w := &pauseWindow{name: cfg.Name, recovery: defaultPauseRecovery}
+		var err error
+		if w.at, err = parseExtendedDuration(cfg.At); err != nil || w.at < 0 {
+			return nil, fmt.Errorf("pause window %s: invalid at %q", cfg.Name, cfg.At)
+		}
+		if w.duration, err = parseExtendedDuration(cfg.Duration); err != nil || w.duration <= 0 {
+			return nil, fmt.Errorf("pause window %s: invalid duration %q", cfg.Name, cfg.Duration)
+		}
+		if cfg.Every != "" {
+			if w.every, err = parseExtendedDuration(cfg.Every); err != nil || w.every <= w.duration {
+				return nil, fmt.Errorf("pause window %s: every %q must be longer than the duration", cfg.Name, cfg.Every)
+			}
+		}
+		if cfg.Recovery != "" {
+			if w.recovery, err = parseExtendedDuration(cfg.Recovery); err != nil || w.recovery <= 0 {
+				return nil, fmt.Errorf("pause window %s: invalid recovery %q", cfg.Name, cfg.Recovery)
+			}
+		}
+		for _, q := range cfg.Queries {
+			if !known[q] {
+				return nil, fmt.Errorf("pause window %s: undefined query %s", cfg.Name, q)
+			}
+			if w.queries == nil {
+				w.queries = make(map[string]bool)
+			}
+			w.queries[q] = true
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// applies reports whether the window pauses the query
+func (w *pauseWindow) applies(queryName string) bool {
+	return w.queries == nil || w.queries[queryName] || w.queries[sweepBaseName(queryName)]
+}
+
+// occurrence returns the start of the n-th occurrence of the window
+func (w *pauseWindow) occurrence(testStart time.Time, n int) time.Time {
+	return testStart.Add(w.at + time.Duration(n)*w.every)
+}
+
+// latest returns the last occurrence of the window starting before t + ahead (false when none)
+func (w *pauseWindow) latest(testStart, t time.Time, ahead time.Duration) (int, bool) {
+	offset := t.Add(ahead).Sub(testStart.Add(w.at))
+	if offset < 0 {
+		return 0, false
+	}
+	if w.every == 0 {
+		return 0, true
+	}
+	return int(offset / w.every), true
+}
+
+// pausedUntil returns the end of the window pausing the query at now (zero when none)
+func (p *pauseSchedule) pausedUntil(queryName string, now time.Time) time.Time {
+	var until time.Time
+	for _, w := range p.windows {
+		if !w.applies(queryName) {
+			continue
+		}
+		n, ok := w.latest(p.testStart, now, 0)
+		if !ok {
+			continue
+		}
+		if end := w.occurrence(p.testStart, n).Add(w.duration); end.After(now) && end.After(until) {
+			until = end
+		}
+	}
+	return until
+}
+
+// nextStart returns the start of the next window pausing the query after now (zero when none)
+func (p *pauseSchedule) nextStart(queryName string, now time.Time) time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	var next time.Time
+	for _, w := range p.windows {
+		if !w.applies(queryName) {
+			continue
+		}
+		start := w.occurrence(p.testStart, 0)
+		if n, ok := w.latest(p.testStart, now, 0); ok {
+			if w.every == 0 {
+				continue
+			}
+			start = w.occurrence(p.testStart, n+1)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// wait blocks while a window pauses the query; false means ctx is done
+func (p *pauseSchedule) wait(ctx context.Context, queryName string) bool {
+	if p == nil {
+		return ctx.Err() == nil
+	}
+	for {
+		until := p.pausedUntil(queryName, time.Now())
+		if until.IsZero() {
+			return ctx.Err() == nil
+		}
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// run logs the start and end of each window and exports whether it is in progress, until ctx
+// is done
+func (p *pauseSchedule) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	active := make(map[string]bool, len(p.windows))
+	for {
+		now := time.Now()
+		for _, w := range p.windows {
+			n, ok := w.latest(p.testStart, now, 0)
+			inProgress := ok && now.Before(w.occurrence(p.testStart, n).Add(w.duration))
+			if inProgress == active[w.name] {
+				continue
+			}
+			active[w.name] = inProgress
+			if inProgress {
+				p.active.WithLabelValues(w.name).Set(1)
+				log.Printf("Pause window %s: pausing %s for %s", w.name, w.describeQueries(), w.duration)
+			} else {
+				p.active.WithLabelValues(w.name).Set(0)
+				log.Printf("Pause window %s: resuming %s", w.name, w.describeQueries())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// describeQueries names the queries the window pauses
+func (w *pauseWindow) describeQueries() string {
+	if w.queries == nil {
+		return "all queries"
+	}
+	names := make([]string, 0, len(w.queries))
+	for q := range w.queries {
+		names = append(names, q)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// observe adds a request to the period before or after the occurrences of the windows
+// pausing its query
+func (p *pauseSchedule) observe(sample *requestSample) {
+	if p == nil || sample.Throttled {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.windows {
+		if !w.applies(sample.Query) {
+			continue
+		}
+		// The next occurrence starting within the recovery period: the request ran before it
+		if n, ok := w.latest(p.testStart, sample.Timestamp, w.recovery); ok {
+			if start := w.occurrence(p.testStart, n); sample.Timestamp.Before(start) {
+				p.periodsOf(w.name, n).before.add(sample)
+			}
+		}
+		// The last occurrence that ended within the recovery period: the request ran after it
+		n, ok := w.latest(p.testStart, sample.Timestamp, 0)
+		if !ok {
+			continue
+		}
+		end := w.occurrence(p.testStart, n).Add(w.duration)
+		if !sample.Timestamp.Before(end) && sample.Timestamp.Before(end.Add(w.recovery)) {
+			periods := p.periodsOf(w.name, n)
+			if periods.after.requests == 0 {
+				periods.first = sample.LatencySeconds
+			}
+			periods.after.add(sample)
+		}
+	}
+}
+
+// periodsOf returns the periods of an occurrence; the caller holds p.mu
+func (p *pauseSchedule) periodsOf(window string, n int) *pausePeriods {
+	key := pauseKey{window: window, n: n}
+	periods := p.periods[key]
+	if periods == nil {
+		periods = &pausePeriods{}
+		p.periods[key] = periods
+	}
+	return periods
+}
+
+func (s *pausePeriodStats) add(sample *requestSample) {
+	s.requests++
+	if sample.failed() {
+		s.failures++
+	}
+	s.latency += sample.LatencySeconds
+}
+
+func (s pausePeriodStats) result() pausePeriodResult {
+	r := pausePeriodResult{Requests: s.requests}
+	if s.requests > 0 {
+		r.ErrorRatePct = float64(s.failures) / float64(s.requests) * 100
+		r.MeanSeconds = s.latency / float64(s.requests)
+	}
+	return r
+}
+
+// results returns the occurrences that started before end, in order
+func (p *pauseSchedule) results(end time.Time) []pauseResult {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var results []pauseResult
+	for _, w := range p.windows {
+		last, ok := w.latest(p.testStart, end, 0)
+		if !ok {
+			continue
+		}
+		for n := 0; n <= last; n++ {
+			start := w.occurrence(p.testStart, n)
+			if !start.Before(end) {
+				break
+			}
+			r := pauseResult{Window: w.name, Start: start, End: start.Add(w.duration)}
+			if periods := p.periods[pauseKey{window: w.name, n: n}]; periods != nil {
+				r.Before, r.After = periods.before.result(), periods.after.result()
+				r.FirstResponseSeconds = periods.first
+			}
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Start.Before(results[j].Start) })
+	return results
+}
+
+// writePauses appends the Markdown pause windows with their recovery
+func writePauses(b *strings.Builder, results []pauseResult) {
+	if len(results) == 0 {
+		return
+	}
+	b.WriteString("\n#### Pause windows\n\n")
+	b.WriteString("| Window | Paused | Before: requests | Before: errors | Before: mean | After: requests | After: errors | After: mean | First response |\n|:--|:--|--:|--:|--:|--:|--:|--:|--:|\n")
+	for _, r := range results {
+		first := "-"
+		if r.After.Requests > 0 {
+			first = formatSeconds(r.FirstResponseSeconds)
+		}
+		fmt.Fprintf(b, "| `%s` | %s to %s | %d | %.2f%% | %s | %d | %.2f%% | %s | %s |\n", r.Window,
+			r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339),
+			r.Before.Requests, r.Before.ErrorRatePct, formatSeconds(r.Before.MeanSeconds),
+			r.After.Requests, r.After.ErrorRatePct, formatSeconds(r.After.MeanSeconds), first)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// testPauseSchedule returns a schedule without metrics: "maintenance" pauses every query once,
+// 30m into the test for 5m; "upgrade" pauses q1 1h in for 10m, again every 3h
+func testPauseSchedule(t *testing.T, testStart time.Time) *pauseSchedule {
+	t.Helper()
+	windows, err := parsePauseWindows([]PauseWindowConfig{
+		{Name: "maintenance", At: "30m", Duration: "5m"},
+		{Name: "upgrade", At: "1h", Duration: "10m", Every: "3h", Queries: []string{"q1"}},
+	}, []QueryConfig{{Name: "q1"}, {Name: "q2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pauseSchedule{testStart: testStart, windows: windows, periods: make(map[pauseKey]*pausePeriods)}
+}
+
+func TestParsePauseWindows(t *testing.T) {
+	queries := []QueryConfig{{Name: "q1"}, {Name: "q2"}}
+	windows, err := parsePauseWindows([]PauseWindowConfig{
+		{Name: "nightly", At: "1d", Duration: "10m", Every: "1d", Queries: []string{"q2"}, Recovery: "15m"},
+	}, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := windows[0]
+	if w.at != 24*time.Hour || w.duration != 10*time.Minute || w.every != 24*time.Hour || w.recovery != 15*time.Minute {
+		t.Errorf("window = %+v, want at 24h for 10m every 24h with 15m recovery", w)
+	}
+	if w.applies("q1") || !w.applies("q2") {
+		t.Errorf("window applies to q1: %v, q2: %v, want only q2", w.applies("q1"), w.applies("q2"))
+	}
+
+	for _, tc := range []struct {
+		name string
+		cfg  []PauseWindowConfig
+	}{
+		{"no name", []PauseWindowConfig{{At: "1h", Duration: "1m"}}},
+		{"duplicate", []PauseWindowConfig{{Name: "a", At: "1h", Duration: "1m"}, {Name: "a", At: "2h", Duration: "1m"}}},
+		{"no at", []PauseWindowConfig{{Name: "a", Duration: "1m"}}},
+		{"no duration", []PauseWindowConfig{{Name: "a", At: "1h"}}},
+		{"every within the duration", []PauseWindowConfig{{Name: "a", At: "1h", Duration: "10m", Every: "10m"}}},
+		{"invalid recovery", []PauseWindowConfig{{Name: "a", At: "1h", Duration: "1m", Recovery: "0s"}}},
+		{"undefined query", []PauseWindowConfig{{Name: "a", At: "1h", Duration: "1m", Queries: []string{"q3"}}}},
+	} {
+		if _, err := parsePauseWindows(tc.cfg, queries); err == nil {
+			t.Errorf("%s: parsePauseWindows succeeded, want an error", tc.name)
+		}
+	}
+}
+
+func TestPauseSchedulePausedUntil(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	p := testPauseSchedule(t, start)
+	for _, tc := range []struct {
+		query string
+		at    time.Duration
+		until time.Duration // 0 = not paused
+	}{
+		{"q1", 29 * time.Minute, 0},
+		{"q1", 30 * time.Minute, 35 * time.Minute},
+		{"q2", 32 * time.Minute, 35 * time.Minute},
+		{"q2", 35 * time.Minute, 0},
+		{"q1", 65 * time.Minute, 70 * time.Minute},
+		{"q2", 65 * time.Minute, 0}, // upgrade only pauses q1
+		{"q1", 70 * time.Minute, 0},
+		{"q1", 4*time.Hour + time.Minute, 4*time.Hour + 10*time.Minute},
+		{"q1", 7*time.Hour + 9*time.Minute, 7*time.Hour + 10*time.Minute},
+	} {
+		want := time.Time{}
+		if tc.until > 0 {
+			want = start.Add(tc.until)
+		}
+		if got := p.pausedUntil(tc.query, start.Add(tc.at)); !got.Equal(want) {
+			t.Errorf("pausedUntil(%s, +%s) = %s, want %s", tc.query, tc.at, got, want)
+		}
+	}
+}
+
+func TestPauseScheduleNextStart(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	p := testPauseSchedule(t, start)
+	for _, tc := range []struct {
+		query string
+		at    time.Duration
+		next  time.Duration // 0 = none
+	}{
+		{"q1", 0, 30 * time.Minute},
+		{"q1", 40 * time.Minute, time.Hour},
+		{"q1", 2 * time.Hour, 4 * time.Hour},
+		{"q2", 0, 30 * time.Minute},
+		{"q2", 40 * time.Minute, 0},
+	} {
+		want := time.Time{}
+		if tc.next > 0 {
+			want = start.Add(tc.next)
+		}
+		if got := p.nextStart(tc.query, start.Add(tc.at)); !got.Equal(want) {
+			t.Errorf("nextStart(%s, +%s) = %s, want %s", tc.query, tc.at, got, want)
+		}
+	}
+	var none *pauseSchedule
+	if next := none.nextStart("q1", start); !next.IsZero() {
+		t.Errorf("nextStart without windows = %s, want zero", next)
+	}
+}
+
+func TestPauseScheduleRecovery(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	p := testPauseSchedule(t, start)
+	for _, s := range []struct {
+		query     string
+		at        time.Duration
+		status    int
+		latency   float64
+		throttled bool
+	}{
+		{"q1", 50 * time.Minute, 200, 9, false}, // before the recovery period
+		{"q1", 56 * time.Minute, 200, 0.1, false},
+		{"q1", 57 * time.Minute, 429, 9, true}, // throttled requests are left out
+		{"q1", 58 * time.Minute, 500, 0.3, false},
+		{"q2", 59 * time.Minute, 200, 9, false}, // not paused by upgrade
+		{"q1", 71 * time.Minute, 200, 2, false},
+		{"q1", 74 * time.Minute, 200, 0.4, false},
+		{"q1", 76 * time.Minute, 200, 9, false}, // after the recovery period
+	} {
+		p.observe(&requestSample{Query: s.query, Timestamp: start.Add(s.at), Status: s.status, LatencySeconds: s.latency, Throttled: s.throttled})
+	}
+
+	results := p.results(start.Add(2 * time.Hour))
+	if len(results) != 2 || results[0].Window != "maintenance" || results[1].Window != "upgrade" {
+		t.Fatalf("results = %+v, want maintenance then upgrade", results)
+	}
+	if r := results[0]; r.Before.Requests != 0 || r.After.Requests != 0 || !r.End.Equal(start.Add(35*time.Minute)) {
+		t.Errorf("maintenance = %+v, want no requests around 30m to 35m", r)
+	}
+	r := results[1]
+	if !r.Start.Equal(start.Add(time.Hour)) || !r.End.Equal(start.Add(70*time.Minute)) {
+		t.Errorf("upgrade paused %s to %s, want 1h to 1h10m in", r.Start, r.End)
+	}
+	if r.Before.Requests != 2 || r.Before.ErrorRatePct != 50 || math.Abs(r.Before.MeanSeconds-0.2) > 1e-9 {
+		t.Errorf("before = %+v, want 2 requests, 50%% errors, 0.2s mean", r.Before)
+	}
+	if r.After.Requests != 2 || r.After.ErrorRatePct != 0 || math.Abs(r.After.MeanSeconds-1.2) > 1e-9 || r.FirstResponseSeconds != 2 {
+		t.Errorf("after = %+v, first %v, want 2 requests, no errors, 1.2s mean, first 2s", r.After, r.FirstResponseSeconds)
+	}
+
+	// Each occurrence of a repeating window is reported once it started
+	if results := p.results(start.Add(5 * time.Hour)); len(results) != 3 || !results[2].Start.Equal(start.Add(4*time.Hour)) {
+		t.Errorf("results after 5h = %+v, want the second upgrade at 4h", results)
+	}
+}
+
+func TestPauseScheduleWait(t *testing.T) {
+	p := testPauseSchedule(t, time.Now().Add(-31*time.Minute)) // inside maintenance
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.wait(ctx, "q2") {
+		t.Errorf("wait returned true after ctx was done")
+	}
+
+	p = testPauseSchedule(t, time.Now().Add(-40*time.Minute)) // between windows
+	if !p.wait(context.Background(), "q2") {
+		t.Errorf("wait outside a window returned false")
+	}
+	var none *pauseSchedule
+	if !none.wait(context.Background(), "q1") {
+		t.Errorf("wait without windows returned false")
+	}
+}
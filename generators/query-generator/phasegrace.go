@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// phaseGrace cancels requests outliving their phase (nil when disabled)
+var phaseGrace *phaseGraceLimiter
+
+// phaseGraceLimiter gives every request a deadline at the end of the phase it is sent in plus
+// a grace period, so the tail of a phase (e.g. a spike stage) does not run into the next one.
+// Phases end at stair-step stage boundaries, when a pause window starts, at the query's
+// stopAfter and at the end of job.duration.
+type phaseGraceLimiter struct {
+	grace     time.Duration
+	cancelled *prometheus.CounterVec
+}
+
+// phaseDeadlineKey is the request context key of the phase deadline
+type phaseDeadlineKey struct{}
+
+// parsePhaseGrace parses the grace period
+func parsePhaseGrace(grace string) (time.Duration, error) {
+	d, err := parseExtendedDuration(grace)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid phaseGrace %q", grace)
+	}
+	return d, nil
+}
+
+// newPhaseGraceLimiter parses the grace period (nil when unset)
+func newPhaseGraceLimiter(grace string) (*phaseGraceLimiter, error) {
+	if grace == "" {
+		return nil, nil
+	}
+	d, err := parsePhaseGrace(grace)
+	if err != nil {
+		return nil, err
+	}
+	return &phaseGraceLimiter{
+		grace: d,
+		cancelled: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "phase",
+			Name:      "cancelled_total",
+			Help:      "Requests cancelled because they outlived the phase they were sent in by more than phaseGrace",
+		}, []string{"name"}),
+	}, nil
+}
+
+// phaseEnd returns the end of the phase running at now for a query (zero when the phase does
+// not end)
+func phaseEnd(queryName string, schedule querySchedule, now time.Time) time.Time {
+	var end time.Time
+	for _, t := range []time.Time{stairStep.stageEnd(now), pauses.nextStart(queryName, now), schedule.stopAt, job.endsAt()} {
+		if t.After(now) && (end.IsZero() || t.Before(end)) {
+			end = t
+		}
+	}
+	return end
+}
+
+// bound returns the request carrying the deadline of its phase; the transport applies it
+func (l *phaseGraceLimiter) bound(req *http.Request, queryName string, schedule querySchedule) *http.Request {
+	if l == nil {
+		return req
+	}
+	end := phaseEnd(queryName, schedule, time.Now())
+	if end.IsZero() {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), phaseDeadlineKey{}, end.Add(l.grace)))
+}
+
+// record counts a request error caused by the phase deadline; it reports whether it was
+func (l *phaseGraceLimiter) record(queryName string, req *http.Request, err error) bool {
+	if l == nil || !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	deadline, ok := req.Context().Value(phaseDeadlineKey{}).(time.Time)
+	if !ok || time.Now().Before(deadline) {
+		return false
+	}
+	l.cancelled.WithLabelValues(queryName).Inc()
+	return true
+}
+
+// wrap returns a transport applying the phase deadline of each request, until its response
+// body is closed
+func (l *phaseGraceLimiter) wrap(next http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return next
+	}
+	return &phaseDeadlineTransport{next: next}
+}
+
+// phaseDeadlineTransport cancels requests at their phase deadline
+type phaseDeadlineTransport struct {
+	next http.RoundTripper
+}
+
+func (t *phaseDeadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Value(phaseDeadlineKey{}).(time.Time)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelOnClose releases the deadline of a request once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runPlanCommand implements the "plan" subcommand
+func runPlanCommand(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return fmt.Errorf("usage: plan generate [flags]")
+	}
+
+	fs := flag.NewFlagSet("plan generate", flag.ExitOnError)
+	configPath := fs.String("config", configPathFromEnv(), "config file providing queries and bucket weights")
+	length := fs.Int("length", 1000, "number of plan entries to generate")
+	format := fs.String("format", "yaml", "output format: yaml or csv")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed used to shuffle the plan")
+	queryWeightsFlag := fs.String("query-weights", "", "query weights as name=weight,... (default: weights from config)")
+	bucketWeightsFlag := fs.String("bucket-weights", "", "bucket weights as name=weight,... (default: weights from config)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *length < 1 {
+		return fmt.Errorf("length must be >= 1, got: %d", *length)
+	}
+
+	queryWeights, err := parseWeights(*queryWeightsFlag)
+	if err != nil {
+		return fmt.Errorf("invalid query weights: %v", err)
+	}
+	bucketWeights, err := parseWeights(*bucketWeightsFlag)
+	if err != nil {
+		return fmt.Errorf("invalid bucket weights: %v", err)
+	}
+
+	// Fall back to the weights defined in the config file
+	if len(queryWeights) == 0 || len(bucketWeights) == 0 {
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if len(queryWeights) == 0 {
+			for _, q := range config.Queries {
+				queryWeights = append(queryWeights, namedWeight{name: q.Name, weight: q.planWeight()})
+			}
+		}
+		if len(bucketWeights) == 0 {
+			for _, b := range config.TimeBuckets {
+				bucketWeights = append(bucketWeights, namedWeight{name: b.Name, weight: b.Weight})
+			}
+		}
+	}
+	if len(queryWeights) == 0 {
+		return fmt.Errorf("no queries to generate a plan for")
+	}
+	if len(bucketWeights) == 0 {
+		bucketWeights = []namedWeight{{name: "immediate", weight: 1}}
+	}
+
+	plan, err := generatePlan(queryWeights, bucketWeights, *length, rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "yaml":
+		return writePlanYAML(os.Stdout, plan)
+	case "csv":
+		return writePlanCSV(os.Stdout, plan)
+	default:
+		return fmt.Errorf("unknown format %q, expected yaml or csv", *format)
+	}
+}
+
+// namedWeight is a name with its relative weight
+type namedWeight struct {
+	name   string
+	weight int
+}
+
+// parseWeights parses "name=weight,..." into a list of weights
+func parseWeights(s string) ([]namedWeight, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var weights []namedWeight
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected name=weight, got %q", part)
+		}
+		w, err := strconv.Atoi(kv[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %q", kv[0], kv[1])
+		}
+		weights = append(weights, namedWeight{name: kv[0], weight: w})
+	}
+	return weights, nil
+}
+
+// apportion splits total into integer counts proportional to the weights (largest remainder
+// method), breaking ties between equal remainders randomly. It fails when no weight is positive.
+func apportion(weights []namedWeight, total int, rng *rand.Rand) ([]int, error) {
+	counts := make([]int, len(weights))
+	sum := 0
+	for _, w := range weights {
+		sum += w.weight
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("weights sum to 0")
+	}
+
+	remainders := make([]int, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		exact := w.weight * total
+		counts[i] = exact / sum
+		remainders[i] = exact % sum
+		assigned += counts[i]
+	}
+
+	order := rng.Perm(len(weights))
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; assigned < total; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+	return counts, nil
+}
+
+// defaultExecutionPlan is the plan used when none is configured: each query once per time bucket,
+// or once in the immediate bucket when no buckets are defined
+func defaultExecutionPlan(queries []QueryConfig, buckets []TimeBucketConfig) []PlanEntry {
+	plan := make([]PlanEntry, 0, len(queries)*(len(buckets)+1))
+	seen := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		if seen[q.Name] {
+			continue // duration sweep variants share their query's entries
+		}
+		seen[q.Name] = true
+		if len(buckets) == 0 {
+			plan = append(plan, PlanEntry{QueryName: q.Name, BucketName: "immediate"})
+			continue
+		}
+		for _, b := range buckets {
+			plan = append(plan, PlanEntry{QueryName: q.Name, BucketName: b.Name})
+		}
+	}
+	return plan
+}
+
+// generatePlan builds a shuffled plan of the given length matching the query and bucket weights
+func generatePlan(queryWeights, bucketWeights []namedWeight, length int, rng *rand.Rand) ([]PlanEntry, error) {
+	// Apportion over every query/bucket combination so the joint distribution matches the weights
+	combos := make([]namedWeight, 0, len(queryWeights)*len(bucketWeights))
+	entries := make([]PlanEntry, 0, cap(combos))
+	for _, q := range queryWeights {
+		for _, b := range bucketWeights {
+			combos = append(combos, namedWeight{name: q.name + "/" + b.name, weight: q.weight * b.weight})
+			entries = append(entries, PlanEntry{QueryName: q.name, BucketName: b.name})
+		}
+	}
+
+	counts, err := apportion(combos, length, rng)
+	if err != nil {
+		return nil, fmt.Errorf("no query/bucket combination has a positive weight: %v", err)
+	}
+	plan := make([]PlanEntry, 0, length)
+	for i, count := range counts {
+		for k := 0; k < count; k++ {
+			plan = append(plan, entries[i])
+		}
+	}
+
+	rng.Shuffle(len(plan), func(i, j int) { plan[i], plan[j] = plan[j], plan[i] })
+	return plan, nil
+}
+
+// writePlanYAML writes the plan as an executionPlan config section
+func writePlanYAML(w io.Writer, plan []PlanEntry) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(struct {
+		ExecutionPlan []PlanEntry `yaml:"executionPlan"`
+	}{plan}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writePlanCSV writes the plan as queryName,bucketName rows
+func writePlanCSV(w io.Writer, plan []PlanEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"queryName", "bucketName"}); err != nil {
+		return err
+	}
+	for _, entry := range plan {
+		if err := cw.Write([]string{entry.QueryName, entry.BucketName}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestApportion(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		weights []int
+		total   int
+		want    []int // nil when ties make the counts random; they then differ by at most 1
+	}{
+		{"exact", []int{1, 2, 3}, 60, []int{10, 20, 30}},
+		{"largest remainder", []int{5, 3, 2}, 7, []int{4, 2, 1}},
+		{"zero weight", []int{0, 1, 1}, 4, []int{0, 2, 2}},
+		{"single", []int{7}, 3, []int{3}},
+		{"fewer than weights", []int{1, 1, 1}, 1, nil},
+		{"ties", []int{1, 1, 1}, 10, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			weights := make([]namedWeight, len(tc.weights))
+			for i, w := range tc.weights {
+				weights[i] = namedWeight{name: string(rune('a' + i)), weight: w}
+			}
+			counts, err := apportion(weights, tc.total, rand.New(rand.NewSource(1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum, lo, hi := 0, counts[0], counts[0]
+			for _, c := range counts {
+				sum += c
+				if c < lo {
+					lo = c
+				}
+				if c > hi {
+					hi = c
+				}
+			}
+			if sum != tc.total {
+				t.Errorf("counts %v sum to %d, want %d", counts, sum, tc.total)
+			}
+			if tc.want != nil && !reflect.DeepEqual(counts, tc.want) {
+				t.Errorf("counts = %v, want %v", counts, tc.want)
+			}
+			if tc.want == nil && hi-lo > 1 {
+				t.Errorf("counts %v of equal weights differ by more than 1", counts)
+			}
+		})
+	}
+}
+
+func TestApportionZeroSum(t *testing.T) {
+	for _, weights := range [][]namedWeight{nil, {{name: "a"}, {name: "b"}}} {
+		if counts, err := apportion(weights, 10, rand.New(rand.NewSource(1))); err == nil {
+			t.Errorf("apportion(%v) = %v, want an error", weights, counts)
+		}
+	}
+}
+
+func TestGeneratePlan(t *testing.T) {
+	queries := []namedWeight{{name: "q1", weight: 3}, {name: "q2", weight: 1}, {name: "off", weight: 0}}
+	buckets := []namedWeight{{name: "recent", weight: 1}, {name: "old", weight: 1}}
+
+	plan, err := generatePlan(queries, buckets, 80, rand.New(rand.NewSource(42)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 80 {
+		t.Fatalf("len(plan) = %d, want 80", len(plan))
+	}
+	counts := map[PlanEntry]int{}
+	for _, entry := range plan {
+		counts[entry]++
+	}
+	want := map[PlanEntry]int{
+		{QueryName: "q1", BucketName: "recent"}: 30,
+		{QueryName: "q1", BucketName: "old"}:    30,
+		{QueryName: "q2", BucketName: "recent"}: 10,
+		{QueryName: "q2", BucketName: "old"}:    10,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("entry counts = %v, want %v", counts, want)
+	}
+
+	again, err := generatePlan(queries, buckets, 80, rand.New(rand.NewSource(42)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan, again) {
+		t.Errorf("plans generated with the same seed differ")
+	}
+	other, err := generatePlan(queries, buckets, 80, rand.New(rand.NewSource(43)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(plan, other) {
+		t.Errorf("plans generated with different seeds are identical")
+	}
+}
+
+func TestGeneratePlanZeroWeights(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		queries, buckets []namedWeight
+	}{
+		{"queries", []namedWeight{{name: "q1"}, {name: "q2"}}, []namedWeight{{name: "recent", weight: 1}}},
+		{"buckets", []namedWeight{{name: "q1", weight: 1}}, []namedWeight{{name: "recent"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if plan, err := generatePlan(tc.queries, tc.buckets, 10, rand.New(rand.NewSource(1))); err == nil {
+				t.Errorf("generatePlan = %d entries, want an error", len(plan))
+			}
+		})
+	}
+}
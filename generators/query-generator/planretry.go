@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Policies for failed plan entries
+const (
+	planFailureSkip    = "skip"    // move on to the next entry (default)
+	planFailureRetry   = "retry"   // the worker sends the entry again right away
+	planFailureRequeue = "requeue" // the entry runs again at the end of the plan cycle
+
+	defaultPlanMaxAttempts = 3
+)
+
+// PlanFailureConfig controls what happens to a plan entry whose request failed, for plans meant
+// to execute every entry once (job.untilPlanComplete) or in fixed proportions
+type PlanFailureConfig struct {
+	Policy      string `yaml:"policy"`      // skip, retry or requeue (default: skip)
+	MaxAttempts int    `yaml:"maxAttempts"` // Attempts of an entry, the first included, before it is abandoned (default: 3)
+}
+
+// planFailures applies the failure policy of plan entries (nil until initialized at startup)
+var planFailures *planFailurePolicy
+
+// planFailurePolicy retries or requeues failed plan entries and counts the outcomes
+type planFailurePolicy struct {
+	policy      string
+	maxAttempts int
+	outcomes    *prometheus.CounterVec
+}
+
+// planAttempt is a plan entry handed to a worker and its attempt number (0 when the window
+// does not come from a plan entry)
+type planAttempt struct {
+	entry PlanEntry
+	n     int
+}
+
+// planRetries holds the requeued entries of a lane and the entries it handed out whose outcome
+// is not final yet
+type planRetries struct {
+	mu        sync.Mutex
+	queue     []planAttempt
+	unsettled int
+}
+
+// check validates the config
+func (cfg PlanFailureConfig) check() error {
+	switch cfg.Policy {
+	case "", planFailureSkip, planFailureRetry, planFailureRequeue:
+	default:
+		return fmt.Errorf("unknown policy %q (skip, retry or requeue)", cfg.Policy)
+	}
+	if cfg.MaxAttempts < 0 {
+		return fmt.Errorf("maxAttempts must not be negative")
+	}
+	return nil
+}
+
+// newPlanFailurePolicy validates the config and registers the outcome counter
+func newPlanFailurePolicy(cfg PlanFailureConfig) (*planFailurePolicy, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	p := &planFailurePolicy{policy: cfg.Policy, maxAttempts: cfg.MaxAttempts}
+	if p.policy == "" {
+		p.policy = planFailureSkip
+	}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = defaultPlanMaxAttempts
+	}
+	p.outcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "plan",
+		Name:      "failed_entries_total",
+		Help:      "Outcomes of plan entries whose request failed by query name: skipped, retried, requeued, recovered (succeeded on a later attempt) or abandoned (failed maxAttempts times)",
+	}, []string{"name", "outcome"})
+	return p, nil
+}
+
+// tracks reports whether entries stay unsettled until their outcome is final
+func (p *planFailurePolicy) tracks() bool {
+	return p != nil && p.policy != planFailureSkip
+}
+
+// take hands out a plan entry of the lane, tracking it until its outcome is final
+func (p *planFailurePolicy) take(lane *planLane, entry PlanEntry) planAttempt {
+	if p.tracks() {
+		lane.retries.mu.Lock()
+		lane.retries.unsettled++
+		lane.retries.mu.Unlock()
+	}
+	return planAttempt{entry: entry, n: 1}
+}
+
+// requeued pops an entry requeued on the lane when it is due: at the end of a plan cycle, or
+// once the plan is exhausted in a job running until plan completion. idx is the next plan index.
+func (l *planLane) requeued(idx int64) (planAttempt, bool) {
+	entries := int64(len(l.entries))
+	exhausted := job != nil && job.untilPlanComplete && idx >= entries
+	if !exhausted && idx%entries != 0 {
+		return planAttempt{}, false
+	}
+	l.retries.mu.Lock()
+	defer l.retries.mu.Unlock()
+	if len(l.retries.queue) == 0 {
+		return planAttempt{}, false
+	}
+	a := l.retries.queue[0]
+	l.retries.queue = l.retries.queue[1:]
+	return a, true
+}
+
+// unsettled reports whether the lane has entries waiting for their final outcome
+func (l *planLane) unsettled() bool {
+	l.retries.mu.Lock()
+	defer l.retries.mu.Unlock()
+	return l.retries.unsettled > 0
+}
+
+// settle records the outcome of a plan entry's request. It returns the attempt the worker sends
+// next with the retry policy; with the requeue policy the entry goes back to the lane's queue.
+func (p *planFailurePolicy) settle(queryName string, lane *planLane, a planAttempt, failed bool) *planAttempt {
+	if p == nil || a.n == 0 {
+		return nil
+	}
+	if !failed {
+		if a.n > 1 {
+			p.outcomes.WithLabelValues(queryName, "recovered").Inc()
+		}
+		p.done(queryName, lane)
+		return nil
+	}
+	switch {
+	case p.policy == planFailureSkip:
+		p.outcomes.WithLabelValues(queryName, "skipped").Inc()
+		return nil
+	case a.n >= p.maxAttempts:
+		p.outcomes.WithLabelValues(queryName, "abandoned").Inc()
+		log.Printf("Warning: Query %s: plan entry [%s] abandoned after %d failed attempts", queryName, a.entry.BucketName, a.n)
+		p.done(queryName, lane)
+		return nil
+	case p.policy == planFailureRetry:
+		p.outcomes.WithLabelValues(queryName, "retried").Inc()
+		return &planAttempt{entry: a.entry, n: a.n + 1}
+	default:
+		p.outcomes.WithLabelValues(queryName, "requeued").Inc()
+		lane.retries.mu.Lock()
+		lane.retries.queue = append(lane.retries.queue, planAttempt{entry: a.entry, n: a.n + 1})
+		lane.retries.mu.Unlock()
+		return nil
+	}
+}
+
+// drop settles an entry that was never sent (circuit breaker open, budget used, invalid
+// request), without retrying it
+func (p *planFailurePolicy) drop(queryName string, lane *planLane, a planAttempt) {
+	if p == nil || a.n == 0 {
+		return
+	}
+	p.done(queryName, lane)
+}
+
+// done marks an entry's outcome final; a lane exhausted while entries were unsettled completes
+// with its last one
+func (p *planFailurePolicy) done(queryName string, lane *planLane) {
+	if !p.tracks() {
+		return
+	}
+	lane.retries.mu.Lock()
+	lane.retries.unsettled--
+	last := lane.retries.unsettled == 0 && len(lane.retries.queue) == 0
+	lane.retries.mu.Unlock()
+	if last {
+		lane.complete(queryName)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testPlanFailurePolicy returns a policy with an unregistered outcome counter
+func testPlanFailurePolicy(policy string, maxAttempts int) *planFailurePolicy {
+	return &planFailurePolicy{
+		policy:      policy,
+		maxAttempts: maxAttempts,
+		outcomes:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"name", "outcome"}),
+	}
+}
+
+func TestPlanFailureConfigCheck(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   PlanFailureConfig
+		valid bool
+	}{
+		{PlanFailureConfig{}, true},
+		{PlanFailureConfig{Policy: planFailureSkip}, true},
+		{PlanFailureConfig{Policy: planFailureRetry, MaxAttempts: 5}, true},
+		{PlanFailureConfig{Policy: planFailureRequeue}, true},
+		{PlanFailureConfig{Policy: "drop"}, false},
+		{PlanFailureConfig{MaxAttempts: -1}, false},
+	} {
+		if err := tc.cfg.check(); (err == nil) != tc.valid {
+			t.Errorf("check(%+v) = %v, want valid: %v", tc.cfg, err, tc.valid)
+		}
+	}
+}
+
+func TestPlanFailurePolicySettle(t *testing.T) {
+	entry := PlanEntry{QueryName: "q", BucketName: "recent"}
+	for _, tc := range []struct {
+		name      string
+		policy    string
+		attempt   int // 0 for a window not taken from the plan
+		failed    bool
+		next      int // attempt the worker sends next, 0 for none
+		requeued  int // attempt requeued on the lane, 0 for none
+		outcome   string
+		unsettled int // entries of the lane still unsettled after settle
+	}{
+		{"success", planFailureRetry, 1, false, 0, 0, "", 0},
+		{"recovered", planFailureRetry, 2, false, 0, 0, "recovered", 0},
+		{"recovered after requeue", planFailureRequeue, 3, false, 0, 0, "recovered", 0},
+		{"skipped", planFailureSkip, 1, true, 0, 0, "skipped", 0},
+		{"retried", planFailureRetry, 1, true, 2, 0, "retried", 1},
+		{"retried again", planFailureRetry, 2, true, 3, 0, "retried", 1},
+		{"retry abandoned", planFailureRetry, 3, true, 0, 0, "abandoned", 0},
+		{"requeued", planFailureRequeue, 1, true, 0, 2, "requeued", 1},
+		{"requeue abandoned", planFailureRequeue, 3, true, 0, 0, "abandoned", 0},
+		{"not from the plan", planFailureRetry, 0, true, 0, 0, "", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := testPlanFailurePolicy(tc.policy, 3)
+			lane := &planLane{entries: []PlanEntry{entry}}
+			if p.take(lane, entry).n != 1 {
+				t.Fatalf("take did not start at attempt 1")
+			}
+
+			next := p.settle("q", lane, planAttempt{entry: entry, n: tc.attempt}, tc.failed)
+
+			switch {
+			case tc.next == 0 && next != nil:
+				t.Errorf("settle = attempt %d, want none", next.n)
+			case tc.next != 0 && (next == nil || next.n != tc.next || next.entry != entry):
+				t.Errorf("settle = %+v, want attempt %d of the entry", next, tc.next)
+			}
+			if tc.requeued == 0 && len(lane.retries.queue) != 0 {
+				t.Errorf("queue = %+v, want empty", lane.retries.queue)
+			}
+			if tc.requeued != 0 {
+				if len(lane.retries.queue) != 1 || lane.retries.queue[0].n != tc.requeued {
+					t.Errorf("queue = %+v, want attempt %d", lane.retries.queue, tc.requeued)
+				}
+			}
+			if tc.policy != planFailureSkip && lane.retries.unsettled != tc.unsettled {
+				t.Errorf("unsettled = %d, want %d", lane.retries.unsettled, tc.unsettled)
+			}
+			for _, outcome := range []string{"skipped", "retried", "requeued", "recovered", "abandoned"} {
+				want := 0.0
+				if outcome == tc.outcome {
+					want = 1
+				}
+				if got := testutil.ToFloat64(p.outcomes.WithLabelValues("q", outcome)); got != want {
+					t.Errorf("%s outcomes = %v, want %v", outcome, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanFailurePolicyRequeued(t *testing.T) {
+	p := testPlanFailurePolicy(planFailureRequeue, 3)
+	entries := []PlanEntry{{QueryName: "q", BucketName: "a"}, {QueryName: "q", BucketName: "b"}}
+	lane := &planLane{entries: entries}
+	p.settle("q", lane, p.take(lane, entries[1]), true)
+
+	if _, ok := lane.requeued(1); ok {
+		t.Errorf("requeued entry due in the middle of a plan cycle")
+	}
+	a, ok := lane.requeued(2)
+	if !ok || a.entry != entries[1] || a.n != 2 {
+		t.Fatalf("requeued(2) = %+v, %v, want attempt 2 of entry b at the end of the cycle", a, ok)
+	}
+	if _, ok := lane.requeued(4); ok {
+		t.Errorf("requeued entry handed out twice")
+	}
+	if !lane.unsettled() {
+		t.Errorf("entry settled before its requeued attempt finished")
+	}
+	p.settle("q", lane, a, false)
+	if lane.unsettled() {
+		t.Errorf("entry unsettled after its requeued attempt succeeded")
+	}
+}
+
+func TestPlanFailurePolicyNil(t *testing.T) {
+	var p *planFailurePolicy
+	lane := &planLane{entries: []PlanEntry{{QueryName: "q"}}}
+	a := p.take(lane, lane.entries[0])
+	if next := p.settle("q", lane, a, true); next != nil {
+		t.Errorf("nil policy settle = %+v, want nil", next)
+	}
+	p.drop("q", lane, a)
+	if lane.unsettled() {
+		t.Errorf("nil policy tracks entries")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed presets/*.yaml
+var presetFiles embed.FS
+
+var presetFlag = flag.String("preset", "", "Built-in profile (smoke, soak or stress) the config file is merged over; implies --mode=job unless --mode is set")
+
+// presetNames returns the names of the built-in presets
+func presetNames() []string {
+	entries, _ := presetFiles.ReadDir("presets")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadPresetConfig merges the config file over a built-in preset. The preset provides queries,
+// buckets, plan, QPS and job SLOs, so the config file only needs the endpoint and tenant.
+func loadPresetConfig(name, configPath string) (*Config, error) {
+	data, err := presetFiles.ReadFile("presets/" + name + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse preset %s: %w", name, err)
+	}
+
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("preset %s needs a config file with at least tempo.queryEndpoint and tenantId: %w", name, err)
+	}
+	overrides, err := loadConfigTree(configPath, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	tree, err = mergeCatalog(mergeConfigMaps(tree, overrides))
+	if err != nil {
+		return nil, err
+	}
+	config, err := decodeConfigTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	return config, applyDerivedBuckets(config)
+}
+
+// modeFlagSet reports whether --mode was given on the command line
+func modeFlagSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "mode" {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errTraceNotFound is returned when Tempo does not know a trace ID
+var errTraceNotFound = errors.New("trace not found")
+
+// probeClient sends the searches and trace lookups of the probes, outside of the load
+type probeClient struct {
+	client     *http.Client
+	target     string
+	endpoint   string
+	tenant     string
+	timeFormat string
+}
+
+func newProbeClient(transport http.RoundTripper, timeout time.Duration, target, endpoint, tenant, timeFormat string) *probeClient {
+	return &probeClient{
+		client:     &http.Client{Transport: transport, Timeout: timeout},
+		target:     target,
+		endpoint:   endpoint,
+		tenant:     tenant,
+		timeFormat: timeFormat,
+	}
+}
+
+// get sends an authenticated GET request and returns the response of a successful one
+func (c *probeClient) get(rawURL string, params map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.tenant != "" && sendsOrgID(c.target) {
+		req.Header.Set("X-Scope-OrgID", c.tenant)
+	}
+	if len(params) > 0 {
+		query := req.URL.Query()
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	auth.apply(c.tenant, req)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, errTraceNotFound
+	}
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, redaction.body(body))
+	}
+	return res, nil
+}
+
+// search runs a TraceQL search over [start, end]
+func (c *probeClient) search(traceql string, start, end time.Time, limit int) (*TempoSearchResponse, error) {
+	res, err := c.get(searchURL(c.target, c.endpoint, c.tenant), map[string]string{
+		"q":     traceql,
+		"start": formatTimeParam(start, c.timeFormat),
+		"end":   formatTimeParam(end, c.timeFormat),
+		"limit": strconv.Itoa(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var resp TempoSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+	return &resp, nil
+}
+
+// traceSpans retrieves a trace by ID and returns its number of spans; errTraceNotFound when
+// Tempo does not have it
+func (c *probeClient) traceSpans(traceID string) (int, error) {
+	res, err := c.get(traceByIDURL(c.target, c.endpoint, c.tenant, traceID), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	var trace otlpTrace
+	if err := json.NewDecoder(res.Body).Decode(&trace); err != nil {
+		return 0, fmt.Errorf("failed to decode trace: %w", err)
+	}
+	spans := trace.spanCount()
+	if spans == 0 {
+		return 0, errTraceNotFound
+	}
+	return spans, nil
+}
+
+// otlpTrace is a trace-by-ID response: OTLP JSON resource spans under "batches" (v1 API) or
+// "trace.resourceSpans" (v2 API), with scope spans under either of their OTLP names
+type otlpTrace struct {
+	Batches []otlpResourceSpans `json:"batches"`
+	Trace   struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	} `json:"trace"`
+}
+
+type otlpResourceSpans struct {
+	ScopeSpans                  []otlpScopeSpans `json:"scopeSpans"`
+	InstrumentationLibrarySpans []otlpScopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type otlpScopeSpans struct {
+	Spans []struct {
+		SpanID string `json:"spanId"`
+	} `json:"spans"`
+}
+
+// spanCount returns the number of spans of the trace
+func (t *otlpTrace) spanCount() int {
+	n := 0
+	for _, rs := range append(t.Batches, t.Trace.ResourceSpans...) {
+		for _, ss := range append(rs.ScopeSpans, rs.InstrumentationLibrarySpans...) {
+			n += len(ss.Spans)
+		}
+	}
+	return n
+}
+
+// traceEnd returns when a search result's trace ended, or the zero time when its start is unknown
+func traceEnd(startTimeUnixNano string, durationMs int64) time.Time {
+	startNano, err := strconv.ParseInt(startTimeUnixNano, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, startNano).Add(time.Duration(durationMs) * time.Millisecond)
+}
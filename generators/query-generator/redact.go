@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces redacted header, parameter and body values
+const redactedValue = "[REDACTED]"
+
+// gatewayTenantPrefix precedes the tenant in gateway search paths
+const gatewayTenantPrefix = "/api/traces/v1/"
+
+// defaultDeniedHeaders are always redacted, whatever the allowlist says
+var defaultDeniedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RedactionConfig controls what is hidden from logs, request samples and failure captures
+type RedactionConfig struct {
+	AllowHeaders []string `yaml:"allowHeaders"` // Headers shown as-is; every other header is redacted (default: all but the denied ones)
+	DenyHeaders  []string `yaml:"denyHeaders"`  // Headers redacted in addition to Authorization, cookies and API key headers
+	QueryParams  []string `yaml:"queryParams"`  // URL query parameters whose values are redacted (e.g. q to hide TraceQL)
+	BodyFields   []string `yaml:"bodyFields"`   // JSONPath of response body fields to scrub, e.g. $.traces[*].rootServiceName or $..value
+	Tenants      bool     `yaml:"tenants"`      // Replace tenant IDs with a stable hash in headers, URLs, logs and samples
+}
+
+// redaction is the policy applied before requests, responses and samples leave the process;
+// it is replaced at startup by the configured one
+var redaction = &redactor{deny: headerSet(defaultDeniedHeaders)}
+
+// redactor applies a redaction policy
+type redactor struct {
+	allow   map[string]bool // nil when every header not denied is shown
+	deny    map[string]bool
+	params  map[string]bool
+	fields  [][]pathSegment
+	tenants bool
+}
+
+// newRedactor validates the redaction config; extraDenied are headers carrying credentials
+func newRedactor(cfg RedactionConfig, extraDenied ...string) (*redactor, error) {
+	r := &redactor{
+		deny:    headerSet(append(append(append([]string{}, defaultDeniedHeaders...), cfg.DenyHeaders...), extraDenied...)),
+		params:  map[string]bool{},
+		tenants: cfg.Tenants,
+	}
+	if len(cfg.AllowHeaders) > 0 {
+		r.allow = headerSet(cfg.AllowHeaders)
+	}
+	for _, p := range cfg.QueryParams {
+		r.params[p] = true
+	}
+	for _, expr := range cfg.BodyFields {
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("bodyFields: %w", err)
+		}
+		r.fields = append(r.fields, path)
+	}
+	return r, nil
+}
+
+// headerSet returns the canonical names of the given headers
+func headerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name != "" {
+			set[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return set
+}
+
+// tenant returns the tenant ID, or a stable hash of it when tenants are redacted
+func (r *redactor) tenant(id string) string {
+	if !r.tenants || id == "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "tenant-" + hex.EncodeToString(sum[:4])
+}
+
+// header returns the value of a header as it may be shown
+func (r *redactor) header(name, value string) string {
+	name = http.CanonicalHeaderKey(name)
+	switch {
+	case r.deny[name]:
+		// Keep the scheme so logs still tell which kind of credentials were sent
+		if i := strings.IndexByte(value, ' '); i > 0 && name == "Authorization" {
+			return value[:i] + " " + redactedValue
+		}
+		return redactedValue
+	case name == "X-Scope-Orgid" && r.tenants:
+		return r.tenant(value)
+	case r.allow != nil && !r.allow[name]:
+		return redactedValue
+	default:
+		return value
+	}
+}
+
+// url returns a request URL with the tenant path segment and denied parameters redacted
+func (r *redactor) url(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if !r.tenants && len(r.params) == 0 {
+		return u.String()
+	}
+	redacted := *u
+	if r.tenants && strings.HasPrefix(u.Path, gatewayTenantPrefix) {
+		rest := strings.TrimPrefix(u.Path, gatewayTenantPrefix)
+		tenant, tail := rest, ""
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			tenant, tail = rest[:i], rest[i:]
+		}
+		redacted.Path = gatewayTenantPrefix + r.tenant(tenant) + tail
+		redacted.RawPath = ""
+	}
+	if len(r.params) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if r.params[name] {
+				query[name] = []string{redactedValue}
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// error returns the text of a request error with the URL it quotes redacted
+func (r *redactor) error(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+			return (&url.Error{Op: urlErr.Op, URL: r.url(u), Err: urlErr.Err}).Error()
+		}
+	}
+	return err.Error()
+}
+
+// request formats the full HTTP request details for logging
+func (r *redactor) request(req *http.Request) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("Method: %s\n", req.Method))
+	buf.WriteString(fmt.Sprintf("URL: %s\n", r.url(req.URL)))
+	buf.WriteString("Headers:\n")
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			buf.WriteString(fmt.Sprintf("  %s: %s\n", key, r.header(key, value)))
+		}
+	}
+	return buf.String()
+}
+
+// body scrubs the configured fields from a JSON response body; other bodies are returned as-is
+func (r *redactor) body(data []byte) []byte {
+	if len(r.fields) == 0 {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return data
+	}
+	for _, path := range r.fields {
+		doc = scrubJSONPath(doc, path)
+	}
+	scrubbed, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return scrubbed
+}
+
+// sample returns a copy of a request sample with the tenant redacted, for sample outputs
+func (r *redactor) sample(s *requestSample) *requestSample {
+	if !r.tenants {
+		return s
+	}
+	redacted := *s
+	redacted.Tenant = r.tenant(s.Tenant)
+	return &redacted
+}
+
+// pathSegment is one step of a JSONPath expression
+type pathSegment struct {
+	name      string // object member; empty for wildcards and indexes
+	index     int    // array index, -1 when unused
+	wildcard  bool   // every member or element
+	recursive bool   // matched at any depth (..)
+}
+
+// parseJSONPath parses the supported JSONPath subset: $, .name, ..name, .*, [*], [N] and ['name']
+func parseJSONPath(expr string) ([]pathSegment, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("%q must start with $", expr)
+	}
+	var path []pathSegment
+	rest := expr[1:]
+	for rest != "" {
+		seg := pathSegment{index: -1}
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%q: unclosed [", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				seg.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				seg.name = inner[1 : len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%q: invalid index [%s]", expr, inner)
+				}
+				seg.index = n
+			}
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				seg.recursive = true
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch {
+			case name == "*":
+				seg.wildcard = true
+			case name != "":
+				seg.name = name
+			default:
+				return nil, fmt.Errorf("%q: empty member name", expr)
+			}
+		default:
+			return nil, fmt.Errorf("%q: unexpected %q", expr, rest)
+		}
+		path = append(path, seg)
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%q selects the whole document", expr)
+	}
+	return path, nil
+}
+
+// scrubJSONPath replaces the values selected by path in a decoded JSON document
+func scrubJSONPath(node interface{}, path []pathSegment) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	seg := path[0]
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if seg.wildcard || (seg.name != "" && key == seg.name) {
+				v[key] = scrubJSONPath(child, path[1:])
+			} else if seg.recursive {
+				v[key] = scrubJSONPath(child, path)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if seg.wildcard || seg.index == i {
+				v[i] = scrubJSONPath(child, path[1:])
+			} else if seg.recursive {
+				v[i] = scrubJSONPath(child, path)
+			}
+		}
+	}
+	return node
+}
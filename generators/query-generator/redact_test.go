@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want []pathSegment
+	}{
+		{"$.traces", []pathSegment{{name: "traces", index: -1}}},
+		{"$.traces[*].rootServiceName", []pathSegment{{name: "traces", index: -1}, {index: -1, wildcard: true}, {name: "rootServiceName", index: -1}}},
+		{"$..value", []pathSegment{{name: "value", index: -1, recursive: true}}},
+		{"$.a.*", []pathSegment{{name: "a", index: -1}, {index: -1, wildcard: true}}},
+		{"$.a[2]", []pathSegment{{name: "a", index: -1}, {index: 2}}},
+		{"$['span.name']", []pathSegment{{name: "span.name", index: -1}}},
+		{`$["x"].y`, []pathSegment{{name: "x", index: -1}, {name: "y", index: -1}}},
+	} {
+		got, err := parseJSONPath(tc.expr)
+		if err != nil {
+			t.Errorf("parseJSONPath(%s) = %v", tc.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseJSONPath(%s) = %+v, want %+v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseJSONPathInvalid(t *testing.T) {
+	for _, expr := range []string{"", "traces", "$", "$.", "$.a..", "$[", "$[-1]", "$[x]", "$x"} {
+		if path, err := parseJSONPath(expr); err == nil {
+			t.Errorf("parseJSONPath(%q) = %+v, want an error", expr, path)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fields []string
+		in     string
+		want   string
+	}{
+		{
+			"member",
+			[]string{"$.metrics.inspectedBytes"},
+			`{"metrics": {"inspectedBytes": "123", "totalBlocks": 2}}`,
+			`{"metrics": {"inspectedBytes": "[REDACTED]", "totalBlocks": 2}}`,
+		},
+		{
+			"wildcard index",
+			[]string{"$.traces[*].rootServiceName"},
+			`{"traces": [{"traceID": "a", "rootServiceName": "x"}, {"traceID": "b", "rootServiceName": "y"}]}`,
+			`{"traces": [{"traceID": "a", "rootServiceName": "[REDACTED]"}, {"traceID": "b", "rootServiceName": "[REDACTED]"}]}`,
+		},
+		{
+			"array index",
+			[]string{"$.traces[1].traceID"},
+			`{"traces": [{"traceID": "a"}, {"traceID": "b"}]}`,
+			`{"traces": [{"traceID": "a"}, {"traceID": "[REDACTED]"}]}`,
+		},
+		{
+			"recursive",
+			[]string{"$..value"},
+			`{"value": 1, "attributes": [{"key": "k", "value": {"stringValue": "s"}}], "nested": {"deeper": {"value": true}}}`,
+			`{"value": "[REDACTED]", "attributes": [{"key": "k", "value": "[REDACTED]"}], "nested": {"deeper": {"value": "[REDACTED]"}}}`,
+		},
+		{
+			"member wildcard",
+			[]string{"$.metrics.*"},
+			`{"metrics": {"a": 1, "b": [2]}, "other": 3}`,
+			`{"metrics": {"a": "[REDACTED]", "b": "[REDACTED]"}, "other": 3}`,
+		},
+		{
+			"quoted member",
+			[]string{"$['span.name']"},
+			`{"span.name": "GET", "span": {"name": "kept"}}`,
+			`{"span.name": "[REDACTED]", "span": {"name": "kept"}}`,
+		},
+		{
+			"several fields",
+			[]string{"$.a", "$.b"},
+			`{"a": 1, "b": 2, "c": 3}`,
+			`{"a": "[REDACTED]", "b": "[REDACTED]", "c": 3}`,
+		},
+		{
+			"no match",
+			[]string{"$.missing.deeper", "$.a[5]", "$.a.b"},
+			`{"a": [1, 2], "n": 12345678901234567890}`,
+			`{"a": [1, 2], "n": 12345678901234567890}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRedactor(RedactionConfig{BodyFields: tc.fields})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(r.body([]byte(tc.in)), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s, want %s", r.body([]byte(tc.in)), tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactBodyNotJSON(t *testing.T) {
+	r, err := newRedactor(RedactionConfig{BodyFields: []string{"$.a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"", "not json", "<html></html>"} {
+		if got := string(r.body([]byte(body))); got != body {
+			t.Errorf("body(%q) = %q, want it unchanged", body, got)
+		}
+	}
+}
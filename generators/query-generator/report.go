@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReportConfig configures the reports written at the end of the run
+type ReportConfig struct {
+	HTML       string `yaml:"html"`       // Path of the self-contained HTML report (empty = disabled)
+	Resolution string `yaml:"resolution"` // Initial time resolution of report time series (default: 10s)
+
+	// Markdown summary for CI PR comments
+	Markdown  string  `yaml:"markdown"`  // Path of the GitHub-flavored Markdown summary (empty = disabled)
+	JSON      string  `yaml:"json"`      // Path of the machine-readable summary, usable as a later baseline
+	Baseline  string  `yaml:"baseline"`  // JSON summary of a previous run to compare against
+	Tolerance float64 `yaml:"tolerance"` // Allowed relative regression of p99 and QPS vs baseline (default: 0.1)
+	Cluster   string  `yaml:"cluster"`   // Cluster the summary is labeled with, for federated reports (default: CLUSTER_NAME)
+}
+
+// cluster returns the cluster label of the summary (empty when unknown)
+func (c ReportConfig) cluster() string {
+	if c.Cluster != "" {
+		return c.Cluster
+	}
+	return os.Getenv("CLUSTER_NAME")
+}
+
+// enabled reports whether any end-of-run report is configured
+func (c ReportConfig) enabled() bool {
+	return c.HTML != "" || c.Markdown != "" || c.JSON != ""
+}
+
+// runReport holds everything needed to render the end-of-run reports
+type runReport struct {
+	Namespace   string
+	Pod         string
+	Node        string
+	Start       time.Time
+	End         time.Time
+	Duration    time.Duration
+	TargetQPS   float64 // per query, 0 = unlimited
+	Queries     []queryStatsSnapshot
+	Stages      []stageResult       // Concurrency stair-step stages (empty when the experiment is disabled)
+	Load        *littlesLawCheck    // Little's-law check of the whole run (nil when not sampled)
+	Tenants     []tenantComparison  // Queries that ran against several tenants
+	Calibration []calibrationResult // Baselines measured before the load (empty when disabled)
+	Pauses      []pauseResult       // Scheduled pause windows with the results around them
+	// Latency histogram buckets recommended from the observed latencies (empty when disabled)
+	LatencyBuckets []bucketRecommendation
+	// Tempo CPU attributed to each query, and the CPU used while no query ran (empty when disabled)
+	Costs           []queryCost
+	UnattributedCPU float64
+}
+
+// newRunReport builds a report from the run statistics
+func newRunReport(stats *runStats, namespace string, targetQPS float64) *runReport {
+	queries, duration := stats.snapshot()
+	end := stats.start.Add(duration)
+
+	var total seriesPoint
+	for i := range queries {
+		total.merge(&queries[i].total)
+	}
+	queryCosts, unattributedCPU := costs.results()
+	return &runReport{
+		Namespace: namespace,
+		Pod:       identity.Pod,
+		Node:      identity.Node,
+		TargetQPS: targetQPS,
+		Start:     stats.start,
+		End:       end,
+		Duration:  duration,
+		Queries:   queries,
+		Stages:    stairStep.results(end, loadSamples.total()),
+		Load:      loadSamples.check(total.qps(duration), total.latency.mean()),
+		Tenants:   compareTenants(queries),
+
+		Calibration: calibration,
+		Pauses:      pauses.results(end),
+
+		LatencyBuckets:  latencyBuckets.recommendations(),
+		Costs:           queryCosts,
+		UnattributedCPU: unattributedCPU,
+	}
+}
+
+// htmlReportQuery is the per-query data of the HTML report template
+type htmlReportQuery struct {
+	Name      string
+	Requests  int64
+	QPS       float64
+	ErrorRate float64
+	P50       float64
+	P90       float64
+	P99       float64
+	AvgSpans  float64
+	Charts    []template.HTML
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"formatBuckets": formatBuckets}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Query load report - {{.Namespace}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f0f0f0; }
+.charts { display: flex; flex-wrap: wrap; gap: 8px; }
+svg { border: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1>Query load report</h1>
+<p>Namespace: <b>{{.Namespace}}</b><br>
+{{if .Pod}}Pod: {{.Pod}}<br>
+{{end}}{{if .Node}}Node: {{.Node}}<br>
+{{end}}
+Start: {{.Start}}<br>
+End: {{.End}}<br>
+Duration: {{.Duration}}</p>
+{{with .Load}}<h2>Little's law</h2>
+<p>Outstanding requests observed: <b>{{printf "%.2f" .ObservedInFlight}}</b>, implied by throughput x latency: <b>{{printf "%.2f" .ImpliedInFlight}}</b>
+(workers: {{printf "%.1f" .Workers}}, QPS: {{printf "%.2f" .AchievedQPS}} of {{printf "%.2f" .TargetQPS}})<br>
+Verdict: <b>{{.Verdict}}</b></p>
+{{end}}<h2>Summary</h2>
+<table>
+<tr><th>Query</th><th>Requests</th><th>QPS</th><th>Error rate</th><th>p50 (s)</th><th>p90 (s)</th><th>p99 (s)</th><th>Avg spans</th></tr>
+{{range .Queries}}<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Requests}}</td><td>{{printf "%.2f" .QPS}}</td><td>{{printf "%.2f%%" .ErrorRate}}</td><td>{{printf "%.3f" .P50}}</td><td>{{printf "%.3f" .P90}}</td><td>{{printf "%.3f" .P99}}</td><td>{{printf "%.1f" .AvgSpans}}</td></tr>
+{{end}}</table>
+{{if .Stages}}<h2>Concurrency stair-step</h2>
+<table>
+<tr><th>Workers per query</th><th>Duration</th><th>Requests</th><th>QPS</th><th>Error rate</th><th>p50 (s)</th><th>p99 (s)</th><th>Mean (s)</th><th>In flight (observed)</th><th>In flight (QPS x mean)</th><th>Little's law</th></tr>
+{{range .Stages}}<tr><td>{{.Concurrency}}</td><td>{{.Duration}}</td><td>{{.Requests}}</td><td>{{printf "%.2f" .QPS}}</td><td>{{printf "%.2f%%" .ErrorRate}}</td><td>{{printf "%.3f" .P50}}</td><td>{{printf "%.3f" .P99}}</td><td>{{printf "%.3f" .Mean}}</td><td>{{printf "%.2f" .Little.ObservedInFlight}}</td><td>{{printf "%.2f" .Little.ImpliedInFlight}}</td><td style="text-align: left">{{.Little.Verdict}}</td></tr>
+{{end}}</table>
+<div class="charts">{{range .StageCharts}}{{.}}{{end}}</div>
+{{end}}{{if .Tenants}}<h2>Tenant comparison</h2>
+<table>
+<tr><th>Query</th><th>Tenant</th><th>Requests</th><th>Error rate</th><th>p50 (s)</th><th>p99 (s)</th><th>Avg spans</th></tr>
+{{range .Tenants}}{{$query := .Query}}{{range .Tenants}}<tr><td>{{$query}}</td><td>{{.Tenant}}</td><td>{{.Requests}}</td><td>{{printf "%.2f%%" .ErrorRatePct}}</td><td>{{printf "%.3f" .P50Seconds}}</td><td>{{printf "%.3f" .P99Seconds}}</td><td>{{printf "%.1f" .AvgSpans}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}{{if .Calibration}}<h2>Calibration</h2>
+<table>
+<tr><th>Query</th><th>Bucket</th><th>Spans</th><th>Traces</th><th>Latency (s)</th></tr>
+{{range .Calibration}}<tr><td>{{.Query}}</td><td>{{.Bucket}}</td>{{if .Error}}<td colspan="3">failed: {{.Error}}</td>{{else}}<td>{{.Spans}}</td><td>{{.Traces}}</td><td>{{printf "%.3f" .LatencySeconds}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{if .Pauses}}<h2>Pause windows</h2>
+<table>
+<tr><th>Window</th><th>Start</th><th>End</th><th>Before: requests</th><th>Before: error rate</th><th>Before: mean (s)</th><th>After: requests</th><th>After: error rate</th><th>After: mean (s)</th><th>First response (s)</th></tr>
+{{range .Pauses}}<tr><td>{{.Window}}</td><td>{{.Start.Format "15:04:05"}}</td><td>{{.End.Format "15:04:05"}}</td><td>{{.Before.Requests}}</td><td>{{printf "%.2f%%" .Before.ErrorRatePct}}</td><td>{{printf "%.3f" .Before.MeanSeconds}}</td><td>{{.After.Requests}}</td><td>{{printf "%.2f%%" .After.ErrorRatePct}}</td><td>{{printf "%.3f" .After.MeanSeconds}}</td><td>{{printf "%.3f" .FirstResponseSeconds}}</td></tr>
+{{end}}</table>
+{{end}}{{if .LatencyBuckets}}<h2>Recommended latency buckets</h2>
+<table>
+<tr><th>Query</th><th>Requests</th><th style="text-align: left">Buckets (s)</th></tr>
+{{range .LatencyBuckets}}<tr><td>{{.Query}}</td><td>{{.Requests}}</td><td style="text-align: left"><code>{{formatBuckets .Buckets}}</code></td></tr>
+{{end}}</table>
+{{end}}{{if .Costs}}<h2>Estimated cost per query</h2>
+<table>
+<tr><th>Query</th><th>Requests</th><th>Inspected bytes</th><th>CPU (s)</th><th>CPU per request (s)</th><th>Share</th></tr>
+{{range .Costs}}<tr><td>{{.Query}}</td><td>{{.Requests}}</td><td>{{.InspectedBytes}}</td><td>{{printf "%.1f" .CPUSeconds}}</td><td>{{printf "%.4f" .CPUSecondsPerRequest}}</td><td>{{printf "%.1f%%" .SharePct}}</td></tr>
+{{end}}</table>
+{{end}}{{range .Queries}}<h2 id="{{.Name}}">{{.Name}}</h2>
+<div class="charts">{{range .Charts}}{{.}}{{end}}</div>
+{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLReport renders the report as a single HTML file with inline SVG charts
+func writeHTMLReport(path string, report *runReport, loc *time.Location) error {
+	data := struct {
+		Namespace   string
+		Pod         string
+		Node        string
+		Start       string
+		End         string
+		Duration    time.Duration
+		Queries     []htmlReportQuery
+		Stages      []stageResult
+		StageCharts []template.HTML
+		Load        *littlesLawCheck
+		Tenants     []tenantComparison
+		Calibration []calibrationResult
+		Pauses      []pauseResult
+
+		LatencyBuckets []bucketRecommendation
+		Costs          []queryCost
+	}{
+		Namespace: report.Namespace,
+		Pod:       report.Pod,
+		Node:      report.Node,
+		Start:     formatZoned(report.Start, loc),
+		End:       formatZoned(report.End, loc),
+		Duration:  report.Duration.Round(time.Second),
+		Load:      report.Load,
+		Tenants:   report.Tenants,
+
+		Calibration: report.Calibration,
+		Pauses:      report.Pauses,
+
+		LatencyBuckets: report.LatencyBuckets,
+		Costs:          report.Costs,
+	}
+
+	if len(report.Stages) > 0 {
+		for _, stage := range report.Stages {
+			stage.Duration = stage.Duration.Round(time.Second)
+			data.Stages = append(data.Stages, stage)
+		}
+		n := len(report.Stages)
+		xs, qps, p50, p99 := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+		for i, stage := range report.Stages {
+			xs[i] = float64(stage.Concurrency)
+			qps[i] = stage.QPS
+			p50[i] = stage.P50
+			p99[i] = stage.P99
+		}
+		workers := func(v float64) string { return fmt.Sprintf("%.0f workers", v) }
+		data.StageCharts = []template.HTML{
+			svgChart("Throughput (QPS) by workers per query", xs, []chartSeries{{"qps", "#2ca02c", qps}}, workers),
+			svgChart("Latency (s) by workers per query", xs, []chartSeries{{"p50", "#1f77b4", p50}, {"p99", "#d62728", p99}}, workers),
+		}
+	}
+
+	for _, q := range report.Queries {
+		hq := htmlReportQuery{
+			Name:      q.name,
+			Requests:  q.total.count,
+			QPS:       q.total.qps(report.Duration),
+			ErrorRate: q.total.errorRate() * 100,
+			P50:       q.total.latency.quantile(0.5),
+			P90:       q.total.latency.quantile(0.9),
+			P99:       q.total.latency.quantile(0.99),
+			AvgSpans:  q.total.avgSpans(),
+		}
+
+		n := len(q.series)
+		xs := make([]float64, n)
+		p50, p99, qps, errRate, spans := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+		for i := range q.series {
+			p := &q.series[i]
+			xs[i] = (time.Duration(i) * q.width).Seconds()
+			p50[i] = p.latency.quantile(0.5)
+			p99[i] = p.latency.quantile(0.99)
+			qps[i] = p.qps(q.width)
+			errRate[i] = p.errorRate() * 100
+			spans[i] = p.avgSpans()
+		}
+
+		hq.Charts = []template.HTML{
+			svgLineChart("Latency (s)", xs, []chartSeries{{"p50", "#1f77b4", p50}, {"p99", "#d62728", p99}}),
+			svgLineChart("QPS", xs, []chartSeries{{"qps", "#2ca02c", qps}}),
+			svgLineChart("Error rate (%)", xs, []chartSeries{{"errors", "#ff7f0e", errRate}}),
+			svgLineChart("Spans returned (avg)", xs, []chartSeries{{"spans", "#9467bd", spans}}),
+		}
+		data.Queries = append(data.Queries, hq)
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// chartSeries is a named line of a chart
+type chartSeries struct {
+	name   string
+	color  string
+	values []float64
+}
+
+// svgLineChart renders a small line chart with x values in seconds since the run start
+func svgLineChart(title string, xs []float64, series []chartSeries) template.HTML {
+	return svgChart(title, xs, series, func(x float64) string {
+		return time.Duration(x * float64(time.Second)).Round(time.Second).String()
+	})
+}
+
+// svgChart renders a small line chart; formatX labels the x axis
+func svgChart(title string, xs []float64, series []chartSeries, formatX func(float64) string) template.HTML {
+	const width, height, left, right, top, bottom = 420.0, 200.0, 50.0, 10.0, 24.0, 28.0
+	plotW, plotH := width-left-right, height-top-bottom
+
+	maxX, maxY := 1.0, 0.0
+	if len(xs) > 0 && xs[len(xs)-1] > 0 {
+		maxX = xs[len(xs)-1]
+	}
+	for _, s := range series {
+		for _, v := range s.values {
+			maxY = math.Max(maxY, v)
+		}
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-size="11">`, width, height)
+	fmt.Fprintf(&b, `<text x="%.0f" y="15" font-weight="bold">%s</text>`, left, template.HTMLEscapeString(title))
+	fmt.Fprintf(&b, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="#999"/>`, left, top+plotH, left+plotW, top+plotH)
+	fmt.Fprintf(&b, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="#999"/>`, left, top, left, top+plotH)
+	fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" text-anchor="end">%s</text>`, left-4, top+8, formatAxisValue(maxY))
+	fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" text-anchor="end">0</text>`, left-4, top+plotH)
+	fmt.Fprintf(&b, `<text x="%.0f" y="%.0f">%s</text>`, left, height-8, formatX(0))
+	fmt.Fprintf(&b, `<text x="%.0f" y="%.0f" text-anchor="end">%s</text>`, left+plotW, height-8, formatX(maxX))
+
+	for i, s := range series {
+		var points []string
+		for j, v := range s.values {
+			x := left + xs[j]/maxX*plotW
+			y := top + plotH - v/maxY*plotH
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, s.color, strings.Join(points, " "))
+		if len(series) > 1 {
+			fmt.Fprintf(&b, `<text x="%.0f" y="15" fill="%s">%s</text>`, width-right-40*float64(len(series)-i), s.color, template.HTMLEscapeString(s.name))
+		}
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// formatAxisValue formats an axis label compactly
+func formatAxisValue(v float64) string {
+	switch {
+	case v >= 100:
+		return fmt.Sprintf("%.0f", v)
+	case v >= 1:
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return fmt.Sprintf("%.3f", v)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// Multiwindow burn-rate alerts: a long window to be significant and a short one to reset quickly
+var burnRateAlerts = []struct {
+	severity    string
+	long, short time.Duration
+	burnRate    float64
+	for_        string
+}{
+	{"critical", time.Hour, 5 * time.Minute, 14.4, "2m"},
+	{"warning", 6 * time.Hour, 30 * time.Minute, 6, "15m"},
+}
+
+// promRuleGroup is a Prometheus rule group
+type promRuleGroup struct {
+	Name  string     `yaml:"name"`
+	Rules []promRule `yaml:"rules"`
+}
+
+// promRule is a Prometheus recording or alerting rule
+type promRule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// runRulesCommand implements the "rules" subcommand: it prints Prometheus recording and alerting
+// rules for the metric names and SLOs of a config, as a PrometheusRule or a plain rule file
+func runRulesCommand(args []string) error {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	configPath := fs.String("config", configPathFromEnv(), "config the rules are generated for")
+	namespace := fs.String("namespace", "", "namespace the generator runs with (default: config namespace)")
+	selector := fs.String("selector", "", `label matchers added to every series selector, e.g. namespace="tempo-perf-test"`)
+	format := fs.String("format", "prometheusrule", `"prometheusrule" (monitoring.coreos.com/v1) or "file" (Prometheus rule file)`)
+	out := fs.String("out", "-", "output file (- = stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "prometheusrule" && *format != "file" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *namespace == "" {
+		*namespace = config.Namespace
+	}
+	if *namespace == "" {
+		*namespace = defaultNamespace
+		log.Printf("Namespace not set, generating rules for: %s", *namespace)
+	}
+
+	groups, err := generateRules(config, *namespace, *selector)
+	if err != nil {
+		return err
+	}
+	var doc interface{} = map[string]interface{}{"groups": groups}
+	if *format == "prometheusrule" {
+		doc = map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "PrometheusRule",
+			"metadata": map[string]interface{}{
+				"name":   "query-load-generator-" + *namespace,
+				"labels": map[string]string{"app": "query-load-generator"},
+			},
+			"spec": doc,
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// generateRules builds the rule groups of the generator metrics of a namespace: error-budget and
+// latency burn rates per query with multiwindow alerts, bucket SLO alerts and a stalled-generator alert
+func generateRules(config *Config, namespace, selector string) ([]promRuleGroup, error) {
+	burn, err := newBurnRateSettings(config.Query.BurnRate)
+	if err != nil {
+		return nil, err
+	}
+	sanitizedNs := strings.ReplaceAll(namespace, "-", "_")
+	labels := map[string]string{"perftest_namespace": namespace}
+	// Recorded series only keep the name and perftest_namespace labels
+	nsSel := "{" + matcher("perftest_namespace", namespace) + "}"
+	sel := func(matchers string) string {
+		switch {
+		case selector == "" && matchers == "":
+			return ""
+		case selector == "":
+			return "{" + matchers + "}"
+		case matchers == "":
+			return "{" + selector + "}"
+		default:
+			return "{" + selector + "," + matchers + "}"
+		}
+	}
+
+	// Requests per query, including transport errors, and failures per query
+	requests := `label_replace(sum by (query_name) (rate(query_load_test_time_bucket_queries_total%s[%s])), "name", "$1", "query_name", "(.*)")`
+	failures := `sum by (name) (rate(query_failures_count_` + sanitizedNs + `%s[%s]))`
+	latencyCount := `sum by (name) (rate(query_load_test_` + sanitizedNs + `_count%s[%s]))`
+	latencyFast := `sum by (name) (rate(query_load_test_` + sanitizedNs + `_bucket%s[%s]))`
+
+	windows := burn.windows
+	for _, a := range burnRateAlerts {
+		windows = appendDuration(windows, a.long)
+		windows = appendDuration(windows, a.short)
+	}
+
+	recording := promRuleGroup{Name: "query-load-generator-" + namespace + ".rules"}
+	for _, d := range windows {
+		w := promDuration(d)
+		recording.Rules = append(recording.Rules,
+			promRule{
+				Record: "name:query_load_test_requests:rate" + w,
+				Expr:   fmt.Sprintf(requests, sel(""), w),
+				Labels: labels,
+			},
+			promRule{
+				Record: "name:query_load_test_failures:rate" + w,
+				Expr:   fmt.Sprintf(failures, sel(""), w),
+				Labels: labels,
+			},
+			promRule{
+				Record: "name:query_load_test_error_budget_burn_rate:ratio_rate" + w,
+				Expr: fmt.Sprintf(`(name:query_load_test_failures:rate%s%s / name:query_load_test_requests:rate%s%s) / %s`,
+					w, nsSel, w, nsSel, formatFloat(1-burn.availability)),
+				Labels: labels,
+			},
+			promRule{
+				Record: "name:query_load_test_latency_burn_rate:ratio_rate" + w,
+				Expr: fmt.Sprintf(`(1 - %s / %s) / %s`,
+					fmt.Sprintf(latencyFast, sel(matcher("le", burn.le)), w), fmt.Sprintf(latencyCount, sel(""), w), formatFloat(1-burn.latencyTarget)),
+				Labels: labels,
+			},
+		)
+	}
+
+	alerting := promRuleGroup{Name: "query-load-generator-" + namespace + ".alerts"}
+	for _, a := range burnRateAlerts {
+		threshold := a.burnRate
+		if a.severity == "critical" && burn.alertBurnRate > 0 {
+			threshold = burn.alertBurnRate
+		}
+		long, short := promDuration(a.long), promDuration(a.short)
+		alerting.Rules = append(alerting.Rules,
+			promRule{
+				Alert: "QueryLoadTestErrorBudgetBurn",
+				Expr: fmt.Sprintf("name:query_load_test_error_budget_burn_rate:ratio_rate%s%s > %s\nand\nname:query_load_test_error_budget_burn_rate:ratio_rate%s%s > %s",
+					long, nsSel, formatFloat(threshold), short, nsSel, formatFloat(threshold)),
+				For:    a.for_,
+				Labels: alertLabels(namespace, a.severity),
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("Query {{ $labels.name }} burns its %s%% availability error budget %sx too fast (%s/%s windows)",
+						formatFloat(burn.availability*100), formatFloat(threshold), long, short),
+				},
+			},
+			promRule{
+				Alert: "QueryLoadTestLatencyBurn",
+				Expr: fmt.Sprintf("name:query_load_test_latency_burn_rate:ratio_rate%s%s > %s\nand\nname:query_load_test_latency_burn_rate:ratio_rate%s%s > %s",
+					long, nsSel, formatFloat(threshold), short, nsSel, formatFloat(threshold)),
+				For:    a.for_,
+				Labels: alertLabels(namespace, a.severity),
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("Query {{ $labels.name }} burns its latency SLO (%s%% < %ss) %sx too fast (%s/%s windows)",
+						formatFloat(burn.latencyTarget*100), burn.le, formatFloat(threshold), long, short),
+				},
+			},
+		)
+	}
+	for _, b := range config.TimeBuckets {
+		if b.SLO.MaxP99 == "" && b.SLO.MaxErrorRate == 0 {
+			continue
+		}
+		bucketSel := sel(matcher("bucket", b.Name))
+		alerting.Rules = append(alerting.Rules, promRule{
+			Alert: "QueryLoadTestBucketSLO",
+			Expr: fmt.Sprintf("query_load_test_bucket_slo_compliance_ratio%s\n<\nquery_load_test_bucket_slo_objective_ratio%s",
+				bucketSel, bucketSel),
+			For:    "5m",
+			Labels: alertLabels(namespace, "warning"),
+			Annotations: map[string]string{
+				"summary": "Time bucket {{ $labels.bucket }} misses its {{ $labels.slo }} SLO ({{ $value | humanizePercentage }} compliant)",
+			},
+		})
+	}
+	alerting.Rules = append(alerting.Rules, promRule{
+		Alert:  "QueryLoadTestStalled",
+		Expr:   fmt.Sprintf("time() - query_load_test_heartbeat_timestamp_seconds%s > 300", sel("")),
+		For:    "5m",
+		Labels: alertLabels(namespace, "warning"),
+		Annotations: map[string]string{
+			"summary": "The query load generator has not completed a request for 5 minutes",
+		},
+	})
+
+	return []promRuleGroup{recording, alerting}, nil
+}
+
+// burnRateSettings are the burn-rate SLOs of a config with defaults applied
+type burnRateSettings struct {
+	availability  float64
+	latencyTarget float64
+	alertBurnRate float64
+	le            string // latency histogram bucket boundary of the latency threshold
+	windows       []time.Duration
+}
+
+// newBurnRateSettings applies the burn-rate defaults and maps the latency threshold to a bucket
+// of the latency histogram, since rules can only count requests at bucket boundaries
+func newBurnRateSettings(cfg BurnRateConfig) (*burnRateSettings, error) {
+	t, err := newBurnRateTracker(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &burnRateSettings{
+		availability:  t.availability,
+		latencyTarget: t.latencyTarget,
+		alertBurnRate: t.alertBurnRate,
+		windows:       t.windows,
+	}
+	threshold := t.latencyThreshold.Seconds()
+	for _, b := range prometheus.DefBuckets {
+		if b >= threshold {
+			if b != threshold {
+				log.Printf("Warning: latencyThreshold %s is not a latency histogram bucket, using %ss", t.latencyThreshold, formatFloat(b))
+			}
+			s.le = formatFloat(b)
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("latencyThreshold %s exceeds the largest latency histogram bucket (%ss)",
+		t.latencyThreshold, formatFloat(prometheus.DefBuckets[len(prometheus.DefBuckets)-1]))
+}
+
+// alertLabels returns the labels of a generated alert
+func alertLabels(namespace, severity string) map[string]string {
+	return map[string]string{"severity": severity, "perftest_namespace": namespace}
+}
+
+// matcher returns an equality label matcher
+func matcher(name, value string) string {
+	return name + "=" + strconv.Quote(value)
+}
+
+// formatFloat formats a float the way Prometheus formats label values, rounding away
+// floating-point noise such as 1-0.99
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', 12, 64)
+}
+
+// promDuration formats a duration as a PromQL range
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// appendDuration appends d unless already present
+func appendDuration(durations []time.Duration, d time.Duration) []time.Duration {
+	for _, existing := range durations {
+		if existing == d {
+			return durations
+		}
+	}
+	return append(durations, d)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// sampleBufferSize is the number of samples buffered before new ones are dropped
+const sampleBufferSize = 10000
+
+// SampleOutputConfig configures a per-request sample output
+type SampleOutputConfig struct {
+	Format         string   `yaml:"format"`         // "ndjson", "csv", "parquet" or "loki"
+	Path           string   `yaml:"path"`           // Directory the sample files are written to
+	Prefix         string   `yaml:"prefix"`         // File name prefix (default: "samples")
+	Columns        []string `yaml:"columns"`        // CSV columns (default: all)
+	RotateBytes    int64    `yaml:"rotateBytes"`    // Start a new file after this many bytes (0 = never)
+	RotateInterval string   `yaml:"rotateInterval"` // Start a new file after this interval (e.g. "1h", empty = never)
+
+	// Loki push settings, only used by the "loki" format
+	URL      string            `yaml:"url"`      // Push endpoint, e.g. http://loki:3100/loki/api/v1/push
+	TenantID string            `yaml:"tenantID"` // Sent as X-Scope-OrgID when set
+	Labels   map[string]string `yaml:"labels"`   // Static stream labels (default: job=query-load-generator)
+}
+
+// requestSample is the outcome of a single query request
+type requestSample struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Query          string    `json:"query"`
+	Bucket         string    `json:"bucket"`
+	Tenant         string    `json:"tenant"`
+	Status         int       `json:"status"`
+	LatencySeconds float64   `json:"latencySeconds"`
+	Spans          int       `json:"spans"`
+	Traces         int       `json:"traces"`
+	Bytes          int64     `json:"bytes"`
+	InspectedBytes int64     `json:"inspectedBytes,omitempty"` // Bytes Tempo read to answer the search
+	HeaderProfile  string    `json:"headerProfile,omitempty"`  // Header profile the request was sent with
+	Client         string    `json:"client,omitempty"`         // Client identity the request was sent as
+	LimitHit       bool      `json:"limitHit,omitempty"`       // As many traces as the limit were returned
+	Partial        bool      `json:"partial,omitempty"`        // Tempo did not complete every search job
+	WindowStart    int64     `json:"windowStart,omitempty"`
+	WindowEnd      int64     `json:"windowEnd,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Throttled      bool      `json:"throttled,omitempty"` // 429 that paused the query, not counted as a failure
+}
+
+// sampleColumns maps CSV column names to their value in a sample
+var sampleColumns = map[string]func(s *requestSample) string{
+	"timestamp":       func(s *requestSample) string { return s.Timestamp.Format(time.RFC3339Nano) },
+	"query":           func(s *requestSample) string { return s.Query },
+	"bucket":          func(s *requestSample) string { return s.Bucket },
+	"tenant":          func(s *requestSample) string { return s.Tenant },
+	"status":          func(s *requestSample) string { return strconv.Itoa(s.Status) },
+	"latency_seconds": func(s *requestSample) string { return strconv.FormatFloat(s.LatencySeconds, 'f', 6, 64) },
+	"spans":           func(s *requestSample) string { return strconv.Itoa(s.Spans) },
+	"traces":          func(s *requestSample) string { return strconv.Itoa(s.Traces) },
+	"bytes":           func(s *requestSample) string { return strconv.FormatInt(s.Bytes, 10) },
+	"inspected_bytes": func(s *requestSample) string { return strconv.FormatInt(s.InspectedBytes, 10) },
+	"header_profile":  func(s *requestSample) string { return s.HeaderProfile },
+	"client":          func(s *requestSample) string { return s.Client },
+	"limit_hit":       func(s *requestSample) string { return strconv.FormatBool(s.LimitHit) },
+	"partial":         func(s *requestSample) string { return strconv.FormatBool(s.Partial) },
+	"window_start":    func(s *requestSample) string { return strconv.FormatInt(s.WindowStart, 10) },
+	"window_end":      func(s *requestSample) string { return strconv.FormatInt(s.WindowEnd, 10) },
+	"error":           func(s *requestSample) string { return s.Error },
+}
+
+// defaultSampleColumns is the CSV column order used when none is configured
+var defaultSampleColumns = []string{
+	"timestamp", "query", "bucket", "tenant", "status", "latency_seconds",
+	"spans", "traces", "bytes", "window_start", "window_end", "error",
+}
+
+// sampleSink writes samples to an output
+type sampleSink interface {
+	write(s *requestSample) error
+	close() error
+}
+
+// samples records per-request samples (nil when no output is configured)
+var samples *sampleRecorder
+
+// sampleRecorder fans samples out to the configured sinks from a single goroutine
+type sampleRecorder struct {
+	ch      chan *requestSample
+	sinks   []sampleSink
+	done    chan struct{}
+	dropped prometheus.Counter
+
+	mu     sync.RWMutex // guards sends on ch against close
+	closed bool
+}
+
+// newSampleRecorder creates the sinks for the configured outputs and starts the writer;
+// extra sinks (e.g. run statistics for reports) receive every sample as well
+func newSampleRecorder(outputs []SampleOutputConfig, extra ...sampleSink) (*sampleRecorder, error) {
+	r := &sampleRecorder{
+		ch:   make(chan *requestSample, sampleBufferSize),
+		done: make(chan struct{}),
+		dropped: promauto.NewCounter(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "samples",
+			Name:      "dropped_total",
+			Help:      "Request samples dropped because the sample writer could not keep up or was closed",
+		}),
+	}
+
+	for _, out := range outputs {
+		sink, err := newSampleSink(out)
+		if err != nil {
+			return nil, err
+		}
+		r.sinks = append(r.sinks, redactedSink{sink})
+	}
+	r.sinks = append(r.sinks, extra...)
+
+	go r.run()
+	return r, nil
+}
+
+// newSampleSink creates the sink for a single output
+func newSampleSink(out SampleOutputConfig) (sampleSink, error) {
+	if out.Format == "loki" {
+		return newLokiSink(out)
+	}
+
+	var interval time.Duration
+	if out.RotateInterval != "" {
+		d, err := time.ParseDuration(out.RotateInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotateInterval: %v", err)
+		}
+		interval = d
+	}
+	if out.Path == "" {
+		return nil, fmt.Errorf("sample output %q needs a path", out.Format)
+	}
+	if err := os.MkdirAll(out.Path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create sample directory: %w", err)
+	}
+	prefix := out.Prefix
+	if prefix == "" {
+		prefix = "samples"
+	}
+
+	switch out.Format {
+	case "ndjson", "":
+		return &ndjsonSink{file: newRotatingFile(out.Path, prefix, "ndjson", out.RotateBytes, interval)}, nil
+	case "csv":
+		columns := out.Columns
+		if len(columns) == 0 {
+			columns = defaultSampleColumns
+		}
+		for _, c := range columns {
+			if _, ok := sampleColumns[c]; !ok {
+				return nil, fmt.Errorf("unknown sample column %q", c)
+			}
+		}
+		return &csvSink{file: newRotatingFile(out.Path, prefix, "csv", out.RotateBytes, interval), columns: columns}, nil
+	case "parquet":
+		return newParquetSink(out.Path, prefix, out.RotateBytes, interval), nil
+	default:
+		return nil, fmt.Errorf("unknown sample format %q", out.Format)
+	}
+}
+
+// redactedSink applies the redaction policy to samples before they leave the process
+type redactedSink struct {
+	sampleSink
+}
+
+func (s redactedSink) write(sample *requestSample) error {
+	return s.sampleSink.write(redaction.sample(sample))
+}
+
+// record queues a sample without blocking the worker; samples are dropped when the buffer is full
+// or the recorder is closed (workers still running when the run ends)
+func (r *sampleRecorder) record(s *requestSample) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		r.dropped.Inc()
+		return
+	}
+	select {
+	case r.ch <- s:
+	default:
+		r.dropped.Inc()
+	}
+}
+
+// run writes queued samples to every sink
+func (r *sampleRecorder) run() {
+	defer close(r.done)
+	for s := range r.ch {
+		for _, sink := range r.sinks {
+			if err := sink.write(s); err != nil {
+				log.Printf("Warning: Failed to write sample: %v", err)
+			}
+		}
+	}
+	for _, sink := range r.sinks {
+		if err := sink.close(); err != nil {
+			log.Printf("Warning: Failed to close sample output: %v", err)
+		}
+	}
+}
+
+// close flushes pending samples and closes the sinks
+func (r *sampleRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.ch)
+	}
+	r.mu.Unlock()
+	<-r.done
+}
+
+// rotatingFile is a buffered file that is replaced by a new one after a size or age limit
+type rotatingFile struct {
+	dir, prefix, ext string
+	maxBytes         int64
+	interval         time.Duration
+
+	f       *os.File
+	w       *bufio.Writer
+	written int64
+	opened  time.Time
+}
+
+// newRotatingFile creates a rotating file; the first file is opened on the first write
+func newRotatingFile(dir, prefix, ext string, maxBytes int64, interval time.Duration) *rotatingFile {
+	return &rotatingFile{dir: dir, prefix: prefix, ext: ext, maxBytes: maxBytes, interval: interval}
+}
+
+// prepare makes sure a file is open, rotating if needed; it reports whether a new file was opened
+func (r *rotatingFile) prepare(now time.Time) (bool, error) {
+	if r.f != nil {
+		full := r.maxBytes > 0 && r.written >= r.maxBytes
+		old := r.interval > 0 && now.Sub(r.opened) >= r.interval
+		if !full && !old {
+			return false, nil
+		}
+		if err := r.close(); err != nil {
+			return false, err
+		}
+	}
+
+	name := filepath.Join(r.dir, fmt.Sprintf("%s-%s.%s", r.prefix, now.UTC().Format("20060102-150405.000"), r.ext))
+	f, err := os.Create(name)
+	if err != nil {
+		return false, err
+	}
+	r.f = f
+	r.w = bufio.NewWriter(f)
+	r.written = 0
+	r.opened = now
+	return true, nil
+}
+
+// Write implements io.Writer on the current file
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	r.written += int64(n)
+	return n, err
+}
+
+// close flushes and closes the current file
+func (r *rotatingFile) close() error {
+	if r.f == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// ndjsonSink writes one JSON object per line
+type ndjsonSink struct {
+	file *rotatingFile
+}
+
+func (s *ndjsonSink) write(sample *requestSample) error {
+	if _, err := s.file.prepare(time.Now()); err != nil {
+		return err
+	}
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *ndjsonSink) close() error {
+	return s.file.close()
+}
+
+// csvSink writes the configured columns as CSV, with a header in every file
+type csvSink struct {
+	file    *rotatingFile
+	columns []string
+	w       *csv.Writer
+}
+
+func (s *csvSink) write(sample *requestSample) error {
+	opened, err := s.file.prepare(time.Now())
+	if err != nil {
+		return err
+	}
+	if opened {
+		s.w = csv.NewWriter(s.file)
+		if err := s.w.Write(s.columns); err != nil {
+			return err
+		}
+	}
+
+	row := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		row[i] = sampleColumns[c](sample)
+	}
+	if err := s.w.Write(row); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvSink) close() error {
+	return s.file.close()
+}
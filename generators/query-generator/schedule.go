@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// querySchedule is when a query runs: its startAfter and stopAfter offsets resolved against the
+// test start (zero times = from the start, until the end of the run)
+type querySchedule struct {
+	startAt, stopAt time.Time
+}
+
+// offsets parses the startAfter and stopAfter offsets of a query (zero when unset)
+func (q QueryConfig) offsets() (startAfter, stopAfter time.Duration, err error) {
+	if q.StartAfter != "" {
+		startAfter, err = parseExtendedDuration(q.StartAfter)
+		if err != nil || startAfter < 0 {
+			return 0, 0, fmt.Errorf("query %s: invalid startAfter %q", q.Name, q.StartAfter)
+		}
+	}
+	if q.StopAfter != "" {
+		stopAfter, err = parseExtendedDuration(q.StopAfter)
+		if err != nil || stopAfter <= startAfter {
+			return 0, 0, fmt.Errorf("query %s: stopAfter %q must be a duration after startAfter", q.Name, q.StopAfter)
+		}
+	}
+	return startAfter, stopAfter, nil
+}
+
+// newQuerySchedule resolves the offsets of a query against the test start
+func newQuerySchedule(q QueryConfig, testStart time.Time) (querySchedule, error) {
+	startAfter, stopAfter, err := q.offsets()
+	if err != nil {
+		return querySchedule{}, err
+	}
+	var s querySchedule
+	if startAfter > 0 {
+		s.startAt = testStart.Add(startAfter)
+	}
+	if stopAfter > 0 {
+		s.stopAt = testStart.Add(stopAfter)
+	}
+	return s, nil
+}
+
+// scheduled reports whether the query does not simply run for the whole test
+func (s querySchedule) scheduled() bool {
+	return !s.startAt.IsZero() || !s.stopAt.IsZero()
+}
+
+// context returns the context the query's workers run under: parent, cancelled at stopAt, when
+// the query is also marked done for the job
+func (s querySchedule) context(parent context.Context, queryName string) context.Context {
+	if s.stopAt.IsZero() {
+		return parent
+	}
+	ctx, cancel := context.WithCancel(parent)
+	time.AfterFunc(time.Until(s.stopAt), func() {
+		if ctx.Err() == nil {
+			log.Printf("Query '%s': stopAfter reached, stopping its workers", queryName)
+		}
+		cancel()
+		queryActiveGauge.WithLabelValues(queryName).Set(0)
+		job.queryDone(queryName)
+	})
+	return ctx
+}
+
+// start calls run once startAt is reached, unless ctx is done first
+func (s querySchedule) start(ctx context.Context, queryName string, run func()) {
+	if wait := time.Until(s.startAt); wait > 0 {
+		log.Printf("Query '%s': starting in %s (startAfter)", queryName, wait.Round(time.Second))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		log.Printf("Query '%s': startAfter reached, starting its workers", queryName)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	run()
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query kinds supported by the generator
+const (
+	// queryKindTraceQL sends the query as a TraceQL expression in the q= parameter
+	queryKindTraceQL = "traceql"
+	// queryKindLegacy uses Tempo's pre-TraceQL search parameters (tags, minDuration, maxDuration)
+	queryKindLegacy = "legacy"
+)
+
+// mostRecentHint is appended to TraceQL queries with mostRecent set
+const mostRecentHint = "with (most_recent=true)"
+
+// QueryConfig represents a single query definition from config
+type QueryConfig struct {
+	Name    string `yaml:"name"`
+	Kind    string `yaml:"kind"` // "traceql" (default), "legacy", or zipkin-traces, zipkin-trace or zipkin-services
+	TraceQL string `yaml:"traceql"`
+	Weight  int    `yaml:"weight"` // Relative weight used by "plan generate" (default: 1)
+	Golden  string `yaml:"golden"` // Path to a golden file describing the expected response structure
+	Class   string `yaml:"class"`  // "standard" (default) or "expensive" for long-range queries (see query.expensive)
+
+	// MaxTotalQueries stops the query's workers after this many requests (0 = unlimited)
+	MaxTotalQueries int64 `yaml:"maxTotalQueries"`
+
+	// Offsets from the test start between which the query runs, e.g. "2h" (default: the whole test)
+	StartAfter string `yaml:"startAfter"`
+	StopAfter  string `yaml:"stopAfter"`
+
+	// Search parameters; tags and service are only used when kind is "legacy" or a Zipkin kind
+	Tags        map[string]string `yaml:"tags"`
+	Logfmt      string            `yaml:"logfmt"`      // Raw tags= value sent as-is by legacy queries, e.g. copied from an older Grafana
+	Service     string            `yaml:"service"`     // Shorthand for the service.name tag (Zipkin: serviceName)
+	SpanName    string            `yaml:"spanName"`    // Zipkin spanName
+	TraceIDs    []string          `yaml:"traceIDs"`    // Trace IDs looked up by zipkin-trace queries, picked at random
+	MinDuration string            `yaml:"minDuration"` // e.g. "100ms", also sent alongside TraceQL queries
+	MaxDuration string            `yaml:"maxDuration"` // e.g. "5s", also sent alongside TraceQL queries
+
+	// MostRecent asks for the newest matches first (TraceQL "with (most_recent=true)" hint, Tempo 2.5+)
+	// and records whether responses come back ordered by descending start time
+	MostRecent bool `yaml:"mostRecent"`
+
+	// HeaderProfiles are the header profiles requests rotate through at random, e.g. ["none",
+	// "no-cache"] to compare cached and uncached latency in one run (default: no extra headers)
+	HeaderProfiles []string `yaml:"headerProfiles"`
+
+	// UserAgent is sent with every request of the query; Clients rotates requests across client
+	// identities at random instead, e.g. ["grafana", "tempo-cli"] (default: the Go client's)
+	UserAgent string   `yaml:"userAgent"`
+	Clients   []string `yaml:"clients"`
+
+	// DurationSweep expands the query into one variant per threshold
+	DurationSweep *DurationSweep `yaml:"durationSweep"`
+
+	// threshold is the duration threshold of an expanded sweep variant and sweep the name of the
+	// query it was expanded from (both empty otherwise)
+	threshold string
+	sweep     string
+}
+
+// DurationSweep describes a set of duration thresholds to run a query with
+type DurationSweep struct {
+	Mode       string   `yaml:"mode"`       // "param" (minDuration/maxDuration search params) or "inline" (substitutes $threshold in the TraceQL)
+	Bound      string   `yaml:"bound"`      // "min" (default) or "max", only used in param mode
+	Thresholds []string `yaml:"thresholds"` // e.g. ["100ms", "500ms", "1s"]
+}
+
+// Duration sweep modes
+const (
+	sweepModeParam  = "param"
+	sweepModeInline = "inline"
+
+	// sweepPlaceholder is replaced by the threshold in inline sweep mode
+	sweepPlaceholder = "$threshold"
+	// sweepNameSeparator joins the query name and the threshold in sweep variant names
+	sweepNameSeparator = "@"
+)
+
+// kind returns the normalized query kind, defaulting to TraceQL
+func (q QueryConfig) kind() string {
+	if q.Kind == "" {
+		return queryKindTraceQL
+	}
+	return strings.ToLower(q.Kind)
+}
+
+// planWeight returns the weight used when generating plans
+func (q QueryConfig) planWeight() int {
+	if q.Weight <= 0 {
+		return 1
+	}
+	return q.Weight
+}
+
+// validate checks that the query has the parameters required by its kind
+func (q QueryConfig) validate() error {
+	switch q.kind() {
+	case queryKindTraceQL:
+		if q.TraceQL == "" {
+			return fmt.Errorf("query %s: traceql must be set", q.Name)
+		}
+		if err := validateTraceQL(q.TraceQL); err != nil {
+			return fmt.Errorf("query %s: invalid traceql %q: %v", q.Name, q.TraceQL, err)
+		}
+	case queryKindLegacy:
+		if q.MostRecent {
+			return fmt.Errorf("query %s: mostRecent needs a traceql query", q.Name)
+		}
+		if len(q.Tags) == 0 && q.Service == "" && q.Logfmt == "" && q.MinDuration == "" && q.MaxDuration == "" {
+			return fmt.Errorf("query %s: legacy queries need at least one of tags, service, logfmt, minDuration or maxDuration", q.Name)
+		}
+		if q.Logfmt != "" {
+			if len(q.Tags) > 0 || q.Service != "" {
+				return fmt.Errorf("query %s: logfmt replaces tags and service, set only one", q.Name)
+			}
+			if _, err := parseLogfmt(q.Logfmt); err != nil {
+				return fmt.Errorf("query %s: invalid logfmt %q: %v", q.Name, q.Logfmt, err)
+			}
+		}
+	case queryKindZipkinTraces, queryKindZipkinTrace, queryKindZipkinServices:
+		if q.MostRecent {
+			return fmt.Errorf("query %s: mostRecent needs a traceql query", q.Name)
+		}
+		if q.kind() == queryKindZipkinTrace && len(q.TraceIDs) == 0 {
+			return fmt.Errorf("query %s: zipkin-trace queries need traceIDs", q.Name)
+		}
+	default:
+		return fmt.Errorf("query %s: unknown kind %q", q.Name, q.Kind)
+	}
+
+	if err := validateQueryClass(q.Class); err != nil {
+		return fmt.Errorf("query %s: %v", q.Name, err)
+	}
+
+	if _, _, err := q.offsets(); err != nil {
+		return err
+	}
+
+	for _, d := range []string{q.MinDuration, q.MaxDuration} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("query %s: invalid duration %q: %v", q.Name, d, err)
+		}
+	}
+	return nil
+}
+
+// expandDurationSweeps replaces every query that defines a durationSweep with one variant per
+// threshold, named <query>@<threshold>, and every plan entry of the query with one entry per
+// variant. Each variant is a query of its own: it gets its share of the target QPS, its plan
+// index, statistics and metrics.
+func expandDurationSweeps(queries []QueryConfig, plan []PlanEntry) ([]QueryConfig, []PlanEntry, error) {
+	expanded := make([]QueryConfig, 0, len(queries))
+	variants := make(map[string][]string)
+	for _, q := range queries {
+		sweep := q.DurationSweep
+		if sweep == nil {
+			expanded = append(expanded, q)
+			continue
+		}
+		if len(sweep.Thresholds) == 0 {
+			return nil, nil, fmt.Errorf("query %s: durationSweep needs at least one threshold", q.Name)
+		}
+
+		mode := strings.ToLower(sweep.Mode)
+		if mode == "" {
+			mode = sweepModeParam
+		}
+		if mode == sweepModeInline && (q.kind() != queryKindTraceQL || !strings.Contains(q.TraceQL, sweepPlaceholder)) {
+			return nil, nil, fmt.Errorf("query %s: inline durationSweep needs a traceql query containing %s", q.Name, sweepPlaceholder)
+		}
+
+		for _, threshold := range sweep.Thresholds {
+			if _, err := time.ParseDuration(threshold); err != nil {
+				return nil, nil, fmt.Errorf("query %s: invalid durationSweep threshold %q: %v", q.Name, threshold, err)
+			}
+
+			variant := q
+			variant.Name = q.Name + sweepNameSeparator + threshold
+			variant.DurationSweep = nil
+			variant.threshold = threshold
+			variant.sweep = q.Name
+			switch mode {
+			case sweepModeInline:
+				variant.TraceQL = strings.ReplaceAll(q.TraceQL, sweepPlaceholder, threshold)
+			case sweepModeParam:
+				if strings.ToLower(sweep.Bound) == "max" {
+					variant.MaxDuration = threshold
+				} else {
+					variant.MinDuration = threshold
+				}
+			default:
+				return nil, nil, fmt.Errorf("query %s: unknown durationSweep mode %q", q.Name, sweep.Mode)
+			}
+			expanded = append(expanded, variant)
+			variants[q.Name] = append(variants[q.Name], variant.Name)
+		}
+	}
+	if len(variants) == 0 {
+		return expanded, plan, nil
+	}
+
+	expandedPlan := make([]PlanEntry, 0, len(plan))
+	for _, entry := range plan {
+		names, ok := variants[entry.QueryName]
+		if !ok {
+			expandedPlan = append(expandedPlan, entry)
+			continue
+		}
+		for _, name := range names {
+			expandedPlan = append(expandedPlan, PlanEntry{QueryName: name, BucketName: entry.BucketName})
+		}
+	}
+	return expanded, expandedPlan, nil
+}
+
+// sweepBaseName returns the name of the query a sweep variant was expanded from (the name
+// itself for other queries)
+func sweepBaseName(name string) string {
+	if i := strings.LastIndex(name, sweepNameSeparator); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// setSearchParams adds the kind-specific search parameters to the request query string
+func (q QueryConfig) setSearchParams(params url.Values) {
+	if q.MinDuration != "" {
+		params.Set("minDuration", q.MinDuration)
+	}
+	if q.MaxDuration != "" {
+		params.Set("maxDuration", q.MaxDuration)
+	}
+
+	if q.kind() != queryKindLegacy {
+		params.Set("q", q.traceQL())
+		return
+	}
+
+	if q.Logfmt != "" {
+		params.Set("tags", q.Logfmt)
+		return
+	}
+	tags := make(map[string]string, len(q.Tags)+1)
+	for k, v := range q.Tags {
+		tags[k] = v
+	}
+	if q.Service != "" {
+		tags["service.name"] = q.Service
+	}
+	if len(tags) > 0 {
+		params.Set("tags", encodeLogfmt(tags))
+	}
+}
+
+// traceQL returns the TraceQL expression sent to Tempo, including query hints
+func (q QueryConfig) traceQL() string {
+	if q.MostRecent && !strings.Contains(q.TraceQL, "most_recent") {
+		return q.TraceQL + " " + mostRecentHint
+	}
+	return q.TraceQL
+}
+
+// newestFirst reports whether the traces of a response are ordered by descending start time;
+// traces without a start time are skipped
+func (r *TempoSearchResponse) newestFirst() bool {
+	var previous uint64
+	seen := false
+	for _, trace := range r.Traces {
+		start, err := strconv.ParseUint(trace.StartTimeUnixNano, 10, 64)
+		if err != nil {
+			continue
+		}
+		if seen && start > previous {
+			return false
+		}
+		previous, seen = start, true
+	}
+	return true
+}
+
+// describe returns a short human readable form of the query for logging
+func (q QueryConfig) describe() string {
+	if q.isZipkin() {
+		return q.describeZipkin()
+	}
+	if q.kind() != queryKindLegacy && q.MinDuration == "" && q.MaxDuration == "" {
+		return q.traceQL()
+	}
+	params := url.Values{}
+	q.setSearchParams(params)
+	return params.Encode()
+}
+
+// encodeLogfmt encodes tags in the logfmt format expected by Tempo's legacy search (sorted for stable URLs)
+func encodeLogfmt(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := tags[k]
+		if v == "" || strings.ContainsAny(v, " =\"") {
+			v = fmt.Sprintf("%q", v)
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseLogfmt parses the logfmt tags of Tempo's legacy search: space-separated key=value pairs
+// whose values may be double-quoted Go strings
+func parseLogfmt(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 || strings.ContainsAny(rest[:eq], " \"") {
+			return nil, fmt.Errorf("expected key=value at %q", rest)
+		}
+		key := rest[:eq]
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("unterminated value of %s", key)
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+			if rest != "" && rest[0] != ' ' {
+				return nil, fmt.Errorf("expected a space after the value of %s", key)
+			}
+		} else {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+		tags[key] = value
+		rest = strings.TrimLeft(rest, " ")
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags")
+	}
+	return tags, nil
+}
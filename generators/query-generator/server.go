@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Defaults of the metrics/status server
+const (
+	defaultListenAddress = ":2112"
+	defaultMetricsPath   = "/metrics"
+
+	defaultBindRetryInterval = 10 * time.Second
+)
+
+// What the generator does when the server cannot bind its address or stops serving
+const (
+	bindFailureAbort    = "abort"    // exit, the run would be unmonitored
+	bindFailureRetry    = "retry"    // keep generating load and retry binding in the background
+	bindFailureHeadless = "headless" // keep generating load without the server, relying on reports and sinks
+)
+
+// ServerConfig configures the HTTP server exposing metrics and status
+type ServerConfig struct {
+	Listen      string          `yaml:"listen"`      // Listen address (default: ":2112")
+	MetricsPath string          `yaml:"metricsPath"` // Path of the Prometheus endpoint (default: "/metrics")
+	BasicAuth   BasicAuthConfig `yaml:"basicAuth"`   // Require HTTP basic auth on every endpoint (optional)
+	TLS         ServerTLSConfig `yaml:"tls"`         // Serve HTTPS instead of HTTP (optional)
+	Control     bool            `yaml:"control"`     // Serve the control API (/control/queries) to change QPS and workers at runtime
+
+	DebugSamples DebugSamplesConfig `yaml:"debugSamples"` // Serve the last responses of each query at /debug/samples
+
+	OnBindFailure     string `yaml:"onBindFailure"`     // "abort" (default), "retry" or "headless"
+	BindRetryInterval string `yaml:"bindRetryInterval"` // Interval between bind attempts with "retry" (default: 10s)
+}
+
+// BasicAuthConfig holds the credentials required by the server
+type BasicAuthConfig struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"` // Read the password from a file (e.g. a mounted secret)
+}
+
+// password returns the configured password, reading passwordFile when set
+func (c BasicAuthConfig) password() (string, error) {
+	password := c.Password
+	if c.PasswordFile != "" {
+		data, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read basicAuth.passwordFile: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+	if password == "" {
+		return "", fmt.Errorf("basicAuth needs a password or passwordFile")
+	}
+	return password, nil
+}
+
+// ServerTLSConfig holds the server certificate
+type ServerTLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// metricsPath returns the configured metrics path
+func (c ServerConfig) metricsPath() string {
+	if c.MetricsPath == "" {
+		return defaultMetricsPath
+	}
+	if !strings.HasPrefix(c.MetricsPath, "/") {
+		return "/" + c.MetricsPath
+	}
+	return c.MetricsPath
+}
+
+// startServer binds the listen address and serves handler in the background. Errors loading
+// credentials are returned; a failure to bind or serve is handled by the onBindFailure policy
+// until ctx is done. The server keeps serving after that, so the end of a run can be scraped.
+func startServer(ctx context.Context, cfg ServerConfig, handler http.Handler) error {
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return fmt.Errorf("tls needs both certFile and keyFile")
+	}
+	policy := cfg.OnBindFailure
+	switch policy {
+	case "":
+		policy = bindFailureAbort
+	case bindFailureAbort, bindFailureRetry, bindFailureHeadless:
+	default:
+		return fmt.Errorf("unknown onBindFailure %q (expected %s, %s or %s)", cfg.OnBindFailure, bindFailureAbort, bindFailureRetry, bindFailureHeadless)
+	}
+	retryInterval := defaultBindRetryInterval
+	if cfg.BindRetryInterval != "" {
+		d, err := time.ParseDuration(cfg.BindRetryInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid bindRetryInterval %q", cfg.BindRetryInterval)
+		}
+		retryInterval = d
+	}
+	if cfg.BasicAuth.Username != "" {
+		password, err := cfg.BasicAuth.password()
+		if err != nil {
+			return err
+		}
+		handler = requireBasicAuth(handler, cfg.BasicAuth.Username, password)
+	}
+
+	s := &metricsServer{ctx: ctx, policy: policy, retryInterval: retryInterval, addr: cfg.Listen, path: cfg.metricsPath()}
+	s.server = &http.Server{Handler: handler}
+	if s.addr == "" {
+		s.addr = defaultListenAddress
+	}
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		if policy == bindFailureAbort {
+			return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+		}
+		s.failed(fmt.Errorf("failed to listen on %s: %w", s.addr, err))
+		return nil
+	}
+	go s.serve(listener)
+	return nil
+}
+
+// metricsServer serves the metrics and applies the bind failure policy for its whole lifetime
+type metricsServer struct {
+	ctx           context.Context // Bind failures are no longer handled once done
+	server        *http.Server
+	policy        string
+	retryInterval time.Duration
+	addr          string
+	path          string
+}
+
+// serve serves on listener until the server fails
+func (s *metricsServer) serve(listener net.Listener) {
+	var err error
+	if s.server.TLSConfig != nil {
+		log.Printf("Serving metrics on https://%s%s", listener.Addr(), s.path)
+		err = s.server.ServeTLS(listener, "", "")
+	} else {
+		log.Printf("Serving metrics on http://%s%s", listener.Addr(), s.path)
+		err = s.server.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
+		s.failed(err)
+	}
+}
+
+// failed applies the policy to a bind or serve error
+func (s *metricsServer) failed(err error) {
+	if s.ctx.Err() != nil {
+		log.Printf("Warning: Metrics server unavailable (%v) while the run ends", err)
+		return
+	}
+	switch s.policy {
+	case bindFailureRetry:
+		log.Printf("Warning: Metrics server unavailable (%v), retrying every %s", err, s.retryInterval)
+		go s.rebind()
+	case bindFailureHeadless:
+		log.Printf("Warning: Metrics server unavailable (%v), continuing without it; results are only in the reports, samples and metrics sinks", err)
+	default:
+		fatalf("Metrics server failed: %v", err)
+	}
+}
+
+// rebind retries binding the listen address until it succeeds, then serves again; it gives up
+// when ctx is done
+func (s *metricsServer) rebind() {
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+		listener, err := net.Listen("tcp", s.addr)
+		if err == nil {
+			s.serve(listener)
+			return
+		}
+	}
+}
+
+// requireBasicAuth rejects requests without the expected credentials
+func requireBasicAuth(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="query-load-generator"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// occupy binds a free local port and returns the listener holding it
+func occupy(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestServerRetryBindsOnceFree(t *testing.T) {
+	busy := occupy(t)
+	addr := busy.Addr().String()
+	cfg := ServerConfig{Listen: addr, OnBindFailure: bindFailureRetry, BindRetryInterval: "20ms"}
+	if err := startServer(context.Background(), cfg, http.NewServeMux()); err != nil {
+		t.Fatal(err)
+	}
+	busy.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			res.Body.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not bind %s after it was freed: %v", addr, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServerRetryStopsWithContext(t *testing.T) {
+	busy := occupy(t)
+	addr := busy.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := ServerConfig{Listen: addr, OnBindFailure: bindFailureRetry, BindRetryInterval: "20ms"}
+	if err := startServer(ctx, cfg, http.NewServeMux()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(50 * time.Millisecond) // let the retry loop see the cancellation
+	busy.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("%s was bound after the context was done: %v", addr, err)
+	}
+	l.Close()
+}
+
+func TestServerAbortOnBindFailure(t *testing.T) {
+	busy := occupy(t)
+	defer busy.Close()
+	if err := startServer(context.Background(), ServerConfig{Listen: busy.Addr().String()}, http.NewServeMux()); err == nil {
+		t.Errorf("startServer on a bound address succeeded, want an error")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// planShard selects the plan entries executed by one replica of a generator fleet, so N replicas
+// together execute exactly one logical plan
+type planShard struct {
+	index int
+	count int
+}
+
+// detectPlanShard reads REPLICA_INDEX and REPLICA_COUNT; without REPLICA_INDEX the index is the
+// StatefulSet ordinal (trailing "-N" of the pod name). Without REPLICA_COUNT there is one shard.
+func detectPlanShard(podName string) (planShard, error) {
+	countEnv := os.Getenv("REPLICA_COUNT")
+	if countEnv == "" {
+		return planShard{index: 0, count: 1}, nil
+	}
+	count, err := strconv.Atoi(countEnv)
+	if err != nil || count < 1 {
+		return planShard{}, fmt.Errorf("invalid REPLICA_COUNT %q", countEnv)
+	}
+
+	indexEnv := os.Getenv("REPLICA_INDEX")
+	if indexEnv == "" {
+		if i := strings.LastIndex(podName, "-"); i >= 0 {
+			indexEnv = podName[i+1:]
+		}
+	}
+	index, err := strconv.Atoi(indexEnv)
+	if err != nil {
+		return planShard{}, fmt.Errorf("REPLICA_COUNT is set but the replica index is unknown: set REPLICA_INDEX or run as a StatefulSet (pod %q)", podName)
+	}
+	if index < 0 || index >= count {
+		return planShard{}, fmt.Errorf("replica index %d out of range for REPLICA_COUNT %d", index, count)
+	}
+	return planShard{index: index, count: count}, nil
+}
+
+// assign returns the shard of every plan entry: entry i runs on the replica whose index is
+// i % count. A query whose entries do not spread over every position runs on fewer replicas,
+// and a plan shorter than the fleet leaves the last replicas without entries.
+func (s planShard) assign(plan []PlanEntry) []int {
+	shards := make([]int, len(plan))
+	for i := range plan {
+		shards[i] = i % s.count
+	}
+	return shards
+}
+
+// filter returns the plan entries of this shard
+func (s planShard) filter(plan []PlanEntry) []PlanEntry {
+	if s.count <= 1 {
+		return plan
+	}
+	var entries []PlanEntry
+	for i, shard := range s.assign(plan) {
+		if shard == s.index {
+			entries = append(entries, plan[i])
+		}
+	}
+	return entries
+}
+
+// share returns the fraction of a query's entries of the whole plan this shard executes, which
+// is the share of the query's fleet-wide QPS the replica runs
+func (s planShard) share(plan []PlanEntry, queryName string) float64 {
+	if s.count <= 1 {
+		return 1
+	}
+	var total, here int
+	for i, shard := range s.assign(plan) {
+		if plan[i].QueryName != queryName {
+			continue
+		}
+		total++
+		if shard == s.index {
+			here++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(here) / float64(total)
+}
+
+// split returns this shard's part of n requests, e.g. a query budget, dealt across the shards in
+// proportion to their entries of a query (of the whole plan when queryName is empty). Shards
+// without entries get none; the requests left after rounding down go one each to the shards with
+// the largest remainders, lowest index first, so the parts of the fleet add up to exactly n.
+func (s planShard) split(n int64, plan []PlanEntry, queryName string) int64 {
+	if s.count <= 1 {
+		return n
+	}
+	weights := make([]int64, s.count)
+	var total int64
+	for i, shard := range s.assign(plan) {
+		if queryName == "" || plan[i].QueryName == queryName {
+			weights[shard]++
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	parts := make([]int64, s.count)
+	remainders := make([]int64, s.count)
+	left := n
+	for i, w := range weights {
+		parts[i] = n * w / total
+		remainders[i] = n * w % total
+		left -= parts[i]
+	}
+	order := make([]int, s.count)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:left] {
+		parts[i]++
+	}
+	return parts[s.index]
+}
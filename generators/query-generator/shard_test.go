@@ -0,0 +1,163 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testPlan(queries ...string) []PlanEntry {
+	plan := make([]PlanEntry, len(queries))
+	for i, q := range queries {
+		plan[i] = PlanEntry{QueryName: q, BucketName: "recent"}
+	}
+	return plan
+}
+
+func planQueries(plan []PlanEntry) []string {
+	var names []string
+	for _, entry := range plan {
+		names = append(names, entry.QueryName)
+	}
+	return names
+}
+
+func TestDetectPlanShard(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		count string
+		index string
+		pod   string
+		want  planShard
+		ok    bool
+	}{
+		{"unsharded", "", "", "generator-3", planShard{index: 0, count: 1}, true},
+		{"index", "4", "2", "", planShard{index: 2, count: 4}, true},
+		{"statefulset ordinal", "10", "", "query-load-generator-7", planShard{index: 7, count: 10}, true},
+		{"index overrides the ordinal", "10", "1", "query-load-generator-7", planShard{index: 1, count: 10}, true},
+		{"no index", "4", "", "generator", planShard{}, false},
+		{"index out of range", "4", "4", "", planShard{}, false},
+		{"invalid count", "0", "0", "", planShard{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("REPLICA_COUNT", tc.count)
+			t.Setenv("REPLICA_INDEX", tc.index)
+			got, err := detectPlanShard(tc.pod)
+			if (err == nil) != tc.ok || got != tc.want {
+				t.Errorf("detectPlanShard(%q) = %+v, %v, want %+v, ok: %v", tc.pod, got, err, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestPlanShardFilter(t *testing.T) {
+	plan := testPlan("q1", "q2", "q1", "q2", "q1", "q3")
+	for _, tc := range []struct {
+		shard planShard
+		want  []string
+	}{
+		{planShard{index: 0, count: 1}, []string{"q1", "q2", "q1", "q2", "q1", "q3"}},
+		{planShard{index: 0, count: 2}, []string{"q1", "q1", "q1"}},
+		{planShard{index: 1, count: 2}, []string{"q2", "q2", "q3"}},
+		{planShard{index: 0, count: 4}, []string{"q1", "q1"}},
+		{planShard{index: 1, count: 4}, []string{"q2", "q3"}},
+		{planShard{index: 3, count: 4}, []string{"q2"}},
+		// More replicas than entries: the last ones idle
+		{planShard{index: 5, count: 8}, []string{"q3"}},
+		{planShard{index: 6, count: 8}, nil},
+	} {
+		if got := planQueries(tc.shard.filter(plan)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("replica %d of %d runs %v, want %v", tc.shard.index, tc.shard.count, got, tc.want)
+		}
+	}
+
+	// Every entry runs on exactly one replica
+	for count := 1; count <= 8; count++ {
+		var runs int
+		for index := 0; index < count; index++ {
+			runs += len(planShard{index: index, count: count}.filter(plan))
+		}
+		if runs != len(plan) {
+			t.Errorf("%d replicas run %d entries, want %d", count, runs, len(plan))
+		}
+	}
+}
+
+func TestPlanShardShare(t *testing.T) {
+	plan := testPlan("q1", "q2", "q1", "q2", "q1", "q3")
+	for _, tc := range []struct {
+		shard planShard
+		query string
+		want  float64
+	}{
+		{planShard{index: 0, count: 1}, "q1", 1},
+		{planShard{index: 0, count: 2}, "q1", 1},
+		{planShard{index: 1, count: 2}, "q1", 0},
+		{planShard{index: 0, count: 4}, "q1", 2.0 / 3},
+		{planShard{index: 2, count: 4}, "q1", 1.0 / 3},
+		{planShard{index: 1, count: 4}, "q2", 0.5},
+		{planShard{index: 0, count: 2}, "unplanned", 0},
+	} {
+		if got := tc.shard.share(plan, tc.query); got != tc.want {
+			t.Errorf("replica %d of %d: share of %s = %v, want %v", tc.shard.index, tc.shard.count, tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestJobIdleRun(t *testing.T) {
+	j, err := newJobController(JobConfig{UntilPlanComplete: true}, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.idleRun("replica 6 of 8 has no plan entries")
+	select {
+	case <-j.context().Done():
+	default:
+		t.Fatalf("idle job without a duration did not end")
+	}
+	if code := j.evaluate(newRunStats(time.Now(), time.Second)); code != exitPass {
+		t.Errorf("idle job exit code = %d, want %d", code, exitPass)
+	}
+
+	j, err = newJobController(JobConfig{Duration: "1h"}, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.idleRun("replica 6 of 8 has no plan entries")
+	if j.context().Err() != nil {
+		t.Errorf("idle job ended before its duration")
+	}
+}
+
+func TestPlanShardSplit(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		n     int64
+		plan  []PlanEntry
+		count int
+		query string
+		want  []int64 // part of every replica
+	}{
+		{"unsharded", 7, testPlan("q1"), 1, "", []int64{7}},
+		{"even", 100, testPlan("q1", "q1", "q1", "q1"), 4, "q1", []int64{25, 25, 25, 25}},
+		// A query on 3 of 10 replicas keeps its whole budget
+		{"query on some replicas", 100, testPlan("q1", "q2", "q2", "q1", "q2", "q2", "q1", "q2", "q2", "q2"), 10, "q1",
+			[]int64{34, 0, 0, 33, 0, 0, 33, 0, 0, 0}},
+		// The global cap is not rounded up on every replica
+		{"global cap below the fleet", 5, testPlan("a", "b", "c", "d", "e", "f", "g", "h", "i", "j"), 10, "",
+			[]int64{1, 1, 1, 1, 1, 0, 0, 0, 0, 0}},
+		{"by share of the plan", 10, testPlan("a", "b", "c", "d", "e"), 2, "", []int64{6, 4}},
+		{"more replicas than entries", 9, testPlan("a", "b"), 4, "", []int64{5, 4, 0, 0}},
+		{"unplanned query", 10, testPlan("a"), 2, "b", []int64{0, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make([]int64, tc.count)
+			for i := range got {
+				got[i] = planShard{index: i, count: tc.count}.split(tc.n, tc.plan, tc.query)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parts = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
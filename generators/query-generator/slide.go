@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SlideConfig makes a bucket issue overlapping windows sliding forward through its range, like
+// a user scrubbing a dashboard, instead of independent windows. Consecutive requests of a
+// worker overlap, which exercises the query-frontend caches and block pruning the way
+// dashboards do.
+type SlideConfig struct {
+	Window  string  `yaml:"window"`  // Window length, e.g. "30m"
+	Step    string  `yaml:"step"`    // How far each request moves the window forward, e.g. "5m"
+	Overlap float64 `yaml:"overlap"` // Or the overlapping fraction of consecutive windows, e.g. 0.8 (step = window x (1 - overlap))
+}
+
+// windowSlide holds the position of every worker sliding through a bucket; it is shared by the
+// copies of the bucket
+type windowSlide struct {
+	window time.Duration
+	step   time.Duration
+
+	mu      sync.Mutex
+	cursors map[string]time.Time // start of the next window by worker
+}
+
+// newWindowSlide validates a slide config (nil when unset)
+func newWindowSlide(cfg SlideConfig) (*windowSlide, error) {
+	if cfg.Window == "" && cfg.Step == "" && cfg.Overlap == 0 {
+		return nil, nil
+	}
+	window, err := parseExtendedDuration(cfg.Window)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid window %q", cfg.Window)
+	}
+	s := &windowSlide{window: window, cursors: make(map[string]time.Time)}
+	switch {
+	case cfg.Step != "" && cfg.Overlap != 0:
+		return nil, fmt.Errorf("set either step or overlap")
+	case cfg.Step != "":
+		if s.step, err = parseExtendedDuration(cfg.Step); err != nil || s.step <= 0 {
+			return nil, fmt.Errorf("invalid step %q", cfg.Step)
+		}
+	case cfg.Overlap > 0 && cfg.Overlap < 1:
+		s.step = time.Duration(float64(window) * (1 - cfg.Overlap))
+	default:
+		return nil, fmt.Errorf("needs a step, or an overlap between 0 and 1 (got %g)", cfg.Overlap)
+	}
+	if s.step <= 0 {
+		return nil, fmt.Errorf("step must be > 0")
+	}
+	return s, nil
+}
+
+// next returns the window of a worker inside [start, end] and moves its cursor forward by the
+// step; a worker whose window would pass the end starts over at the oldest window
+func (s *windowSlide) next(worker string, start, end time.Time) (time.Time, time.Time) {
+	if end.Sub(start) <= s.window {
+		return start, end
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from, ok := s.cursors[worker]
+	if !ok || from.Before(start) || from.Add(s.window).After(end) {
+		from = start
+	}
+	s.cursors[worker] = from.Add(s.step)
+	return from, from.Add(s.window)
+}
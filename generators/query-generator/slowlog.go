@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default slow-query thresholds per query class
+const (
+	defaultSlowThreshold          = 5 * time.Second
+	defaultExpensiveSlowThreshold = 2 * time.Minute
+)
+
+// SlowLogConfig writes requests slower than a threshold to a dedicated log, like a database
+// slow-query log
+type SlowLogConfig struct {
+	Enabled    bool              `yaml:"enabled"`
+	Path       string            `yaml:"path"`       // NDJSON file entries are appended to (default: the generator log)
+	Thresholds map[string]string `yaml:"thresholds"` // Latency above which a request is logged, per query class (default: standard 5s, expensive 2m)
+}
+
+// slowQueries logs slow requests (nil when disabled)
+var slowQueries *slowQueryLog
+
+// slowQueryLog writes slow-query entries to a file or the log
+type slowQueryLog struct {
+	path       string
+	thresholds map[string]time.Duration
+	logged     *prometheus.CounterVec
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// newSlowQueryLog validates the slow-query log config and opens its file
+func newSlowQueryLog(cfg SlowLogConfig) (*slowQueryLog, error) {
+	l := &slowQueryLog{
+		path: cfg.Path,
+		thresholds: map[string]time.Duration{
+			queryClassStandard:  defaultSlowThreshold,
+			queryClassExpensive: defaultExpensiveSlowThreshold,
+		},
+	}
+	for class, value := range cfg.Thresholds {
+		if err := validateQueryClass(class); err != nil || class == "" {
+			return nil, fmt.Errorf("thresholds: unknown class %q", class)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid threshold %q for class %s", value, class)
+		}
+		l.thresholds[class] = d
+	}
+	if l.path != "" {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		l.f = f
+	}
+
+	l.logged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "query_load_test",
+		Subsystem: "slow_queries",
+		Name:      "logged_total",
+		Help:      "Requests written to the slow-query log",
+	}, []string{"name"})
+	return l, nil
+}
+
+// trace attaches timing hooks to a request; the returned timings are nil when disabled
+func (l *slowQueryLog) trace(req *http.Request) (*http.Request, *requestTimings) {
+	if l == nil {
+		return req, nil
+	}
+	t := &requestTimings{}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace())), t
+}
+
+// slowQueryEntry is one line of the slow-query log; phases that did not happen (e.g. DNS on a
+// reused connection) are omitted
+type slowQueryEntry struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Query            string    `json:"query"`
+	Class            string    `json:"class"`
+	Bucket           string    `json:"bucket"`
+	Tenant           string    `json:"tenant"`
+	URL              string    `json:"url"`
+	Status           int       `json:"status"`
+	ThresholdSeconds float64   `json:"thresholdSeconds"`
+	LatencySeconds   float64   `json:"latencySeconds"` // until response headers, as in the latency metrics
+	TotalSeconds     float64   `json:"totalSeconds"`   // until the response was read and decoded
+	DNSSeconds       float64   `json:"dnsSeconds,omitempty"`
+	ConnectSeconds   float64   `json:"connectSeconds,omitempty"`
+	TLSSeconds       float64   `json:"tlsSeconds,omitempty"`
+	WaitSeconds      float64   `json:"waitSeconds,omitempty"`     // request written to first response byte (server time)
+	TransferSeconds  float64   `json:"transferSeconds,omitempty"` // first response byte to body read
+	DecodeSeconds    float64   `json:"decodeSeconds,omitempty"`   // body read to end of processing
+	ReusedConnection bool      `json:"reusedConnection"`
+	Bytes            int64     `json:"bytes"`
+	Spans            int       `json:"spans"`
+	Traces           int       `json:"traces"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// observe writes the request to the slow-query log if it exceeded its class threshold
+func (l *slowQueryLog) observe(class string, req *http.Request, s *requestSample, t *requestTimings) {
+	if l == nil {
+		return
+	}
+	if class == "" {
+		class = queryClassStandard
+	}
+	threshold := l.thresholds[class]
+	if s.LatencySeconds < threshold.Seconds() {
+		return
+	}
+	end := time.Now()
+	entry := slowQueryEntry{
+		Timestamp:        s.Timestamp,
+		Query:            s.Query,
+		Class:            class,
+		Bucket:           s.Bucket,
+		Tenant:           redaction.tenant(s.Tenant),
+		URL:              redaction.url(req.URL),
+		Status:           s.Status,
+		ThresholdSeconds: threshold.Seconds(),
+		LatencySeconds:   s.LatencySeconds,
+		TotalSeconds:     end.Sub(s.Timestamp).Seconds(),
+		Bytes:            s.Bytes,
+		Spans:            s.Spans,
+		Traces:           s.Traces,
+		Error:            s.Error,
+	}
+	t.fill(&entry, end)
+	l.logged.WithLabelValues(s.Query).Inc()
+
+	// Keep the URL readable: no \u0026 for the & between parameters
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		log.Printf("Warning: Failed to encode slow-query entry: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		log.Printf("Slow query: %s", bytes.TrimSpace(buf.Bytes()))
+		return
+	}
+	if _, err := l.f.Write(buf.Bytes()); err != nil {
+		log.Printf("Warning: Failed to write slow-query log: %v", err)
+	}
+}
+
+// close closes the slow-query log file
+func (l *slowQueryLog) close() {
+	if l == nil || l.f == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.f.Close(); err != nil {
+		log.Printf("Warning: Failed to close slow-query log: %v", err)
+	}
+	l.f = nil
+}
+
+// requestTimings are the phase timestamps of one request, collected through httptrace
+type requestTimings struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	bodyRead                  time.Time
+	reused                    bool
+}
+
+// clientTrace returns the hooks recording the connection and response phases
+func (t *requestTimings) clientTrace() *httptrace.ClientTrace {
+	set := func(field *time.Time) {
+		t.mu.Lock()
+		*field = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:      func(string, string) { set(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart: func() { set(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+// bodyReadDone marks the end of reading the response body
+func (t *requestTimings) bodyReadDone() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.bodyRead = time.Now()
+	t.mu.Unlock()
+}
+
+// fill sets the phase durations of a slow-query entry
+func (t *requestTimings) fill(e *slowQueryEntry, end time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e.DNSSeconds = phaseSeconds(t.dnsStart, t.dnsDone)
+	e.ConnectSeconds = phaseSeconds(t.connectStart, t.connectDone)
+	e.TLSSeconds = phaseSeconds(t.tlsStart, t.tlsDone)
+	e.WaitSeconds = phaseSeconds(t.wroteRequest, t.firstByte)
+	e.TransferSeconds = phaseSeconds(t.firstByte, t.bodyRead)
+	e.DecodeSeconds = phaseSeconds(t.bodyRead, end)
+	e.ReusedConnection = t.reused
+}
+
+// phaseSeconds returns the length of a phase, or 0 when it was not observed
+func phaseSeconds(start, end time.Time) float64 {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Seconds()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// How spans are counted in search responses
+const (
+	spanCountingJSON = "json" // Decode the whole response (default)
+	spanCountingScan = "scan" // Count span and trace keys without decoding
+)
+
+// validateSpanCounting checks the configured span counting mode
+func validateSpanCounting(mode string) error {
+	switch mode {
+	case "", spanCountingJSON, spanCountingScan:
+		return nil
+	default:
+		return fmt.Errorf("unknown spanCounting %q (expected %s or %s)", mode, spanCountingJSON, spanCountingScan)
+	}
+}
+
+// Quoted keys counted when scanning
+var (
+	spanIDKey  = []byte(`"spanID"`)
+	traceIDKey = []byte(`"traceID"`)
+)
+
+// scanSearchResponse counts the spans and traces of a search response by scanning for their
+// ID keys. It counts exactly what decoding counts (spans of spanSet and spanSets alike) without
+// allocating, but does not validate the JSON.
+func scanSearchResponse(body []byte) (spans, traces int) {
+	return countJSONKey(body, spanIDKey), countJSONKey(body, traceIDKey)
+}
+
+// countJSONKey counts occurrences of a quoted key followed by a colon. Keys inside string
+// values are escaped (\"spanID\") and never match; a value equal to the key is not followed
+// by a colon.
+func countJSONKey(data, quotedKey []byte) int {
+	n := 0
+	for {
+		i := bytes.Index(data, quotedKey)
+		if i < 0 {
+			return n
+		}
+		data = data[i+len(quotedKey):]
+		j := 0
+		for j < len(data) && (data[j] == ' ' || data[j] == '\t' || data[j] == '\n' || data[j] == '\r') {
+			j++
+		}
+		if j < len(data) && data[j] == ':' {
+			n++
+		}
+	}
+}
+
+// bodyBufPool holds buffers response bodies are read into when scanning
+var bodyBufPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readPooledBody reads a response body into a pooled buffer; the returned bytes are only
+// valid until release is called
+func readPooledBody(r io.Reader) (body []byte, release func(), err error) {
+	buf := bodyBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	_, err = buf.ReadFrom(r)
+	return buf.Bytes(), func() { bodyBufPool.Put(buf) }, err
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Defaults of the concurrency stair-step experiment
+const (
+	defaultStairStepMaxConcurrency = 64
+	defaultStairStepStageDuration  = 2 * time.Minute
+)
+
+// StairStepConfig holds the QPS fixed and sweeps the workers per query in timed stages,
+// recording throughput and latency of every stage for the report
+type StairStepConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Concurrency    []int  `yaml:"concurrency"`    // Workers per query in each stage (default: 1, 2, 4, ... up to maxConcurrency)
+	MaxConcurrency int    `yaml:"maxConcurrency"` // Last stage of the default doubling sequence (default: 64)
+	StageDuration  string `yaml:"stageDuration"`  // How long each stage runs (default: 2m)
+}
+
+// stairStep runs the concurrency stair-step experiment (nil when disabled)
+var stairStep *stairStepExperiment
+
+// stairStepExperiment resizes the worker pools at every stage boundary and aggregates the
+// samples of each stage; it is a sample sink
+type stairStepExperiment struct {
+	levels        []int
+	stageDuration time.Duration
+	concurrency   prometheus.Gauge
+
+	mu     sync.Mutex
+	pools  []*workerPool
+	start  time.Time // zero until the experiment runs
+	stages []seriesPoint
+	load   []loadAverage // outstanding requests and workers sampled per stage
+}
+
+// parseStairStep validates the stair-step config and returns its levels and stage duration
+func parseStairStep(cfg StairStepConfig) ([]int, time.Duration, error) {
+	levels, stageDuration := cfg.Concurrency, defaultStairStepStageDuration
+	if cfg.StageDuration != "" {
+		d, err := time.ParseDuration(cfg.StageDuration)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("invalid stageDuration %q", cfg.StageDuration)
+		}
+		stageDuration = d
+	}
+	if len(levels) == 0 {
+		limit := cfg.MaxConcurrency
+		if limit <= 0 {
+			limit = defaultStairStepMaxConcurrency
+		}
+		for n := 1; n <= limit; n *= 2 {
+			levels = append(levels, n)
+		}
+	}
+	for _, n := range levels {
+		if n <= 0 {
+			return nil, 0, fmt.Errorf("concurrency levels must be positive, got %d", n)
+		}
+	}
+	return levels, stageDuration, nil
+}
+
+// newStairStepExperiment validates the stair-step config
+func newStairStepExperiment(cfg StairStepConfig) (*stairStepExperiment, error) {
+	levels, stageDuration, err := parseStairStep(cfg)
+	if err != nil {
+		return nil, err
+	}
+	e := &stairStepExperiment{levels: levels, stageDuration: stageDuration}
+	e.stages = make([]seriesPoint, len(e.levels))
+	e.load = make([]loadAverage, len(e.levels))
+
+	e.concurrency = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "query_load_test",
+		Subsystem: "stair_step",
+		Name:      "concurrency",
+		Help:      "Workers per query in the current stair-step stage",
+	})
+	return e, nil
+}
+
+// initialConcurrency returns the workers per query of the first stage
+func (e *stairStepExperiment) initialConcurrency() int {
+	return e.levels[0]
+}
+
+// duration returns the time needed to run every stage
+func (e *stairStepExperiment) duration() time.Duration {
+	return time.Duration(len(e.levels)) * e.stageDuration
+}
+
+// register adds the worker pool of an executor to the pools resized at every stage
+func (e *stairStepExperiment) register(pool *workerPool) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.pools = append(e.pools, pool)
+	e.mu.Unlock()
+}
+
+// run starts the first stage and steps through the others; after the last stage the pools
+// keep its concurrency
+func (e *stairStepExperiment) run(ctx context.Context) {
+	e.mu.Lock()
+	e.start = time.Now()
+	e.mu.Unlock()
+
+	for i, n := range e.levels {
+		log.Printf("Stair-step stage %d/%d: %d workers per query for %s", i+1, len(e.levels), n, e.stageDuration)
+		e.concurrency.Set(float64(n))
+		e.mu.Lock()
+		for _, pool := range e.pools {
+			pool.setWorkers(n)
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.stageDuration):
+		}
+	}
+	log.Printf("Stair-step experiment complete, keeping %d workers per query", e.levels[len(e.levels)-1])
+}
+
+// stageEnd returns the end of the stage running at now (zero when the experiment is not running
+// or after its last stage)
+func (e *stairStepExperiment) stageEnd(now time.Time) time.Time {
+	if e == nil {
+		return time.Time{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.start.IsZero() || now.Before(e.start) {
+		return time.Time{}
+	}
+	stage := int(now.Sub(e.start)/e.stageDuration) + 1
+	if stage >= len(e.levels) {
+		return time.Time{}
+	}
+	return e.start.Add(time.Duration(stage) * e.stageDuration)
+}
+
+func (e *stairStepExperiment) write(s *requestSample) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.start.IsZero() || s.Timestamp.Before(e.start) {
+		return nil
+	}
+	// Requests are attributed to the stage they were sent in
+	stage := int(s.Timestamp.Sub(e.start) / e.stageDuration)
+	if stage < len(e.stages) {
+		e.stages[stage].add(s)
+	}
+	return nil
+}
+
+func (e *stairStepExperiment) close() error {
+	return nil
+}
+
+// addLoad records a sample of outstanding requests and workers in the stage running at now
+func (e *stairStepExperiment) addLoad(now time.Time, inFlight, workers int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.start.IsZero() || now.Before(e.start) {
+		return
+	}
+	if stage := int(now.Sub(e.start) / e.stageDuration); stage < len(e.load) {
+		e.load[stage].add(inFlight, workers)
+	}
+}
+
+// stageResult is the throughput and latency of one stair-step stage across all queries
+type stageResult struct {
+	Concurrency int
+	Duration    time.Duration // time the stage ran, shorter than stageDuration when the run ended early
+	Requests    int64
+	QPS         float64
+	ErrorRate   float64 // percent
+	P50         float64
+	P99         float64
+	Mean        float64
+	Little      littlesLawCheck // observed vs implied outstanding requests
+}
+
+// results returns the stages that have started, in order (nil when disabled); targetQPS is the
+// total across all queries
+func (e *stairStepExperiment) results(end time.Time, targetQPS float64) []stageResult {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.start.IsZero() {
+		return nil
+	}
+
+	var results []stageResult
+	for i := range e.stages {
+		stageStart := e.start.Add(time.Duration(i) * e.stageDuration)
+		if !stageStart.Before(end) {
+			break
+		}
+		duration := e.stageDuration
+		if remaining := end.Sub(stageStart); remaining < duration {
+			duration = remaining
+		}
+		p := &e.stages[i]
+		results = append(results, stageResult{
+			Concurrency: e.levels[i],
+			Duration:    duration,
+			Requests:    p.count,
+			QPS:         p.qps(duration),
+			ErrorRate:   p.errorRate() * 100,
+			P50:         p.latency.quantile(0.5),
+			P99:         p.latency.quantile(0.99),
+			Mean:        p.latency.mean(),
+			Little:      newLittlesLawCheck(e.load[i], targetQPS, p.qps(duration), p.latency.mean()),
+		})
+	}
+	return results
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStairStep returns an experiment whose first stage started at start, without metrics
+func testStairStep(levels []int, stageDuration time.Duration, start time.Time) *stairStepExperiment {
+	return &stairStepExperiment{
+		levels:        levels,
+		stageDuration: stageDuration,
+		start:         start,
+		stages:        make([]seriesPoint, len(levels)),
+		load:          make([]loadAverage, len(levels)),
+	}
+}
+
+func TestParseStairStep(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      StairStepConfig
+		levels   []int
+		duration time.Duration
+	}{
+		{"defaults", StairStepConfig{}, []int{1, 2, 4, 8, 16, 32, 64}, defaultStairStepStageDuration},
+		{"max concurrency", StairStepConfig{MaxConcurrency: 10, StageDuration: "30s"}, []int{1, 2, 4, 8}, 30 * time.Second},
+		{"levels", StairStepConfig{Concurrency: []int{3, 1, 5}, MaxConcurrency: 2}, []int{3, 1, 5}, defaultStairStepStageDuration},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			levels, duration, err := parseStairStep(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(levels, tc.levels) || duration != tc.duration {
+				t.Errorf("parseStairStep = %v, %s, want %v, %s", levels, duration, tc.levels, tc.duration)
+			}
+		})
+	}
+	for _, cfg := range []StairStepConfig{{Concurrency: []int{1, 0}}, {StageDuration: "0s"}, {StageDuration: "soon"}} {
+		if _, _, err := parseStairStep(cfg); err == nil {
+			t.Errorf("parseStairStep(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestStairStepStageAttribution(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	e := testStairStep([]int{1, 2, 4}, time.Minute, start)
+
+	// Samples are attributed to the stage they were sent in, whenever they complete
+	for _, tc := range []struct {
+		sent   time.Duration // after the start
+		status int
+	}{
+		{-time.Second, 200}, // before the experiment
+		{0, 200},
+		{30 * time.Second, 500},
+		{time.Minute - time.Nanosecond, 200},
+		{time.Minute, 200},
+		{119 * time.Second, 200},
+		{2 * time.Minute, 200},
+		{3 * time.Minute, 200}, // after the last stage
+	} {
+		if err := e.write(&requestSample{Timestamp: start.Add(tc.sent), Status: tc.status, LatencySeconds: 0.1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.addLoad(start.Add(10*time.Second), 2, 1)
+	e.addLoad(start.Add(70*time.Second), 4, 2)
+	e.addLoad(start.Add(80*time.Second), 6, 2)
+	e.addLoad(start.Add(-time.Second), 100, 100)
+
+	var counts, errors []int64
+	for _, p := range e.stages {
+		counts = append(counts, p.count)
+		errors = append(errors, p.errors)
+	}
+	if want := []int64{3, 2, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("requests per stage = %v, want %v", counts, want)
+	}
+	if want := []int64{1, 0, 0}; !reflect.DeepEqual(errors, want) {
+		t.Errorf("errors per stage = %v, want %v", errors, want)
+	}
+	if got := []int64{e.load[0].samples, e.load[1].samples, e.load[2].samples}; !reflect.DeepEqual(got, []int64{1, 2, 0}) {
+		t.Errorf("load samples per stage = %v, want [1 2 0]", got)
+	}
+
+	// The run ended 30s into the last stage
+	results := e.results(start.Add(150*time.Second), 0)
+	if len(results) != 3 {
+		t.Fatalf("results = %d stages, want 3", len(results))
+	}
+	for i, want := range []struct {
+		concurrency int
+		duration    time.Duration
+		requests    int64
+	}{{1, time.Minute, 3}, {2, time.Minute, 2}, {4, 30 * time.Second, 1}} {
+		got := results[i]
+		if got.Concurrency != want.concurrency || got.Duration != want.duration || got.Requests != want.requests {
+			t.Errorf("stage %d = %d workers for %s with %d requests, want %d for %s with %d",
+				i+1, got.Concurrency, got.Duration, got.Requests, want.concurrency, want.duration, want.requests)
+		}
+	}
+	if got := results[0].ErrorRate; got < 33.3 || got > 33.4 {
+		t.Errorf("stage 1 error rate = %.2f%%, want 33.33%%", got)
+	}
+	if got := results[2].QPS; got != 1.0/30 {
+		t.Errorf("stage 3 QPS = %v, want one request over 30s", got)
+	}
+
+	// Stages that had not started when the run ended are left out
+	if results := e.results(start.Add(90*time.Second), 0); len(results) != 2 || results[1].Duration != 30*time.Second {
+		t.Errorf("results of a run ended in stage 2 = %+v, want 2 stages, the last of 30s", results)
+	}
+}
+
+func TestStairStepStageEnd(t *testing.T) {
+	start := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	e := testStairStep([]int{1, 2, 4}, time.Minute, start)
+	for _, tc := range []struct {
+		at   time.Duration
+		want time.Duration // end after the start, -1 for none
+	}{
+		{-time.Second, -1},
+		{0, time.Minute},
+		{59 * time.Second, time.Minute},
+		{time.Minute, 2 * time.Minute},
+		{2 * time.Minute, -1}, // the last stage runs on
+		{5 * time.Minute, -1},
+	} {
+		got := e.stageEnd(start.Add(tc.at))
+		want := time.Time{}
+		if tc.want >= 0 {
+			want = start.Add(tc.want)
+		}
+		if !got.Equal(want) {
+			t.Errorf("stageEnd(+%s) = %s, want %s", tc.at, got, want)
+		}
+	}
+	if end := testStairStep([]int{1, 2}, time.Minute, time.Time{}).stageEnd(start); !end.IsZero() {
+		t.Errorf("stageEnd before the experiment runs = %s, want zero", end)
+	}
+	var disabled *stairStepExperiment
+	if end := disabled.stageEnd(start); !end.IsZero() {
+		t.Errorf("stageEnd when disabled = %s, want zero", end)
+	}
+}
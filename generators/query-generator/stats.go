@@ -0,0 +1,294 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency histogram layout: log-scale buckets growing by 20% from 1ms, covering up to ~40 minutes
+const (
+	latencyHistBuckets = 80
+	latencyHistMin     = 0.001
+	latencyHistGrowth  = 1.2
+)
+
+// maxSeriesPoints bounds the number of time series points kept per query; when exceeded,
+// adjacent points are merged and the resolution halves
+const maxSeriesPoints = 720
+
+// latencyHistogram is a compact log-scale histogram used to compute percentiles of a run
+type latencyHistogram struct {
+	counts [latencyHistBuckets + 1]uint64
+	total  uint64
+	sum    float64
+}
+
+// observe adds a latency in seconds
+func (h *latencyHistogram) observe(seconds float64) {
+	idx := 0
+	if seconds > latencyHistMin {
+		idx = int(math.Ceil(math.Log(seconds/latencyHistMin) / math.Log(latencyHistGrowth)))
+		if idx > latencyHistBuckets {
+			idx = latencyHistBuckets
+		}
+	}
+	h.counts[idx]++
+	h.total++
+	h.sum += seconds
+}
+
+// merge adds the observations of another histogram
+func (h *latencyHistogram) merge(o *latencyHistogram) {
+	for i := range h.counts {
+		h.counts[i] += o.counts[i]
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// quantile returns the upper bound of the bucket holding the q-quantile (0 when empty)
+func (h *latencyHistogram) quantile(q float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= rank {
+			return latencyHistMin * math.Pow(latencyHistGrowth, float64(i))
+		}
+	}
+	return latencyHistMin * math.Pow(latencyHistGrowth, latencyHistBuckets)
+}
+
+// mean returns the average latency (0 when empty)
+func (h *latencyHistogram) mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// seriesPoint aggregates the samples of one time slot
+type seriesPoint struct {
+	count     int64
+	errors    int64
+	throttled int64 // 429s that paused the query, neither errors nor latency samples
+	spans     int64
+	bytes     int64 // response bytes of successful requests
+	latency   latencyHistogram
+}
+
+// add records a sample in the point
+func (p *seriesPoint) add(s *requestSample) {
+	p.count++
+	if s.Throttled {
+		p.throttled++
+		return
+	}
+	if s.failed() {
+		p.errors++
+		return
+	}
+	p.spans += int64(s.Spans)
+	p.bytes += s.Bytes
+	p.latency.observe(s.LatencySeconds)
+}
+
+// merge adds the samples of another point
+func (p *seriesPoint) merge(o *seriesPoint) {
+	p.count += o.count
+	p.errors += o.errors
+	p.throttled += o.throttled
+	p.spans += o.spans
+	p.bytes += o.bytes
+	p.latency.merge(&o.latency)
+}
+
+// failed reports whether the sample is a failed request
+func (s *requestSample) failed() bool {
+	return s.Status == 0 || s.Status >= 300
+}
+
+// queryStats aggregates the samples of a single query over the run
+type queryStats struct {
+	name    string
+	total   seriesPoint
+	series  []seriesPoint
+	tenants map[string]*seriesPoint // totals per tenant, compared when requests rotate across tenants
+}
+
+// stats aggregates the run for end-of-run reports (nil when no report is configured)
+var stats *runStats
+
+// runStats aggregates samples per query for reports; it is a sample sink
+type runStats struct {
+	mu      sync.Mutex
+	start   time.Time
+	last    time.Time
+	width   time.Duration // width of a series point
+	queries map[string]*queryStats
+}
+
+// newRunStats creates run statistics with the given initial time resolution
+func newRunStats(start time.Time, resolution time.Duration) *runStats {
+	return &runStats{
+		start:   start,
+		last:    start,
+		width:   resolution,
+		queries: make(map[string]*queryStats),
+	}
+}
+
+func (r *runStats) write(s *requestSample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q, ok := r.queries[s.Query]
+	if !ok {
+		q = &queryStats{name: s.Query}
+		r.queries[s.Query] = q
+	}
+	q.total.add(s)
+	if s.Tenant != "" {
+		if q.tenants == nil {
+			q.tenants = make(map[string]*seriesPoint)
+		}
+		t, ok := q.tenants[s.Tenant]
+		if !ok {
+			t = &seriesPoint{}
+			q.tenants[s.Tenant] = t
+		}
+		t.add(s)
+	}
+
+	slot := int(s.Timestamp.Sub(r.start) / r.width)
+	if slot < 0 {
+		slot = 0
+	}
+	for slot >= maxSeriesPoints {
+		r.compact()
+		slot = int(s.Timestamp.Sub(r.start) / r.width)
+	}
+	for len(q.series) <= slot {
+		q.series = append(q.series, seriesPoint{})
+	}
+	q.series[slot].add(s)
+
+	if s.Timestamp.After(r.last) {
+		r.last = s.Timestamp
+	}
+	return nil
+}
+
+func (r *runStats) close() error {
+	return nil
+}
+
+// compact halves the resolution of every series by merging adjacent points
+func (r *runStats) compact() {
+	for _, q := range r.queries {
+		merged := make([]seriesPoint, (len(q.series)+1)/2)
+		for i := range q.series {
+			merged[i/2].merge(&q.series[i])
+		}
+		q.series = merged
+	}
+	r.width *= 2
+}
+
+// queryStatsSnapshot is a consistent copy of a query's statistics
+type queryStatsSnapshot struct {
+	queryStats
+	width time.Duration
+}
+
+// snapshot returns a copy of the statistics of every query, sorted by name, and the run duration
+func (r *runStats) snapshot() ([]queryStatsSnapshot, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]queryStatsSnapshot, 0, len(r.queries))
+	for _, q := range r.queries {
+		c := *q
+		c.series = append([]seriesPoint(nil), q.series...)
+		c.tenants = make(map[string]*seriesPoint, len(q.tenants))
+		for tenant, t := range q.tenants {
+			p := *t
+			c.tenants[tenant] = &p
+		}
+		result = append(result, queryStatsSnapshot{queryStats: c, width: r.width})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, r.last.Sub(r.start)
+}
+
+// qps returns the achieved requests per second over the given duration
+func (p *seriesPoint) qps(d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(p.count) / d.Seconds()
+}
+
+// errorRate returns the fraction of failed requests
+func (p *seriesPoint) errorRate() float64 {
+	if p.count == 0 {
+		return 0
+	}
+	return float64(p.errors) / float64(p.count)
+}
+
+// avgSpans returns the average spans returned per successful request
+func (p *seriesPoint) avgSpans() float64 {
+	if p.latency.total == 0 {
+		return 0
+	}
+	return float64(p.spans) / float64(p.latency.total)
+}
+
+// avgBytes returns the mean response size of successful requests
+func (p *seriesPoint) avgBytes() float64 {
+	if p.latency.total == 0 {
+		return 0
+	}
+	return float64(p.bytes) / float64(p.latency.total)
+}
+
+// recentQueryStats holds the run totals of a query and its statistics over a recent window
+type recentQueryStats struct {
+	name   string
+	total  seriesPoint
+	recent seriesPoint
+	span   time.Duration // time covered by recent
+}
+
+// recent returns, sorted by query name, the run totals and the statistics over (at least) the
+// last window of every query. It avoids copying whole series so it can be polled frequently.
+func (r *runStats) recent(now time.Time, window time.Duration) []recentQueryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from := int((now.Sub(r.start) - window) / r.width)
+	if from < 0 {
+		from = 0
+	}
+	span := now.Sub(r.start.Add(time.Duration(from) * r.width))
+
+	result := make([]recentQueryStats, 0, len(r.queries))
+	for _, q := range r.queries {
+		s := recentQueryStats{name: q.name, total: q.total, span: span}
+		for i := from; i < len(q.series); i++ {
+			s.recent.merge(&q.series[i])
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsdMaxPacket keeps datagrams below the common 1500 byte MTU
+const statsdMaxPacket = 1432
+
+// statsd emits metrics to a StatsD/DogStatsD agent (nil when not configured)
+var statsd *statsDSink
+
+// statsDSink mirrors the Prometheus registry to StatsD: counters are sent as deltas, gauges as
+// values, and request latencies as timings at observation time
+type statsDSink struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+
+	mu       sync.Mutex
+	buf      []byte
+	previous map[string]float64
+}
+
+// newStatsDSink connects the UDP socket of the agent
+func newStatsDSink(cfg MetricsSinkConfig) (*statsDSink, error) {
+	addr := cfg.Address
+	if addr == "" {
+		addr = "localhost:8125"
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "query_load_test"
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	log.Printf("Sending metrics to StatsD agent at %s (prefix: %s, tags: %v)", addr, prefix, cfg.Tags)
+	return &statsDSink{conn: conn, prefix: prefix, tags: cfg.Tags, previous: make(map[string]float64)}, nil
+}
+
+// timing sends a latency observation in milliseconds
+func (s *statsDSink) timing(name string, seconds float64, labels ...labelPair) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send(name, fmt.Sprintf("%.3f", seconds*1000), "ms", labels)
+	s.flushLocked()
+}
+
+// run flushes the registry every interval
+func (s *statsDSink) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.flushRegistry(prometheus.DefaultGatherer); err != nil {
+			log.Printf("Warning: Failed to send metrics to StatsD: %v", err)
+		}
+	}
+}
+
+// flushRegistry sends counter deltas and gauge values since the previous flush
+func (s *statsDSink) flushRegistry(g prometheus.Gatherer) error {
+	points, err := gatherMetricPoints(g)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range points {
+		if p.gauge {
+			s.send(p.name, fmt.Sprintf("%g", p.value), "g", p.labels)
+			continue
+		}
+		key := p.key()
+		delta := p.value - s.previous[key]
+		s.previous[key] = p.value
+		if delta > 0 {
+			s.send(p.name, fmt.Sprintf("%g", delta), "c", p.labels)
+		}
+	}
+	s.flushLocked()
+	return nil
+}
+
+// send appends a line to the packet buffer, flushing first when it would not fit
+func (s *statsDSink) send(name, value, kind string, labels []labelPair) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(".")
+	b.WriteString(statsdSanitize(name))
+	if !s.tags {
+		for _, l := range labels {
+			b.WriteString(".")
+			b.WriteString(statsdSanitize(l.value))
+		}
+	}
+	fmt.Fprintf(&b, ":%s|%s", value, kind)
+	if s.tags && len(labels) > 0 {
+		b.WriteString("|#")
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "%s:%s", l.name, strings.NewReplacer(",", "_", "|", "_").Replace(l.value))
+		}
+	}
+
+	line := b.String()
+	if len(s.buf) > 0 && len(s.buf)+1+len(line) > statsdMaxPacket {
+		s.flushLocked()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, line...)
+}
+
+// flushLocked sends the buffered lines; errors are dropped like any lost UDP datagram
+func (s *statsDSink) flushLocked() {
+	if len(s.buf) == 0 {
+		return
+	}
+	s.conn.Write(s.buf)
+	s.buf = s.buf[:0]
+}
+
+// statsdSanitize replaces the characters that have a meaning in the StatsD protocol
+func statsdSanitize(s string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_").Replace(s)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var suitesFlag = flag.String("suites", "", "Comma-separated query suites to run, overriding the suites enabled in the config (env: QUERY_SUITES)")
+
+// SuiteConfig groups queries under a name so one config can serve several test intents
+type SuiteConfig struct {
+	Name    string   `yaml:"name"`
+	Enabled bool     `yaml:"enabled"` // Run this suite when none are selected with --suites/QUERY_SUITES
+	Queries []string `yaml:"queries"` // Names of the queries in the suite
+}
+
+// selectedSuites returns the suites selected at startup, from --suites or QUERY_SUITES
+func selectedSuites() []string {
+	value := *suitesFlag
+	if value == "" {
+		value = os.Getenv("QUERY_SUITES")
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// selectSuites keeps the queries of the selected suites, or of the enabled ones when none are
+// selected, and drops plan entries of the other queries. Without suites every query runs.
+func selectSuites(suites []SuiteConfig, selected []string, queries []QueryConfig, plan []PlanEntry) ([]QueryConfig, []PlanEntry, []string, error) {
+	if len(suites) == 0 {
+		if len(selected) > 0 {
+			return nil, nil, nil, fmt.Errorf("suites %v selected but no suites are defined", selected)
+		}
+		return queries, plan, nil, nil
+	}
+
+	byName := make(map[string]SuiteConfig, len(suites))
+	for _, s := range suites {
+		byName[s.Name] = s
+	}
+	if len(selected) == 0 {
+		for _, s := range suites {
+			if s.Enabled {
+				selected = append(selected, s.Name)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, nil, nil, fmt.Errorf("no suite is enabled; enable one in the config or select one with --suites")
+		}
+	}
+
+	keep := make(map[string]bool)
+	for _, name := range selected {
+		s, ok := byName[name]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("unknown suite %q", name)
+		}
+		for _, q := range s.Queries {
+			keep[q] = true
+		}
+	}
+
+	known := make(map[string]bool, len(queries))
+	var kept []QueryConfig
+	for _, q := range queries {
+		known[q.Name] = true
+		if keep[q.Name] {
+			kept = append(kept, q)
+		}
+	}
+	for name := range keep {
+		if !known[name] {
+			return nil, nil, nil, fmt.Errorf("suite references undefined query: %s", name)
+		}
+	}
+
+	var keptPlan []PlanEntry
+	for _, entry := range plan {
+		if keep[entry.QueryName] || !known[entry.QueryName] {
+			// Entries of undefined queries are kept so plan validation still reports them
+			keptPlan = append(keptPlan, entry)
+		}
+	}
+	return kept, keptPlan, selected, nil
+}
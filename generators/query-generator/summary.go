@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultSummaryTolerance is the relative regression of p99 latency and achieved QPS allowed
+// before a query is flagged against the baseline
+const defaultSummaryTolerance = 0.1
+
+// maxErrorRateIncrease is the absolute increase of the error rate (in percentage points)
+// allowed before a query is flagged against the baseline
+const maxErrorRateIncrease = 1.0
+
+// runSummary is the compact, machine-readable result of a run
+type runSummary struct {
+	Namespace       string              `json:"namespace"`
+	Cluster         string              `json:"cluster,omitempty"`
+	Pod             string              `json:"pod,omitempty"`
+	Node            string              `json:"node,omitempty"`
+	Start           time.Time           `json:"start"`
+	DurationSeconds float64             `json:"durationSeconds"`
+	Queries         []querySummary      `json:"queries"`
+	Stages          []stageSummary      `json:"stages,omitempty"` // Concurrency stair-step stages
+	LittlesLaw      *littlesLawSummary  `json:"littlesLaw,omitempty"`
+	Tenants         []tenantComparison  `json:"tenants,omitempty"`     // Per-tenant results of queries run against several tenants
+	Calibration     []calibrationResult `json:"calibration,omitempty"` // Baselines measured before the load
+	Pauses          []pauseResult       `json:"pauses,omitempty"`      // Scheduled pause windows with the results around them
+	// Latency histogram buckets recommended from the observed latencies
+	LatencyBuckets []bucketRecommendation `json:"latencyBuckets,omitempty"`
+	// Tempo CPU attributed to each query, and the CPU seconds used while no query ran
+	Costs           []queryCost `json:"costs,omitempty"`
+	UnattributedCPU float64     `json:"unattributedCPUSeconds,omitempty"`
+}
+
+// littlesLawSummary compares observed and implied outstanding requests of a run or stage
+type littlesLawSummary struct {
+	ObservedInFlight float64 `json:"observedInFlight"`
+	ImpliedInFlight  float64 `json:"impliedInFlight"` // achieved QPS x mean latency
+	Workers          float64 `json:"workers"`
+	Verdict          string  `json:"verdict"`
+}
+
+// newLittlesLawSummary condenses a Little's-law check
+func newLittlesLawSummary(c littlesLawCheck) *littlesLawSummary {
+	return &littlesLawSummary{
+		ObservedInFlight: c.ObservedInFlight,
+		ImpliedInFlight:  c.ImpliedInFlight,
+		Workers:          c.Workers,
+		Verdict:          c.Verdict,
+	}
+}
+
+// stageSummary is the result of a concurrency stair-step stage across all queries
+type stageSummary struct {
+	Concurrency     int                `json:"concurrency"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Requests        int64              `json:"requests"`
+	AchievedQPS     float64            `json:"achievedQPS"`
+	P50Seconds      float64            `json:"p50Seconds"`
+	P99Seconds      float64            `json:"p99Seconds"`
+	MeanSeconds     float64            `json:"meanSeconds"`
+	ErrorRatePct    float64            `json:"errorRatePercent"`
+	LittlesLaw      *littlesLawSummary `json:"littlesLaw"`
+}
+
+// querySummary is the result of a single query over a run
+type querySummary struct {
+	Name         string   `json:"name"`
+	Requests     int64    `json:"requests"`
+	TargetQPS    float64  `json:"targetQPS"` // 0 = unlimited
+	AchievedQPS  float64  `json:"achievedQPS"`
+	P50Seconds   float64  `json:"p50Seconds"`
+	P99Seconds   float64  `json:"p99Seconds"`
+	ErrorRatePct float64  `json:"errorRatePercent"`
+	AvgSpans     float64  `json:"avgSpans"`
+	Apdex        *float64 `json:"apdex,omitempty"` // Over the run, when query.apdex is enabled
+	// Mean response size of successful requests, used to estimate the data volume of later runs
+	AvgBytes float64 `json:"avgBytes,omitempty"`
+	// 429 responses that paused the query, and the wall-clock time it was paused
+	Throttled        int64   `json:"throttled,omitempty"`
+	ThrottledSeconds float64 `json:"throttledSeconds,omitempty"`
+}
+
+// newRunSummary condenses a report into a summary
+func newRunSummary(report *runReport) *runSummary {
+	s := &runSummary{
+		Namespace:       report.Namespace,
+		Pod:             report.Pod,
+		Node:            report.Node,
+		Start:           report.Start,
+		DurationSeconds: report.Duration.Seconds(),
+		Tenants:         report.Tenants,
+		Calibration:     report.Calibration,
+		Pauses:          report.Pauses,
+		LatencyBuckets:  report.LatencyBuckets,
+		Costs:           report.Costs,
+		UnattributedCPU: report.UnattributedCPU,
+	}
+	for _, q := range report.Queries {
+		var score *float64
+		if value, ok := apdex.runScore(q.name); ok {
+			score = &value
+		}
+		s.Queries = append(s.Queries, querySummary{
+			Name:         q.name,
+			Requests:     q.total.count,
+			TargetQPS:    report.TargetQPS,
+			AchievedQPS:  q.total.qps(report.Duration),
+			P50Seconds:   q.total.latency.quantile(0.5),
+			P99Seconds:   q.total.latency.quantile(0.99),
+			ErrorRatePct: q.total.errorRate() * 100,
+			AvgSpans:     q.total.avgSpans(),
+			AvgBytes:     q.total.avgBytes(),
+			Apdex:        score,
+
+			Throttled:        q.total.throttled,
+			ThrottledSeconds: throttledTime(q.name).Seconds(),
+		})
+	}
+	for _, stage := range report.Stages {
+		s.Stages = append(s.Stages, stageSummary{
+			Concurrency:     stage.Concurrency,
+			DurationSeconds: stage.Duration.Seconds(),
+			Requests:        stage.Requests,
+			AchievedQPS:     stage.QPS,
+			P50Seconds:      stage.P50,
+			P99Seconds:      stage.P99,
+			MeanSeconds:     stage.Mean,
+			ErrorRatePct:    stage.ErrorRate,
+			LittlesLaw:      newLittlesLawSummary(stage.Little),
+		})
+	}
+	if report.Load != nil {
+		s.LittlesLaw = newLittlesLawSummary(*report.Load)
+	}
+	return s
+}
+
+// writeSummaryJSON writes the summary so that it can be used as the baseline of a later run
+func writeSummaryJSON(path string, s *runSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// loadSummaryJSON reads a summary written by a previous run
+func loadSummaryJSON(path string) (*runSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s runSummary
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// verdict compares a query against its baseline and returns a short verdict with the reasons
+func (q querySummary) verdict(base *querySummary, tolerance float64) string {
+	if base == nil {
+		return "🆕 no baseline"
+	}
+
+	var reasons []string
+	if base.P99Seconds > 0 && q.P99Seconds > base.P99Seconds*(1+tolerance) {
+		reasons = append(reasons, fmt.Sprintf("p99 %+.0f%%", (q.P99Seconds/base.P99Seconds-1)*100))
+	}
+	if base.AchievedQPS > 0 && q.AchievedQPS < base.AchievedQPS*(1-tolerance) {
+		reasons = append(reasons, fmt.Sprintf("QPS %+.0f%%", (q.AchievedQPS/base.AchievedQPS-1)*100))
+	}
+	if q.ErrorRatePct > base.ErrorRatePct+maxErrorRateIncrease {
+		reasons = append(reasons, fmt.Sprintf("errors %+.1fpp", q.ErrorRatePct-base.ErrorRatePct))
+	}
+	if len(reasons) > 0 {
+		return "❌ " + strings.Join(reasons, ", ")
+	}
+	return "✅ pass"
+}
+
+// writeMarkdownSummary writes a GitHub-flavored Markdown table meant to be posted as a PR comment
+func writeMarkdownSummary(path string, s *runSummary, baseline *runSummary, tolerance float64, loc *time.Location) error {
+	if tolerance <= 0 {
+		tolerance = defaultSummaryTolerance
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Tempo query load results (`%s`)\n\n", s.Namespace)
+	fmt.Fprintf(&b, "Start: %s · Duration: %s", formatZoned(s.Start, loc), time.Duration(s.DurationSeconds*float64(time.Second)).Round(time.Second))
+	if s.Cluster != "" {
+		fmt.Fprintf(&b, " · cluster `%s`", s.Cluster)
+	}
+	if s.Pod != "" {
+		fmt.Fprintf(&b, " · pod `%s`", s.Pod)
+	}
+	if baseline != nil {
+		fmt.Fprintf(&b, " · compared to baseline from %s (tolerance %.0f%%)", formatZoned(baseline.Start, loc), tolerance*100)
+	}
+	b.WriteString("\n\n")
+
+	withApdex, withThrottling := false, false
+	for _, q := range s.Queries {
+		withApdex = withApdex || q.Apdex != nil
+		withThrottling = withThrottling || q.Throttled > 0
+	}
+
+	b.WriteString("| Query | Target QPS | Achieved QPS | p50 | p99 | Error rate |")
+	if withApdex {
+		b.WriteString(" Apdex |")
+	}
+	if withThrottling {
+		b.WriteString(" Throttled |")
+	}
+	if baseline != nil {
+		b.WriteString(" Baseline p99 | Verdict |")
+	}
+	b.WriteString("\n|:--|--:|--:|--:|--:|--:|")
+	if withApdex {
+		b.WriteString("--:|")
+	}
+	if withThrottling {
+		b.WriteString("--:|")
+	}
+	if baseline != nil {
+		b.WriteString("--:|:--|")
+	}
+	b.WriteString("\n")
+
+	regressions := 0
+	for _, q := range s.Queries {
+		target := "unlimited"
+		if q.TargetQPS > 0 {
+			target = fmt.Sprintf("%.2f", q.TargetQPS)
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %.2f | %s | %s | %.2f%% |", q.Name, target, q.AchievedQPS,
+			formatSeconds(q.P50Seconds), formatSeconds(q.P99Seconds), q.ErrorRatePct)
+		if withApdex {
+			if q.Apdex != nil {
+				fmt.Fprintf(&b, " %.2f |", *q.Apdex)
+			} else {
+				b.WriteString(" - |")
+			}
+		}
+		if withThrottling {
+			fmt.Fprintf(&b, " %d (%s) |", q.Throttled, time.Duration(q.ThrottledSeconds*float64(time.Second)).Round(time.Second))
+		}
+
+		if baseline != nil {
+			var base *querySummary
+			for i := range baseline.Queries {
+				if baseline.Queries[i].Name == q.Name {
+					base = &baseline.Queries[i]
+					break
+				}
+			}
+			basePercentile := "-"
+			if base != nil {
+				basePercentile = formatSeconds(base.P99Seconds)
+			}
+			verdict := q.verdict(base, tolerance)
+			if strings.HasPrefix(verdict, "❌") {
+				regressions++
+			}
+			fmt.Fprintf(&b, " %s | %s |", basePercentile, verdict)
+		}
+		b.WriteString("\n")
+	}
+
+	if baseline != nil {
+		b.WriteString("\n")
+		if regressions > 0 {
+			fmt.Fprintf(&b, "**%d of %d queries regressed against the baseline.**\n", regressions, len(s.Queries))
+		} else {
+			b.WriteString("No regressions against the baseline.\n")
+		}
+	}
+	if s.LittlesLaw != nil {
+		fmt.Fprintf(&b, "\nLittle's law: %.2f requests in flight observed vs %.2f implied by QPS x latency — %s\n",
+			s.LittlesLaw.ObservedInFlight, s.LittlesLaw.ImpliedInFlight, s.LittlesLaw.Verdict)
+	}
+	writeTenantComparison(&b, s.Tenants)
+	writeCalibration(&b, s.Calibration)
+	writePauses(&b, s.Pauses)
+	writeBucketRecommendations(&b, s.LatencyBuckets)
+	writeCosts(&b, s.Costs, s.UnattributedCPU)
+
+	if len(s.Stages) > 0 {
+		b.WriteString("\n#### Concurrency stair-step\n\n")
+		b.WriteString("| Workers per query | Achieved QPS | p50 | p99 | Error rate | In flight (observed / implied) | Little's law |\n|--:|--:|--:|--:|--:|--:|:--|\n")
+		for _, stage := range s.Stages {
+			fmt.Fprintf(&b, "| %d | %.2f | %s | %s | %.2f%% |", stage.Concurrency, stage.AchievedQPS,
+				formatSeconds(stage.P50Seconds), formatSeconds(stage.P99Seconds), stage.ErrorRatePct)
+			if stage.LittlesLaw != nil {
+				fmt.Fprintf(&b, " %.2f / %.2f | %s |\n", stage.LittlesLaw.ObservedInFlight, stage.LittlesLaw.ImpliedInFlight, stage.LittlesLaw.Verdict)
+			} else {
+				b.WriteString(" - | - |\n")
+			}
+		}
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Query targets, which determine the search URL layout and how the tenant is passed
+const (
+	targetGateway      = "gateway"      // Tempo gateway (Observatorium API): /api/traces/v1/{tenant}/tempo/api/search
+	targetGrafanaCloud = "grafanaCloud" // Grafana Cloud Tempo: /tempo/api/search, the tenant is the stack of the credentials
+	targetGrafana      = "grafana"      // Tempo data source of a Grafana instance: /api/datasources/proxy/{id}/api/search
+)
+
+// Formats of the start/end search parameters
+const (
+	timeFormatUnix        = "unix"        // Unix seconds, as Tempo expects
+	timeFormatRFC3339     = "rfc3339"     // RFC3339 timestamps in UTC
+	timeFormatNanoseconds = "nanoseconds" // Unix nanoseconds
+)
+
+// Bounds of the backoff after 429 responses without a Retry-After header
+const (
+	initialRateLimitBackoff = time.Second
+	maxRateLimitBackoff     = time.Minute
+)
+
+// normalizeTarget returns the query target, defaulting to the gateway
+func normalizeTarget(target string) string {
+	if target == "" {
+		return targetGateway
+	}
+	return target
+}
+
+// validateTarget checks the configured query target
+func validateTarget(target string) error {
+	switch normalizeTarget(target) {
+	case targetGateway, targetGrafanaCloud, targetGrafana:
+		return nil
+	default:
+		return fmt.Errorf("unknown target %q (expected %s, %s or %s)", target, targetGateway, targetGrafanaCloud, targetGrafana)
+	}
+}
+
+// grafanaProxyEndpoint returns the base URL of a Grafana data source proxy; the data source is
+// its numeric ID or "uid:<uid>" (Grafana 9+)
+func grafanaProxyEndpoint(grafanaURL, datasource string) (string, error) {
+	base := strings.TrimSuffix(grafanaURL, "/") + "/api/datasources/proxy/"
+	switch {
+	case strings.HasPrefix(datasource, "uid:") && len(datasource) > len("uid:"):
+		return base + "uid/" + url.PathEscape(strings.TrimPrefix(datasource, "uid:")), nil
+	case datasource != "":
+		if _, err := strconv.Atoi(datasource); err != nil {
+			return "", fmt.Errorf("grafanaDatasource %q must be a numeric ID or uid:<uid>", datasource)
+		}
+		return base + datasource, nil
+	default:
+		return "", fmt.Errorf("the grafana target needs tempo.grafanaDatasource")
+	}
+}
+
+// searchURL returns the search URL of a tenant's requests
+func searchURL(target, endpoint, tenant string) string {
+	switch normalizeTarget(target) {
+	case targetGrafanaCloud:
+		// The stack URL may be given with or without the /tempo prefix of the data source URL
+		return strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/tempo") + "/tempo/api/search"
+	case targetGrafana:
+		// The endpoint is the data source proxy, which forwards to the data source URL
+		return endpoint + "/api/search"
+	}
+	return fmt.Sprintf("%s/api/traces/v1/%s/tempo/api/search", endpoint, tenant)
+}
+
+// traceByIDURL returns the URL a tenant's trace is retrieved from by ID
+func traceByIDURL(target, endpoint, tenant, traceID string) string {
+	return strings.TrimSuffix(searchURL(target, endpoint, tenant), "/search") + "/traces/" + traceID
+}
+
+// sendsOrgID reports whether requests to the target carry the tenant in X-Scope-OrgID
+func sendsOrgID(target string) bool {
+	switch normalizeTarget(target) {
+	case targetGrafanaCloud, targetGrafana:
+		return false
+	default:
+		return true
+	}
+}
+
+// validateTimeFormat checks the configured start/end parameter format
+func validateTimeFormat(format string) error {
+	switch format {
+	case "", timeFormatUnix, timeFormatRFC3339, timeFormatNanoseconds:
+		return nil
+	default:
+		return fmt.Errorf("unknown timeFormat %q (expected %s, %s or %s)", format, timeFormatUnix, timeFormatRFC3339, timeFormatNanoseconds)
+	}
+}
+
+// appendTimeParam appends a start/end parameter value in the given format
+func appendTimeParam(b []byte, t time.Time, format string) []byte {
+	switch format {
+	case timeFormatRFC3339:
+		return t.UTC().AppendFormat(b, time.RFC3339)
+	case timeFormatNanoseconds:
+		return strconv.AppendInt(b, t.UnixNano(), 10)
+	default:
+		return strconv.AppendInt(b, t.Unix(), 10)
+	}
+}
+
+// formatTimeParam returns a start/end parameter value in the given format
+func formatTimeParam(t time.Time, format string) string {
+	return string(appendTimeParam(nil, t, format))
+}
+
+// throttles holds the rate-limit backoff of every query, for the end-of-run reports
+var throttles = struct {
+	sync.Mutex
+	queries map[string]*rateLimitBackoff
+}{queries: make(map[string]*rateLimitBackoff)}
+
+// rateLimitBackoff pauses all workers of a query after a 429 response: for its Retry-After, or
+// when doubling is on, for a pause doubling up to a minute until a request is no longer rate
+// limited. Throttled responses are not failures of the query.
+type rateLimitBackoff struct {
+	query         string
+	doubling      bool          // Back off without Retry-After too
+	maxRetryAfter time.Duration // Cap of pauses requested by Retry-After, 0 = none
+
+	mu        sync.Mutex
+	until     time.Time     // Workers wait until then before their next request
+	next      time.Duration // Pause of the next 429 without Retry-After
+	throttled time.Duration // Wall-clock time the query was paused
+
+	limited   prometheus.Counter
+	waited    prometheus.Counter
+	pauses    prometheus.Counter
+	pausedFor prometheus.Counter
+}
+
+// newRateLimitBackoff creates the backoff shared by the workers of a query
+func newRateLimitBackoff(query string, doubling bool, maxRetryAfter time.Duration) *rateLimitBackoff {
+	b := &rateLimitBackoff{
+		query:         query,
+		doubling:      doubling,
+		maxRetryAfter: maxRetryAfter,
+		next:          initialRateLimitBackoff,
+		limited:       rateLimitedCounter.WithLabelValues(query),
+		waited:        rateLimitBackoffCounter.WithLabelValues(query),
+		pauses:        rateLimitPausesCounter.WithLabelValues(query),
+		pausedFor:     rateLimitThrottledCounter.WithLabelValues(query),
+	}
+	throttles.Lock()
+	throttles.queries[query] = b
+	throttles.Unlock()
+	return b
+}
+
+// throttledTime returns how long a query was paused by 429 responses
+func throttledTime(query string) time.Duration {
+	throttles.Lock()
+	b := throttles.queries[query]
+	throttles.Unlock()
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.throttled
+}
+
+// wait blocks while the query is paused; false means ctx is done
+func (b *rateLimitBackoff) wait(ctx context.Context) bool {
+	if b == nil {
+		return ctx.Err() == nil
+	}
+	b.mu.Lock()
+	pause := time.Until(b.until)
+	b.mu.Unlock()
+	if pause <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	start := time.Now()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	b.waited.Add(time.Since(start).Seconds())
+	return ctx.Err() == nil
+}
+
+// observe records a response; it reports whether it was a 429 that paused the query, in which
+// case it counts as throttled rather than failed
+func (b *rateLimitBackoff) observe(res *http.Response) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if res.StatusCode != http.StatusTooManyRequests {
+		b.next = initialRateLimitBackoff
+		return false
+	}
+	b.limited.Inc()
+
+	now := time.Now()
+	wait, ok := retryAfter(res.Header.Get("Retry-After"), now)
+	requested := wait
+	switch {
+	case !ok && !b.doubling:
+		return false
+	case !ok:
+		wait = b.next
+		b.next *= 2
+		if b.next > maxRateLimitBackoff {
+			b.next = maxRateLimitBackoff
+		}
+	case b.maxRetryAfter > 0 && wait > b.maxRetryAfter:
+		wait = b.maxRetryAfter
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	// Extend the pause; overlapping 429s of several workers only add the time beyond it
+	until := now.Add(wait)
+	from := b.until
+	if from.Before(now) {
+		from = now
+		b.pauses.Inc()
+		if wait < requested {
+			log.Printf("Warning: Query %s: Retry-After of %s shortened to tempo.maxRetryAfter (%s)", b.query, requested.Round(time.Second), wait)
+		}
+	}
+	if until.After(from) {
+		b.throttled += until.Sub(from)
+		b.pausedFor.Add(until.Sub(from).Seconds())
+		b.until = until
+	}
+	return true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
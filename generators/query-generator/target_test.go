@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testRateLimitBackoff returns a backoff with unregistered counters
+func testRateLimitBackoff(doubling bool, maxRetryAfter time.Duration) *rateLimitBackoff {
+	counter := func() prometheus.Counter { return prometheus.NewCounter(prometheus.CounterOpts{Name: "test"}) }
+	return &rateLimitBackoff{
+		query:         "q",
+		doubling:      doubling,
+		maxRetryAfter: maxRetryAfter,
+		next:          initialRateLimitBackoff,
+		limited:       counter(),
+		waited:        counter(),
+		pauses:        counter(),
+		pausedFor:     counter(),
+	}
+}
+
+func tooManyRequests(retryAfter string) *http.Response {
+	res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	if retryAfter != "" {
+		res.Header.Set("Retry-After", retryAfter)
+	}
+	return res
+}
+
+func TestRateLimitBackoffObserve(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		doubling      bool
+		maxRetryAfter time.Duration
+		retryAfter    []string // Retry-After of consecutive 429s, "" for none
+		throttled     bool
+		pause         time.Duration // Pause after the last 429
+	}{
+		{"retry-after honored", false, 0, []string{"30"}, true, 30 * time.Second},
+		{"retry-after beyond a minute honored", false, 0, []string{"600"}, true, 10 * time.Minute},
+		{"retry-after capped", false, 2 * time.Minute, []string{"600"}, true, 2 * time.Minute},
+		{"retry-after under the cap", false, 2 * time.Minute, []string{"90"}, true, 90 * time.Second},
+		{"no retry-after without doubling", false, 0, []string{""}, false, 0},
+		{"doubling", true, 0, []string{"", "", ""}, true, 4 * time.Second},
+		{"doubling bounded", true, 0, []string{"", "", "", "", "", "", "", "", ""}, true, maxRateLimitBackoff},
+		{"doubling ignores the cap", true, 2 * time.Second, []string{"", "", ""}, true, 4 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testRateLimitBackoff(tc.doubling, tc.maxRetryAfter)
+			var throttled bool
+			var pause time.Duration
+			for _, value := range tc.retryAfter {
+				b.until = time.Time{} // each 429 starts a new pause
+				start := time.Now()
+				throttled = b.observe(tooManyRequests(value))
+				pause = b.until.Sub(start)
+			}
+			if throttled != tc.throttled {
+				t.Errorf("observe = %v, want %v", throttled, tc.throttled)
+			}
+			if !tc.throttled {
+				return
+			}
+			if d := pause - tc.pause; d < 0 || d > time.Second {
+				t.Errorf("pause = %s, want %s", pause, tc.pause)
+			}
+		})
+	}
+}
+
+func TestRateLimitBackoffReset(t *testing.T) {
+	b := testRateLimitBackoff(true, 0)
+	b.observe(tooManyRequests(""))
+	b.observe(tooManyRequests(""))
+	if b.next != 4*time.Second {
+		t.Fatalf("next = %s after two 429s, want 4s", b.next)
+	}
+	if b.observe(&http.Response{StatusCode: http.StatusOK}) {
+		t.Errorf("observe(200) = true, want false")
+	}
+	if b.next != initialRateLimitBackoff {
+		t.Errorf("next = %s after a 200, want %s", b.next, initialRateLimitBackoff)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"30", 30 * time.Second, true},
+		{" 120 ", 2 * time.Minute, true},
+		{"3600", time.Hour, true},
+		{"Thu, 27 Nov 2025 08:05:00 GMT", 5 * time.Minute, true},
+		{"Thursday, 27-Nov-25 08:00:30 GMT", 30 * time.Second, true},
+		{"Thu Nov 27 08:01:00 2025", time.Minute, true},
+		{"Thu, 27 Nov 2025 07:59:00 GMT", -time.Minute, true},
+		{"1.5", 0, false},
+		{"soon", 0, false},
+		{"2025-11-27T08:05:00Z", 0, false},
+	} {
+		got, ok := retryAfter(tc.value, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tenantComparison compares the results of one query across the tenants it ran against, to
+// evaluate tenant isolation and noisy-neighbor effects (e.g. a small and a huge tenant)
+type tenantComparison struct {
+	Query   string         `json:"query"`
+	Tenants []tenantResult `json:"tenants"`
+	// Slowest over fastest tenant p99, and most over fewest spans returned per request
+	P99Spread   float64 `json:"p99Spread"`
+	SpansSpread float64 `json:"spansSpread,omitempty"` // 0 when a tenant returned no spans
+}
+
+// tenantResult is the result of a query for one tenant over the run
+type tenantResult struct {
+	Tenant       string  `json:"tenant"`
+	Requests     int64   `json:"requests"`
+	P50Seconds   float64 `json:"p50Seconds"`
+	P99Seconds   float64 `json:"p99Seconds"`
+	ErrorRatePct float64 `json:"errorRatePercent"`
+	AvgSpans     float64 `json:"avgSpans"`
+}
+
+// compareTenants returns the per-tenant results of every query that ran against more than one
+// tenant; tenant IDs are shown as the redaction settings allow
+func compareTenants(queries []queryStatsSnapshot) []tenantComparison {
+	var comparisons []tenantComparison
+	for _, q := range queries {
+		if len(q.tenants) < 2 {
+			continue
+		}
+		c := tenantComparison{Query: q.name}
+		var minP99, maxP99, minSpans, maxSpans float64
+		for tenant, p := range q.tenants {
+			r := tenantResult{
+				Tenant:       redaction.tenant(tenant),
+				Requests:     p.count,
+				P50Seconds:   p.latency.quantile(0.5),
+				P99Seconds:   p.latency.quantile(0.99),
+				ErrorRatePct: p.errorRate() * 100,
+				AvgSpans:     p.avgSpans(),
+			}
+			if len(c.Tenants) == 0 || r.P99Seconds < minP99 {
+				minP99 = r.P99Seconds
+			}
+			if r.P99Seconds > maxP99 {
+				maxP99 = r.P99Seconds
+			}
+			if len(c.Tenants) == 0 || r.AvgSpans < minSpans {
+				minSpans = r.AvgSpans
+			}
+			if r.AvgSpans > maxSpans {
+				maxSpans = r.AvgSpans
+			}
+			c.Tenants = append(c.Tenants, r)
+		}
+		sort.Slice(c.Tenants, func(i, j int) bool { return c.Tenants[i].Tenant < c.Tenants[j].Tenant })
+		if minP99 > 0 {
+			c.P99Spread = maxP99 / minP99
+		}
+		if minSpans > 0 {
+			c.SpansSpread = maxSpans / minSpans
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// writeTenantComparison appends the Markdown tenant comparison: one row per query and tenant,
+// with each tenant's p99 relative to the fastest tenant of the query
+func writeTenantComparison(b *strings.Builder, comparisons []tenantComparison) {
+	if len(comparisons) == 0 {
+		return
+	}
+	b.WriteString("\n#### Tenant comparison\n\n")
+	b.WriteString("| Query | Tenant | Requests | p50 | p99 | p99 vs fastest | Error rate | Avg spans |\n|:--|:--|--:|--:|--:|--:|--:|--:|\n")
+	for _, c := range comparisons {
+		fastest := c.Tenants[0].P99Seconds
+		for _, t := range c.Tenants {
+			if t.P99Seconds < fastest {
+				fastest = t.P99Seconds
+			}
+		}
+		for i, t := range c.Tenants {
+			query := ""
+			if i == 0 {
+				query = "`" + c.Query + "`"
+			}
+			relative := "-"
+			if fastest > 0 {
+				relative = fmt.Sprintf("×%.2f", t.P99Seconds/fastest)
+			}
+			fmt.Fprintf(b, "| %s | `%s` | %d | %s | %s | %s | %.2f%% | %.1f |\n", query, t.Tenant, t.Requests,
+				formatSeconds(t.P50Seconds), formatSeconds(t.P99Seconds), relative, t.ErrorRatePct, t.AvgSpans)
+		}
+	}
+}
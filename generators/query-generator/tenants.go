@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// maxTrackedTraceIDs bounds the memory used by the tenant isolation checker
+const maxTrackedTraceIDs = 200000
+
+// tenantRotation cycles through the configured tenants, one per request
+type tenantRotation struct {
+	tenants []string
+	next    uint64
+}
+
+// newTenantRotation creates a rotation over the given tenants
+func newTenantRotation(tenants []string) *tenantRotation {
+	return &tenantRotation{tenants: tenants}
+}
+
+// pick returns the tenant for the next request
+func (r *tenantRotation) pick() string {
+	if len(r.tenants) == 1 {
+		return r.tenants[0]
+	}
+	idx := atomic.AddUint64(&r.next, 1) - 1
+	return r.tenants[idx%uint64(len(r.tenants))]
+}
+
+// isolationChecker verifies that a trace ID is only ever returned to a single tenant.
+// Trace IDs are random, so the same ID showing up for two tenants means results leaked across tenants.
+type isolationChecker struct {
+	mu     sync.Mutex
+	owners map[string]string // trace ID -> tenant that first saw it
+	order  []string          // ring of tracked trace IDs for eviction
+	next   int
+
+	checked    *prometheus.CounterVec
+	violations *prometheus.CounterVec
+}
+
+// newIsolationChecker creates a tenant isolation checker and its metrics
+func newIsolationChecker() *isolationChecker {
+	return &isolationChecker{
+		owners: make(map[string]string),
+		checked: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "tenant_isolation",
+			Name:      "traces_checked_total",
+			Help:      "Trace IDs checked for tenant isolation",
+		}, []string{"tenant"}),
+		violations: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "query_load_test",
+			Subsystem: "tenant_isolation",
+			Name:      "violations_total",
+			Help:      "Trace IDs returned to a tenant that were already returned to another tenant",
+		}, []string{"tenant", "owner_tenant", "query_name"}),
+	}
+}
+
+// check records the trace IDs returned to a tenant and counts isolation violations
+func (c *isolationChecker) check(tenant, queryName string, traceIDs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range traceIDs {
+		owner, seen := c.owners[id]
+		if !seen {
+			c.track(id, tenant)
+			continue
+		}
+		if owner != tenant {
+			c.violations.WithLabelValues(tenant, owner, queryName).Inc()
+			log.Printf("Tenant isolation violation: trace %s returned to tenant '%s' for query '%s' but belongs to tenant '%s'",
+				id, redaction.tenant(tenant), queryName, redaction.tenant(owner))
+		}
+	}
+	c.checked.WithLabelValues(tenant).Add(float64(len(traceIDs)))
+}
+
+// track remembers the owner of a trace ID, evicting the oldest one when full
+func (c *isolationChecker) track(id, tenant string) {
+	if len(c.order) < maxTrackedTraceIDs {
+		c.order = append(c.order, id)
+	} else {
+		delete(c.owners, c.order[c.next])
+		c.order[c.next] = id
+		c.next = (c.next + 1) % maxTrackedTraceIDs
+	}
+	c.owners[id] = tenant
+}
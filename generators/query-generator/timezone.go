@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// bucketTimeLayout is the layout of absolute bucket times without a UTC offset, read in the
+// configured timezone
+const bucketTimeLayout = "2006-01-02T15:04:05"
+
+// loadTimezone returns the location of the timezone of logs and reports: an IANA name such as
+// "Europe/Berlin", "Local" for the host's timezone, or UTC when unset
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", name, err)
+	}
+	return loc, nil
+}
+
+// logTimeLayout is the layout of log timestamps, as the standard logger writes them
+const logTimeLayout = "2006/01/02 15:04:05 "
+
+// zonedLogWriter prefixes log lines with their time in loc, in place of the standard logger's
+// timestamp in the host's timezone
+type zonedLogWriter struct {
+	out io.Writer
+	loc *time.Location
+}
+
+func (w zonedLogWriter) Write(p []byte) (int, error) {
+	line := make([]byte, 0, len(logTimeLayout)+len(p))
+	line = time.Now().In(w.loc).AppendFormat(line, logTimeLayout)
+	line = append(line, p...)
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// useLogTimezone makes the standard logger write its timestamps in loc
+func useLogTimezone(loc *time.Location) {
+	out := log.Writer()
+	if z, ok := out.(zonedLogWriter); ok {
+		out = z.out
+	}
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime | log.Lmicroseconds))
+	log.SetOutput(zonedLogWriter{out: out, loc: loc})
+}
+
+// redirectLogs sends log lines to out, keeping the timezone of their timestamps, and returns
+// the previous writer to restore
+func redirectLogs(out io.Writer) io.Writer {
+	prev := log.Writer()
+	if z, ok := prev.(zonedLogWriter); ok {
+		log.SetOutput(zonedLogWriter{out: out, loc: z.loc})
+	} else {
+		log.SetOutput(out)
+	}
+	return prev
+}
+
+// parseBucketTime parses the start or end of an absolute bucket: RFC 3339, or without an offset
+// in loc (e.g. "2025-11-27T00:00:00")
+func parseBucketTime(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	if t, zonedErr := time.ParseInLocation(bucketTimeLayout, s, loc); zonedErr == nil {
+		return t, nil
+	}
+	return time.Time{}, err
+}
+
+// formatZoned formats a time in UTC followed by its time in loc unless loc is UTC under any name
+// (e.g. "Etc/UTC"): "2025-11-27T08:00:00Z (2025-11-27 09:00:00 CET)"
+func formatZoned(t time.Time, loc *time.Location) string {
+	utc := t.UTC().Format(time.RFC3339)
+	zoned := t.In(loc)
+	if name, offset := zoned.Zone(); offset == 0 && name == "UTC" {
+		return utc
+	}
+	return fmt.Sprintf("%s (%s)", utc, zoned.Format("2006-01-02 15:04:05 MST"))
+}
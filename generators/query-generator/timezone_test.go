@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatZoned(t *testing.T) {
+	at := time.Date(2025, 11, 27, 8, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		zone string
+		want string
+	}{
+		{"", "2025-11-27T08:00:00Z"},
+		{"UTC", "2025-11-27T08:00:00Z"},
+		{"Etc/UTC", "2025-11-27T08:00:00Z"},
+		{"Europe/Berlin", "2025-11-27T08:00:00Z (2025-11-27 09:00:00 CET)"},
+		{"Europe/London", "2025-11-27T08:00:00Z (2025-11-27 08:00:00 GMT)"},
+		{"America/New_York", "2025-11-27T08:00:00Z (2025-11-27 03:00:00 EST)"},
+	} {
+		loc, err := loadTimezone(tc.zone)
+		if err != nil {
+			t.Skipf("timezone database unavailable: %v", err)
+		}
+		if got := formatZoned(at, loc); got != tc.want {
+			t.Errorf("formatZoned(%q) = %s, want %s", tc.zone, got, tc.want)
+		}
+	}
+}
+
+func TestParseBucketTime(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	for _, tc := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2025-11-27T00:00:00Z", time.Date(2025, 11, 27, 0, 0, 0, 0, time.UTC)},
+		{"2025-11-27T00:00:00+02:00", time.Date(2025, 11, 26, 22, 0, 0, 0, time.UTC)},
+		{"2025-11-27T00:00:00", time.Date(2025, 11, 26, 23, 0, 0, 0, time.UTC)},
+	} {
+		got, err := parseBucketTime(tc.in, loc)
+		if err != nil {
+			t.Errorf("parseBucketTime(%s) = %v", tc.in, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseBucketTime(%s) = %s, want %s", tc.in, got.UTC(), tc.want)
+		}
+	}
+	if _, err := parseBucketTime("27/11/2025", loc); err == nil {
+		t.Errorf("parseBucketTime(27/11/2025) succeeded, want an error")
+	}
+}
+
+func TestZonedLogWriter(t *testing.T) {
+	prevOut, prevFlags := log.Writer(), log.Flags()
+	defer func() {
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	}()
+
+	var first, second bytes.Buffer
+	log.SetOutput(&first)
+	loc := time.FixedZone("X", 5*3600+30*60)
+	useLogTimezone(loc)
+	log.Printf("hello")
+	prev := redirectLogs(&second)
+	log.Printf("redirected")
+	log.SetOutput(prev)
+	log.Printf("restored")
+
+	for _, tc := range []struct {
+		out   *bytes.Buffer
+		lines []string
+	}{
+		{&first, []string{"hello", "restored"}},
+		{&second, []string{"redirected"}},
+	} {
+		lines := strings.Split(strings.TrimSuffix(tc.out.String(), "\n"), "\n")
+		if len(lines) != len(tc.lines) {
+			t.Fatalf("log lines = %q, want %d", lines, len(tc.lines))
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(line, " "+tc.lines[i]) || len(line) != len(logTimeLayout)+len(tc.lines[i]) {
+				t.Errorf("log line = %q, want a timestamp followed by %s", line, tc.lines[i])
+				continue
+			}
+			stamp, err := time.ParseInLocation(logTimeLayout, line[:len(logTimeLayout)], loc)
+			if err != nil {
+				t.Errorf("log line %q: %v", line, err)
+			} else if d := time.Since(stamp); d < 0 || d > time.Minute {
+				t.Errorf("log line %q is %s off the time in its zone", line, d)
+			}
+		}
+	}
+}
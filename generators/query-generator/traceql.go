@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// traceqlSyntaxError describes a syntax problem at a 1-based column of a TraceQL expression
+type traceqlSyntaxError struct {
+	col int
+	msg string
+}
+
+func (e traceqlSyntaxError) Error() string {
+	return fmt.Sprintf("col %d: %s", e.col, e.msg)
+}
+
+// traceqlToken is a lexical token of a TraceQL expression
+type traceqlToken struct {
+	kind string // "ident", "string", "number", "op", "open", "close", "pipe", "comma"
+	text string
+	col  int
+}
+
+// traceqlOperators lists the operators accepted by the lexer, longest first
+var traceqlOperators = []string{
+	"!>>", "!<<", "&>>", "&<<", "&~",
+	"&&", "||", "!=", "=~", "!~", ">=", "<=", ">>", "<<", "!>", "!<", "&>", "&<",
+	"=", ">", "<", "!", "~", "+", "-", "*", "/", "%", "^",
+}
+
+// validateTraceQL performs a lightweight syntax check of a TraceQL expression so that typos are
+// reported with their position at startup instead of as HTTP 400s minutes into a run. It checks
+// tokens, string termination, delimiter balance and operator placement; it does not type-check.
+func validateTraceQL(expr string) error {
+	tokens, err := lexTraceQL(expr)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return traceqlSyntaxError{col: 1, msg: "empty expression"}
+	}
+
+	var stack []traceqlToken
+	for i, tok := range tokens {
+		var prev, next *traceqlToken
+		if i > 0 {
+			prev = &tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = &tokens[i+1]
+		}
+
+		switch tok.kind {
+		case "open":
+			stack = append(stack, tok)
+		case "close":
+			if len(stack) == 0 {
+				return traceqlSyntaxError{col: tok.col, msg: fmt.Sprintf("unexpected %q", tok.text)}
+			}
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if (open.text == "{") != (tok.text == "}") {
+				return traceqlSyntaxError{col: tok.col, msg: fmt.Sprintf("%q does not match %q at col %d", tok.text, open.text, open.col)}
+			}
+		case "op":
+			unary := tok.text == "!" || tok.text == "-"
+			if !unary && (prev == nil || prev.kind == "open" || prev.kind == "op" || prev.kind == "pipe" || prev.kind == "comma") {
+				return traceqlSyntaxError{col: tok.col, msg: fmt.Sprintf("missing operand before %q", tok.text)}
+			}
+			if next == nil || next.kind == "close" || next.kind == "pipe" || next.kind == "comma" {
+				return traceqlSyntaxError{col: tok.col, msg: fmt.Sprintf("missing operand after %q", tok.text)}
+			}
+		case "pipe":
+			if prev == nil || next == nil {
+				return traceqlSyntaxError{col: tok.col, msg: "pipeline stage is missing"}
+			}
+		default:
+			// Two operands in a row inside a spanset filter are missing an operator
+			if prev != nil && (prev.kind == "string" || prev.kind == "number" || prev.kind == "ident") &&
+				(tok.kind == "string" || tok.kind == "number") {
+				return traceqlSyntaxError{col: tok.col, msg: fmt.Sprintf("missing operator before %s", tok.text)}
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return traceqlSyntaxError{col: open.col, msg: fmt.Sprintf("unclosed %q", open.text)}
+	}
+	return nil
+}
+
+// lexTraceQL splits a TraceQL expression into tokens
+func lexTraceQL(expr string) ([]traceqlToken, error) {
+	var tokens []traceqlToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if r == '"' && runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, traceqlSyntaxError{col: col, msg: "unterminated string"}
+			}
+			tokens = append(tokens, traceqlToken{kind: "string", text: string(runes[i : end+1]), col: col})
+			i = end + 1
+		case r == '{' || r == '(':
+			tokens = append(tokens, traceqlToken{kind: "open", text: string(r), col: col})
+			i++
+		case r == '}' || r == ')':
+			tokens = append(tokens, traceqlToken{kind: "close", text: string(r), col: col})
+			i++
+		case r == ',':
+			tokens = append(tokens, traceqlToken{kind: "comma", text: ",", col: col})
+			i++
+		case r == '|' && (i+1 >= len(runes) || runes[i+1] != '|'):
+			tokens = append(tokens, traceqlToken{kind: "pipe", text: "|", col: col})
+			i++
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, traceqlToken{kind: "number", text: string(runes[i:end]), col: col})
+			i = end
+		case unicode.IsLetter(r) || r == '.' || r == '_':
+			end, err := scanTraceQLIdent(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, traceqlToken{kind: "ident", text: string(runes[i:end]), col: col})
+			i = end
+		default:
+			op := ""
+			rest := string(runes[i:])
+			for _, candidate := range traceqlOperators {
+				if strings.HasPrefix(rest, candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, traceqlSyntaxError{col: col, msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			tokens = append(tokens, traceqlToken{kind: "op", text: op, col: col})
+			i += len([]rune(op))
+		}
+	}
+	return tokens, nil
+}
+
+// scanTraceQLIdent returns the end of the keyword or attribute starting at i. Attributes (with a
+// scope such as span. or .) run like in Tempo's lexer up to whitespace or a reserved character,
+// and a scope may be followed by a quoted name, e.g. span."http status".
+func scanTraceQLIdent(runes []rune, i int) (int, error) {
+	end := i
+	for end < len(runes) && isTraceQLIdentRune(runes[end]) {
+		end++
+	}
+	if !strings.ContainsRune(string(runes[i:end]), '.') {
+		return end, nil
+	}
+	for end < len(runes) {
+		switch {
+		case runes[end] == '"' && runes[end-1] == '.':
+			quote := end
+			end++
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return 0, traceqlSyntaxError{col: quote + 1, msg: "unterminated attribute name"}
+			}
+			end++
+		case isTraceQLAttributeRune(runes[end]):
+			end++
+		default:
+			return end, nil
+		}
+	}
+	return end, nil
+}
+
+// isTraceQLIdentRune reports whether r can be part of an attribute or keyword
+func isTraceQLIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == ':'
+}
+
+// isTraceQLAttributeRune reports whether r can be part of an attribute name: anything but
+// whitespace, quotes and the characters reserved for TraceQL syntax
+func isTraceQLAttributeRune(r rune) bool {
+	if unicode.IsSpace(r) {
+		return false
+	}
+	switch r {
+	case '{', '}', '(', ')', '=', '~', '!', '<', '>', '&', '|', '^', ',', '"', '`':
+		return false
+	}
+	return true
+}
+
+// checkTraceQL validates an optional TraceQL expression of a config section, empty meaning its default
+func checkTraceQL(section, expr string) error {
+	if expr == "" {
+		return nil
+	}
+	if err := validateTraceQL(expr); err != nil {
+		return fmt.Errorf("%s: invalid traceql %q: %v", section, expr, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateTraceQLValid(t *testing.T) {
+	for _, expr := range []string{
+		`{}`,
+		`{ status = error }`,
+		`{ resource.service.name = "frontend" && span.http.status_code >= 500 }`,
+		`{ span."http status" = 200 }`,
+		`{ ."foo bar" != nil }`,
+		`{ resource."k8s pod"."name" = "x" }`,
+		`{ span."with \"escaped\" quote" = 1 }`,
+		`{ .service-name = "a" }`,
+		`{ span.http/route =~ "/api/.*" }`,
+		`{ duration > 1.5s && kind = server }`,
+		`{ span:duration > 10ms } | count() > 2`,
+		`{ trace:rootService = "api" } >> { .db.system = "redis" }`,
+		`{ .a = 1 } && { .b = 2 } | by(resource.service.name) | select(span.http.url)`,
+		`{ .a = -1 } | avg(duration) > 100ms`,
+		`{ .msg = ` + "`raw \"string\"`" + ` }`,
+		`{ status = error } with (most_recent=true)`,
+		`{ !(.a = 1) }`,
+		`{ .a = 1 } | quantile_over_time(duration, .9)`,
+	} {
+		if err := validateTraceQL(expr); err != nil {
+			t.Errorf("validateTraceQL(%s) = %v, want nil", expr, err)
+		}
+	}
+}
+
+func TestValidateTraceQLInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		col  int
+	}{
+		{``, 1},
+		{`{ .a = }`, 6},
+		{`{ = 1 }`, 3},
+		{`{ .a = 1`, 1},
+		{`{ .a = 1 })`, 11},
+		{`{ (.a = 1 }`, 11},
+		{`{ .a "x" }`, 6},
+		{`{ .a = "x }`, 8},
+		{`{ span."http status = 1 }`, 8},
+		{`{ .a = 1 } |`, 12},
+		{`{ .a = 1 ] }`, 10},
+	} {
+		err := validateTraceQL(tc.expr)
+		var syntaxErr traceqlSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("validateTraceQL(%s) = %v, want a syntax error", tc.expr, err)
+			continue
+		}
+		if syntaxErr.col != tc.col {
+			t.Errorf("validateTraceQL(%s) = %v, want col %d", tc.expr, err, tc.col)
+		}
+	}
+}
+
+func TestValidateConfigTraceQL(t *testing.T) {
+	config := &Config{
+		Queries:     []QueryConfig{{Name: "ok", TraceQL: `{ span."http status" = 200 }`}, {Name: "typo", TraceQL: `{ .a = }`}},
+		Freshness:   FreshnessConfig{TraceQL: `{ .a = 1`},
+		BucketProbe: BucketProbeConfig{TraceQL: `{}`},
+	}
+	var got []string
+	for _, p := range validateConfig(config) {
+		if strings.Contains(p.Error(), "traceql") {
+			got = append(got, p.Error())
+		}
+	}
+	want := []string{
+		`query typo: invalid traceql "{ .a = }": col 6: missing operand after "="`,
+		`freshness: invalid traceql "{ .a = 1": col 1: unclosed "{"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("traceql problems = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TracingConfig configures tracing of the generator's own requests
+type TracingConfig struct {
+	Enabled     bool     `yaml:"enabled"`     // Send a W3C traceparent header with every request
+	SampleRatio *float64 `yaml:"sampleRatio"` // Fraction of requests marked as sampled (default: 1)
+}
+
+// tracer starts traces for outgoing requests (nil when tracing is disabled)
+var tracer *requestTracer
+
+// requestTracer propagates W3C trace context on search requests so that Tempo's own spans for a
+// query join a trace started by the generator, and latency observations can carry the trace ID
+// as an exemplar
+type requestTracer struct {
+	sampleRatio float64
+}
+
+// newRequestTracer creates a tracer from the config (nil when disabled)
+func newRequestTracer(cfg TracingConfig) (*requestTracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	if ratio < 0 || ratio > 1 || math.IsNaN(ratio) {
+		return nil, fmt.Errorf("sampleRatio must be between 0 and 1, got %v", ratio)
+	}
+	return &requestTracer{sampleRatio: ratio}, nil
+}
+
+// start sets the traceparent header of the request and returns the trace ID when the request is
+// sampled ("" otherwise, or when tracing is disabled)
+func (t *requestTracer) start(req *http.Request) string {
+	if t == nil {
+		return ""
+	}
+	var ids [24]byte
+	if _, err := rand.Read(ids[:]); err != nil {
+		return ""
+	}
+	traceID, spanID := hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:])
+
+	sampled := mathrand.Float64() < t.sampleRatio
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", traceID, spanID, flags))
+
+	if !sampled {
+		return ""
+	}
+	return traceID
+}
+
+// observeWithTrace records an observation, attaching the trace ID as an exemplar when there is one
+func observeWithTrace(o prometheus.Observer, value float64, traceID string) {
+	if traceID != "" {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+			return
+		}
+	}
+	o.Observe(value)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// unixScheme prefixes query endpoints that are unix domain sockets, e.g. unix:///var/run/tempo.sock
+const unixScheme = "unix://"
+
+// unixBaseURL is the URL requests over a unix socket are built against; the host is ignored
+const unixBaseURL = "http://localhost"
+
+// splitUnixEndpoint returns the base URL requests are built against and, when the endpoint is a
+// unix:// socket, the socket path
+func splitUnixEndpoint(endpoint string) (baseURL, socketPath string) {
+	if !strings.HasPrefix(endpoint, unixScheme) {
+		return endpoint, ""
+	}
+	return unixBaseURL, strings.TrimPrefix(endpoint, unixScheme)
+}
+
+// HTTP protocols the client can be pinned to
+const (
+	protocolAuto  = "auto"  // net/http defaults: HTTP/1.1, as the custom TLS config turns off HTTP/2 negotiation
+	protocolHTTP1 = "http1" // HTTP/1.1 only
+	protocolHTTP2 = "http2" // HTTP/2 over TLS when the server offers it (ALPN), HTTP/1.1 otherwise
+
+	// protocolHTTP3 is rejected with an explanation: quic-go needs a newer Go than this module builds with
+	protocolHTTP3 = "http3"
+)
+
+// newTransport creates the HTTP transport used by the query executors; when socketPath is set
+// every connection is made to that unix socket instead of over the network
+func newTransport(protocol, socketPath string) (http.RoundTripper, error) {
+	// TLS config allows self-signed certificates
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if socketPath != "" {
+		var dialer net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+
+	switch normalizeProtocol(protocol) {
+	case protocolAuto:
+	case protocolHTTP1:
+		// A non-nil, empty TLSNextProto disables HTTP/2 negotiation
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case protocolHTTP2:
+		transport.ForceAttemptHTTP2 = true
+	case protocolHTTP3:
+		return nil, fmt.Errorf("protocol %q is not supported: HTTP/3 needs quic-go, which requires a newer Go than this module's go 1.18", protocol)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (expected %s, %s or %s)", protocol, protocolAuto, protocolHTTP1, protocolHTTP2)
+	}
+	return transport, nil
+}
+
+// normalizeProtocol lower-cases the configured protocol, defaulting to auto
+func normalizeProtocol(protocol string) string {
+	if protocol == "" {
+		return protocolAuto
+	}
+	return strings.ToLower(protocol)
+}
+
+// protocolLabel returns the negotiated protocol of a response for metric labels
+func protocolLabel(res *http.Response) string {
+	switch res.ProtoMajor {
+	case 1:
+		return "http1"
+	case 2:
+		return "http2"
+	default:
+		return res.Proto
+	}
+}
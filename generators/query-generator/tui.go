@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// tuiMode renders a live dashboard in the terminal instead of streaming logs
+var tuiMode = flag.Bool("tui", false, "Render a live per-query dashboard in the terminal instead of streaming logs")
+
+// tuiWindow is the window of the "recent" columns of the dashboard
+const tuiWindow = 10 * time.Second
+
+// tuiLogLines is the number of recent log lines shown below the dashboard
+const tuiLogLines = 8
+
+// dashboard is the live terminal dashboard (nil unless --tui is set)
+var dashboard *tuiDashboard
+
+// tuiDashboard periodically redraws per-query QPS, error rates and percentiles
+type tuiDashboard struct {
+	out       io.Writer
+	stats     *runStats
+	namespace string
+	targetQPS float64 // per query, 0 = unlimited
+	logs      *logTail
+	prevLogs  io.Writer // log output to restore when stopped
+	stopCh    chan struct{}
+	done      chan struct{}
+}
+
+// newTUIDashboard creates a dashboard and captures the log output so it does not scroll the screen
+func newTUIDashboard(stats *runStats, namespace string, targetQPS float64) *tuiDashboard {
+	d := &tuiDashboard{
+		out:       os.Stdout,
+		stats:     stats,
+		namespace: namespace,
+		targetQPS: targetQPS,
+		logs:      &logTail{max: tuiLogLines},
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	d.prevLogs = redirectLogs(d.logs)
+	return d
+}
+
+// run redraws the dashboard every interval until stopped
+func (d *tuiDashboard) run(interval time.Duration) {
+	defer close(d.done)
+	fmt.Fprint(d.out, "\033[?25l") // hide cursor
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.render()
+		select {
+		case <-ticker.C:
+		case <-d.stopCh:
+			return
+		}
+	}
+}
+
+// stop draws a final frame, restores the cursor and sends logs back to their previous output
+func (d *tuiDashboard) stop() {
+	if d == nil {
+		return
+	}
+	close(d.stopCh)
+	<-d.done
+	d.render()
+	fmt.Fprint(d.out, "\033[?25h")
+	log.SetOutput(d.prevLogs)
+}
+
+// render clears the screen and draws the current statistics
+func (d *tuiDashboard) render() {
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "Tempo query load - namespace %s - elapsed %s\n\n", d.namespace, now.Sub(d.stats.start).Round(time.Second))
+
+	target := "unlimited"
+	if d.targetQPS > 0 {
+		target = fmt.Sprintf("%.2f", d.targetQPS)
+	}
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "QUERY\tQPS\tTARGET\tERR%%\tP50\tP90\tP99\tSPANS\tTOTAL\tERR%% (ALL)\tP99 (ALL)\t\n")
+	for _, q := range d.stats.recent(now, tuiWindow) {
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\t%.1f\t%s\t%s\t%s\t%.1f\t%d\t%.1f\t%s\t\n",
+			q.name, q.recent.qps(q.span), target, q.recent.errorRate()*100,
+			formatSeconds(q.recent.latency.quantile(0.5)),
+			formatSeconds(q.recent.latency.quantile(0.9)),
+			formatSeconds(q.recent.latency.quantile(0.99)),
+			q.recent.avgSpans(), q.total.count, q.total.errorRate()*100,
+			formatSeconds(q.total.latency.quantile(0.99)))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(&b, "\nColumns without (ALL) cover the last %s. Recent log lines:\n", tuiWindow)
+	for _, line := range d.logs.lines() {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	fmt.Fprint(d.out, b.String())
+}
+
+// formatSeconds formats a latency in seconds for the dashboard
+func formatSeconds(s float64) string {
+	if s == 0 {
+		return "-"
+	}
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// logTail keeps the last log lines written to it
+type logTail struct {
+	mu   sync.Mutex
+	max  int
+	tail []string
+}
+
+func (l *logTail) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.tail = append(l.tail, line)
+	}
+	if len(l.tail) > l.max {
+		l.tail = l.tail[len(l.tail)-l.max:]
+	}
+	return len(p), nil
+}
+
+// lines returns a copy of the retained lines
+func (l *logTail) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.tail...)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runValidateCommand implements the "validate" subcommand: it checks a config file
+// (queries including TraceQL syntax, time buckets and execution plan) without generating load,
+// and with -estimate prints the request and response data volume the config would generate
+func runValidateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := fs.String("config", configPathFromEnv(), "config file to validate")
+	estimate := fs.Bool("estimate", false, "print the request volume per query, bucket and tenant over -duration")
+	durationFlag := fs.String("duration", "", "duration of the estimate, e.g. 7d (default: job.duration, or the stair-step stages)")
+	baselinePath := fs.String("baseline", "", "JSON summary of a previous run providing response sizes (default: report.baseline)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if zone, err := loadTimezone(config.Timezone); err == nil {
+		useLogTimezone(zone) // an invalid timezone is reported with the other problems
+	}
+
+	problems := validateConfig(config)
+	if !config.StrictAttributes {
+		for _, w := range checkAttributes(config.Queries, config.Attributes) {
+			fmt.Printf("WARNING: %v\n", w)
+		}
+	}
+	for _, p := range problems {
+		fmt.Printf("ERROR: %v\n", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %d problem(s) found", *configPath, len(problems))
+	}
+
+	fmt.Printf("%s: OK (%d queries, %d time buckets, %d plan entries)\n",
+		*configPath, len(config.Queries), len(config.TimeBuckets), len(config.ExecutionPlan))
+	if *estimate {
+		return printLoadEstimate(config, *durationFlag, *baselinePath)
+	}
+	return nil
+}
+
+// printLoadEstimate prints the load estimate of a valid config
+func printLoadEstimate(config *Config, durationFlag, baselinePath string) error {
+	if durationFlag == "" {
+		durationFlag = config.Job.Duration
+	}
+	var duration time.Duration
+	switch {
+	case durationFlag != "":
+		d, err := parseExtendedDuration(durationFlag)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q", durationFlag)
+		}
+		duration = d
+	case config.StairStep.Enabled:
+		levels, stageDuration, err := parseStairStep(config.StairStep)
+		if err != nil {
+			return err
+		}
+		duration = time.Duration(len(levels)) * stageDuration
+	default:
+		return fmt.Errorf("-estimate needs -duration, job.duration or stairStep")
+	}
+
+	if baselinePath == "" {
+		baselinePath = config.Report.Baseline
+	}
+	var baseline *runSummary
+	if baselinePath != "" {
+		var err error
+		if baseline, err = loadSummaryJSON(baselinePath); err != nil {
+			return err
+		}
+	}
+
+	e, err := estimateLoad(config, duration, baseline)
+	if err != nil {
+		return err
+	}
+	writeLoadEstimate(os.Stdout, e)
+	return nil
+}
+
+// validateConfig returns every problem found in the config instead of stopping at the first one
+func validateConfig(config *Config) []error {
+	var problems []error
+
+	queries, _, err := expandDurationSweeps(config.Queries, nil)
+	if err != nil {
+		problems = append(problems, err)
+		queries = config.Queries
+	}
+
+	queryNames := make(map[string]bool)
+	for _, q := range queries {
+		queryNames[q.Name] = true
+		if q.sweep != "" {
+			queryNames[q.sweep] = true // plan entries of a swept query run every variant
+		}
+		if q.DurationSweep != nil {
+			continue // already reported by expandDurationSweeps
+		}
+		if err := q.validate(); err != nil {
+			problems = append(problems, err)
+		}
+		if q.isZipkin() && config.Tempo.ZipkinEndpoint == "" {
+			problems = append(problems, fmt.Errorf("query %s: %s queries need tempo.zipkinEndpoint", q.Name, q.kind()))
+		}
+	}
+	if len(queries) == 0 {
+		problems = append(problems, fmt.Errorf("no queries defined"))
+	}
+	if _, err := newQueryBudget(config.Query.MaxTotalQueries, queries, planShard{count: 1}, nil); err != nil {
+		problems = append(problems, err)
+	}
+	if err := checkHeaderProfiles(config.HeaderProfiles, queries); err != nil {
+		problems = append(problems, err)
+	}
+	if err := checkClientIdentities(config.ClientIdentities, queries); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := parsePauseWindows(config.Pauses, queries); err != nil {
+		problems = append(problems, err)
+	}
+	if err := config.Cost.check(); err != nil {
+		problems = append(problems, fmt.Errorf("cost: %w", err))
+	}
+	if _, _, err := config.Job.parse(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := config.PlanFailures.check(); err != nil {
+		problems = append(problems, fmt.Errorf("planFailures: %w", err))
+	}
+	if config.PhaseGrace != "" {
+		if _, err := parsePhaseGrace(config.PhaseGrace); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	for _, err := range []error{
+		checkTraceQL("freshness", config.Freshness.TraceQL),
+		checkTraceQL("audit", config.Audit.TraceQL),
+		checkTraceQL("bucketProbe", config.BucketProbe.TraceQL),
+	} {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if config.StrictAttributes {
+		problems = append(problems, checkAttributes(queries, config.Attributes)...)
+	}
+
+	zone, err := loadTimezone(config.Timezone)
+	if err != nil {
+		problems = append(problems, err)
+		zone = time.UTC
+	}
+	buckets, err := convertTimeBuckets(config.TimeBuckets, zone)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	bucketNames := map[string]bool{"immediate": true}
+	for _, b := range buckets {
+		bucketNames[b.name] = true
+	}
+
+	for i, entry := range config.ExecutionPlan {
+		if !queryNames[entry.QueryName] {
+			problems = append(problems, fmt.Errorf("executionPlan[%d]: undefined query %s", i, entry.QueryName))
+		}
+		if err == nil && !bucketNames[entry.BucketName] {
+			problems = append(problems, fmt.Errorf("executionPlan[%d]: undefined bucket %s", i, entry.BucketName))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Zipkin read API query kinds, sent to tempo.zipkinEndpoint (a Zipkin-compatible translation
+// layer in front of Tempo) instead of the search API
+const (
+	queryKindZipkinTraces   = "zipkin-traces"   // GET /api/v2/traces: search by service, span name, tags and duration
+	queryKindZipkinTrace    = "zipkin-trace"    // GET /api/v2/trace/{id}: lookup of one of traceIDs
+	queryKindZipkinServices = "zipkin-services" // GET /api/v2/services: service listing
+)
+
+// isZipkin reports whether the query uses the Zipkin read API
+func (q QueryConfig) isZipkin() bool {
+	switch q.kind() {
+	case queryKindZipkinTraces, queryKindZipkinTrace, queryKindZipkinServices:
+		return true
+	default:
+		return false
+	}
+}
+
+// zipkinURL returns the URL of a Zipkin query; the window is sent as endTs and lookback when set
+func (q QueryConfig) zipkinURL(endpoint string, windowed bool, start, end time.Time, limit int) string {
+	base := strings.TrimSuffix(endpoint, "/") + "/api/v2"
+	switch q.kind() {
+	case queryKindZipkinServices:
+		return base + "/services"
+	case queryKindZipkinTrace:
+		return base + "/trace/" + url.PathEscape(q.TraceIDs[rand.Intn(len(q.TraceIDs))])
+	}
+
+	params := url.Values{}
+	if q.Service != "" {
+		params.Set("serviceName", q.Service)
+	}
+	if q.SpanName != "" {
+		params.Set("spanName", q.SpanName)
+	}
+	if len(q.Tags) > 0 {
+		params.Set("annotationQuery", zipkinAnnotationQuery(q.Tags))
+	}
+	// Zipkin durations are in microseconds
+	if d, err := time.ParseDuration(q.MinDuration); err == nil {
+		params.Set("minDuration", strconv.FormatInt(d.Microseconds(), 10))
+	}
+	if d, err := time.ParseDuration(q.MaxDuration); err == nil {
+		params.Set("maxDuration", strconv.FormatInt(d.Microseconds(), 10))
+	}
+	if windowed {
+		params.Set("endTs", strconv.FormatInt(end.UnixNano()/int64(time.Millisecond), 10))
+		params.Set("lookback", strconv.FormatInt(end.Sub(start).Milliseconds(), 10))
+	}
+	params.Set("limit", strconv.Itoa(limit))
+	return base + "/traces?" + params.Encode()
+}
+
+// zipkinAnnotationQuery encodes tags as a Zipkin annotationQuery (key=value terms joined by
+// "and"; an empty value only requires the key), sorted for stable URLs
+func zipkinAnnotationQuery(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	terms := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if tags[k] == "" {
+			terms = append(terms, k)
+		} else {
+			terms = append(terms, k+"="+tags[k])
+		}
+	}
+	return strings.Join(terms, " and ")
+}
+
+// describeZipkin returns a short human readable form of a Zipkin query for logging
+func (q QueryConfig) describeZipkin() string {
+	switch q.kind() {
+	case queryKindZipkinServices:
+		return "/api/v2/services"
+	case queryKindZipkinTrace:
+		return fmt.Sprintf("/api/v2/trace/{id} (%d trace IDs)", len(q.TraceIDs))
+	}
+	u, err := url.Parse(q.zipkinURL("", false, time.Time{}, time.Time{}, 0))
+	if err != nil {
+		return "/api/v2/traces"
+	}
+	params := u.Query()
+	params.Del("limit")
+	return "/api/v2/traces?" + params.Encode()
+}
+
+// countZipkinResponse counts the spans and traces of a Zipkin response; service listings have
+// neither
+func countZipkinResponse(kind string, body []byte) (spans, traces int, err error) {
+	switch kind {
+	case queryKindZipkinTraces:
+		var result [][]struct{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return 0, 0, err
+		}
+		for _, trace := range result {
+			spans += len(trace)
+		}
+		return spans, len(result), nil
+	case queryKindZipkinTrace:
+		var result []struct{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return 0, 0, err
+		}
+		if len(result) > 0 {
+			traces = 1
+		}
+		return len(result), traces, nil
+	default:
+		var services []string
+		return 0, 0, json.Unmarshal(body, &services)
+	}
+}
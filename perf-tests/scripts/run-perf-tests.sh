@@ -313,11 +313,31 @@ reset_tempo_state() {
 deploy_tempo() {
     log_section "Deploying Tempo Monolithic"
     
-    "${PROJECT_ROOT}/scripts/deploy-tempo-monolithic.sh"
+    # Span duplication and distribution are applied by the collector, in front of Tempo
+    DUPLICATE_PERCENT=$(yq eval '.duplication.exactPercent // 0' "$CONFIG_FILE") \
+    NEAR_DUPLICATE_PERCENT=$(yq eval '.duplication.nearPercent // 0' "$CONFIG_FILE") \
+    SPAN_ERROR_PERCENT=$(yq eval '.spanDistribution.errorPercent // 0' "$CONFIG_FILE") \
+    SPAN_KINDS=$(read_distribution kinds) \
+    SPAN_HTTP_STATUS_CODES=$(read_distribution httpStatusCodes) \
+        "${PROJECT_ROOT}/scripts/deploy-tempo-monolithic.sh"
     
     log_info "Tempo Monolithic deployed successfully."
 }
 
+#
+# Read a spanDistribution map from YAML as value=percent,...
+#
+read_distribution() {
+    local field="$1"
+    local spec=""
+    local key
+    
+    for key in $(yq eval ".spanDistribution.$field // {} | keys | .[]" "$CONFIG_FILE"); do
+        spec="${spec:+$spec,}${key}=$(yq eval ".spanDistribution.$field.\"$key\"" "$CONFIG_FILE")"
+    done
+    echo "$spec"
+}
+
 #
 # Read load configuration from YAML
 #
@@ -136,7 +136,144 @@ fi
 # Deploy OpenTelemetry Collector RBAC and CR (after Tempo is ready)
 echo "Deploying OpenTelemetry Collector..."
 oc apply -f "$PROJECT_ROOT/deploy/otel-collector/rbac.yaml" -n ${NAMESPACE}
-oc apply -f "$PROJECT_ROOT/deploy/otel-collector/collector.yaml" -n ${NAMESPACE}
+
+# span_ranges OFFSET TEMPLATE SPEC prints one OTTL statement per value=percent entry of SPEC,
+# each applied to a consecutive range of the span ID byte at OFFSET, so that every value hits
+# its percentage of the spans
+span_ranges() {
+  awk -v offset="$1" -v template="$2" -v spec="$3" 'BEGIN {
+    n = split(spec, entries, ",")
+    lo = 0
+    total = 0
+    for (i = 1; i <= n; i++) {
+      if (split(entries[i], kv, "=") != 2 || kv[2] !~ /^[0-9]+(\.[0-9]+)?$/) {
+        print "invalid value=percent entry: " entries[i] > "/dev/stderr"
+        exit 1
+      }
+      total += kv[2]
+      if (total > 100) {
+        print "percentages add up to more than 100: " spec > "/dev/stderr"
+        exit 1
+      }
+      hi = int(total * 256 / 100 + 0.5)
+      if (hi == lo) {
+        continue
+      }
+      byte = sprintf("Substring(span_id.string, %d, 2)", offset)
+      cond = ""
+      if (lo > 0) {
+        cond = sprintf("%s >= \"%02x\"", byte, lo)
+      }
+      if (hi < 256) {
+        cond = cond (cond != "" ? " and " : "") sprintf("%s < \"%02x\"", byte, hi)
+      }
+      statement = sprintf(template, kv[1])
+      print (cond != "" ? statement " where " cond : statement)
+      lo = hi
+    }
+  }'
+}
+
+collector_manifest=$(mktemp)
+trap 'rm -f "$collector_manifest"' EXIT
+cp "$PROJECT_ROOT/deploy/otel-collector/collector.yaml" "$collector_manifest"
+
+# Span duplication: extra pipelines re-send a fraction of the received traces unchanged (exact
+# duplicates) or with rewritten span IDs (near-duplicates), to exercise Tempo's deduplication
+DUPLICATE_PERCENT=${DUPLICATE_PERCENT:-0}
+NEAR_DUPLICATE_PERCENT=${NEAR_DUPLICATE_PERCENT:-0}
+for percent in "$DUPLICATE_PERCENT" "$NEAR_DUPLICATE_PERCENT"; do
+  if ! awk -v p="$percent" 'BEGIN { exit !(p ~ /^[0-9]+(\.[0-9]+)?$/ && p <= 100) }'; then
+    echo "Error: duplication percentages must be between 0 and 100, got: $percent"
+    exit 1
+  fi
+done
+if awk -v a="$DUPLICATE_PERCENT" -v b="$NEAR_DUPLICATE_PERCENT" 'BEGIN { exit !(a > 0 || b > 0) }'; then
+  echo "Enabling span duplication: ${DUPLICATE_PERCENT}% exact, ${NEAR_DUPLICATE_PERCENT}% near-duplicates"
+fi
+if awk -v p="$DUPLICATE_PERCENT" 'BEGIN { exit !(p > 0) }'; then
+  yq eval -i "
+    .spec.config.processors.\"probabilistic_sampler/duplicates\" = {\"sampling_percentage\": ${DUPLICATE_PERCENT}, \"hash_seed\": 22} |
+    .spec.config.service.pipelines.\"traces/duplicates\" = {
+      \"receivers\": [\"otlp\"],
+      \"processors\": [\"probabilistic_sampler/duplicates\"],
+      \"exporters\": [\"otlp\"]
+    }" "$collector_manifest"
+fi
+if awk -v p="$NEAR_DUPLICATE_PERCENT" 'BEGIN { exit !(p > 0) }'; then
+  # A different hash seed than the exact duplicates, so both select different traces. Span
+  # and parent IDs are rewritten the same way, so the near-duplicate tree stays connected
+  yq eval -i "
+    .spec.config.processors.\"probabilistic_sampler/near_duplicates\" = {\"sampling_percentage\": ${NEAR_DUPLICATE_PERCENT}, \"hash_seed\": 23} |
+    .spec.config.processors.\"transform/near_duplicates\" = {
+      \"error_mode\": \"ignore\",
+      \"trace_statements\": [{
+        \"context\": \"span\",
+        \"statements\": [
+          \"set(span_id.string, Substring(SHA256(span_id.string), 0, 16))\",
+          \"set(parent_span_id.string, Substring(SHA256(parent_span_id.string), 0, 16)) where parent_span_id.string != \\\"\\\"\"
+        ]
+      }]
+    } |
+    .spec.config.service.pipelines.\"traces/near-duplicates\" = {
+      \"receivers\": [\"otlp\"],
+      \"processors\": [\"probabilistic_sampler/near_duplicates\", \"transform/near_duplicates\"],
+      \"exporters\": [\"otlp\"]
+    }" "$collector_manifest"
+fi
+
+# Span distribution: the write generator cannot set span status, kind or HTTP status codes, so
+# the collector sets them on a configurable share of the spans. Each attribute uses a different
+# byte of the span ID, so they are independent of each other (e.g. SPAN_ERROR_PERCENT=5,
+# SPAN_KINDS=server=40,client=40, SPAN_HTTP_STATUS_CODES=200=90,404=5,500=5)
+SPAN_ERROR_PERCENT=${SPAN_ERROR_PERCENT:-0}
+SPAN_KINDS=${SPAN_KINDS:-}
+SPAN_HTTP_STATUS_CODES=${SPAN_HTTP_STATUS_CODES:-}
+kinds_spec=""
+for entry in ${SPAN_KINDS//,/ }; do
+  kind=${entry%%=*}
+  case "$kind" in
+    server|client|internal|producer|consumer) ;;
+    *)
+      echo "Error: unknown span kind in SPAN_KINDS: $kind"
+      exit 1
+      ;;
+  esac
+  kinds_spec="${kinds_spec:+$kinds_spec,}SPAN_KIND_$(echo "$kind" | tr '[:lower:]' '[:upper:]')=${entry#*=}"
+done
+for entry in ${SPAN_HTTP_STATUS_CODES//,/ }; do
+  if ! [[ "${entry%%=*}" =~ ^[1-5][0-9][0-9]$ ]]; then
+    echo "Error: invalid HTTP status code in SPAN_HTTP_STATUS_CODES: ${entry%%=*}"
+    exit 1
+  fi
+done
+error_spec=""
+if awk -v p="$SPAN_ERROR_PERCENT" 'BEGIN { exit !(p > 0) }'; then
+  error_spec="STATUS_CODE_ERROR=$SPAN_ERROR_PERCENT"
+fi
+
+span_statements=$(
+  span_ranges 0 'set(status.code, %s)' "$error_spec" &&
+  span_ranges 2 'set(kind, %s)' "$kinds_spec" &&
+  span_ranges 4 'set(attributes["http.status_code"], %s)' "$SPAN_HTTP_STATUS_CODES"
+) || exit 1
+if [ -n "$span_statements" ]; then
+  echo "Setting span distribution: ${SPAN_ERROR_PERCENT}% errors, kinds: ${SPAN_KINDS:-unchanged}, HTTP status codes: ${SPAN_HTTP_STATUS_CODES:-unchanged}"
+  statements=""
+  while IFS= read -r statement; do
+    statements="${statements:+$statements, }\"${statement//\"/\\\"}\""
+  done <<< "$span_statements"
+  # First in every pipeline, so duplicates carry the same attributes as the originals
+  yq eval -i "
+    .spec.config.processors.\"transform/span_distribution\" = {
+      \"error_mode\": \"ignore\",
+      \"trace_statements\": [{\"context\": \"span\", \"statements\": [${statements}]}]
+    } |
+    .spec.config.service.pipelines[] |= (.processors = [\"transform/span_distribution\"] + (.processors // []))
+  " "$collector_manifest"
+fi
+
+oc apply -f "$collector_manifest" -n ${NAMESPACE}
 
 # Wait for collector to be ready
 echo "Waiting for OpenTelemetry Collector to be ready..."